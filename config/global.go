@@ -11,9 +11,11 @@ import flag "github.com/spf13/pflag"
 type GlobalConfiguration struct {
 	ServerPort int `toml:"server_port" env:"GOBOOK_SERVER_PORT" env-default:"3000"`
 	CashFlowLimit int `toml:"cashflow_limit"`
+	OfxSyncHours int `toml:"ofx_sync_hours"`
 	LimitImportPayeeNameLength bool
 	Sessions bool
 	UpdateAccountsOnLogin bool
+	JobScheduler bool
 	// booleans must default to false, see cleanenv #61,#82
 	EnableSecurityCharts bool `toml:"enable_security_charts"`
 	EnableSecurityFilings bool `toml:"enable_security_filings"`
@@ -21,10 +23,13 @@ type GlobalConfiguration struct {
 	DisableImportPayeeNameLength bool `toml:"disable_import_payee_name_length"`
 	DisableSessions bool `toml:"disable_sessions"`
 	DisableUpdateAccountsOnLogin bool `toml:"disable_update_accounts_on_login"`
+	DisableJobScheduler bool `toml:"disable_job_scheduler"`
 	EnableImportTradeFixups bool `toml:"enable_import_trade_fixups"`
+	VaultPassphrase string `toml:"vault_passphrase" env:"GOBOOK_VAULT_PASSPHRASE"`
 }
 
 var DebugFlag bool
+var FixFlag bool
 var globalConfig *GlobalConfiguration
 
 func GlobalConfig() *GlobalConfiguration {
@@ -34,10 +39,12 @@ func GlobalConfig() *GlobalConfiguration {
 	globalConfig.LimitImportPayeeNameLength = !globalConfig.DisableImportPayeeNameLength
 	globalConfig.Sessions = !globalConfig.DisableSessions
 	globalConfig.UpdateAccountsOnLogin = !globalConfig.DisableUpdateAccountsOnLogin
+	globalConfig.JobScheduler = !globalConfig.DisableJobScheduler
 	return globalConfig
 }
 
 func init() {
 	flag.BoolVarP(&DebugFlag, "debug", "d", false, "run in debug mode")
+	flag.BoolVar(&FixFlag, "fix", false, "repair discrepancies found by audit")
 	flag.Parse()
 }
@@ -10,7 +10,9 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 	"github.com/labstack/echo/v4"
 	"github.com/pacificbrian/go-bookkeeper/model"
 	"github.com/pacificbrian/go-bookkeeper/helpers"
@@ -33,8 +35,17 @@ func ListAccounts(c echo.Context) error {
 	}
 	log.Println("LIST ACCOUNTS")
 	get_json := false
+	db := session.DB
+
+	// exchange rates used for total are as of date
+	totalDate, err := time.ParseInLocation("2006-01-02", c.QueryParam("date"),
+					       time.Local)
+	if err != nil {
+		totalDate = time.Now()
+	}
 
 	entries := model.ListAccounts(session, allParam > 0)
+	total, totalMissing := model.TotalAccounts(session, entries, totalDate)
 
 	dh := new(helpers.DateHelper)
 	dh.Init()
@@ -46,11 +57,34 @@ func ListAccounts(c echo.Context) error {
 		//data := pongo2.Context{ "accounts":entries }
 		data := map[string]any{ "accounts": entries,
 					"date_helper": dh,
+					"total": session.GetUser().UserSettings.Currency(total),
+					"total_missing": totalMissing,
+					"total_date": totalDate.Format("2006-01-02"),
+					"currency_type_id": session.GetUser().UserSettings.CurrencyTypeID,
+					"currency_types": new(model.CurrencyType).List(db),
+					"sync_failures": model.ListOfxSyncFailures(session),
 					"debug_balance": debugParam > 0 }
 		return c.Render(http.StatusOK, "accounts/index.html", data)
 	}
 }
 
+// Set base currency of User for Account totals
+func UpdateTotalCurrency(c echo.Context) error {
+	currencyParam, _ := strconv.Atoi(c.FormValue("currency_type_id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("UPDATE TOTAL CURRENCY(%d)", currencyParam)
+
+	err := session.GetUser().SetCurrencyType(uint(currencyParam))
+	if err != nil {
+		log.Println(err)
+	}
+	return c.Redirect(http.StatusSeeOther,
+			  "/accounts?date=" + url.QueryEscape(c.FormValue("date")))
+}
+
 func CreateAccount(c echo.Context) error {
 	session := getSession(c)
 	if session == nil {
@@ -60,6 +94,7 @@ func CreateAccount(c echo.Context) error {
 
 	entry := new(model.Account)
 	c.Bind(entry)
+	entry.SetLowBalance(c.FormValue("account.LowBalance"))
 	entry.Create(session)
 	// set status based on if Create failed
 
@@ -86,11 +121,12 @@ func DeleteAccount(c echo.Context) error {
 func GetAccount(c echo.Context) error {
 	id, _ := strconv.Atoi(c.Param("id"))
 	all, _ := strconv.Atoi(c.QueryParam("all"))
+	tag_id, _ := strconv.Atoi(c.QueryParam("tag"))
 	session := getSession(c)
 	if session == nil {
 		return redirectToLogin(c)
 	}
-	log.Printf("GET ACCOUNT(%d) ALL(%d)", id, all)
+	log.Printf("GET ACCOUNT(%d) ALL(%d) TAG(%d)", id, all, tag_id)
 	get_json := false
 	debugAB := false
 
@@ -110,15 +146,28 @@ func GetAccount(c echo.Context) error {
 		var tradeTypes []model.TradeType
 		db := session.DB
 
+		tag := new(model.Tag)
+		tag.ID = uint(tag_id)
+		if tag_id > 0 {
+			tag = tag.Get(session)
+		}
+
 		if entry != nil {
 			// List will order returned results
 			if entry.IsInvestment() {
 				securities = entry.ListSecurities(session, all == 0)
-				cashflows = new(model.Trade).ListCashFlows(db, entry)
 				tradeTypes = new(model.TradeType).List(db)
 				entry.TotalPortfolio(securities)
 			}
-			cashflows = new(model.CashFlow).ListMerge(db, entry, cashflows)
+			if tag != nil && tag.ID > 0 {
+				// only tagged, no Balances
+				cashflows = entry.ListTagged(session, tag)
+			} else {
+				if entry.IsInvestment() {
+					cashflows = new(model.Trade).ListCashFlows(db, entry)
+				}
+				cashflows = new(model.CashFlow).ListMerge(db, entry, cashflows)
+			}
 		}
 
 		if debugAB {
@@ -133,6 +182,9 @@ func GetAccount(c echo.Context) error {
 					"button_text": "Add CashFlow",
 					"cash_flows": cashflows,
 					"securities": securities,
+					"tag": tag,
+					"tags": new(model.Tag).List(session),
+					"no_cashflow_balance": tag != nil && tag.ID > 0,
 					"allSecurities": all > 0,
 					"total_amount": nil,
 					"cash_flow_types": new(model.CashFlowType).List(db),
@@ -159,6 +211,7 @@ func UpdateAccount(c echo.Context) error {
 
 	entry.ClearBooleans()
 	c.Bind(entry)
+	entry.SetLowBalance(c.FormValue("account.LowBalance"))
 	entry.Update()
 	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/accounts/%d", id))
 }
@@ -0,0 +1,113 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"github.com/labstack/echo/v4"
+	"github.com/pacificbrian/go-bookkeeper/model"
+)
+
+// Create Attachment from uploaded file, then return to edit page
+func createAttachment(c echo.Context, session *model.Session,
+		      entry *model.Attachment, editPath string) error {
+	var attachFile model.HttpFile
+
+	file, err := c.FormFile("attachment")
+	if err == nil {
+		attachFile.FileName = file.Filename
+		attachFile.FileData, err = file.Open()
+		if err == nil {
+			defer attachFile.FileData.Close()
+			err = entry.Create(session, attachFile)
+		}
+	}
+	if err != nil {
+		log.Printf("CREATE ATTACHMENT FAILED: %v", err)
+	}
+	return c.Redirect(http.StatusSeeOther, editPath)
+}
+
+func CreateCashFlowAttachment(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("CREATE ATTACHMENT CASHFLOW(%d)", id)
+
+	entry := new(model.Attachment)
+	entry.CashFlowID = uint(id)
+	return createAttachment(c, session, entry,
+				fmt.Sprintf("/cash_flows/%d/edit", id))
+}
+
+func CreateTradeAttachment(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("CREATE ATTACHMENT TRADE(%d)", id)
+
+	entry := new(model.Attachment)
+	entry.TradeID = uint(id)
+	return createAttachment(c, session, entry,
+				fmt.Sprintf("/trades/%d/edit", id))
+}
+
+func CreateTaxEntryAttachment(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("CREATE ATTACHMENT TAX ENTRY(%d)", id)
+
+	entry := new(model.Attachment)
+	entry.TaxEntryID = uint(id)
+	return createAttachment(c, session, entry,
+				fmt.Sprintf("/tax_entries/%d/edit", id))
+}
+
+// Download Attachment
+func GetAttachment(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("GET ATTACHMENT(%d)", id)
+
+	entry := new(model.Attachment)
+	entry.ID = uint(id)
+	entry = entry.Get(session)
+	if entry == nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	return c.Attachment(entry.FilePath(), entry.FileName)
+}
+
+func DeleteAttachment(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("DELETE ATTACHMENT(%d)", id)
+
+	entry := new(model.Attachment)
+	entry.ID = uint(id)
+	if entry.Delete(session) != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	} else {
+		return c.NoContent(http.StatusAccepted)
+	}
+}
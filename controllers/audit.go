@@ -0,0 +1,44 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"github.com/labstack/echo/v4"
+	"github.com/pacificbrian/go-bookkeeper/model"
+)
+
+func renderAudit(c echo.Context, entries []model.AuditEntry, fix bool) error {
+	data := map[string]any{ "audit_entries": entries,
+				"fixed": fix }
+	return c.Render(http.StatusOK, "admin/audit.html", data)
+}
+
+// Audit ledger of current User, reporting discrepancies
+func GetAudit(c echo.Context) error {
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Println("GET AUDIT")
+
+	entries := model.AuditLedger(session, false)
+	return renderAudit(c, entries, false)
+}
+
+// Audit ledger of current User, and repair discrepancies
+func FixAudit(c echo.Context) error {
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Println("FIX AUDIT")
+
+	entries := model.AuditLedger(session, true)
+	return renderAudit(c, entries, true)
+}
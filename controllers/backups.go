@@ -0,0 +1,85 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"github.com/labstack/echo/v4"
+	"github.com/pacificbrian/go-bookkeeper/model"
+)
+
+func renderBackup(c echo.Context, session *model.Session,
+		  notice string, err error) error {
+	data := map[string]any{ "accounts": model.List(session, true),
+				"notice": notice,
+				"error": err }
+	return c.Render(http.StatusOK, "accounts/backup.html", data)
+}
+
+func GetBackup(c echo.Context) error {
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Println("GET BACKUP")
+
+	return renderBackup(c, session, "", nil)
+}
+
+func DownloadBackup(c echo.Context) error {
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	format := c.QueryParam("format")
+	if format == "" {
+		format = model.BackupJSON
+	}
+	log.Printf("DOWNLOAD BACKUP(%s)", format)
+
+	entry := new(model.Backup)
+	var b bytes.Buffer
+	err := entry.Write(session, &b, format)
+	if err != nil {
+		return renderBackup(c, session, "", err)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+				  fmt.Sprintf("attachment; filename=%q",
+					      model.BackupFileName(format)))
+	return c.Blob(http.StatusOK, model.BackupContentType(format), b.Bytes())
+}
+
+func RestoreBackup(c echo.Context) error {
+	var backupFile model.HttpFile
+
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Println("RESTORE BACKUP")
+
+	entry := new(model.Backup)
+	file, err := c.FormFile("filename")
+	if err == nil {
+		backupFile.FileName = file.Filename
+		backupFile.FileData, err = file.Open()
+		if err == nil {
+			defer backupFile.FileData.Close()
+			err = entry.Restore(session, backupFile)
+		}
+	}
+	if err != nil {
+		log.Printf("RESTORE BACKUP FAILED: %v", err)
+		return renderBackup(c, session, "", err)
+	}
+	return renderBackup(c, session,
+			    fmt.Sprintf("Restored %d Accounts", len(entry.Accounts)), nil)
+}
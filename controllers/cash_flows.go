@@ -33,6 +33,7 @@ func CreateCashFlow(c echo.Context) error {
 	entry.AccountID = uint(id)
 	entry.Amount = getFormDecimal(c, "amount")
 	entry.Date = getFormDate(c)
+	entry.SetTags(c.FormValue("tags"))
 	err = entry.Create(session)
 	if err != nil {
 		log.Printf("CREATE CASHFLOW ACCOUNT(%d) FAILED: %v", id, err)
@@ -55,10 +56,13 @@ func CreateScheduledCashFlow(c echo.Context) error {
 	assert(err == nil, "CREATE SCHEDULED CASHFLOW BIND FAILED")
 	c.Bind(&entry.RepeatInterval)
 	entry.RepeatInterval.Rate = getFormDecimal(c, "rate")
+	entry.RepeatInterval.SetRepeatsLeft(c.FormValue("repeats"))
+	entry.RepeatInterval.SetEndDate(c.FormValue("end_date"))
 	entry.AccountID = uint(id)
 	entry.Date = getFormDate(c)
 	entry.Amount = getFormDecimal(c, "amount")
 	entry.Type = "RCashFlow"
+	entry.SetTags(c.FormValue("tags"))
 	err = entry.Create(session)
 	if err != nil {
 		log.Printf("CREATE SCHEDULED CASHFLOW ACCOUNT(%d) FAILED: %v", id, err)
@@ -84,6 +88,7 @@ func CreateSplitCashFlow(c echo.Context) error {
 	err := c.Bind(entry)
 	assert(err == nil, "CREATE SPLIT CASHFLOW BIND FAILED")
 	entry.Amount = getFormDecimal(c, "amount")
+	entry.SetTags(c.FormValue("tags"))
 	err = entry.Create(session)
 	if err != nil {
 		log.Printf("CREATE SPLIT CASHFLOW FAILED: %v", err)
@@ -155,7 +160,12 @@ func UpdateCashFlow(c echo.Context) error {
 	entry.Date = getFormDate(c)
 	// special case RepeatsLeft so that unset from user equals SQL NULL value
 	entry.RepeatInterval.SetRepeatsLeft(c.FormValue("repeats"))
-	entry.Update()
+	entry.RepeatInterval.SetEndDate(c.FormValue("end_date"))
+	entry.SetTags(c.FormValue("tags"))
+	err = entry.Update()
+	if err != nil {
+		log.Printf("UPDATE CASHFLOW(%d) FAILED: %v", id, err)
+	}
 
 	// possibly can clean this up with Sessions
 	if entry.Split {
@@ -182,6 +192,7 @@ func EditCashFlow(c echo.Context) error {
 	var repeat_interval_types []model.RepeatIntervalType
 	var cash_flows []model.CashFlow
 	var cash_flow_total string
+	var attachments []model.Attachment
 	entry := new(model.CashFlow)
 	entry.Model.ID = uint(id)
 	entry = entry.Get(session, true)
@@ -193,6 +204,7 @@ func EditCashFlow(c echo.Context) error {
 		dh.SetDate(entry.Date)
 
 		cash_flows, cash_flow_total = entry.ListSplit(db)
+		attachments = (&model.Attachment{CashFlowID: entry.ID}).List(session)
 		if entry.IsScheduled() {
 			repeat_interval_types = new(model.RepeatIntervalType).List(db)
 		}
@@ -202,9 +214,12 @@ func EditCashFlow(c echo.Context) error {
 				"date_helper": dh,
 				"cash_flows": cash_flows,
 				"total_amount": cash_flow_total,
+				"attachments": attachments,
+				"attachment_path": fmt.Sprintf("/cash_flows/%d/attachments", id),
 				"cash_flow_types": new(model.CashFlowType).List(db),
 				"categories": new(model.Category).List(db),
-				"repeat_interval_types": repeat_interval_types }
+				"repeat_interval_types": repeat_interval_types,
+				"repeat_adjust_types": new(model.RepeatAdjustType).List() }
 	return c.Render(http.StatusOK, "cash_flows/edit.html", data)
 }
 
@@ -234,6 +249,7 @@ func ListScheduledCashFlows(c echo.Context) error {
 				"cash_flows": cash_flows,
 				"cash_flow_types": new(model.CashFlowType).List(db),
 				"repeat_interval_types": new(model.RepeatIntervalType).List(db),
+				"repeat_adjust_types": new(model.RepeatAdjustType).List(),
 				"categories": new(model.Category).List(db) }
 	return c.Render(http.StatusOK, "cash_flows/index.html", data)
 }
@@ -0,0 +1,66 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"github.com/labstack/echo/v4"
+	"github.com/pacificbrian/go-bookkeeper/model"
+)
+
+// Net worth history for all Accounts, or single Account if :id is set
+func ListNetWorth(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	days, _ := strconv.Atoi(c.QueryParam("days"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("LIST NET WORTH ACCOUNT(%d) DAYS(%d)", id, days)
+
+	var accounts []model.Account
+	var account *model.Account
+	if id > 0 {
+		account = getAccount(session, uint(id))
+		if account == nil {
+			return c.NoContent(http.StatusUnauthorized)
+		}
+		accounts = append(accounts, *account)
+	} else {
+		accounts = model.List(session, true)
+	}
+	entries := model.ListNetWorth(session, accounts, days)
+
+	var latest model.NetWorth
+	if len(entries) > 0 {
+		latest = entries[len(entries)-1]
+	}
+
+	data := map[string]any{ "account": account,
+				"days": days,
+				"net_worth": session.GetUser().UserSettings.Currency(latest.Total()),
+				"investments": session.GetUser().UserSettings.Currency(latest.Investments),
+				"missing": latest.Missing,
+				"chart_data": model.NetWorthChartData(entries),
+				"chart_options": model.NetWorthChartOptions() }
+	return c.Render(http.StatusOK, "charts/index.html", data)
+}
+
+// Rebuild net worth history from CashFlows and Trades
+func CreateBalanceSnapshots(c echo.Context) error {
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Println("CREATE BALANCE SNAPSHOTS")
+
+	count := model.BackfillSnapshots(session)
+	log.Printf("CREATE BALANCE SNAPSHOTS (%d)", count)
+	return c.Redirect(http.StatusSeeOther, "/charts")
+}
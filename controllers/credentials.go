@@ -0,0 +1,114 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"github.com/labstack/echo/v4"
+	"github.com/pacificbrian/go-bookkeeper/model"
+)
+
+func renderCredentials(c echo.Context, session *model.Session, err error) error {
+	data := map[string]any{ "credentials": new(model.Credential).List(session),
+				"accounts": model.List(session, true),
+				// skip zero entry
+				"institutions": new(model.Institution).List()[1:],
+				"key_source": model.VaultKeySource(),
+				"error": err }
+	return c.Render(http.StatusOK, "credentials/index.html", data)
+}
+
+func ListCredentials(c echo.Context) error {
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Println("LIST CREDENTIALS")
+
+	return renderCredentials(c, session, nil)
+}
+
+func CreateCredential(c echo.Context) error {
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Println("CREATE CREDENTIAL")
+
+	entry := new(model.Credential)
+	c.Bind(entry)
+	err := entry.Save(session)
+	if err != nil {
+		return renderCredentials(c, session, err)
+	}
+	return c.Redirect(http.StatusSeeOther, "/credentials")
+}
+
+func EditCredential(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("EDIT CREDENTIAL(%d)", id)
+
+	entry := new(model.Credential)
+	entry.ID = uint(id)
+	entry = entry.Get(session)
+	var err error
+	if entry != nil {
+		// show current Username only
+		err = entry.Open(session)
+		entry.Password = ""
+	}
+
+	data := map[string]any{ "credential": entry, "error": err }
+	return c.Render(http.StatusOK, "credentials/edit.html", data)
+}
+
+// Rotate Credential's Username and Password
+func RotateCredential(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("ROTATE CREDENTIAL(%d)", id)
+
+	entry := new(model.Credential)
+	entry.ID = uint(id)
+	entry = entry.Get(session)
+	if entry == nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	c.Bind(entry)
+	err := entry.Save(session)
+	if err != nil {
+		return renderCredentials(c, session, err)
+	}
+	return c.Redirect(http.StatusSeeOther, "/credentials")
+}
+
+func DeleteCredential(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("DELETE CREDENTIAL(%d)", id)
+
+	entry := new(model.Credential)
+	entry.ID = uint(id)
+	if entry.Delete(session) != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	} else {
+		return c.NoContent(http.StatusAccepted)
+	}
+}
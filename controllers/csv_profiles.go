@@ -0,0 +1,119 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"github.com/labstack/echo/v4"
+	"github.com/pacificbrian/go-bookkeeper/model"
+)
+
+func bindCsvProfile(c echo.Context, entry *model.CsvProfile) {
+	entry.ClearBooleans()
+	c.Bind(entry)
+}
+
+func csvProfileFormData(session *model.Session, data map[string]any) map[string]any {
+	data["accounts"] = model.List(session, true)
+	// skip zero entry
+	data["institutions"] = new(model.Institution).List()[1:]
+	return data
+}
+
+func renderCsvProfiles(c echo.Context, session *model.Session,
+		       entry *model.CsvProfile, err error) error {
+	data := map[string]any{ "profile": entry,
+				"profiles": new(model.CsvProfile).List(session),
+				"error": err }
+	return c.Render(http.StatusOK, "csv_profiles/index.html",
+			csvProfileFormData(session, data))
+}
+
+func ListCsvProfiles(c echo.Context) error {
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Println("LIST CSV PROFILES")
+
+	return renderCsvProfiles(c, session, new(model.CsvProfile), nil)
+}
+
+func CreateCsvProfile(c echo.Context) error {
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Println("CREATE CSV PROFILE")
+
+	entry := new(model.CsvProfile)
+	bindCsvProfile(c, entry)
+	err := entry.Save(session)
+	if err != nil {
+		return renderCsvProfiles(c, session, entry, err)
+	}
+	return c.Redirect(http.StatusSeeOther, "/csv_profiles")
+}
+
+func EditCsvProfile(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("EDIT CSV PROFILE(%d)", id)
+
+	entry := new(model.CsvProfile)
+	entry.ID = uint(id)
+	entry = entry.Get(session)
+
+	data := map[string]any{ "profile": entry }
+	return c.Render(http.StatusOK, "csv_profiles/edit.html",
+			csvProfileFormData(session, data))
+}
+
+func UpdateCsvProfile(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("UPDATE CSV PROFILE(%d)", id)
+
+	entry := new(model.CsvProfile)
+	entry.ID = uint(id)
+	entry = entry.Get(session)
+	if entry == nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	bindCsvProfile(c, entry)
+	err := entry.Save(session)
+	if err != nil {
+		return renderCsvProfiles(c, session, entry, err)
+	}
+	return c.Redirect(http.StatusSeeOther, "/csv_profiles")
+}
+
+func DeleteCsvProfile(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("DELETE CSV PROFILE(%d)", id)
+
+	entry := new(model.CsvProfile)
+	entry.ID = uint(id)
+	if entry.Delete(session) != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	} else {
+		return c.NoContent(http.StatusAccepted)
+	}
+}
@@ -0,0 +1,65 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"github.com/labstack/echo/v4"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"github.com/pacificbrian/go-bookkeeper/helpers"
+)
+
+func ListExchangeRates(c echo.Context) error {
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Println("LIST EXCHANGE RATES")
+	db := session.DB
+
+	dh := new(helpers.DateHelper)
+	dh.Init()
+
+	data := map[string]any{ "exchange_rates": new(model.ExchangeRate).List(db),
+				"date_helper": dh,
+				"admin": session.GetUser().IsAdmin(),
+				"currency_types": new(model.CurrencyType).List(db) }
+	return c.Render(http.StatusOK, "exchange_rates/index.html", data)
+}
+
+func CreateExchangeRate(c echo.Context) error {
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	var importFile model.HttpFile
+	var err error
+
+	file, fileErr := c.FormFile("filename")
+	if fileErr == nil {
+		log.Printf("IMPORT EXCHANGE RATES (FILE:%s)", file.Filename)
+		importFile.FileName = file.Filename
+		importFile.FileData, err = file.Open()
+		if err == nil {
+			defer importFile.FileData.Close()
+			_, err = model.ImportExchangeRates(session, importFile)
+		}
+	} else {
+		log.Println("CREATE EXCHANGE RATE")
+		entry := new(model.ExchangeRate)
+		c.Bind(entry)
+		entry.Date = getFormDate(c)
+		entry.Rate = getFormDecimal(c, "rate")
+		err = entry.Create(session)
+	}
+	if err != nil {
+		log.Printf("CREATE EXCHANGE RATE FAILED: %v", err)
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/exchange_rates")
+}
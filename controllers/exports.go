@@ -0,0 +1,69 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"github.com/labstack/echo/v4"
+	"github.com/pacificbrian/go-bookkeeper/model"
+)
+
+// zero Time if not set or invalid
+func getQueryDate(c echo.Context, name string) time.Time {
+	date, err := time.ParseInLocation("2006-01-02", c.QueryParam(name), time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return date
+}
+
+func renderExport(c echo.Context, session *model.Session,
+		  accountID int, err error) error {
+	data := map[string]any{ "accounts": model.List(session, true),
+				"account_id": accountID,
+				"error": err }
+	return c.Render(http.StatusOK, "accounts/export.html", data)
+}
+
+func GetExport(c echo.Context) error {
+	accountID, _ := strconv.Atoi(c.QueryParam("account_id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("GET EXPORT ACCOUNT(%d)", accountID)
+
+	return renderExport(c, session, accountID, nil)
+}
+
+func DownloadExport(c echo.Context) error {
+	accountID, _ := strconv.Atoi(c.QueryParam("account_id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("DOWNLOAD EXPORT ACCOUNT(%d)", accountID)
+
+	entry := &model.Export{AccountID: uint(accountID),
+			       Format: c.QueryParam("format"),
+			       StartDate: getQueryDate(c, "start_date"),
+			       EndDate: getQueryDate(c, "end_date")}
+	var b bytes.Buffer
+	err := entry.Write(session, &b)
+	if err != nil {
+		return renderExport(c, session, accountID, err)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+				  fmt.Sprintf("attachment; filename=%q", entry.FileName()))
+	return c.Blob(http.StatusOK, entry.ContentType(), b.Bytes())
+}
@@ -0,0 +1,50 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"github.com/labstack/echo/v4"
+	"github.com/pacificbrian/go-bookkeeper/model"
+)
+
+// Projected balances from ScheduledCashFlows for all Accounts, or single
+// Account if :id is set
+func GetForecast(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	months, _ := strconv.Atoi(c.QueryParam("months"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("GET FORECAST ACCOUNT(%d) MONTHS(%d)", id, months)
+
+	var account *model.Account
+	if id > 0 {
+		account = getAccount(session, uint(id))
+		if account == nil {
+			return c.NoContent(http.StatusUnauthorized)
+		}
+	}
+
+	entries := model.Forecast(session, months)
+	if account != nil {
+		// forecast needs all Accounts for Transfers, keep only this one
+		for i := 0; i < len(entries); i++ {
+			if entries[i].Account.ID == account.ID {
+				entries = entries[i:i+1]
+				break
+			}
+		}
+	}
+
+	data := map[string]any{ "account": account,
+				"forecasts": entries }
+	return c.Render(http.StatusOK, "forecast/index.html", data)
+}
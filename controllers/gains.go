@@ -40,8 +40,8 @@ func ListTradeGains(c echo.Context) error {
 		data := map[string]any{ "account": &entry.Account,
 					"trades": entries,
 					"year": year,
-					"total_gain": currency(totals[0]),
-					"taxable_gain": currency(totals[1]) }
+					"total_gain": entry.Account.Currency(totals[0]),
+					"taxable_gain": entry.Account.Currency(totals[1]) }
 		return c.Render(http.StatusOK, "gains/index.html", data)
 	}
 }
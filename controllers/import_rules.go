@@ -0,0 +1,140 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"github.com/labstack/echo/v4"
+	"github.com/pacificbrian/go-bookkeeper/model"
+)
+
+func bindImportRule(c echo.Context, entry *model.ImportRule) {
+	entry.ClearBooleans()
+	c.Bind(entry)
+	entry.SetMinAmount(c.FormValue("rule.MinAmount"))
+	entry.SetMaxAmount(c.FormValue("rule.MaxAmount"))
+}
+
+func renderImportRules(c echo.Context, session *model.Session,
+		       entry *model.ImportRule, message string, err error) error {
+	data := map[string]any{ "rule": entry,
+				"rules": new(model.ImportRule).List(session),
+				"message": message,
+				"error": err,
+				"accounts": model.List(session, true),
+				"categories": new(model.Category).List(session.DB) }
+	return c.Render(http.StatusOK, "import_rules/index.html", data)
+}
+
+func ListImportRules(c echo.Context) error {
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Println("LIST IMPORT RULES")
+
+	return renderImportRules(c, session, new(model.ImportRule), "", nil)
+}
+
+func CreateImportRule(c echo.Context) error {
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Println("CREATE IMPORT RULE")
+
+	entry := new(model.ImportRule)
+	bindImportRule(c, entry)
+	err := entry.Save(session)
+	if err != nil {
+		return renderImportRules(c, session, entry, "", err)
+	}
+	return c.Redirect(http.StatusSeeOther, "/import_rules")
+}
+
+func EditImportRule(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("EDIT IMPORT RULE(%d)", id)
+
+	entry := new(model.ImportRule)
+	entry.ID = uint(id)
+	entry = entry.Get(session)
+
+	data := map[string]any{ "rule": entry,
+				"accounts": model.List(session, true),
+				"categories": new(model.Category).List(session.DB) }
+	return c.Render(http.StatusOK, "import_rules/edit.html", data)
+}
+
+func UpdateImportRule(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("UPDATE IMPORT RULE(%d)", id)
+
+	entry := new(model.ImportRule)
+	entry.ID = uint(id)
+	entry = entry.Get(session)
+	if entry == nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	bindImportRule(c, entry)
+	err := entry.Save(session)
+	if err != nil {
+		return renderImportRules(c, session, entry, "", err)
+	}
+	return c.Redirect(http.StatusSeeOther, "/import_rules")
+}
+
+// Apply ImportRule to past CashFlows
+func RunImportRule(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("RUN IMPORT RULE(%d)", id)
+
+	entry := new(model.ImportRule)
+	entry.ID = uint(id)
+	entry = entry.Get(session)
+	if entry == nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	count, err := entry.Run(session)
+	message := fmt.Sprintf("Rule (%s) applied to %d transactions.",
+			       entry.Name, count)
+	return renderImportRules(c, session, new(model.ImportRule), message, err)
+}
+
+func DeleteImportRule(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("DELETE IMPORT RULE(%d)", id)
+
+	entry := new(model.ImportRule)
+	entry.ID = uint(id)
+	if entry.Delete(session) != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	} else {
+		return c.NoContent(http.StatusAccepted)
+	}
+}
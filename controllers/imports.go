@@ -27,7 +27,7 @@ func CreateImportedCashFlows(c echo.Context) error {
 	entry := new(model.Import)
 	entry.AccountID = uint(id)
 	c.Bind(entry)
-	if (entry.Username != "" || entry.Password != "") {
+	if (entry.Download || entry.Username != "" || entry.Password != "") {
 		log.Printf("IMPORT OFX TRANSACTIONS (ACCOUNT:%d)", id)
 		err = entry.FetchOFX(session)
 	} else {
@@ -49,9 +49,29 @@ func CreateImportedCashFlows(c echo.Context) error {
 		return c.NoContent(http.StatusNoContent)
 	}
 
+	if entry.Staged && entry.ID > 0 {
+		return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/imported/%d", entry.ID))
+	}
 	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/accounts/%d/imported", id))
 }
 
+func renderImportedCashFlows(c echo.Context, session *model.Session,
+			      entry *model.Import, err error) error {
+	var cashflows []model.CashFlow
+	var duplicates []model.ImportDuplicate
+	if entry != nil {
+		cashflows = entry.ListImported(session)
+		duplicates = entry.ListDuplicates(session)
+	}
+
+	data := map[string]any{ "import": entry,
+				"cash_flows": cashflows,
+				"duplicates": duplicates,
+				"error": err,
+				"disallow_cashflow_delete": true }
+	return c.Render(http.StatusOK, "accounts/list_imported.html", data)
+}
+
 func ListImportedCashFlows(c echo.Context) error {
 	id, _ := strconv.Atoi(c.Param("id"))
 	session := getSession(c)
@@ -60,18 +80,35 @@ func ListImportedCashFlows(c echo.Context) error {
 	}
 	log.Printf("LIST IMPORTED CASHFLOWS (IMPORT:%d)", id)
 
-	var cashflows []model.CashFlow
 	entry := new(model.Import)
 	entry.ID = uint(id)
 	entry = entry.Get(session)
-	if entry != nil {
-		cashflows = entry.ListImported(session)
+	if entry != nil && entry.Staged {
+		return renderStagedImport(c, session, entry)
 	}
+	return renderImportedCashFlows(c, session, entry, nil)
+}
 
-	data := map[string]any{ "import": entry,
-				"cash_flows": cashflows,
-				"disallow_cashflow_delete": true }
-	return c.Render(http.StatusOK, "accounts/list_imported.html", data)
+// Delete everything entered by Import
+func UndoImport(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("UNDO IMPORT(%d)", id)
+
+	entry := new(model.Import)
+	entry.ID = uint(id)
+	entry = entry.Get(session)
+	if entry == nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	err := entry.Undo(session)
+	if err != nil {
+		return renderImportedCashFlows(c, session, entry, err)
+	}
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/accounts/%d/imported", entry.AccountID))
 }
 
 func ListImported(c echo.Context) error {
@@ -89,6 +126,156 @@ func ListImported(c echo.Context) error {
 
 	data := map[string]any{ "account": entry,
 				"button_text": "Import File",
-				"imports": imports }
+				"credential": new(model.Credential).ForAccount(session, entry),
+				"csv_profiles": new(model.CsvProfile).List(session),
+				"imports": imports,
+				"syncs": entry.ListOfxSyncs(session, 10) }
 	return c.Render(http.StatusOK, "accounts/import.html", data)
 }
+
+// Download linked Account now (also downloaded by sync_ofx Job)
+func SyncAccount(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("SYNC ACCOUNT(%d)", id)
+
+	entry := new(model.Account)
+	entry.ID = uint(id)
+	_, err := entry.SyncOFX(session)
+	if err != nil {
+		log.Println(err)
+	}
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/accounts/%d/imported", id))
+}
+
+func renderStagedImport(c echo.Context, session *model.Session, entry *model.Import) error {
+	data := map[string]any{ "import": entry,
+				"staged": entry.ListStaged(session),
+				"accounts": model.List(session, true),
+				"categories": new(model.Category).List(session.DB) }
+	return c.Render(http.StatusOK, "accounts/staged.html", data)
+}
+
+// Get staged Import and apply review changes from form, nil Import
+// if access is denied
+func updateStagedImport(c echo.Context, session *model.Session, id int) (*model.Import, error) {
+	entry := new(model.Import)
+	entry.ID = uint(id)
+	entry = entry.Get(session)
+	if entry == nil {
+		return nil, nil
+	}
+
+	entries := entry.ListStaged(session)
+	for i := 0; i < len(entries); i++ {
+		e := &entries[i]
+		field := func(name string) string {
+			return c.FormValue(fmt.Sprintf("%s_%d", name, e.ID))
+		}
+		e.Selected = field("selected") != ""
+		e.Duplicate = field("duplicate") != ""
+		categoryID, _ := strconv.Atoi(field("category_id"))
+		e.CategoryID = uint(categoryID)
+		accountID, _ := strconv.Atoi(field("transfer_account_id"))
+		e.TransferAccountID = uint(accountID)
+		e.PayeeName = field("payee_name")
+		e.Memo = field("memo")
+	}
+	return entry, entry.UpdateStaged(session, entries)
+}
+
+func UpdateStagedImport(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("UPDATE STAGED IMPORT(%d)", id)
+
+	entry, err := updateStagedImport(c, session, id)
+	if entry == nil {
+		return c.NoContent(http.StatusUnauthorized)
+	} else if err != nil {
+		log.Println(err)
+	}
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/imported/%d", id))
+}
+
+// Save review changes and enter selected transactions
+func CommitStagedImport(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("COMMIT STAGED IMPORT(%d)", id)
+
+	entry, err := updateStagedImport(c, session, id)
+	if entry == nil {
+		return c.NoContent(http.StatusUnauthorized)
+	} else if err != nil {
+		log.Println(err)
+		return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/imported/%d", id))
+	}
+	_, err = entry.CommitStaged(session)
+	if err != nil {
+		log.Println(err)
+	}
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/imported/%d", id))
+}
+
+func DiscardStagedImport(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("DISCARD STAGED IMPORT(%d)", id)
+
+	entry := new(model.Import)
+	entry.ID = uint(id)
+	entry = entry.Get(session)
+	if entry == nil || entry.DiscardStaged(session) != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/accounts/%d/imported", entry.AccountID))
+}
+
+// Enter imported transaction held as a suspected duplicate
+func AcceptImportDuplicate(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("ACCEPT IMPORT DUPLICATE(%d)", id)
+
+	entry := new(model.ImportDuplicate)
+	entry.ID = uint(id)
+	err := entry.Accept(session)
+	if entry.ImportID == 0 {
+		return c.NoContent(http.StatusUnauthorized)
+	} else if err != nil {
+		log.Println(err)
+	}
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/imported/%d", entry.ImportID))
+}
+
+func DiscardImportDuplicate(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("DISCARD IMPORT DUPLICATE(%d)", id)
+
+	entry := new(model.ImportDuplicate)
+	entry.ID = uint(id)
+	if entry.Discard(session) != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/imported/%d", entry.ImportID))
+}
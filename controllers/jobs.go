@@ -0,0 +1,51 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"github.com/labstack/echo/v4"
+	"github.com/pacificbrian/go-bookkeeper/model"
+)
+
+func renderJobs(c echo.Context, session *model.Session, err error) error {
+	data := map[string]any{ "jobs": model.ListJobs(),
+				"admin": session.GetUser().IsAdmin(),
+				"error": err }
+	return c.Render(http.StatusOK, "admin/jobs.html", data)
+}
+
+// Status of background Jobs
+func ListJobs(c echo.Context) error {
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Println("LIST JOBS")
+
+	return renderJobs(c, session, nil)
+}
+
+// Queue background Job to run now (administrator only)
+func RunJob(c echo.Context) error {
+	name := c.Param("name")
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	if !session.GetUser().IsAdmin() {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	log.Printf("RUN JOB(%s)", name)
+
+	err := model.RunJob(session, name)
+	if err != nil {
+		return renderJobs(c, session, err)
+	}
+	return c.Redirect(http.StatusSeeOther, "/admin/jobs")
+}
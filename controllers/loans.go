@@ -0,0 +1,90 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"github.com/labstack/echo/v4"
+	"github.com/pacificbrian/go-bookkeeper/model"
+)
+
+// Build what-if LoanScenarios from query parameters, only for those set
+func getLoanScenarios(c echo.Context) []model.LoanScenario {
+	scenarios := []model.LoanScenario{}
+
+	extra := getFormDecimal(c, "extra_payment")
+	if extra.IsPositive() {
+		scenarios = append(scenarios,
+				   model.LoanScenario{Name: "Extra Principal",
+						      ExtraPayment: extra})
+	}
+
+	lumpSum := getFormDecimal(c, "lump_sum")
+	if lumpSum.IsPositive() {
+		lumpSumDate, err := time.ParseInLocation("2006-01-02",
+							 c.QueryParam("lump_sum_date"),
+							 time.Local)
+		if err != nil {
+			lumpSumDate = time.Now()
+		}
+		scenarios = append(scenarios,
+				   model.LoanScenario{Name: "Lump Sum",
+						      LumpSum: lumpSum,
+						      LumpSumDate: lumpSumDate})
+	}
+
+	rate := getFormDecimal(c, "refinance_rate")
+	months, _ := strconv.Atoi(c.QueryParam("refinance_months"))
+	if rate.IsPositive() || months > 0 {
+		scenarios = append(scenarios,
+				   model.LoanScenario{Name: "Refinance",
+						      RefinanceRate: rate,
+						      RefinanceMonths: months,
+						      RefinanceCosts: getFormDecimal(c, "refinance_costs")})
+	}
+	return scenarios
+}
+
+func GetAmortization(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	show, _ := strconv.Atoi(c.QueryParam("show"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("GET AMORTIZATION ACCOUNT(%d)", id)
+
+	account := getAccount(session, uint(id))
+	if account == nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	schedules, err := account.LoanAmortization(session, getLoanScenarios(c))
+	if err != nil {
+		log.Printf("GET AMORTIZATION ACCOUNT(%d) FAILED: %v", id, err)
+	}
+	if show < 0 || show >= len(schedules) {
+		show = 0
+	}
+	// scenario inputs, for form and links to show each schedule
+	params := c.QueryParams()
+	params.Del("show")
+
+	data := map[string]any{ "account": account,
+				"schedules": schedules,
+				"show": show,
+				"params": params,
+				"query": params.Encode(),
+				"error": err }
+	if len(schedules) > 0 {
+		data["schedule"] = schedules[show]
+	}
+	return c.Render(http.StatusOK, "accounts/amortization.html", data)
+}
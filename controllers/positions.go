@@ -0,0 +1,69 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"github.com/labstack/echo/v4"
+	"github.com/pacificbrian/go-bookkeeper/model"
+)
+
+func renderPositions(c echo.Context, session *model.Session,
+		     account *model.Account, err error) error {
+	report, reportErr := account.GetPositionReport(session)
+	if err == nil {
+		err = reportErr
+	}
+
+	data := map[string]any{ "account": account,
+				"report": report,
+				"error": err }
+	return c.Render(http.StatusOK, "accounts/positions.html", data)
+}
+
+func GetPositions(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("GET POSITIONS ACCOUNT(%d)", id)
+
+	account := getAccount(session, uint(id))
+	if account == nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	return renderPositions(c, session, account, nil)
+}
+
+// Enter SharesIn/SharesOut Trade so Security matches broker position
+func AdjustPosition(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	securityID, _ := strconv.Atoi(c.FormValue("security_id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("ADJUST POSITION ACCOUNT(%d) SECURITY(%d)", id, securityID)
+
+	account := getAccount(session, uint(id))
+	if account == nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	report, err := account.GetPositionReport(session)
+	if err == nil {
+		err = report.Adjust(session, uint(securityID))
+	}
+	if err != nil {
+		log.Printf("ADJUST POSITION ACCOUNT(%d) FAILED: %v", id, err)
+		return renderPositions(c, session, account, err)
+	}
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/accounts/%d/positions", id))
+}
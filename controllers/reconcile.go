@@ -0,0 +1,123 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"github.com/labstack/echo/v4"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"github.com/pacificbrian/go-bookkeeper/helpers"
+)
+
+func GetReconcile(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("GET RECONCILE ACCOUNT(%d)", id)
+
+	account := getAccount(session, uint(id))
+	if account == nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	entry, err := account.GetReconcile(session)
+	if err != nil {
+		log.Printf("GET RECONCILE ACCOUNT(%d) FAILED: %v", id, err)
+		return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/accounts/%d", id))
+	}
+
+	var cashflows []model.CashFlow
+	if entry.ID > 0 {
+		cashflows = account.ListUnreconciled(session, &entry.StatementDate)
+	}
+
+	dh := new(helpers.DateHelper)
+	dh.Init()
+	dh.SetDate(entry.StatementDate)
+
+	data := map[string]any{ "account": account,
+				"reconcile": entry,
+				"date_helper": dh,
+				"cash_flows": cashflows }
+	return c.Render(http.StatusOK, "accounts/reconcile.html", data)
+}
+
+func UpdateReconcile(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("UPDATE RECONCILE ACCOUNT(%d)", id)
+
+	account := getAccount(session, uint(id))
+	if account == nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	entry, err := account.GetReconcile(session)
+	if err == nil {
+		entry.StatementDate = getFormDate(c)
+		entry.StatementBalance = getFormDecimal(c, "statement_balance")
+		err = entry.Update()
+	}
+	if err != nil {
+		log.Printf("UPDATE RECONCILE ACCOUNT(%d) FAILED: %v", id, err)
+	}
+
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/accounts/%d/reconcile", id))
+}
+
+func FinishReconcile(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("FINISH RECONCILE ACCOUNT(%d)", id)
+
+	account := getAccount(session, uint(id))
+	if account == nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	entry, err := account.GetReconcile(session)
+	if err == nil {
+		err = entry.Finish()
+	}
+	if err != nil {
+		log.Printf("FINISH RECONCILE ACCOUNT(%d) FAILED: %v", id, err)
+		return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/accounts/%d/reconcile", id))
+	}
+
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/accounts/%d", id))
+}
+
+func DeleteReconcile(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("DELETE RECONCILE ACCOUNT(%d)", id)
+
+	account := getAccount(session, uint(id))
+	if account == nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	entry, err := account.GetReconcile(session)
+	if err == nil {
+		err = entry.Delete()
+	}
+	if err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	} else {
+		return c.NoContent(http.StatusAccepted)
+	}
+}
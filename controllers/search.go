@@ -0,0 +1,139 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"github.com/labstack/echo/v4"
+	"github.com/pacificbrian/go-bookkeeper/model"
+)
+
+func bindSearch(c echo.Context, entry *model.Search) {
+	c.Bind(entry)
+	entry.SetMinAmount(c.FormValue("search.MinAmount"))
+	entry.SetMaxAmount(c.FormValue("search.MaxAmount"))
+	entry.SetStartDate(c.FormValue("search.StartDate"))
+	entry.SetEndDate(c.FormValue("search.EndDate"))
+}
+
+func renderSearch(c echo.Context, session *model.Session, entry *model.Search,
+		  result *model.SearchResult, err error) error {
+	var cash_flows []model.CashFlow
+	if result != nil {
+		cash_flows = result.CashFlows
+	}
+	data := map[string]any{ "search": entry,
+				"search_result": result,
+				"cash_flows": cash_flows,
+				"error": err,
+				"disallow_cashflow_delete": true,
+				"no_cashflow_balance": true,
+				"with_cashflow_account": true,
+				"saved_searches": new(model.Search).List(session),
+				"accounts": model.List(session, true),
+				"categories": new(model.Category).List(session.DB),
+				"tags": new(model.Tag).List(session),
+				"search_filter_types": new(model.SearchFilterType).List() }
+	return c.Render(http.StatusOK, "search/index.html", data)
+}
+
+// Run Search, and if submit is to save, save as well
+func runSearch(c echo.Context, session *model.Session, entry *model.Search) error {
+	if strings.Contains(c.FormValue("submit"), "Save") {
+		err := entry.Save(session)
+		if err != nil {
+			return renderSearch(c, session, entry, nil, err)
+		}
+		return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/searches/%d", entry.ID))
+	}
+
+	result, err := entry.Run(session)
+	return renderSearch(c, session, entry, result, err)
+}
+
+func NewSearch(c echo.Context) error {
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Println("NEW SEARCH")
+
+	return renderSearch(c, session, new(model.Search), nil, nil)
+}
+
+func CreateSearch(c echo.Context) error {
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Println("CREATE SEARCH")
+
+	entry := new(model.Search)
+	bindSearch(c, entry)
+	return runSearch(c, session, entry)
+}
+
+// Run saved Search
+func GetSearch(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("GET SEARCH(%d)", id)
+
+	entry := new(model.Search)
+	entry.ID = uint(id)
+	entry = entry.Get(session)
+	if entry == nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	result, err := entry.Run(session)
+	return renderSearch(c, session, entry, result, err)
+}
+
+// Update saved Search (if saving), and run it
+func UpdateSearch(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("UPDATE SEARCH(%d)", id)
+
+	entry := new(model.Search)
+	entry.ID = uint(id)
+	entry = entry.Get(session)
+	if entry == nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	bindSearch(c, entry)
+	return runSearch(c, session, entry)
+}
+
+func DeleteSearch(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("DELETE SEARCH(%d)", id)
+
+	entry := new(model.Search)
+	entry.ID = uint(id)
+	if entry.Delete(session) != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	} else {
+		return c.NoContent(http.StatusAccepted)
+	}
+}
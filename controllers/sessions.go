@@ -11,6 +11,7 @@ import (
 	"log"
 	"time"
 	"net/http"
+	"sync"
 	"unsafe"
 	"github.com/alexedwards/scs/v2"
 	"github.com/labstack/echo/v4"
@@ -21,6 +22,7 @@ import (
 const SessionExpiry = 3
 var sessionManager *scs.SessionManager
 var activeSessions map[uint]*model.Session
+var activeSessionsMutex sync.RWMutex
 var defaultSession *model.Session
 
 // could have separate config variable for multi-user, but as this is what
@@ -82,7 +84,9 @@ func endSession(c echo.Context) {
 	}
 	session.CloseSession()
 	sessionManager.Destroy(c.Request().Context())
+	activeSessionsMutex.Lock()
 	delete(activeSessions, session.User.ID)
+	activeSessionsMutex.Unlock()
 }
 
 func newSession(c echo.Context, u *model.User) {
@@ -105,7 +109,9 @@ func newSession(c echo.Context, u *model.User) {
 	// keep the logic below to use unsafe.Pointer just to remember this
 	// usage of pointers as it took time to research this.
 	userSession := u.NewSession()
+	activeSessionsMutex.Lock()
 	activeSessions[u.ID] = userSession
+	activeSessionsMutex.Unlock()
 
 	// Don't want to flatten Session, store Session pointer in sessionData
 	// Why is Go afraid of pointers?
@@ -129,6 +135,8 @@ func CloseActiveSessions() {
 		return
 	}
 
+	activeSessionsMutex.RLock()
+	defer activeSessionsMutex.RUnlock()
 	for _,v := range activeSessions {
 		v.CloseSession()
 	}
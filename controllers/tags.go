@@ -0,0 +1,106 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"github.com/labstack/echo/v4"
+	"github.com/pacificbrian/go-bookkeeper/model"
+)
+
+func renderTag(c echo.Context, session *model.Session, entry *model.Tag,
+	       err error) error {
+	s := model.Search{TagID: entry.ID}
+	result, _ := s.Run(session)
+	var cash_flows []model.CashFlow
+	if result != nil {
+		cash_flows = result.CashFlows
+	}
+	data := map[string]any{ "tag": entry,
+				"search_result": result,
+				"cash_flows": cash_flows,
+				"trades": entry.ListTrades(session, nil),
+				"error": err,
+				"disallow_cashflow_delete": true,
+				"no_cashflow_balance": true,
+				"with_cashflow_account": true }
+	return c.Render(http.StatusOK, "tags/show.html", data)
+}
+
+// Totals for each of User's Tags
+func ListTags(c echo.Context) error {
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Println("LIST TAGS")
+
+	data := map[string]any{ "tag_totals": model.TagTotals(session) }
+	return c.Render(http.StatusOK, "tags/index.html", data)
+}
+
+// CashFlows and Trades with Tag
+func GetTag(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("GET TAG(%d)", id)
+
+	entry := new(model.Tag)
+	entry.ID = uint(id)
+	entry = entry.Get(session)
+	if entry == nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	return renderTag(c, session, entry, nil)
+}
+
+// Rename Tag
+func UpdateTag(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("UPDATE TAG(%d)", id)
+
+	entry := new(model.Tag)
+	entry.ID = uint(id)
+	entry = entry.Get(session)
+	if entry == nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	c.Bind(entry)
+	err := entry.Update()
+	if err != nil {
+		return renderTag(c, session, entry, err)
+	}
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/tags/%d", entry.ID))
+}
+
+func DeleteTag(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("DELETE TAG(%d)", id)
+
+	entry := new(model.Tag)
+	entry.ID = uint(id)
+	if entry.Delete(session) != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	} else {
+		return c.NoContent(http.StatusAccepted)
+	}
+}
@@ -174,9 +174,15 @@ func EditTaxEntry(c echo.Context) error {
 	entry := new(model.TaxEntry)
 	entry.ID = uint(id)
 	entry = entry.Get(session)
+	var attachments []model.Attachment
+	if entry != nil {
+		attachments = (&model.Attachment{TaxEntryID: entry.ID}).List(session)
+	}
 
 	data := map[string]any{ "entry": entry,
 				"isEdit": true,
+				"attachments": attachments,
+				"attachment_path": fmt.Sprintf("/tax_entries/%d/attachments", id),
 				"tax_items": new(model.TaxItem).List(session.DB),
 				"tax_types": new(model.TaxType).List(session.DB),
 				"tax_regions": new(model.TaxRegion).List(session.DB) }
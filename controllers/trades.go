@@ -38,6 +38,7 @@ func CreateTrade(c echo.Context) error {
 	entry.Amount = getFormDecimal(c, "amount")
 	entry.Price = getFormDecimal(c, "price")
 	entry.Shares = getFormDecimal(c, "shares")
+	entry.SetTags(c.FormValue("tags"))
 	err = entry.Create(session)
 	account_id = int(entry.AccountID)
 	if err != nil {
@@ -97,6 +98,7 @@ func UpdateTrade(c echo.Context) error {
 	entry.Amount = getFormDecimal(c, "amount")
 	entry.Price = getFormDecimal(c, "price")
 	entry.Shares = getFormDecimal(c, "shares")
+	entry.SetTags(c.FormValue("tags"))
 	entry.Update()
 	a_id := entry.AccountID
 	s_id := entry.SecurityID
@@ -118,6 +120,7 @@ func EditTrade(c echo.Context) error {
 	log.Printf("EDIT TRADE(%d)", id)
 
 	var tradeTypes []model.TradeType
+	var attachments []model.Attachment
 	entry := new(model.Trade)
 	entry.ID = uint(id)
 	entry = entry.Get(session)
@@ -126,6 +129,7 @@ func EditTrade(c echo.Context) error {
 	dh.Init()
 	if entry != nil {
 		dh.SetDate(entry.Date)
+		attachments = (&model.Attachment{TradeID: entry.ID}).List(session)
 		if entry.IsBuy() {
 			tradeTypes = new(model.TradeType).ListBuys(session.DB)
 		}
@@ -133,6 +137,8 @@ func EditTrade(c echo.Context) error {
 
 	data := map[string]any{ "trade": entry,
 				"date_helper": dh,
+				"attachments": attachments,
+				"attachment_path": fmt.Sprintf("/trades/%d/attachments", id),
 				"trade_types": tradeTypes }
 	return c.Render(http.StatusOK, "trades/edit.html", data)
 }
@@ -0,0 +1,81 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"github.com/labstack/echo/v4"
+	"github.com/pacificbrian/go-bookkeeper/model"
+)
+
+func renderTransferMatches(c echo.Context, session *model.Session,
+			   message string, err error) error {
+	data := map[string]any{ "matches": new(model.TransferMatch).List(session),
+				"message": message,
+				"error": err }
+	return c.Render(http.StatusOK, "transfer_matches/index.html", data)
+}
+
+func ListTransferMatches(c echo.Context) error {
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Println("LIST TRANSFER MATCHES")
+
+	return renderTransferMatches(c, session, "", nil)
+}
+
+// Search recent CashFlows for Transfers
+func CreateTransferMatches(c echo.Context) error {
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Println("CREATE TRANSFER MATCHES")
+
+	linked, proposed := model.MatchTransfers(session)
+	message := fmt.Sprintf("Linked %d transfers, %d proposed for review.",
+			       linked, proposed)
+	return renderTransferMatches(c, session, message, nil)
+}
+
+func AcceptTransferMatch(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("ACCEPT TRANSFER MATCH(%d)", id)
+
+	entry := new(model.TransferMatch)
+	entry.ID = uint(id)
+	err := entry.Accept(session)
+	if err != nil {
+		return renderTransferMatches(c, session, "", err)
+	}
+	return c.Redirect(http.StatusSeeOther, "/transfer_matches")
+}
+
+func DismissTransferMatch(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	session := getSession(c)
+	if session == nil {
+		return redirectToLogin(c)
+	}
+	log.Printf("DISMISS TRANSFER MATCH(%d)", id)
+
+	entry := new(model.TransferMatch)
+	entry.ID = uint(id)
+	if entry.Dismiss(session) != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	return c.Redirect(http.StatusSeeOther, "/transfer_matches")
+}
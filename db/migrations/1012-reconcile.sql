@@ -0,0 +1,19 @@
+-- +migrate Up
+
+ALTER TABLE `cash_flows` ADD COLUMN `cleared` tinyint(1) DEFAULT 0;
+ALTER TABLE `cash_flows` ADD COLUMN `reconciled` tinyint(1) DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS `reconciles` (
+  `id` integer PRIMARY KEY,
+  `account_id` int(11) DEFAULT NULL,
+  `statement_date` date DEFAULT NULL,
+  `statement_balance` decimal(16,4) DEFAULT 0.0000,
+  `completed` tinyint(1) DEFAULT 0,
+  `created_on` date DEFAULT NULL
+);
+
+-- +migrate Down
+
+ALTER TABLE `cash_flows` DROP COLUMN `cleared`;
+ALTER TABLE `cash_flows` DROP COLUMN `reconciled`;
+DROP TABLE `reconciles`;
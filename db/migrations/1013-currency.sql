@@ -0,0 +1,30 @@
+-- +migrate Up
+
+ALTER TABLE `currency_types` ADD COLUMN `symbol` varchar(8) DEFAULT NULL;
+ALTER TABLE `users` ADD COLUMN `currency_type_id` int(11) DEFAULT 1;
+
+UPDATE `currency_types` SET symbol = '$' WHERE id = 1;
+UPDATE `currency_types` SET symbol = 'A$' WHERE id = 2;
+UPDATE `currency_types` SET symbol = 'R$' WHERE id = 3;
+UPDATE `currency_types` SET symbol = 'C$' WHERE id = 4;
+UPDATE `currency_types` SET symbol = 'CHF' WHERE id = 5;
+UPDATE `currency_types` SET symbol = '€' WHERE id = 6;
+UPDATE `currency_types` SET symbol = '£' WHERE id = 7;
+UPDATE `currency_types` SET symbol = '¥' WHERE id = 8;
+UPDATE `currency_types` SET symbol = 'kr' WHERE id = 9;
+UPDATE `currency_types` SET symbol = 'NZ$' WHERE id = 10;
+UPDATE `currency_types` SET symbol = 'kr' WHERE id = 11;
+UPDATE `currency_types` SET symbol = 'R' WHERE id = 14;
+
+CREATE TABLE IF NOT EXISTS `exchange_rates` (
+  `id` integer PRIMARY KEY,
+  `currency_type_id` int(11) DEFAULT NULL,
+  `date` date DEFAULT NULL,
+  `rate` decimal(16,8) DEFAULT NULL
+);
+
+-- +migrate Down
+
+ALTER TABLE `currency_types` DROP COLUMN `symbol`;
+ALTER TABLE `users` DROP COLUMN `currency_type_id`;
+DROP TABLE `exchange_rates`;
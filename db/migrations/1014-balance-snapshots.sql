@@ -0,0 +1,14 @@
+-- +migrate Up
+
+CREATE TABLE IF NOT EXISTS `balance_snapshots` (
+  `id` integer PRIMARY KEY,
+  `account_id` int(11) DEFAULT NULL,
+  `security_id` int(11) DEFAULT 0,
+  `date` date DEFAULT NULL,
+  `shares` decimal(16,4) DEFAULT 0.0000,
+  `balance` decimal(16,4) DEFAULT 0.0000
+);
+
+-- +migrate Down
+
+DROP TABLE `balance_snapshots`;
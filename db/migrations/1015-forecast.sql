@@ -0,0 +1,7 @@
+-- +migrate Up
+
+ALTER TABLE `accounts` ADD COLUMN `low_balance` decimal(16,4) DEFAULT NULL;
+
+-- +migrate Down
+
+ALTER TABLE `accounts` DROP COLUMN `low_balance`;
@@ -0,0 +1,13 @@
+-- +migrate Up
+
+ALTER TABLE `repeat_intervals` ADD COLUMN `rule` varchar(255) DEFAULT NULL;
+ALTER TABLE `repeat_intervals` ADD COLUMN `adjust` int(11) DEFAULT 0;
+ALTER TABLE `repeat_intervals` ADD COLUMN `start_date` date DEFAULT NULL;
+ALTER TABLE `repeat_intervals` ADD COLUMN `end_date` date DEFAULT NULL;
+
+-- +migrate Down
+
+ALTER TABLE `repeat_intervals` DROP COLUMN `rule`;
+ALTER TABLE `repeat_intervals` DROP COLUMN `adjust`;
+ALTER TABLE `repeat_intervals` DROP COLUMN `start_date`;
+ALTER TABLE `repeat_intervals` DROP COLUMN `end_date`;
@@ -0,0 +1,23 @@
+-- +migrate Up
+
+CREATE TABLE IF NOT EXISTS `searches` (
+  `id` integer PRIMARY KEY,
+  `user_id` int(11) DEFAULT NULL,
+  `name` varchar(255) DEFAULT NULL,
+  `payee_name` varchar(255) DEFAULT NULL,
+  `memo` varchar(255) DEFAULT NULL,
+  `transnum` varchar(255) DEFAULT NULL,
+  `min_amount` decimal(16,4) DEFAULT NULL,
+  `max_amount` decimal(16,4) DEFAULT NULL,
+  `start_date` date DEFAULT NULL,
+  `end_date` date DEFAULT NULL,
+  `account_id` int(11) DEFAULT 0,
+  `category_id` int(11) DEFAULT 0,
+  `transfer` int(11) DEFAULT 0,
+  `split` int(11) DEFAULT 0,
+  `imported` int(11) DEFAULT 0
+);
+
+-- +migrate Down
+
+DROP TABLE `searches`;
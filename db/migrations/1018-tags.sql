@@ -0,0 +1,29 @@
+-- +migrate Up
+
+ALTER TABLE `searches` ADD COLUMN `tag_id` int(11) DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS `tags` (
+  `id` integer PRIMARY KEY,
+  `user_id` int(11) DEFAULT NULL,
+  `name` varchar(255) DEFAULT NULL
+);
+
+CREATE TABLE IF NOT EXISTS `cash_flow_tags` (
+  `cash_flow_id` int(11) NOT NULL,
+  `tag_id` int(11) NOT NULL,
+  PRIMARY KEY (`cash_flow_id`, `tag_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `trade_tags` (
+  `trade_id` int(11) NOT NULL,
+  `tag_id` int(11) NOT NULL,
+  PRIMARY KEY (`trade_id`, `tag_id`)
+);
+
+-- +migrate Down
+
+ALTER TABLE `searches` DROP COLUMN `tag_id`;
+
+DROP TABLE `tags`;
+DROP TABLE `cash_flow_tags`;
+DROP TABLE `trade_tags`;
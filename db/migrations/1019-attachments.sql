@@ -0,0 +1,18 @@
+-- +migrate Up
+
+CREATE TABLE IF NOT EXISTS `attachments` (
+  `id` integer PRIMARY KEY,
+  `user_id` int(11) DEFAULT NULL,
+  `cash_flow_id` int(11) DEFAULT 0,
+  `trade_id` int(11) DEFAULT 0,
+  `tax_entry_id` int(11) DEFAULT 0,
+  `file_name` varchar(255) DEFAULT NULL,
+  `content_type` varchar(255) DEFAULT NULL,
+  `size` int(11) DEFAULT 0,
+  `hash` varchar(64) DEFAULT NULL,
+  `created_at` datetime DEFAULT NULL
+);
+
+-- +migrate Down
+
+DROP TABLE `attachments`;
@@ -0,0 +1,22 @@
+-- +migrate Up
+
+CREATE TABLE IF NOT EXISTS `import_rules` (
+  `id` integer PRIMARY KEY,
+  `user_id` int(11) DEFAULT NULL,
+  `name` varchar(255) DEFAULT NULL,
+  `position` int(11) DEFAULT 0,
+  `payee_pattern` varchar(255) DEFAULT NULL,
+  `memo_pattern` varchar(255) DEFAULT NULL,
+  `min_amount` decimal(16,4) DEFAULT NULL,
+  `max_amount` decimal(16,4) DEFAULT NULL,
+  `account_id` int(11) DEFAULT 0,
+  `category_id` int(11) DEFAULT 0,
+  `payee_name` varchar(255) DEFAULT NULL,
+  `memo` varchar(255) DEFAULT NULL,
+  `splits` varchar(255) DEFAULT NULL,
+  `skip` tinyint(1) DEFAULT 0
+);
+
+-- +migrate Down
+
+DROP TABLE `import_rules`;
@@ -0,0 +1,17 @@
+-- +migrate Up
+
+CREATE TABLE IF NOT EXISTS `import_duplicates` (
+  `id` integer PRIMARY KEY,
+  `import_id` int(11) DEFAULT NULL,
+  `account_id` int(11) DEFAULT NULL,
+  `cash_flow_id` int(11) DEFAULT 0,
+  `date` date DEFAULT NULL,
+  `amount` decimal(16,4) DEFAULT NULL,
+  `payee_name` varchar(255) DEFAULT NULL,
+  `memo` varchar(255) DEFAULT NULL,
+  `transnum` varchar(255) DEFAULT NULL
+);
+
+-- +migrate Down
+
+DROP TABLE `import_duplicates`;
@@ -0,0 +1,30 @@
+-- +migrate Up
+
+ALTER TABLE `imports` ADD COLUMN `staged` tinyint(1) DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS `staged_transactions` (
+  `id` integer PRIMARY KEY,
+  `import_id` int(11) DEFAULT NULL,
+  `account_id` int(11) DEFAULT NULL,
+  `date` date DEFAULT NULL,
+  `amount` decimal(16,4) DEFAULT NULL,
+  `payee_name` varchar(255) DEFAULT NULL,
+  `memo` varchar(255) DEFAULT NULL,
+  `transnum` varchar(255) DEFAULT NULL,
+  `category_id` int(11) DEFAULT 0,
+  `transfer_account_id` int(11) DEFAULT 0,
+  `import_rule_id` int(11) DEFAULT 0,
+  `duplicate_id` int(11) DEFAULT 0,
+  `duplicate` tinyint(1) DEFAULT 0,
+  `selected` tinyint(1) DEFAULT 0,
+  `security_id` int(11) DEFAULT 0,
+  `trade_type_id` int(11) DEFAULT 0,
+  `shares` decimal(14,4) DEFAULT NULL,
+  `price` decimal(16,4) DEFAULT NULL
+);
+
+-- +migrate Down
+
+ALTER TABLE `imports` DROP COLUMN `staged`;
+
+DROP TABLE `staged_transactions`;
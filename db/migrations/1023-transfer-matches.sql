@@ -0,0 +1,14 @@
+-- +migrate Up
+
+CREATE TABLE IF NOT EXISTS `transfer_matches` (
+  `id` integer PRIMARY KEY,
+  `user_id` int(11) DEFAULT NULL,
+  `cash_flow_id` int(11) DEFAULT NULL,
+  `pair_id` int(11) DEFAULT NULL,
+  `score` int(11) DEFAULT 0,
+  `dismissed` tinyint(1) DEFAULT 0
+);
+
+-- +migrate Down
+
+DROP TABLE `transfer_matches`;
@@ -0,0 +1,21 @@
+-- +migrate Up
+
+ALTER TABLE `imports` ADD COLUMN `positions_date` datetime DEFAULT NULL;
+ALTER TABLE `imports` ADD COLUMN `broker_cash_balance` decimal(16,4) DEFAULT NULL;
+
+CREATE TABLE IF NOT EXISTS `broker_positions` (
+  `id` integer PRIMARY KEY,
+  `import_id` int(11) DEFAULT NULL,
+  `account_id` int(11) DEFAULT NULL,
+  `security_id` int(11) DEFAULT NULL,
+  `unique_id` varchar(255) DEFAULT NULL,
+  `name` varchar(255) DEFAULT NULL,
+  `shares` decimal(14,4) DEFAULT NULL,
+  `price` decimal(16,4) DEFAULT NULL
+);
+
+-- +migrate Down
+
+DROP TABLE `broker_positions`;
+ALTER TABLE `imports` DROP COLUMN `broker_cash_balance`;
+ALTER TABLE `imports` DROP COLUMN `positions_date`;
@@ -0,0 +1,28 @@
+-- +migrate Up
+
+CREATE TABLE IF NOT EXISTS `csv_profiles` (
+  `id` integer PRIMARY KEY,
+  `user_id` int(11) DEFAULT NULL,
+  `name` varchar(255) DEFAULT NULL,
+  `account_id` int(11) DEFAULT NULL,
+  `institution_id` int(11) DEFAULT NULL,
+  `delimiter` varchar(8) DEFAULT NULL,
+  `header_rows` int(11) DEFAULT 0,
+  `date_column` int(11) DEFAULT 0,
+  `date_format` varchar(32) DEFAULT NULL,
+  `amount_column` int(11) DEFAULT 0,
+  `debit_column` int(11) DEFAULT 0,
+  `credit_column` int(11) DEFAULT 0,
+  `negate_amounts` tinyint(1) DEFAULT 0,
+  `payee_column` int(11) DEFAULT 0,
+  `memo_column` int(11) DEFAULT 0,
+  `num_column` int(11) DEFAULT 0,
+  `action_column` int(11) DEFAULT 0,
+  `symbol_column` int(11) DEFAULT 0,
+  `shares_column` int(11) DEFAULT 0,
+  `price_column` int(11) DEFAULT 0
+);
+
+-- +migrate Down
+
+DROP TABLE `csv_profiles`;
@@ -0,0 +1,15 @@
+-- +migrate Up
+
+CREATE TABLE IF NOT EXISTS `credentials` (
+  `id` integer PRIMARY KEY,
+  `user_id` int(11) DEFAULT NULL,
+  `institution_id` int(11) DEFAULT NULL,
+  `account_id` int(11) DEFAULT NULL,
+  `secret` text DEFAULT NULL,
+  `created_on` datetime DEFAULT NULL,
+  `rotated_on` datetime DEFAULT NULL
+);
+
+-- +migrate Down
+
+DROP TABLE `credentials`;
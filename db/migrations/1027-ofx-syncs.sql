@@ -0,0 +1,18 @@
+-- +migrate Up
+
+CREATE TABLE IF NOT EXISTS `ofx_syncs` (
+  `id` integer PRIMARY KEY,
+  `account_id` int(11) DEFAULT NULL,
+  `import_id` int(11) DEFAULT NULL,
+  `started_at` datetime DEFAULT NULL,
+  `cash_flow_count` int(11) DEFAULT 0,
+  `trade_count` int(11) DEFAULT 0,
+  `duplicate_count` int(11) DEFAULT 0,
+  `failures` int(11) DEFAULT 0,
+  `error` varchar(255) DEFAULT NULL,
+  `next_sync` datetime DEFAULT NULL
+);
+
+-- +migrate Down
+
+DROP TABLE `ofx_syncs`;
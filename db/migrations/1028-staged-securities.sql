@@ -0,0 +1,7 @@
+-- +migrate Up
+
+ALTER TABLE `staged_transactions` ADD COLUMN `new_security` tinyint(1) DEFAULT 0;
+
+-- +migrate Down
+
+ALTER TABLE `staged_transactions` DROP COLUMN `new_security`;
@@ -0,0 +1,15 @@
+-- +migrate Up
+
+ALTER TABLE `transfer_matches` ADD COLUMN `linked` tinyint(1) DEFAULT 0;
+ALTER TABLE `transfer_matches` ADD COLUMN `cash_flow_payee_id` int(11) DEFAULT 0;
+ALTER TABLE `transfer_matches` ADD COLUMN `cash_flow_category_id` int(11) DEFAULT 0;
+ALTER TABLE `transfer_matches` ADD COLUMN `pair_payee_id` int(11) DEFAULT 0;
+ALTER TABLE `transfer_matches` ADD COLUMN `pair_category_id` int(11) DEFAULT 0;
+
+-- +migrate Down
+
+ALTER TABLE `transfer_matches` DROP COLUMN `linked`;
+ALTER TABLE `transfer_matches` DROP COLUMN `cash_flow_payee_id`;
+ALTER TABLE `transfer_matches` DROP COLUMN `cash_flow_category_id`;
+ALTER TABLE `transfer_matches` DROP COLUMN `pair_payee_id`;
+ALTER TABLE `transfer_matches` DROP COLUMN `pair_category_id`;
@@ -0,0 +1,7 @@
+-- +migrate Up
+
+ALTER TABLE `trades` ADD COLUMN `fit_id` varchar(255) DEFAULT NULL;
+
+-- +migrate Down
+
+ALTER TABLE `trades` DROP COLUMN `fit_id`;
@@ -0,0 +1,54 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+import { Controller } from '@hotwired/stimulus';
+import { Subject } from 'rxjs';
+import { ajax } from 'rxjs/ajax';
+import { distinctUntilChanged, map, switchMap } from 'rxjs/operators';
+
+export default class extends Controller {
+  attachmentDelete$ = new Subject();
+
+  connect() {
+    console.log("Stimulus[ATTACHMENT] connected!", this.element);
+
+    this.attachmentDelete$
+      .pipe(
+        distinctUntilChanged(),
+        switchMap((attachmentID) => {
+          console.log("RXJS[ATTACHMENT]:ajax:DELETE: ", [attachmentID])
+          return ajax({
+            method: 'DELETE',
+            url: '/attachments/'+attachmentID,
+            responseType: 'json'
+          });
+        }),
+        map((response) => {
+          return response.response;
+        })
+      )
+      .subscribe((response) => {
+        console.log(response)
+        window.location.reload()
+      })
+  }
+
+  disconnect() {
+    this.attachmentDelete$.unsubscribe();
+  }
+
+  actionDelete(event) {
+    let target = event.currentTarget
+    let attachmentID = target.getAttribute('data-attachment-id')
+    console.log("Stimulus[ATTACHMENT]: actionDelete", attachmentID)
+    event.preventDefault()
+
+    if (!confirm("Are you sure?"))
+      return
+    // add to RXJS stream processed with attachmentDelete.pipe above
+    this.attachmentDelete$.next(attachmentID)
+  }
+}
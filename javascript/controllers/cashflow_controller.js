@@ -11,6 +11,7 @@ import { Controller } from '@hotwired/stimulus';
 import { Subject } from 'rxjs';
 import { ajax } from 'rxjs/ajax';
 import { distinctUntilChanged, map, switchMap } from 'rxjs/operators';
+import { currencySplit, currencyFormat } from '../currency';
 
 export default class extends Controller {
   static targets = [ "cashflowTableRow", "cashflowTableRowBalance",
@@ -92,21 +93,17 @@ export default class extends Controller {
       if (parseInt(i) > tableIdx) {
         break
       }
-      let oldAmountHTML = cashflowBalances[i].innerHTML
-      let amountStart = oldAmountHTML.search(/[$]/)
-      let oldBalance = parseFloat(oldAmountHTML.slice(amountStart+1))
+      let [symbol, oldBalance] = currencySplit(cashflowBalances[i].innerHTML)
       let newBalance = oldBalance + adjustAmount
       // overwrite c.Balance
-      cashflowBalances[i].innerHTML = "$"+(newBalance.toFixed(2))
+      cashflowBalances[i].innerHTML = currencyFormat(symbol, newBalance)
     }
 
     // fixup any SingleBalance
     for (let i in cashflowSingleBalance) {
-      let oldAmountHTML = cashflowSingleBalance[i].innerHTML
-      let amountStart = oldAmountHTML.search(/[$]/)
-      let oldBalance = parseFloat(oldAmountHTML.slice(amountStart+1))
+      let [symbol, oldBalance] = currencySplit(cashflowSingleBalance[i].innerHTML)
       let newBalance = oldBalance + adjustAmount
-      cashflowSingleBalance[i].innerHTML = "$"+(newBalance.toFixed(2))
+      cashflowSingleBalance[i].innerHTML = currencyFormat(symbol, newBalance)
       break
     }
 
@@ -174,11 +171,9 @@ export default class extends Controller {
         cashflowRows[r].hidden = 1
         tableIdx = parseInt(r) - 1 // .hidden makes table one row smaller
 
-        let oldAmountHTML = displayAmounts[r].innerHTML
-        let amountStart = oldAmountHTML.search(/[$]/)
-        let oldAmount = oldAmountHTML.slice(amountStart+1)
+        let [symbol, oldAmount] = currencySplit(displayAmounts[r].innerHTML)
         // store adjust needed for Balance column
-        adjustAmount = -1 * parseFloat(oldAmount)
+        adjustAmount = -1 * oldAmount
       }
     }
     this.adjustBalances(tableIdx, adjustAmount)
@@ -245,18 +240,16 @@ export default class extends Controller {
       if (id == cashflowID) {
         tableIdx = parseInt(i)
         if (send_amount) {
-          let oldAmountHTML = displayAmounts[i].innerHTML
-          let amountStart = oldAmountHTML.search(/[$]/)
-          let oldAmount = oldAmountHTML.slice(amountStart+1)
+          let [symbol, oldAmount] = currencySplit(displayAmounts[i].innerHTML)
           // store adjust needed for Balance column
-          adjustAmount = newAmount - parseFloat(oldAmount)
+          adjustAmount = newAmount - oldAmount
 
           // test if c.Amount actually changed or not
           if (adjustAmount == 0) {
             send_amount = 0
           } else {
             // overwrite c.Amount
-            displayAmounts[i].innerHTML = "$"+(newAmount.toFixed(2))
+            displayAmounts[i].innerHTML = currencyFormat(symbol, newAmount)
           }
         }
         displayAmounts[i].hidden = 0
@@ -0,0 +1,54 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+import { Controller } from '@hotwired/stimulus';
+import { Subject } from 'rxjs';
+import { ajax } from 'rxjs/ajax';
+import { distinctUntilChanged, map, switchMap } from 'rxjs/operators';
+
+export default class extends Controller {
+  credentialDelete$ = new Subject();
+
+  connect() {
+    console.log("Stimulus[CREDENTIAL] connected!", this.element);
+
+    this.credentialDelete$
+      .pipe(
+        distinctUntilChanged(),
+        switchMap((credentialID) => {
+          console.log("RXJS[CREDENTIAL]:ajax:DELETE: ", [credentialID])
+          return ajax({
+            method: 'DELETE',
+            url: '/credentials/'+credentialID,
+            responseType: 'json'
+          });
+        }),
+        map((response) => {
+          return response.response;
+        })
+      )
+      .subscribe((response) => {
+        console.log(response)
+        window.location.assign('/credentials')
+      })
+  }
+
+  disconnect() {
+    this.credentialDelete$.unsubscribe();
+  }
+
+  actionDelete(event) {
+    let target = event.currentTarget
+    let credentialID = target.getAttribute('data-credential-id')
+    console.log("Stimulus[CREDENTIAL]: actionDelete", credentialID)
+    event.preventDefault()
+
+    if (!confirm("Are you sure?"))
+      return
+    // add to RXJS stream processed with credentialDelete.pipe above
+    this.credentialDelete$.next(credentialID)
+  }
+}
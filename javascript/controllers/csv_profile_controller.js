@@ -0,0 +1,54 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+import { Controller } from '@hotwired/stimulus';
+import { Subject } from 'rxjs';
+import { ajax } from 'rxjs/ajax';
+import { distinctUntilChanged, map, switchMap } from 'rxjs/operators';
+
+export default class extends Controller {
+  csvProfileDelete$ = new Subject();
+
+  connect() {
+    console.log("Stimulus[CSV_PROFILE] connected!", this.element);
+
+    this.csvProfileDelete$
+      .pipe(
+        distinctUntilChanged(),
+        switchMap((csvProfileID) => {
+          console.log("RXJS[CSV_PROFILE]:ajax:DELETE: ", [csvProfileID])
+          return ajax({
+            method: 'DELETE',
+            url: '/csv_profiles/'+csvProfileID,
+            responseType: 'json'
+          });
+        }),
+        map((response) => {
+          return response.response;
+        })
+      )
+      .subscribe((response) => {
+        console.log(response)
+        window.location.assign('/csv_profiles')
+      })
+  }
+
+  disconnect() {
+    this.csvProfileDelete$.unsubscribe();
+  }
+
+  actionDelete(event) {
+    let target = event.currentTarget
+    let csvProfileID = target.getAttribute('data-csv-profile-id')
+    console.log("Stimulus[CSV_PROFILE]: actionDelete", csvProfileID)
+    event.preventDefault()
+
+    if (!confirm("Are you sure?"))
+      return
+    // add to RXJS stream processed with csvProfileDelete.pipe above
+    this.csvProfileDelete$.next(csvProfileID)
+  }
+}
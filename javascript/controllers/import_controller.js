@@ -0,0 +1,22 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+import { Controller } from '@hotwired/stimulus';
+
+export default class extends Controller {
+  connect() {
+    console.log("Stimulus[IMPORT] connected!", this.element);
+  }
+
+  actionUndo(event) {
+    let target = event.currentTarget
+    let importID = target.getAttribute('data-import-id')
+    console.log("Stimulus[IMPORT]: actionUndo", importID)
+
+    if (!confirm("Delete all transactions entered by this import?"))
+      event.preventDefault()
+  }
+}
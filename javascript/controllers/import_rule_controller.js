@@ -0,0 +1,54 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+import { Controller } from '@hotwired/stimulus';
+import { Subject } from 'rxjs';
+import { ajax } from 'rxjs/ajax';
+import { distinctUntilChanged, map, switchMap } from 'rxjs/operators';
+
+export default class extends Controller {
+  importRuleDelete$ = new Subject();
+
+  connect() {
+    console.log("Stimulus[IMPORT_RULE] connected!", this.element);
+
+    this.importRuleDelete$
+      .pipe(
+        distinctUntilChanged(),
+        switchMap((importRuleID) => {
+          console.log("RXJS[IMPORT_RULE]:ajax:DELETE: ", [importRuleID])
+          return ajax({
+            method: 'DELETE',
+            url: '/import_rules/'+importRuleID,
+            responseType: 'json'
+          });
+        }),
+        map((response) => {
+          return response.response;
+        })
+      )
+      .subscribe((response) => {
+        console.log(response)
+        window.location.assign('/import_rules')
+      })
+  }
+
+  disconnect() {
+    this.importRuleDelete$.unsubscribe();
+  }
+
+  actionDelete(event) {
+    let target = event.currentTarget
+    let importRuleID = target.getAttribute('data-import-rule-id')
+    console.log("Stimulus[IMPORT_RULE]: actionDelete", importRuleID)
+    event.preventDefault()
+
+    if (!confirm("Are you sure?"))
+      return
+    // add to RXJS stream processed with importRuleDelete.pipe above
+    this.importRuleDelete$.next(importRuleID)
+  }
+}
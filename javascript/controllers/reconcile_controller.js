@@ -0,0 +1,110 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+import { Controller } from '@hotwired/stimulus';
+import { Subject } from 'rxjs';
+import { ajax } from 'rxjs/ajax';
+import { map, mergeMap } from 'rxjs/operators';
+import { currencySplit, currencyFormat } from '../currency';
+
+export default class extends Controller {
+  static targets = [ "clearedBalance", "difference" ]
+
+  reconcileDelete$ = new Subject();
+  cashflowPut$ = new Subject();
+
+  connect() {
+    console.log("Stimulus[RECONCILE] connected!", this.element);
+
+    this.reconcileDelete$
+      .pipe(
+        mergeMap((accountID) => {
+          console.log("RXJS[RECONCILE]:ajax:DELETE: ", [accountID])
+          return ajax({
+            method: 'DELETE',
+            url: '/accounts/'+accountID+'/reconcile',
+            responseType: 'json'
+          });
+        }),
+        map((response) => {
+          return response.response;
+        })
+      )
+      .subscribe((response) => {
+        console.log(response)
+        window.location.reload()
+      })
+
+    // each checkbox toggle must be sent, so don't use switchMap here
+    this.cashflowPut$
+      .pipe(
+        mergeMap((cashflowSet) => {
+          console.log("RXJS[RECONCILE]:ajax:PUT: ", cashflowSet)
+          return ajax({
+            method: 'PUT',
+            url: '/cash_flows/'+cashflowSet[0],
+            responseType: 'json',
+            body: {
+              // server reads using KeyValue struct with string types
+              key: "cleared",
+              value: cashflowSet[1]
+            }
+          });
+        }),
+        map((response) => {
+          return response.response;
+        })
+      )
+      .subscribe((response) => {
+        console.log("RXJS[RECONCILE]:ajax:PUT reply: " + response)
+      })
+  }
+
+  disconnect() {
+    this.reconcileDelete$.unsubscribe();
+    this.cashflowPut$.unsubscribe();
+  }
+
+  actionCancel(event) {
+    let accountID = this.element.getAttribute('data-reconcile-account-id')
+    console.log("Stimulus[RECONCILE]: actionCancel", accountID)
+    event.preventDefault()
+
+    if (!confirm("Are you sure?"))
+      return
+    this.reconcileDelete$.next(accountID)
+  }
+
+  // using change event on cleared checkbox
+  actionClear(event) {
+    let target = event.currentTarget
+    let cashflowID = target.getAttribute('data-reconcile-id')
+    let amount = parseFloat(target.getAttribute('data-reconcile-amount'))
+    let statementBalance = parseFloat(this.element.getAttribute('data-reconcile-statement-balance'))
+    let clearedBalance = parseFloat(this.element.getAttribute('data-reconcile-cleared-balance'))
+    console.log("Stimulus[RECONCILE]: actionClear", cashflowID, target.checked)
+
+    if (target.checked) {
+      clearedBalance += amount
+    } else {
+      clearedBalance -= amount
+    }
+    this.element.setAttribute('data-reconcile-cleared-balance', clearedBalance.toFixed(2))
+
+    // update Cleared Balance and Difference live
+    let difference = statementBalance - clearedBalance
+    for (let t of this.clearedBalanceTargets) {
+      let [symbol, oldBalance] = currencySplit(t.innerHTML)
+      t.innerHTML = currencyFormat(symbol, clearedBalance)
+    }
+    for (let t of this.differenceTargets) {
+      let [symbol, oldDifference] = currencySplit(t.innerHTML)
+      t.innerHTML = currencyFormat(symbol, difference)
+    }
+
+    this.cashflowPut$.next([cashflowID, String(target.checked)]);
+  }
+}
@@ -0,0 +1,54 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+import { Controller } from '@hotwired/stimulus';
+import { Subject } from 'rxjs';
+import { ajax } from 'rxjs/ajax';
+import { distinctUntilChanged, map, switchMap } from 'rxjs/operators';
+
+export default class extends Controller {
+  searchDelete$ = new Subject();
+
+  connect() {
+    console.log("Stimulus[SEARCH] connected!", this.element);
+
+    this.searchDelete$
+      .pipe(
+        distinctUntilChanged(),
+        switchMap((searchID) => {
+          console.log("RXJS[SEARCH]:ajax:DELETE: ", [searchID])
+          return ajax({
+            method: 'DELETE',
+            url: '/searches/'+searchID,
+            responseType: 'json'
+          });
+        }),
+        map((response) => {
+          return response.response;
+        })
+      )
+      .subscribe((response) => {
+        console.log(response)
+        window.location.assign('/search')
+      })
+  }
+
+  disconnect() {
+    this.searchDelete$.unsubscribe();
+  }
+
+  actionDelete(event) {
+    let target = event.currentTarget
+    let searchID = target.getAttribute('data-search-id')
+    console.log("Stimulus[SEARCH]: actionDelete", searchID)
+    event.preventDefault()
+
+    if (!confirm("Are you sure?"))
+      return
+    // add to RXJS stream processed with searchDelete.pipe above
+    this.searchDelete$.next(searchID)
+  }
+}
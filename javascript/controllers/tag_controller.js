@@ -0,0 +1,54 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+import { Controller } from '@hotwired/stimulus';
+import { Subject } from 'rxjs';
+import { ajax } from 'rxjs/ajax';
+import { distinctUntilChanged, map, switchMap } from 'rxjs/operators';
+
+export default class extends Controller {
+  tagDelete$ = new Subject();
+
+  connect() {
+    console.log("Stimulus[TAG] connected!", this.element);
+
+    this.tagDelete$
+      .pipe(
+        distinctUntilChanged(),
+        switchMap((tagID) => {
+          console.log("RXJS[TAG]:ajax:DELETE: ", [tagID])
+          return ajax({
+            method: 'DELETE',
+            url: '/tags/'+tagID,
+            responseType: 'json'
+          });
+        }),
+        map((response) => {
+          return response.response;
+        })
+      )
+      .subscribe((response) => {
+        console.log(response)
+        window.location.assign('/tags')
+      })
+  }
+
+  disconnect() {
+    this.tagDelete$.unsubscribe();
+  }
+
+  actionDelete(event) {
+    let target = event.currentTarget
+    let tagID = target.getAttribute('data-tag-id')
+    console.log("Stimulus[TAG]: actionDelete", tagID)
+    event.preventDefault()
+
+    if (!confirm("Are you sure?"))
+      return
+    // add to RXJS stream processed with tagDelete.pipe above
+    this.tagDelete$.next(tagID)
+  }
+}
@@ -0,0 +1,21 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+// Amounts are displayed as currency symbol followed by value, such
+// as "$-12.50" or "CHF 12.50". Return [symbol, value] from such string.
+export function currencySplit(amountHTML) {
+  let amountString = amountHTML.trim()
+  let amountStart = amountString.search(/[-\d]/)
+  if (amountStart < 0) {
+    return [amountString, 0]
+  }
+  return [amountString.slice(0, amountStart),
+          parseFloat(amountString.slice(amountStart))]
+}
+
+export function currencyFormat(symbol, value) {
+  return symbol + value.toFixed(2)
+}
@@ -10,6 +10,7 @@ import (
 	"errors"
 	"log"
 	"strconv"
+	"strings"
 	"time"
 	"github.com/shopspring/decimal"
 	"github.com/pacificbrian/go-bookkeeper/config"
@@ -25,7 +26,10 @@ type Account struct {
 	InstitutionID uint `form:"account.institution_id"`
 	AverageBalance decimal.Decimal `gorm:"-:all"`
 	Balance decimal.Decimal
+	BaseBalance decimal.Decimal `gorm:"-:all"`
+	BaseCurrencyTypeID uint `gorm:"-:all"`
 	CashBalance decimal.Decimal
+	LowBalance decimal.NullDecimal
 	Portfolio SecurityValue `gorm:"-:all"`
 	Routing int `form:"account.Routing"`
 	OfxIndex uint `form:"account.OfxIndex"`
@@ -50,8 +54,18 @@ func (a *Account) sanitizeInputs() {
 	sanitizeString(&a.Number)
 }
 
-func (Account) Currency(value decimal.Decimal) string {
-	return "$" + value.StringFixedBank(2)
+func (a Account) Currency(value decimal.Decimal) string {
+	return currencyFormat(value, a.CurrencyTypeID)
+}
+
+func (a Account) BaseCurrency(value decimal.Decimal) string {
+	return currencyFormat(value, a.BaseCurrencyTypeID)
+}
+
+// Balance is in different CurrencyType than User's base CurrencyType
+func (a Account) HasBaseBalance() bool {
+	return a.BaseCurrencyTypeID > 0 &&
+	       getCurrencyType(a.CurrencyTypeID).ID != a.BaseCurrencyTypeID
 }
 
 // for Bind() and setting from input/checkboxes */
@@ -67,6 +81,21 @@ func (a *Account) GetRouting() string {
 	return strconv.Itoa(a.Routing)
 }
 
+// threshold for Forecast, unset (NULL) if not wanted
+func (a Account) GetLowBalance() string {
+	if !a.LowBalance.Valid {
+		return ""
+	}
+	return a.LowBalance.Decimal.StringFixed(2)
+}
+
+func (a *Account) SetLowBalance(lowBalance string) {
+	lowBalance = strings.Replace(strings.Trim(lowBalance, "$ "), ",", "", -1)
+	value, err := decimal.NewFromString(lowBalance)
+	a.LowBalance.Decimal = value.Round(2)
+	a.LowBalance.Valid = (err == nil)
+}
+
 func (a *Account) IsInvestment() bool {
 	a.AccountType.ID = a.AccountTypeID
 	return a.AccountType.isCrypto() ||
@@ -448,8 +477,7 @@ func (a *Account) lastCashFlow(imported bool) *CashFlow {
 	return entry
 }
 
-func (a *Account) updateBalance(c *CashFlow) {
-	db := getDbManager()
+func (a *Account) updateBalance(db *gorm.DB, c *CashFlow) {
 
 	// catastrophic if we end up here without a.Verified
 	assert(a.Verified, "Unexpected: Account.Verified Unset!")
@@ -471,7 +499,8 @@ func (a *Account) updateBalance(c *CashFlow) {
 	a.User.updateAccountBalance(a, adjustAmount)
 	// TODO: should be fine to discard cached Balance as written below
 
-	if c.oldAmount.IsZero() || oldCashBalance.IsZero() {
+	if c.oldAmount.IsZero() || oldCashBalance.IsZero() ||
+	   a.User.Cache().noBalances {
 		// This case intended to handle when we don't know if we have
 		// accurate Account Balances, and so just use +delta.
 		// (Such as updates for Transfer/Pair).
@@ -505,6 +534,19 @@ func (a *Account) writeBalance() {
 		   a.ID, a.Balance.InexactFloat64())
 }
 
+// add update to Balance in database, without overwriting concurrent updates
+func (a *Account) addBalance(update decimal.Decimal) {
+	if !a.Verified {
+		return
+	}
+	db := getDbManager()
+
+	db.Omit(clause.Associations).Model(a).
+	   Update("balance", gorm.Expr("balance + ?", update))
+	log.Printf("[MODEL] ACCOUNT(%d) ADD BALANCE(%f)",
+		   a.ID, update.InexactFloat64())
+}
+
 func (a *Account) Create(session *Session) error {
 	db := session.DB
 	u := session.GetUser()
@@ -533,6 +575,7 @@ func (a *Account) cloneVerified(src *Account) {
 	a.cloneVerifiedFrom(src)
 	a.ID = src.ID
 	a.AccountTypeID = src.AccountTypeID
+	a.CurrencyTypeID = src.CurrencyTypeID
 	a.Balance = src.Balance
 	a.CashBalance = src.CashBalance
 }
@@ -603,7 +646,81 @@ func (a *Account) updateAccount(session *Session, async bool) {
 		// !async because if aready async then we don't want nested
 		// goroutines to complete and not also run in background
 		a.getOpenSecurities(!async)
+		a.recordSnapshot(getDbManager())
+	}
+}
+
+// Sum of reconciled CashFlows; if date is set, also includes the CashFlows
+// which are cleared on or before date. Only base CashFlows (not Split or
+// Repeat) are included, as only these affect Account.Balance.
+func (a *Account) reconciledBalance(db *gorm.DB, date *time.Time) decimal.Decimal {
+	var total decimal.Decimal
+	entries := []CashFlow{}
+	query := map[string]interface{}{"account_id": a.ID, "type": nil}
+
+	if date != nil {
+		db.Select("amount").
+		   Where("reconciled = 1 OR (cleared = 1 AND date <= ?)", date).
+		   Find(&entries, query)
+	} else {
+		db.Select("amount").Where("reconciled = 1").
+		   Find(&entries, query)
 	}
+
+	for i := 0; i < len(entries); i++ {
+		total = total.Add(entries[i].Amount)
+	}
+	return total
+}
+
+// Returns the in progress Reconcile for Account, or else a new (unsaved)
+// Reconcile defaulting to today's date and current Account.Balance.
+func (a *Account) GetReconcile(session *Session) (*Reconcile, error) {
+	if !a.Verified {
+		a = a.Get(session, false)
+		if a == nil {
+			return nil, errors.New("Permission Denied")
+		}
+	}
+	if a.IsInvestment() {
+		return nil, errors.New("Reconcile Unsupported for Investment Account")
+	}
+	db := session.DB
+
+	r := new(Reconcile)
+	db.Where("completed = 0 OR completed IS NULL").
+	   Where(&Reconcile{AccountID: a.ID}).Last(&r)
+	if r.ID == 0 {
+		r.AccountID = a.ID
+		r.StatementDate = time.Now()
+		r.StatementBalance = a.CashBalance
+	}
+	r.Account.cloneVerified(a)
+	r.postQueryInit()
+	log.Printf("[MODEL] ACCOUNT(%d) GET RECONCILE(%d)", a.ID, r.ID)
+	return r, nil
+}
+
+// CashFlows on or before date which are not yet reconciled
+func (a *Account) ListUnreconciled(session *Session, date *time.Time) []CashFlow {
+	entries := []CashFlow{}
+	if !a.Verified {
+		return entries
+	}
+	db := session.DB
+
+	query := map[string]interface{}{"account_id": a.ID, "type": nil}
+	db.Order("date asc").Preload("Payee").Preload("Category").
+	   Where("reconciled = 0 OR reconciled IS NULL").
+	   Where("date <= ?", date).Find(&entries, query)
+
+	for i := 0; i < len(entries); i++ {
+		c := &entries[i]
+		c.Account.cloneVerified(a)
+		c.Preload(db)
+	}
+	log.Printf("[MODEL] LIST UNRECONCILED ACCOUNT(%d:%d)", a.ID, len(entries))
+	return entries
 }
 
 // update Account.Balance from Securities.Value
@@ -30,6 +30,7 @@ type AccountType struct {
 type CurrencyType struct {
 	Model
 	Name string `form:"currency_type.Name"`
+	Symbol string
 }
 
 func (a AccountType) GetAltText() string {
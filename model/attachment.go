@@ -0,0 +1,249 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"github.com/pacificbrian/go-bookkeeper/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxAttachmentSize int64 = 20 << 20
+
+// An Attachment is a receipt, invoice or statement (PDF or image) for one
+// of a CashFlow, Trade or TaxEntry. Files are stored once per content
+// Hash, and shared by all Attachments with same content.
+type Attachment struct {
+	Model
+	UserID uint `gorm:"not null"`
+	CashFlowID uint
+	TradeID uint
+	TaxEntryID uint
+	FileName string
+	ContentType string
+	Size int64
+	Hash string
+	CreatedAt time.Time
+	Verified bool `gorm:"-:all"`
+}
+
+func attachmentDir() string {
+	return filepath.Join(config.GetConfigDir("config"), "attachments")
+}
+
+// Files stored by Hash, with subdirectory from first byte of Hash
+func attachmentPath(hash string) string {
+	return filepath.Join(attachmentDir(), hash[:2], hash)
+}
+
+func (a *Attachment) FilePath() string {
+	return attachmentPath(a.Hash)
+}
+
+func (a Attachment) GetSize() string {
+	if a.Size < 1024 {
+		return fmt.Sprintf("%d B", a.Size)
+	} else if a.Size < 1024 * 1024 {
+		return fmt.Sprintf("%.1f KB", float64(a.Size) / 1024)
+	}
+	return fmt.Sprintf("%.1f MB", float64(a.Size) / (1024 * 1024))
+}
+
+func (a *Attachment) sanitizeInputs() {
+	a.FileName = filepath.Base(strings.Replace(a.FileName, "\\", "/", -1))
+	sanitizeString(&a.FileName)
+}
+
+// only PDFs and images can be attached
+func attachmentTypeAllowed(contentType string) bool {
+	return contentType == "application/pdf" ||
+	       strings.HasPrefix(contentType, "image/")
+}
+
+// Verify Attachment is for exactly one of User's CashFlow, Trade or TaxEntry
+func (a *Attachment) verifyOwner(session *Session) bool {
+	owners := 0
+	verified := false
+	if a.CashFlowID > 0 {
+		owners += 1
+		c := new(CashFlow)
+		c.ID = a.CashFlowID
+		verified = c.Get(session, false) != nil
+	}
+	if a.TradeID > 0 {
+		owners += 1
+		t := new(Trade)
+		t.ID = a.TradeID
+		verified = t.Get(session) != nil
+	}
+	if a.TaxEntryID > 0 {
+		owners += 1
+		te := new(TaxEntry)
+		te.ID = a.TaxEntryID
+		verified = te.Get(session) != nil
+	}
+	return owners == 1 && verified
+}
+
+// write file for hash unless already stored
+func storeAttachmentFile(hash string, data []byte) error {
+	path := attachmentPath(hash)
+	_, err := os.Stat(path)
+	if err == nil {
+		return nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	// write to temporary file first, so never have partial file at path
+	tmpPath := path + ".tmp"
+	err = os.WriteFile(tmpPath, data, 0600)
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+	return err
+}
+
+// remove stored file once no Attachments use it
+func (a *Attachment) removeFile(db *gorm.DB) {
+	var count int64
+	db.Model(&Attachment{}).Where("hash = ?", a.Hash).Count(&count)
+	if count == 0 {
+		os.Remove(a.FilePath())
+		log.Printf("[MODEL] REMOVE ATTACHMENT FILE(%s)", a.Hash)
+	}
+}
+
+// Delete all Attachments matching owner (CashFlowID, TradeID or TaxEntryID)
+func deleteAttachments(db *gorm.DB, owner *Attachment) {
+	entries := []Attachment{}
+	db.Where(owner).Find(&entries)
+	for i := 0; i < len(entries); i++ {
+		a := &entries[i]
+		db.Delete(a)
+		a.removeFile(db)
+	}
+}
+
+// Create Attachment from uploaded file, for the CashFlowID, TradeID or
+// TaxEntryID set in Attachment.
+func (a *Attachment) Create(session *Session, file HttpFile) error {
+	u := session.GetUser()
+	if u == nil || !a.verifyOwner(session) {
+		return errors.New("Permission Denied")
+	}
+	db := session.DB
+
+	data, err := io.ReadAll(io.LimitReader(file.FileData, maxAttachmentSize + 1))
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return errors.New("Attachment Is Empty")
+	}
+	if int64(len(data)) > maxAttachmentSize {
+		return errors.New(fmt.Sprintf("Attachment Larger Than %d MB",
+					      maxAttachmentSize >> 20))
+	}
+	contentType := http.DetectContentType(data)
+	if !attachmentTypeAllowed(contentType) {
+		return errors.New(fmt.Sprintf("Attachment Type (%s) Not Supported",
+					      contentType))
+	}
+	sum := sha256.Sum256(data)
+
+	a.UserID = u.ID
+	a.FileName = file.FileName
+	a.ContentType = contentType
+	a.Size = int64(len(data))
+	a.Hash = hex.EncodeToString(sum[:])
+	a.sanitizeInputs()
+
+	// same file already attached here
+	existing := new(Attachment)
+	db.Where(&Attachment{UserID: a.UserID, CashFlowID: a.CashFlowID,
+			     TradeID: a.TradeID, TaxEntryID: a.TaxEntryID,
+			     Hash: a.Hash}).First(&existing)
+	if existing.ID > 0 {
+		*a = *existing
+		log.Printf("[MODEL] ATTACHMENT(%d) ALREADY EXISTS", a.ID)
+		return nil
+	}
+
+	err = storeAttachmentFile(a.Hash, data)
+	if err != nil {
+		return err
+	}
+	result := db.Omit(clause.Associations).Create(a)
+	log.Printf("[MODEL] CREATE ATTACHMENT(%d) FILE(%s) SIZE(%d) HASH(%s)",
+		   a.ID, a.FileName, a.Size, a.Hash)
+	return result.Error
+}
+
+// List Attachments of the CashFlow, Trade or TaxEntry set in Attachment
+func (a *Attachment) List(session *Session) []Attachment {
+	entries := []Attachment{}
+	u := session.GetUser()
+	if u == nil || (a.CashFlowID == 0 && a.TradeID == 0 && a.TaxEntryID == 0) {
+		return entries
+	}
+
+	session.DB.Order("id").
+	  Where(&Attachment{UserID: u.ID, CashFlowID: a.CashFlowID,
+			    TradeID: a.TradeID, TaxEntryID: a.TaxEntryID}).
+	  Find(&entries)
+	log.Printf("[MODEL] LIST ATTACHMENTS(%d)", len(entries))
+	return entries
+}
+
+func (a *Attachment) HaveAccessPermission(session *Session) bool {
+	u := session.GetUser()
+	a.Verified = !(u == nil || u.ID != a.UserID)
+	return a.Verified
+}
+
+func (a *Attachment) Get(session *Session) *Attachment {
+	db := session.DB
+	if a.ID > 0 {
+		db.First(&a)
+	}
+	// Verify we have access to Attachment
+	if !a.HaveAccessPermission(session) {
+		return nil
+	}
+	return a
+}
+
+func (a *Attachment) Delete(session *Session) error {
+	// Verify we have access to Attachment
+	a = a.Get(session)
+	if a == nil {
+		return errors.New("Permission Denied")
+	}
+	db := session.DB
+
+	log.Printf("[MODEL] DELETE ATTACHMENT(%d)", a.ID)
+	db.Delete(a)
+	a.removeFile(db)
+	return nil
+}
@@ -0,0 +1,277 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"fmt"
+	"log"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// An AuditEntry is a discrepancy found by Audit between a stored value and
+// the value recomputed from the raw CashFlow, Trade and TradeGain rows.
+// Entries which cannot be repaired automatically are never Fixed.
+type AuditEntry struct {
+	Kind string
+	ID uint
+	Field string
+	Stored decimal.Decimal
+	Expected decimal.Decimal
+	Fixable bool
+	Fixed bool
+}
+
+type ledgerAudit struct {
+	db *gorm.DB
+	fix bool
+	entries []AuditEntry
+}
+
+func (e AuditEntry) String() string {
+	status := ""
+	if e.Fixed {
+		status = " (FIXED)"
+	} else if !e.Fixable {
+		status = " (MANUAL)"
+	}
+	return fmt.Sprintf("%s(%d) %s: %s != %s%s", e.Kind, e.ID, e.Field,
+			   e.Stored.String(), e.Expected.String(), status)
+}
+
+// Records discrepancy and returns true if caller should repair it.
+func (la *ledgerAudit) check(kind string, id uint, field string,
+			     stored decimal.Decimal, expected decimal.Decimal,
+			     fixable bool) bool {
+	if stored.Equal(expected) {
+		return false
+	}
+	e := AuditEntry{Kind: kind, ID: id, Field: field, Stored: stored,
+			Expected: expected, Fixable: fixable,
+			Fixed: fixable && la.fix}
+	la.entries = append(la.entries, e)
+	log.Printf("[MODEL] AUDIT %s", e.String())
+	return e.Fixed
+}
+
+// Recompute CashBalance from base CashFlows and Trades, and Balance from
+// CashBalance and Security.Values (investment Accounts).
+func (la *ledgerAudit) auditAccount(a *Account) {
+	var cashBalance decimal.Decimal
+	db := la.db
+
+	cashFlows := []CashFlow{}
+	query := map[string]interface{}{"account_id": a.ID, "type": nil}
+	db.Select("amount").Find(&cashFlows, query)
+	for i := 0; i < len(cashFlows); i++ {
+		cashBalance = cashBalance.Add(cashFlows[i].Amount)
+	}
+
+	trades := []Trade{}
+	db.Select("trade_type_id", "amount").
+	   Where(&Trade{AccountID: a.ID}).Find(&trades)
+	for i := 0; i < len(trades); i++ {
+		cashBalance = cashBalance.Add(trades[i].cashAmount())
+	}
+
+	balance := cashBalance
+	if a.IsInvestment() {
+		securities := []Security{}
+		db.Select("value").Where("shares > 0 AND account_id = ?", a.ID).
+		   Find(&securities)
+		for i := 0; i < len(securities); i++ {
+			balance = balance.Add(securities[i].Value)
+		}
+	}
+
+	if la.check("Account", a.ID, "CashBalance", a.CashBalance, cashBalance, true) {
+		a.CashBalance = cashBalance
+		db.Omit(clause.Associations).Model(a).
+		   Update("cash_balance", cashBalance)
+	}
+	if la.check("Account", a.ID, "Balance", a.Balance, balance, true) {
+		a.Balance = balance
+		db.Omit(clause.Associations).Model(a).
+		   Update("balance", balance)
+		// else stale cached Balance is written back at CloseSession
+		if a.User.Cache() != nil {
+			a.User.cacheAccountBalance(a)
+		}
+	}
+}
+
+// Replay Trades of Security in order, applying TradeGains and Splits, to
+// recompute Basis and AdjustedShares of each Trade.
+func (la *ledgerAudit) auditSecurity(s *Security) {
+	db := la.db
+	trades := []Trade{}
+	db.Order("date asc").Order("id asc").
+	   Where(&Trade{SecurityID: s.ID}).Find(&trades)
+
+	buys := map[uint]*Trade{}
+	adjustedShares := map[uint]decimal.Decimal{}
+	basis := map[uint]decimal.Decimal{}
+	for i := 0; i < len(trades); i++ {
+		t := &trades[i]
+		if t.IsBuy() {
+			buys[t.ID] = t
+			adjustedShares[t.ID] = t.Shares
+		} else if t.IsSell() {
+			gains := []TradeGain{}
+			db.Where(&TradeGain{SellID: t.ID}).Find(&gains)
+			for j := 0; j < len(gains); j++ {
+				tg := &gains[j]
+				basisFIFO := tg.BasisFIFO
+				if basisFIFO.IsZero() {
+					basisFIFO = tg.Basis
+				}
+				basis[t.ID] = basis[t.ID].Add(tg.Basis)
+				basis[tg.BuyID] = basis[tg.BuyID].Add(basisFIFO)
+				adjustedShares[tg.BuyID] = adjustedShares[tg.BuyID].Sub(tg.Shares)
+			}
+		} else if t.IsSplit() {
+			for id, shares := range adjustedShares {
+				adjustedShares[id] = shares.Mul(t.Shares)
+			}
+		}
+	}
+
+	for i := 0; i < len(trades); i++ {
+		t := &trades[i]
+		if !(t.IsBuy() || t.IsSell()) {
+			continue
+		}
+		updates := make(map[string]interface{})
+
+		if la.check("Trade", t.ID, "Basis", t.Basis, basis[t.ID], true) {
+			updates["basis"] = basis[t.ID]
+		}
+		// unsold Buys from before AdjustedShares was stored have 0
+		expected := adjustedShares[t.ID]
+		if t.IsBuy() &&
+		   !(t.AdjustedShares.IsZero() && t.Basis.IsZero() && expected.Equal(t.Shares)) &&
+		   la.check("Trade", t.ID, "AdjustedShares", t.AdjustedShares, expected, true) {
+			updates["adjusted_shares"] = expected
+			updates["closed"] = expected.IsZero()
+		}
+
+		if len(updates) > 0 {
+			db.Omit(clause.Associations).Model(t).Updates(updates)
+		}
+	}
+}
+
+// Verify each Transfer has a Pair in the other Account with opposite
+// Amount, which refers back to it.
+func (la *ledgerAudit) auditTransfers(a *Account) {
+	db := la.db
+	entries := []CashFlow{}
+	query := map[string]interface{}{"account_id": a.ID, "transfer": true}
+	db.Where("type IS NULL OR type != ?", "RCashFlow").Find(&entries, query)
+
+	for i := 0; i < len(entries); i++ {
+		c := &entries[i]
+		pair := new(CashFlow)
+		if c.CategoryID > 0 {
+			db.Where("account_id = ?", c.PayeeID).First(&pair, c.CategoryID)
+		}
+		if pair.ID == 0 {
+			la.check("Transfer", c.ID, "Pair", decimal.Zero,
+				 decimal.NewFromInt(int64(c.CategoryID)), false)
+			continue
+		}
+		// each Transfer is visited from both Accounts, check once
+		if c.ID < pair.ID {
+			la.check("Transfer", c.ID, "Amount", pair.Amount.Neg(),
+				 c.Amount, false)
+		}
+		if la.check("Transfer", pair.ID, "Pair",
+			    decimal.NewFromInt(int64(pair.CategoryID)),
+			    decimal.NewFromInt(int64(c.ID)), pair.Amount.Equal(c.Amount.Neg())) {
+			db.Omit(clause.Associations).Model(pair).
+			   Update("category_id", c.ID)
+		}
+	}
+}
+
+// Verify Split CashFlows sum to the Amount of their parent, and parent's
+// SplitFrom (the count of Splits) is accurate.
+func (la *ledgerAudit) auditSplits(a *Account) {
+	db := la.db
+	parents := []CashFlow{}
+	query := map[string]interface{}{"account_id": a.ID, "type": nil,
+					"transfer": false, "split": false}
+	db.Where("split_from > 0").Find(&parents, query)
+
+	for i := 0; i < len(parents); i++ {
+		var total decimal.Decimal
+		c := &parents[i]
+		splits := []CashFlow{}
+		db.Select("amount").
+		   Find(&splits, &CashFlow{AccountID: a.ID, SplitFrom: c.ID, Split: true})
+		for j := 0; j < len(splits); j++ {
+			total = total.Add(splits[j].Amount)
+		}
+
+		la.check("Split", c.ID, "Amount", c.Amount, total, false)
+		if la.check("Split", c.ID, "SplitCount",
+			    decimal.NewFromInt(int64(c.SplitFrom)),
+			    decimal.NewFromInt(int64(len(splits))), len(splits) > 0) {
+			db.Omit(clause.Associations).Model(c).
+			   Update("split_from", len(splits))
+		}
+	}
+}
+
+// Audit all of User's Accounts, and repair discrepancies if fix is set.
+func AuditLedger(session *Session, fix bool) []AuditEntry {
+	la := new(ledgerAudit)
+	la.db = session.DB
+	la.fix = fix
+	u := session.GetUser()
+	if u == nil {
+		return la.entries
+	}
+
+	accounts := []Account{}
+	la.db.Where(&Account{UserID: u.ID}).Find(&accounts)
+	for i := 0; i < len(accounts); i++ {
+		a := &accounts[i]
+		a.setSession(session)
+		a.postQueryInit()
+
+		if a.IsInvestment() {
+			securities := []Security{}
+			la.db.Where(&Security{AccountID: a.ID}).Find(&securities)
+			for j := 0; j < len(securities); j++ {
+				la.auditSecurity(&securities[j])
+			}
+		}
+		la.auditTransfers(a)
+		la.auditSplits(a)
+		la.auditAccount(a)
+	}
+
+	log.Printf("[MODEL] AUDIT USER(%d) ACCOUNTS(%d) ERRORS(%d) FIX(%t)",
+		   u.ID, len(accounts), len(la.entries), fix)
+	return la.entries
+}
+
+// Audit ledgers of every User (for command line use).
+func AuditAllUsers(fix bool) []AuditEntry {
+	db := getDbManager()
+	entries := []AuditEntry{}
+
+	users := []User{}
+	db.Select("id").Find(&users)
+	for i := 0; i < len(users); i++ {
+		session := users[i].NewSession()
+		entries = append(entries, AuditLedger(session, fix)...)
+	}
+	return entries
+}
@@ -0,0 +1,792 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	BackupJSON string = "json"
+	BackupZIP string = "zip"
+)
+
+// increment if backup contents change in incompatible way
+// (version 2 keeps RepeatsLeft of NULL apart from 0)
+const backupVersion int = 2
+
+// name of JSON file stored within ZIP archive
+const backupZipEntry string = "backup.json"
+
+// A backupRecord is one database row, keyed by column name. Using the
+// column names (not the Go struct) keeps the archive independent of
+// associations and of the database backend.
+type backupRecord map[string]json.RawMessage
+
+// A Backup is a versioned archive of everything a User owns. IDs in the
+// archive are those of the source database, and are remapped on Restore.
+// Attachments (stored as files) and Credentials (sealed with the vault key
+// of the source server) are not included.
+type Backup struct {
+	Version int
+	Created time.Time
+	Login string
+	Categories []backupRecord `json:",omitempty"`
+	Payees []backupRecord `json:",omitempty"`
+	Accounts []backupRecord `json:",omitempty"`
+	Imports []backupRecord `json:",omitempty"`
+	Companies []backupRecord `json:",omitempty"`
+	Securities []backupRecord `json:",omitempty"`
+	Trades []backupRecord `json:",omitempty"`
+	TradeGains []backupRecord `json:",omitempty"`
+	CashFlows []backupRecord `json:",omitempty"`
+	RepeatIntervals []backupRecord `json:",omitempty"`
+	TaxReturns []backupRecord `json:",omitempty"`
+	TaxEntries []backupRecord `json:",omitempty"`
+	Tags []backupRecord `json:",omitempty"`
+	CashFlowTags []backupRecord `json:",omitempty"`
+	TradeTags []backupRecord `json:",omitempty"`
+	ImportRules []backupRecord `json:",omitempty"`
+	Searches []backupRecord `json:",omitempty"`
+	CsvProfiles []backupRecord `json:",omitempty"`
+	BalanceSnapshots []backupRecord `json:",omitempty"`
+}
+
+// map of IDs in archive to newly created IDs, per table
+type backupIDMap map[uint]uint
+
+// lookup new ID; unknown IDs (such as global Categories) are unchanged
+func (m backupIDMap) get(id uint) uint {
+	if newID, found := m[id]; found {
+		return newID
+	}
+	return id
+}
+
+func (m backupIDMap) mustGet(id uint) uint {
+	if id == 0 {
+		return 0
+	}
+	return m[id]
+}
+
+func BackupFileName(format string) string {
+	return fmt.Sprintf("backup_%s.%s", time.Now().Format("20060102"), format)
+}
+
+func BackupContentType(format string) string {
+	if format == BackupZIP {
+		return "application/zip"
+	}
+	return "application/json"
+}
+
+func parseBackupSchema(db *gorm.DB, value any) (*gorm.Statement, error) {
+	stmt := &gorm.Statement{DB: db}
+	err := stmt.Parse(value)
+	return stmt, err
+}
+
+// Convert rows (pointer to slice of models) into backupRecords
+func makeBackupRecords(db *gorm.DB, rows any) ([]backupRecord, error) {
+	stmt, err := parseBackupSchema(db, rows)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	slice := reflect.Indirect(reflect.ValueOf(rows))
+	records := make([]backupRecord, 0, slice.Len())
+
+	for i := 0; i < slice.Len(); i++ {
+		rv := reflect.Indirect(slice.Index(i))
+		r := backupRecord{}
+		for _, name := range stmt.Schema.DBNames {
+			field := stmt.Schema.FieldsByDBName[name]
+			value, _ := field.ValueOf(ctx, rv)
+			r[name], err = json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// JSON null (or missing) column
+func (r backupRecord) isNull(name string) bool {
+	raw, found := r[name]
+	return !found || string(raw) == "null"
+}
+
+// Fill dest (pointer to model) from backupRecord, ignoring any columns
+// not known to this version of the model.
+func (r backupRecord) decode(stmt *gorm.Statement, dest any) error {
+	ctx := context.Background()
+	rv := reflect.Indirect(reflect.ValueOf(dest))
+	for name, raw := range r {
+		field := stmt.Schema.LookUpField(name)
+		if field == nil || field.DBName == "" {
+			continue
+		}
+		fv := field.ReflectValueOf(ctx, rv)
+		err := json.Unmarshal(raw, fv.Addr().Interface())
+		if err != nil {
+			return fmt.Errorf("Invalid Backup Field (%s.%s)",
+					  stmt.Schema.Table, name)
+		}
+	}
+	return nil
+}
+
+// Query everything owned by User and build Backup
+func (b *Backup) load(session *Session) error {
+	var err error
+	db := session.DB
+	u := session.GetUser()
+
+	accounts := []Account{}
+	db.Where(&Account{UserID: u.ID}).Order("id").Find(&accounts)
+	accountIDs := make([]uint, len(accounts))
+	for i := 0; i < len(accounts); i++ {
+		accountIDs[i] = accounts[i].ID
+	}
+
+	cashFlows := []CashFlow{}
+	payees := []Payee{}
+	categories := []Category{}
+	imports := []Import{}
+	securities := []Security{}
+	companies := []Company{}
+	trades := []Trade{}
+	tradeGains := []TradeGain{}
+	repeatIntervals := []RepeatInterval{}
+	taxReturns := []TaxReturn{}
+	taxEntries := []TaxEntry{}
+	tags := []Tag{}
+	cashFlowTags := []CashFlowTag{}
+	tradeTags := []TradeTag{}
+	importRules := []ImportRule{}
+	searches := []Search{}
+	csvProfiles := []CsvProfile{}
+	snapshots := []BalanceSnapshot{}
+
+	if len(accountIDs) > 0 {
+		cashFlowQuery := db.Model(&CashFlow{}).Select("id").
+				   Where("account_id IN ?", accountIDs)
+		db.Where("account_id IN ?", accountIDs).Order("id").Find(&cashFlows)
+		db.Where("cash_flow_id IN (?)", cashFlowQuery).Order("id").
+		   Find(&repeatIntervals)
+		db.Where("account_id IN ?", accountIDs).Order("id").Find(&imports)
+		db.Where("account_id IN ?", accountIDs).Order("id").Find(&securities)
+		db.Where("id IN (?)", db.Model(&Security{}).Select("company_id").
+					   Where("account_id IN ?", accountIDs)).
+		   Order("id").Find(&companies)
+		db.Where("account_id IN ?", accountIDs).Order("id").Find(&trades)
+		db.Where("sell_id IN (?)", db.Model(&Trade{}).Select("id").
+					   Where("account_id IN ?", accountIDs)).
+		   Order("id").Find(&tradeGains)
+		db.Where("cash_flow_id IN (?)", cashFlowQuery).
+		   Order("cash_flow_id").Order("tag_id").Find(&cashFlowTags)
+		db.Where("trade_id IN (?)", db.Model(&Trade{}).Select("id").
+					    Where("account_id IN ?", accountIDs)).
+		   Order("trade_id").Order("tag_id").Find(&tradeTags)
+		db.Where("account_id IN ?", accountIDs).Order("id").Find(&snapshots)
+	}
+	db.Where(&Payee{UserID: u.ID}).Order("id").Find(&payees)
+
+	// Categories are mostly global, so include those used by User
+	categoryQuery := db.Where("user_id = ?", u.ID).
+			    Or("id IN (?)", db.Model(&Payee{}).Select("category_id").
+					    Where("user_id = ?", u.ID))
+	if len(accountIDs) > 0 {
+		categoryQuery = categoryQuery.
+				Or("id IN (?)", db.Model(&CashFlow{}).Select("category_id").
+						Where("account_id IN ?", accountIDs).
+						Where("transfer = ?", false))
+	}
+	db.Where(categoryQuery).Order("id").Find(&categories)
+
+	db.Where(&TaxReturn{UserID: u.ID}).Order("id").Find(&taxReturns)
+	db.Where(&TaxEntry{UserID: u.ID}).Order("id").Find(&taxEntries)
+	db.Where(&Tag{UserID: u.ID}).Order("id").Find(&tags)
+	db.Where(&ImportRule{UserID: u.ID}).Order("id").Find(&importRules)
+	db.Where(&Search{UserID: u.ID}).Order("id").Find(&searches)
+	db.Where(&CsvProfile{UserID: u.ID}).Order("id").Find(&csvProfiles)
+
+	tables := []struct {
+		records *[]backupRecord
+		rows any
+	}{
+		{&b.Categories, &categories},
+		{&b.Payees, &payees},
+		{&b.Accounts, &accounts},
+		{&b.Imports, &imports},
+		{&b.Companies, &companies},
+		{&b.Securities, &securities},
+		{&b.Trades, &trades},
+		{&b.TradeGains, &tradeGains},
+		{&b.CashFlows, &cashFlows},
+		{&b.RepeatIntervals, &repeatIntervals},
+		{&b.TaxReturns, &taxReturns},
+		{&b.TaxEntries, &taxEntries},
+		{&b.Tags, &tags},
+		{&b.CashFlowTags, &cashFlowTags},
+		{&b.TradeTags, &tradeTags},
+		{&b.ImportRules, &importRules},
+		{&b.Searches, &searches},
+		{&b.CsvProfiles, &csvProfiles},
+		{&b.BalanceSnapshots, &snapshots},
+	}
+	for _, t := range tables {
+		*t.records, err = makeBackupRecords(db, t.rows)
+		if err != nil {
+			return err
+		}
+	}
+
+	// RepeatsLeft of NULL (unlimited) is read as 0, so write null
+	if len(repeatIntervals) > 0 {
+		repeatIntervalIDs := make([]uint, len(repeatIntervals))
+		for i := 0; i < len(repeatIntervals); i++ {
+			repeatIntervalIDs[i] = repeatIntervals[i].ID
+		}
+		unlimitedIDs := []uint{}
+		db.Model(&RepeatInterval{}).Where("id IN ?", repeatIntervalIDs).
+		   Where("repeats_left IS NULL").Pluck("id", &unlimitedIDs)
+		unlimited := map[uint]bool{}
+		for _, id := range unlimitedIDs {
+			unlimited[id] = true
+		}
+		for i := 0; i < len(repeatIntervals); i++ {
+			if unlimited[repeatIntervals[i].ID] {
+				b.RepeatIntervals[i]["repeats_left"] = json.RawMessage("null")
+			}
+		}
+	}
+
+	b.Version = backupVersion
+	b.Created = time.Now()
+	b.Login = u.Login
+	log.Printf("[MODEL] BACKUP USER(%d) ACCOUNTS(%d) CASHFLOWS(%d) TRADES(%d)",
+		   u.ID, len(accounts), len(cashFlows), len(trades))
+	return nil
+}
+
+// Write Backup of everything User owns as JSON or as ZIP archive
+func (b *Backup) Write(session *Session, w io.Writer, format string) error {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		format = BackupJSON
+	}
+	if format != BackupJSON && format != BackupZIP {
+		return errors.New("Invalid Backup Format")
+	}
+
+	err := b.load(session)
+	if err != nil {
+		return err
+	}
+
+	if format == BackupZIP {
+		zw := zip.NewWriter(w)
+		fw, err := zw.Create(backupZipEntry)
+		if err != nil {
+			return err
+		}
+		err = json.NewEncoder(fw).Encode(b)
+		if err != nil {
+			return err
+		}
+		return zw.Close()
+	}
+	return json.NewEncoder(w).Encode(b)
+}
+
+// Read Backup from JSON or ZIP archive (detected from file contents)
+func (b *Backup) read(r io.Reader) error {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(2)
+	if string(magic) != "PK" {
+		return json.NewDecoder(br).Decode(b)
+	}
+
+	data, err := io.ReadAll(br)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if f.Name != backupZipEntry {
+			continue
+		}
+		fr, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer fr.Close()
+		return json.NewDecoder(fr).Decode(b)
+	}
+	return errors.New("Backup Not Found in Archive")
+}
+
+// Restorer holds the ID maps built while restoring a Backup
+type backupRestorer struct {
+	db *gorm.DB
+	userID uint
+	backup *Backup
+	categories backupIDMap
+	payees backupIDMap
+	accounts backupIDMap
+	imports backupIDMap
+	companies backupIDMap
+	securities backupIDMap
+	trades backupIDMap
+	cashFlows backupIDMap
+	repeatIntervals backupIDMap
+	tags backupIDMap
+}
+
+// decode each record into new model from newEntry, then call create
+func (r *backupRestorer) each(records []backupRecord, newEntry func() any,
+			     create func(entry any) error) error {
+	if len(records) == 0 {
+		return nil
+	}
+	stmt, err := parseBackupSchema(r.db, newEntry())
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		entry := newEntry()
+		err = record.decode(stmt, entry)
+		if err == nil {
+			err = create(entry)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *backupRestorer) create(entry any) error {
+	return r.db.Omit(clause.Associations).Create(entry).Error
+}
+
+func (r *backupRestorer) restoreCategories() error {
+	return r.each(r.backup.Categories, func() any { return new(Category) },
+		      func(entry any) error {
+		c := entry.(*Category)
+		oldID := c.ID
+		existing := new(Category)
+		r.db.Where("name = ?", c.Name).
+		     Where("user_id IS NULL OR user_id = 0 OR user_id = ?", r.userID).
+		     First(existing)
+		if existing.ID > 0 {
+			r.categories[oldID] = existing.ID
+			return nil
+		}
+		c.ID = 0
+		c.UserID = r.userID
+		err := r.create(c)
+		r.categories[oldID] = c.ID
+		return err
+	})
+}
+
+func (r *backupRestorer) restorePayees() error {
+	return r.each(r.backup.Payees, func() any { return new(Payee) },
+		      func(entry any) error {
+		p := entry.(*Payee)
+		oldID := p.ID
+		existing := new(Payee)
+		r.db.Where(&Payee{UserID: r.userID, Name: p.Name}).First(existing)
+		if existing.ID > 0 {
+			r.payees[oldID] = existing.ID
+			return nil
+		}
+		p.ID = 0
+		p.UserID = r.userID
+		p.CategoryID = r.categories.get(p.CategoryID)
+		err := r.create(p)
+		r.payees[oldID] = p.ID
+		return err
+	})
+}
+
+func (r *backupRestorer) restoreAccounts() error {
+	return r.each(r.backup.Accounts, func() any { return new(Account) },
+		      func(entry any) error {
+		a := entry.(*Account)
+		oldID := a.ID
+		a.ID = 0
+		a.UserID = r.userID
+		err := r.create(a)
+		r.accounts[oldID] = a.ID
+		return err
+	})
+}
+
+func (r *backupRestorer) restoreImports() error {
+	return r.each(r.backup.Imports, func() any { return new(Import) },
+		      func(entry any) error {
+		im := entry.(*Import)
+		oldID := im.ID
+		im.ID = 0
+		im.AccountID = r.accounts.mustGet(im.AccountID)
+		err := r.create(im)
+		r.imports[oldID] = im.ID
+		return err
+	})
+}
+
+// Companies are global, so find existing or create
+func (r *backupRestorer) restoreCompanies() error {
+	return r.each(r.backup.Companies, func() any { return new(Company) },
+		      func(entry any) error {
+		c := entry.(*Company)
+		oldID := c.ID
+		existing := new(Company)
+		r.db.Where("name = ?", c.Name).Where("symbol = ?", c.Symbol).
+		     First(existing)
+		if existing.ID > 0 {
+			r.companies[oldID] = existing.ID
+			return nil
+		}
+		c.ID = 0
+		err := r.create(c)
+		r.companies[oldID] = c.ID
+		return err
+	})
+}
+
+func (r *backupRestorer) restoreSecurities() error {
+	return r.each(r.backup.Securities, func() any { return new(Security) },
+		      func(entry any) error {
+		s := entry.(*Security)
+		oldID := s.ID
+		s.ID = 0
+		s.AccountID = r.accounts.mustGet(s.AccountID)
+		s.CompanyID = r.companies.mustGet(s.CompanyID)
+		err := r.create(s)
+		r.securities[oldID] = s.ID
+		return err
+	})
+}
+
+func (r *backupRestorer) restoreTrades() error {
+	err := r.each(r.backup.Trades, func() any { return new(Trade) },
+		      func(entry any) error {
+		t := entry.(*Trade)
+		oldID := t.ID
+		t.ID = 0
+		t.AccountID = r.accounts.mustGet(t.AccountID)
+		t.SecurityID = r.securities.mustGet(t.SecurityID)
+		t.ImportID = r.imports.mustGet(t.ImportID)
+		err := r.create(t)
+		r.trades[oldID] = t.ID
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.each(r.backup.TradeGains, func() any { return new(TradeGain) },
+		      func(entry any) error {
+		g := entry.(*TradeGain)
+		g.ID = 0
+		g.SellID = r.trades.mustGet(g.SellID)
+		g.BuyID = r.trades.mustGet(g.BuyID)
+		return r.create(g)
+	})
+}
+
+// CashFlows reference each other (Transfer pairs, Splits) and their
+// RepeatIntervals, so are restored in two passes. First pass creates
+// them with these references cleared, and second pass updates them
+// once all of the new IDs are known.
+func (r *backupRestorer) restoreCashFlows() error {
+	type cashFlowRefs struct {
+		id uint
+		isScheduled bool
+		isTransfer bool
+		hasSplitFrom bool
+		categoryID uint
+		splitFrom uint
+		repeatIntervalID uint
+	}
+	refs := []cashFlowRefs{}
+
+	err := r.each(r.backup.CashFlows, func() any { return new(CashFlow) },
+		      func(entry any) error {
+		c := entry.(*CashFlow)
+		oldID := c.ID
+		ref := cashFlowRefs{isScheduled: c.IsScheduled(),
+				    isTransfer: c.Transfer,
+				    // SplitFrom of Split parent is count of Splits
+				    hasSplitFrom: c.Split || c.Transfer,
+				    categoryID: c.CategoryID,
+				    splitFrom: c.SplitFrom,
+				    repeatIntervalID: c.RepeatIntervalID}
+
+		c.ID = 0
+		c.AccountID = r.accounts.mustGet(c.AccountID)
+		c.ImportID = r.imports.mustGet(c.ImportID)
+		if c.Transfer {
+			// PayeeID is Pair.AccountID, CategoryID is Pair.ID
+			c.PayeeID = r.accounts.mustGet(c.PayeeID)
+			c.CategoryID = 0
+		} else {
+			c.PayeeID = r.payees.get(c.PayeeID)
+			c.CategoryID = r.categories.get(c.CategoryID)
+		}
+		if ref.hasSplitFrom {
+			c.SplitFrom = 0
+		}
+		c.RepeatIntervalID = 0
+
+		err := r.create(c)
+		r.cashFlows[oldID] = c.ID
+		ref.id = c.ID
+		refs = append(refs, ref)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	i := 0
+	err = r.each(r.backup.RepeatIntervals, func() any { return new(RepeatInterval) },
+		     func(entry any) error {
+		ri := entry.(*RepeatInterval)
+		record := r.backup.RepeatIntervals[i]
+		i += 1
+		oldID := ri.ID
+		ri.ID = 0
+		ri.CashFlowID = r.cashFlows.mustGet(ri.CashFlowID)
+		err := r.create(ri)
+		r.repeatIntervals[oldID] = ri.ID
+		// Create stores RepeatsLeft of 0 as NULL (unlimited); version 1
+		// backups have no null, so there 0 is unlimited
+		if err == nil && ri.RepeatsLeft == 0 && r.backup.Version > 1 &&
+		   !record.isNull("repeats_left") {
+			err = r.db.Model(ri).Update("repeats_left", 0).Error
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		updates := map[string]interface{}{}
+		if ref.isTransfer && ref.categoryID > 0 {
+			updates["category_id"] = r.cashFlows.mustGet(ref.categoryID)
+		}
+		if ref.hasSplitFrom && ref.splitFrom > 0 {
+			updates["split_from"] = r.cashFlows.mustGet(ref.splitFrom)
+		}
+		if ref.repeatIntervalID > 0 {
+			// for applied CashFlows, is ID of origin ScheduledCashFlow
+			if ref.isScheduled {
+				updates["repeat_interval_id"] = r.repeatIntervals.mustGet(ref.repeatIntervalID)
+			} else {
+				updates["repeat_interval_id"] = r.cashFlows.mustGet(ref.repeatIntervalID)
+			}
+		}
+		if len(updates) == 0 {
+			continue
+		}
+		err = r.db.Model(&CashFlow{}).Where("id = ?", ref.id).
+			   Updates(updates).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *backupRestorer) restoreTaxes() error {
+	err := r.each(r.backup.TaxReturns, func() any { return new(TaxReturn) },
+		      func(entry any) error {
+		tr := entry.(*TaxReturn)
+		tr.ID = 0
+		tr.UserID = r.userID
+		return r.create(tr)
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.each(r.backup.TaxEntries, func() any { return new(TaxEntry) },
+		      func(entry any) error {
+		te := entry.(*TaxEntry)
+		te.ID = 0
+		te.UserID = r.userID
+		return r.create(te)
+	})
+}
+
+func (r *backupRestorer) restoreTags() error {
+	err := r.each(r.backup.Tags, func() any { return new(Tag) },
+		      func(entry any) error {
+		t := entry.(*Tag)
+		oldID := t.ID
+		t.ID = 0
+		t.UserID = r.userID
+		err := r.create(t)
+		r.tags[oldID] = t.ID
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = r.each(r.backup.CashFlowTags, func() any { return new(CashFlowTag) },
+		     func(entry any) error {
+		ct := entry.(*CashFlowTag)
+		ct.CashFlowID = r.cashFlows.mustGet(ct.CashFlowID)
+		ct.TagID = r.tags.mustGet(ct.TagID)
+		return r.create(ct)
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.each(r.backup.TradeTags, func() any { return new(TradeTag) },
+		      func(entry any) error {
+		tt := entry.(*TradeTag)
+		tt.TradeID = r.trades.mustGet(tt.TradeID)
+		tt.TagID = r.tags.mustGet(tt.TagID)
+		return r.create(tt)
+	})
+}
+
+// ImportRules, saved Searches and CsvProfiles
+func (r *backupRestorer) restoreSettings() error {
+	err := r.each(r.backup.ImportRules, func() any { return new(ImportRule) },
+		      func(entry any) error {
+		rule := entry.(*ImportRule)
+		rule.ID = 0
+		rule.UserID = r.userID
+		rule.AccountID = r.accounts.mustGet(rule.AccountID)
+		rule.CategoryID = r.categories.get(rule.CategoryID)
+		return r.create(rule)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = r.each(r.backup.Searches, func() any { return new(Search) },
+		     func(entry any) error {
+		s := entry.(*Search)
+		s.ID = 0
+		s.UserID = r.userID
+		s.AccountID = r.accounts.mustGet(s.AccountID)
+		s.CategoryID = r.categories.get(s.CategoryID)
+		s.TagID = r.tags.mustGet(s.TagID)
+		return r.create(s)
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.each(r.backup.CsvProfiles, func() any { return new(CsvProfile) },
+		      func(entry any) error {
+		p := entry.(*CsvProfile)
+		p.ID = 0
+		p.UserID = r.userID
+		p.AccountID = r.accounts.mustGet(p.AccountID)
+		return r.create(p)
+	})
+}
+
+func (r *backupRestorer) restoreSnapshots() error {
+	return r.each(r.backup.BalanceSnapshots, func() any { return new(BalanceSnapshot) },
+		      func(entry any) error {
+		bs := entry.(*BalanceSnapshot)
+		bs.ID = 0
+		bs.AccountID = r.accounts.mustGet(bs.AccountID)
+		bs.SecurityID = r.securities.mustGet(bs.SecurityID)
+		return r.create(bs)
+	})
+}
+
+// Restore Backup (JSON or ZIP) into User, who must not have any Accounts.
+// All IDs are remapped to newly created ones, and everything is restored
+// in a single transaction so that a failed Restore leaves nothing behind.
+func (b *Backup) Restore(session *Session, file HttpFile) error {
+	db := session.DB
+	u := session.GetUser()
+
+	err := b.read(file.FileData)
+	if err != nil {
+		log.Printf("[MODEL] RESTORE BACKUP FAILED: %v", err)
+		return errors.New("Invalid Backup File")
+	}
+	if b.Version < 1 || b.Version > backupVersion {
+		return errors.New("Unsupported Backup Version")
+	}
+
+	var numAccounts int64
+	db.Model(&Account{}).Where(&Account{UserID: u.ID}).Count(&numAccounts)
+	if numAccounts > 0 {
+		return errors.New("Restore Requires User Without Accounts")
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		r := &backupRestorer{db: tx, userID: u.ID, backup: b,
+				     categories: backupIDMap{},
+				     payees: backupIDMap{},
+				     accounts: backupIDMap{},
+				     imports: backupIDMap{},
+				     companies: backupIDMap{},
+				     securities: backupIDMap{},
+				     trades: backupIDMap{},
+				     cashFlows: backupIDMap{},
+				     repeatIntervals: backupIDMap{},
+				     tags: backupIDMap{}}
+		steps := []func() error{r.restoreCategories, r.restorePayees,
+					r.restoreAccounts, r.restoreImports,
+					r.restoreCompanies, r.restoreSecurities,
+					r.restoreTrades, r.restoreCashFlows,
+					r.restoreTaxes, r.restoreTags,
+					r.restoreSettings, r.restoreSnapshots}
+		for _, step := range steps {
+			err := step()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("[MODEL] RESTORE BACKUP FAILED: %v", err)
+		return err
+	}
+
+	log.Printf("[MODEL] RESTORE BACKUP USER(%d) FROM(%s) ACCOUNTS(%d) CASHFLOWS(%d) TRADES(%d)",
+		   u.ID, b.Login, len(b.Accounts), len(b.CashFlows), len(b.Trades))
+	return nil
+}
@@ -0,0 +1,297 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"log"
+	"time"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// A BalanceSnapshot records the cash Balance of an Account (SecurityID
+// is 0) or the Value of one of its Securities as of Date. Each Date of an
+// Account has the complete set of entries, so the Account's total as of
+// any date is the sum of entries of its most recent snapshot Date.
+type BalanceSnapshot struct {
+	Model
+	AccountID uint `gorm:"not null"`
+	SecurityID uint
+	Date time.Time
+	Shares decimal.Decimal
+	Balance decimal.Decimal
+}
+
+// NetWorth of User (or set of Accounts) as of Date, in the User's base
+// CurrencyType. Missing is number of Accounts without an ExchangeRate.
+type NetWorth struct {
+	Date time.Time
+	Cash decimal.Decimal
+	Investments decimal.Decimal
+	Missing int
+}
+
+// Chart.js draws poorly with too many points, so limit to this
+const maxNetWorthPoints int = 120
+
+func (nw NetWorth) Total() decimal.Decimal {
+	return nw.Cash.Add(nw.Investments)
+}
+
+func dateOnly(dx time.Time) time.Time {
+	year, month, day := dx.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+}
+
+// change to Account cash from Trade, same as used for Account.Balance
+func (t *Trade) cashAmount() decimal.Decimal {
+	c := t.toCashFlow(false)
+	if c == nil {
+		return decimal.Zero
+	}
+	return c.Amount
+}
+
+// change to Security shares from Trade, or for Split the new share count
+func (t *Trade) applyShares(shares decimal.Decimal) decimal.Decimal {
+	switch t.TradeTypeID {
+	case Buy, ReinvestedDividend, ReinvestedDistribution, SharesIn:
+		shares = shares.Add(t.Shares)
+	case Sell, SharesOut:
+		shares = shares.Sub(t.Shares)
+	case Split:
+		shares = shares.Mul(t.Shares)
+	}
+	return shares
+}
+
+// replace BalanceSnapshots of Account between from and to (inclusive)
+func (a *Account) writeSnapshots(db *gorm.DB, from time.Time, to time.Time,
+				 entries []BalanceSnapshot) {
+	db.Where("account_id = ? AND date >= ? AND date <= ?", a.ID, from, to).
+	   Delete(&BalanceSnapshot{})
+	if len(entries) > 0 {
+		db.Omit(clause.Associations).Create(&entries)
+	}
+}
+
+// Today's BalanceSnapshots for Account from current CashBalance and
+// Security.Values. Uses a.Securities if loaded, else the stored Values.
+func (a *Account) currentSnapshots(db *gorm.DB) []BalanceSnapshot {
+	today := dateOnly(time.Now())
+
+	// a.CashBalance may be stale if ScheduledCashFlows were just entered
+	var cashBalance decimal.Decimal
+	db.Model(&Account{}).Select("cash_balance").
+	   Where("id = ?", a.ID).Scan(&cashBalance)
+
+	securities := a.Securities
+	if securities == nil && a.IsInvestment() {
+		db.Where("shares > 0 AND account_id = ?", a.ID).Find(&securities)
+	}
+
+	entries := []BalanceSnapshot{{AccountID: a.ID, Date: today,
+				       Balance: cashBalance}}
+	for i := 0; i < len(securities); i++ {
+		s := &securities[i]
+		if s.Shares.IsZero() {
+			continue
+		}
+		entries = append(entries, BalanceSnapshot{AccountID: a.ID,
+							  SecurityID: s.ID,
+							  Date: today,
+							  Shares: s.Shares,
+							  Balance: s.Value})
+	}
+	return entries
+}
+
+// Record today's BalanceSnapshots for Account
+func (a *Account) recordSnapshot(db *gorm.DB) {
+	if !a.Verified {
+		return
+	}
+	today := dateOnly(time.Now())
+
+	entries := a.currentSnapshots(db)
+	a.writeSnapshots(db, today, today, entries)
+	log.Printf("[MODEL] ACCOUNT(%d) RECORD SNAPSHOT(%d) %s", a.ID,
+		   len(entries), dateToString(&today))
+}
+
+// Rebuild BalanceSnapshots for Account from its CashFlows and Trades, with
+// one snapshot for each date with activity. As no price history is stored,
+// past Security values use the price of the most recent Trade.
+func (a *Account) backfillSnapshots(db *gorm.DB) int {
+	var cash decimal.Decimal
+	if !a.Verified {
+		return 0
+	}
+	today := dateOnly(time.Now())
+	shares := map[uint]decimal.Decimal{}
+	prices := map[uint]decimal.Decimal{}
+	securityIDs := []uint{}
+	entries := []BalanceSnapshot{}
+
+	// only base CashFlows (not Split or Repeat) affect Account.Balance
+	cashFlows := []CashFlow{}
+	query := map[string]interface{}{"account_id": a.ID, "type": nil}
+	db.Select("date", "amount").Order("date asc").
+	   Where("date < ?", today).Find(&cashFlows, query)
+	trades := []Trade{}
+	db.Order("date asc").Where("date < ?", today).
+	   Where(&Trade{AccountID: a.ID}).Find(&trades)
+
+	i, j := 0, 0
+	for i < len(cashFlows) || j < len(trades) {
+		var date time.Time
+		if j == len(trades) ||
+		   (i < len(cashFlows) && !cashFlows[i].Date.After(trades[j].Date)) {
+			date = dateOnly(cashFlows[i].Date)
+		} else {
+			date = dateOnly(trades[j].Date)
+		}
+		nextDate := date.AddDate(0, 0, 1)
+
+		for ; i < len(cashFlows) && cashFlows[i].Date.Before(nextDate); i++ {
+			cash = cash.Add(cashFlows[i].Amount)
+		}
+		for ; j < len(trades) && trades[j].Date.Before(nextDate); j++ {
+			t := &trades[j]
+			cash = cash.Add(t.cashAmount())
+
+			held, found := shares[t.SecurityID]
+			if !found {
+				securityIDs = append(securityIDs, t.SecurityID)
+			}
+			shares[t.SecurityID] = t.applyShares(held)
+			if t.IsSplit() && !t.Shares.IsZero() {
+				prices[t.SecurityID] = prices[t.SecurityID].Div(t.Shares)
+			} else if t.Price.IsPositive() {
+				prices[t.SecurityID] = t.Price
+			}
+		}
+
+		entries = append(entries, BalanceSnapshot{AccountID: a.ID,
+							  Date: date,
+							  Balance: cash})
+		for _, id := range securityIDs {
+			if shares[id].IsZero() {
+				continue
+			}
+			entries = append(entries, BalanceSnapshot{AccountID: a.ID,
+								  SecurityID: id,
+								  Date: date,
+								  Shares: shares[id],
+								  Balance: shares[id].Mul(prices[id]).Round(2)})
+		}
+	}
+
+	a.writeSnapshots(db, time.Time{}, today.AddDate(0, 0, -1), entries)
+	log.Printf("[MODEL] ACCOUNT(%d) BACKFILL SNAPSHOTS(%d) FROM CASHFLOWS(%d) TRADES(%d)",
+		   a.ID, len(entries), len(cashFlows), len(trades))
+	a.recordSnapshot(db)
+	return len(entries)
+}
+
+// Rebuild BalanceSnapshots for all of User's Accounts
+func BackfillSnapshots(session *Session) int {
+	db := session.DB
+	count := 0
+
+	accounts := List(session, true)
+	for i := 0; i < len(accounts); i++ {
+		count += accounts[i].backfillSnapshots(db)
+	}
+	return count
+}
+
+// Dates for NetWorth history: days is number of days prior to today,
+// or if 0 then the current year to date.
+func netWorthDates(days int) []time.Time {
+	dates := []time.Time{}
+	end := dateOnly(time.Now())
+	start := end.AddDate(0, 0, -days)
+	if days <= 0 {
+		start = yearToDate(end.Year())
+		days = int(durationDays(end.Sub(start)))
+	}
+
+	step := (days + maxNetWorthPoints - 1) / maxNetWorthPoints
+	if step < 1 {
+		step = 1
+	}
+	for d := start; d.Before(end); d = d.AddDate(0, 0, step) {
+		dates = append(dates, d)
+	}
+	return append(dates, end)
+}
+
+// NetWorth history of accounts (access already verified by caller), for
+// days prior to today (0 for year to date). Nothing is written, so today
+// uses current balances, and earlier dates only the BalanceSnapshots
+// recorded by the record_snapshots Job or rebuilt by BackfillSnapshots.
+func ListNetWorth(session *Session, accounts []Account, days int) []NetWorth {
+	db := session.DB
+	baseCurrencyTypeID := session.GetUser().UserSettings.CurrencyTypeID
+	dates := netWorthDates(days)
+	entries := make([]NetWorth, len(dates))
+	for k := 0; k < len(dates); k++ {
+		entries[k].Date = dates[k]
+	}
+
+	for i := 0; i < len(accounts); i++ {
+		a := &accounts[i]
+		if !a.Verified {
+			continue
+		}
+
+		snapshots := []BalanceSnapshot{}
+		db.Order("date asc").Where("date < ?", dates[len(dates)-1]).
+		   Where(&BalanceSnapshot{AccountID: a.ID}).Find(&snapshots)
+		snapshots = append(snapshots, a.currentSnapshots(db)...)
+
+		// walk snapshots and dates together, using most recent
+		// snapshot Date which is on or before each date
+		var cash, investments decimal.Decimal
+		j := 0
+		for k := 0; k < len(dates); k++ {
+			for j < len(snapshots) && !snapshots[j].Date.After(dates[k]) {
+				cash = decimal.Zero
+				investments = decimal.Zero
+				snapshotDate := snapshots[j].Date
+				for ; j < len(snapshots) && snapshots[j].Date.Equal(snapshotDate); j++ {
+					if snapshots[j].SecurityID == 0 {
+						cash = cash.Add(snapshots[j].Balance)
+					} else {
+						investments = investments.Add(snapshots[j].Balance)
+					}
+				}
+			}
+
+			nw := &entries[k]
+			if cash.IsZero() && investments.IsZero() {
+				continue
+			}
+			baseCash, valid := convertCurrency(db, cash, a.CurrencyTypeID,
+							   baseCurrencyTypeID, dates[k])
+			if !valid {
+				nw.Missing += 1
+				continue
+			}
+			baseInvestments, _ := convertCurrency(db, investments, a.CurrencyTypeID,
+							      baseCurrencyTypeID, dates[k])
+			nw.Cash = nw.Cash.Add(baseCash)
+			nw.Investments = nw.Investments.Add(baseInvestments)
+		}
+	}
+
+	log.Printf("[MODEL] LIST NET WORTH ACCOUNTS(%d) DAYS(%d) POINTS(%d)",
+		   len(accounts), days, len(entries))
+	return entries
+}
@@ -38,11 +38,15 @@ type CashFlow struct {
 	SplitFrom uint
 	Split bool
 	Transfer bool
+	Cleared bool
+	Reconciled bool
 	CategoryName string `gorm:"-:all"`
 	Memo string `form:"memo"`
 	PayeeName string `form:"payee_name" gorm:"-:all"`
 	Transnum string `form:"transnum"`
 	Type string `gorm:"default:NULL"`
+	Tags []Tag `gorm:"-:all"`
+	tagNames *string
 	Account Account
 	Category Category
 	Payee Payee
@@ -56,8 +60,8 @@ func (c *CashFlow) sanitizeInputs() {
 	sanitizeString(&c.Transnum)
 }
 
-func (CashFlow) Currency(value decimal.Decimal) string {
-	return currency(value)
+func (c CashFlow) Currency(value decimal.Decimal) string {
+	return c.Account.Currency(value)
 }
 
 func (c CashFlow) GetTransnum() string {
@@ -67,6 +71,22 @@ func (c CashFlow) GetTransnum() string {
 	return c.Transnum
 }
 
+func (c CashFlow) GetTags() string {
+	return tagNames(c.Tags)
+}
+
+// Set Tags (comma separated names) to save with Create or Update
+func (c *CashFlow) SetTags(tags string) {
+	c.tagNames = &tags
+}
+
+func (c *CashFlow) saveTags(db *gorm.DB) {
+	if c.tagNames != nil {
+		c.Tags = saveCashFlowTags(db, c.Account.User.ID, c.ID, *c.tagNames)
+		c.tagNames = nil
+	}
+}
+
 func (c *CashFlow) IsCredit() bool {
 	return CashFlowTypeIsCredit(c.CashFlowTypeID)
 }
@@ -147,6 +167,20 @@ func (c CashFlow) ShowTradeLinks() bool {
 	return c.IsTrade()
 }
 
+// Reconciled CashFlows are locked from changes, which includes when
+// the Pair (other side of a Transfer) is reconciled.
+func (c *CashFlow) isLocked(db *gorm.DB) bool {
+	if c.Reconciled {
+		return true
+	}
+	if c.Transfer && c.PairID > 0 && !c.IsScheduled() {
+		pair := new(CashFlow)
+		db.Select("reconciled").First(&pair, c.PairID)
+		return pair.Reconciled
+	}
+	return false
+}
+
 func (c *CashFlow) mustUpdateBalance() bool {
 	// aka Base Type (!Split and !Repeat)
 	return (c.Type ==  "" || c.IsTrade())
@@ -408,7 +442,7 @@ func (c *CashFlow) ListSplit(db *gorm.DB) ([]CashFlow, string) {
 			total = total.Add(split.Amount)
 		}
 	}
-	return entries, currency(total)
+	return entries, c.Account.Currency(total)
 }
 
 func (u *User) listTaxCategory(db *gorm.DB, year int, taxCat *TaxCategory,
@@ -633,6 +667,15 @@ func (c *CashFlow) insertCashFlow(db *gorm.DB, importing bool) error {
 		log.Printf("[MODEL] INSERT CASHFLOW PERMISSION DENIED")
 		return errors.New("Permission Denied")
 	}
+	var rule *ImportRule
+	var err error
+	if importing {
+		rule, err = c.applyImportRules(db)
+		if err != nil {
+			log.Printf("[MODEL] INSERT CASHFLOW SKIPPED: %s", err)
+			return err
+		}
+	}
 	err, pair := c.prepareInsertCashFlow(db, importing)
 	if err == nil {
 		result := db.Omit(clause.Associations).Create(c)
@@ -655,7 +698,7 @@ func (c *CashFlow) insertCashFlow(db *gorm.DB, importing bool) error {
 	} else {
 		log.Printf("[MODEL] CREATE %s CASHFLOW(%d)", c.Type, c.ID)
 		spewModel(c)
-		c.Account.updateBalance(c)
+		c.Account.updateBalance(db, c)
 	}
 
 	// Create pair CashFlow if have one (Transfers)
@@ -674,9 +717,12 @@ func (c *CashFlow) insertCashFlow(db *gorm.DB, importing bool) error {
 		log.Printf("[MODEL] CREATE PAIR CASHFLOW(%d)", pair.ID)
 
 		pair.Account.ID = pair.AccountID
-		pair.Account.updateBalance(pair)
+		pair.Account.updateBalance(db, pair)
 	}
 
+	if rule != nil {
+		rule.createSplits(db, c)
+	}
 	return err
 }
 
@@ -774,20 +820,15 @@ func (c *CashFlow) updateSplits(db *gorm.DB, updates map[string]interface{}) {
 	}
 }
 
-func (repeat *CashFlow) getMonthlyRate(db *gorm.DB) decimal.Decimal {
-	repeat.PreloadRepeat(db)
-	if repeat.RepeatInterval.RepeatIntervalType.Days != 30 {
-		return decimal.Zero
-	}
+// Monthly rate from annual rate (percentage) for payment on date
+func monthlyRate(annualRate decimal.Decimal, date time.Time) decimal.Decimal {
 	debugRate := false
 
-	// returns decimal.Zero if not set
-	rate := repeat.RepeatInterval.Rate
-	rate = rate.Div(decimal.NewFromInt32(100))
+	rate := annualRate.Div(decimal.NewFromInt32(100))
 	simpleRate := rate.DivRound(decimal.NewFromInt32(12), 4)
 
 	// monthly rate depends on number of days in month
-	rateDate := repeat.Date
+	rateDate := date
 	if rateDate.Day() < 15 {
 		rateDate = rateDate.AddDate(0, -1, 0)
 	}
@@ -802,6 +843,16 @@ func (repeat *CashFlow) getMonthlyRate(db *gorm.DB) decimal.Decimal {
 	return rate
 }
 
+func (repeat *CashFlow) getMonthlyRate(db *gorm.DB) decimal.Decimal {
+	repeat.PreloadRepeat(db)
+	if repeat.RepeatInterval.RepeatIntervalType.Days != 30 {
+		return decimal.Zero
+	}
+
+	// returns decimal.Zero if not set
+	return monthlyRate(repeat.RepeatInterval.Rate, repeat.Date)
+}
+
 func (repeat *CashFlow) applyRate(db *gorm.DB) bool {
 	repeat.Category.ID = repeat.CategoryID
 	if !repeat.Category.IsInterestIncome() {
@@ -918,48 +969,58 @@ func (repeat *CashFlow) calculateLoanPI(db *gorm.DB) ([]CashFlow, bool) {
 	return splits, updateAmounts
 }
 
-// returns true if advanced date is still less than time.Now
-func (repeat *CashFlow) advance(db *gorm.DB, updateDB bool) (bool, int) {
-	days := repeat.RepeatInterval.advance(db)
-	if days == 0 {
-		return false, days
-	}
-
-	day_of_month := repeat.Date.Day()
-	if repeat.RepeatInterval.StartDay > 0 {
-		day_of_month = repeat.RepeatInterval.StartDay
+// Next Date of a ScheduledCashFlow repeating every days, starting from
+// date. startDay (if set) is the day of month to repeat on.
+func advanceDate(date time.Time, days int, startDay int) time.Time {
+	day_of_month := date.Day()
+	if startDay > 0 {
+		day_of_month = startDay
 	}
 
 	if days < 15 {
 		// weekly / bi-weekly
-		repeat.Date = repeat.Date.AddDate(0, 0, days)
+		date = date.AddDate(0, 0, days)
 	} else if days >= 30 {
 		// monthly, quarterly, annually, etc
 		months := days / 30
-		adjustedDate := repeat.Date.AddDate(0, months, day_of_month - repeat.Date.Day())
-		if  adjustedDate.Day() < repeat.Date.Day() {
+		adjustedDate := date.AddDate(0, months, day_of_month - date.Day())
+		if  adjustedDate.Day() < date.Day() {
 			// we overran into next month (less than 30/31 days)
 			adjustedDate = adjustedDate.AddDate(0, 0, -adjustedDate.Day())
 		}
-		repeat.Date = adjustedDate
+		date = adjustedDate
 	} else {
 		// semi-monthly, one of two halves should use day_of_month exactly
-		if repeat.Date.Day() <= 15 {
+		if date.Day() <= 15 {
 			// advance to 2nd half of month
-			adjustedDate := repeat.Date.AddDate(0, 0, 15)
-			if  adjustedDate.Day() < repeat.Date.Day() {
+			adjustedDate := date.AddDate(0, 0, 15)
+			if  adjustedDate.Day() < date.Day() {
 				// we overran into next month (less than 30/31 days)
 				adjustedDate = adjustedDate.AddDate(0, 0, -adjustedDate.Day())
 			}
-			repeat.Date = adjustedDate
+			date = adjustedDate
 		} else {
 			if day_of_month > 15 {
 				day_of_month -= 15
 			}
 			// advance to next month
-			repeat.Date = repeat.Date.AddDate(0, 1, day_of_month - repeat.Date.Day())
+			date = date.AddDate(0, 1, day_of_month - date.Day())
 		}
 	}
+	return date
+}
+
+// returns true if advanced date is still less than time.Now
+// Advance ScheduledCashFlow to its next Date. Returns if can repeat again
+// and if advanced; is not advanced if its Date was already advanced (in
+// database) by a concurrent Job or Session, and so must not be posted.
+func (repeat *CashFlow) advance(db *gorm.DB, updateDB bool) (bool, bool) {
+	date, advanced := repeat.RepeatInterval.advance(db, repeat.Date)
+	if date.IsZero() {
+		return false, advanced
+	}
+
+	repeat.Date = date
 	repeat.TaxYear = repeat.Date.Year()
 
 	if updateDB {
@@ -967,12 +1028,18 @@ func (repeat *CashFlow) advance(db *gorm.DB, updateDB bool) (bool, int) {
 		if !repeat.oldAmount.Equal(repeat.Amount) {
 			updates["amount"] = repeat.Amount
 		}
-		db.Omit(clause.Associations).Model(repeat).Updates(updates)
+		result := db.Omit(clause.Associations).Model(repeat).
+			     Where("date = ?", repeat.oldDate).Updates(updates)
+		if result.RowsAffected == 0 {
+			log.Printf("[MODEL] SCHEDULED CASHFLOW(%d) ALREADY ADVANCED",
+				   repeat.ID)
+			return false, false
+		}
 	}
 	log.Printf("[MODEL] ADVANCE SCHEDULED CASHFLOW(%d) to %s", repeat.ID,
 		   repeat.Date.Format("2006-01-02"))
 
-	return time.Now().After(repeat.Date), days
+	return time.Now().After(repeat.Date), true
 }
 
 func (c *CashFlow) isValidSplit() bool {
@@ -1031,6 +1098,18 @@ func (repeat *CashFlow) tryInsertRepeatCashFlow() (decimal.Decimal, error) {
 			}
 		}
 		c.cloneScheduled(repeat)
+
+		// advance Date in Repeat CashFlow before posting, so that same
+		// Date is never posted twice
+		canRepeat := false
+		if !c.Split {
+			var advanced bool
+			canRepeat, advanced = repeat.advance(db, updateDB)
+			if !advanced {
+				break
+			}
+		}
+
 		// update repeat.Account Balances so will have accurate Balance
 		// if loop and continue to insert additional repeat CashFlows
 		repeat.Account.Balance = repeat.Account.Balance.Add(c.Amount)
@@ -1039,6 +1118,9 @@ func (repeat *CashFlow) tryInsertRepeatCashFlow() (decimal.Decimal, error) {
 		if updateDB {
 			// add scheduled CashFlow
 			err = c.insertCashFlow(db, false)
+			if err == nil {
+				copyCashFlowTags(db, repeat.ID, c.ID)
+			}
 			if err != nil || c.Split {
 				break
 			}
@@ -1070,9 +1152,8 @@ func (repeat *CashFlow) tryInsertRepeatCashFlow() (decimal.Decimal, error) {
 			}
 		}
 
-		// advance Date in Repeat CashFlow and Splits, but reuse
-		// array of Splits we already queried
-		canRepeat,_ := repeat.advance(db, updateDB)
+		// advance Date in Splits, but reuse array of Splits we
+		// already queried
 		if updateDB && len(splits) > 0 {
 			updateSplits(db, splits, repeat.repeatUpdateMap(),
 				     newSplitAmounts)
@@ -1112,10 +1193,21 @@ func (c *CashFlow) Create(session *Session) error {
 	}
 
 	c.sanitizeInputs()
+	if c.IsScheduledParent() {
+		// move Date to first date of Recurrence Rule
+		date, err := c.RepeatInterval.applyRule(c.Date, true)
+		if err != nil {
+			return err
+		}
+		c.Date = date
+	}
 	// defaults for DB fields not set during Create (are Edit only)
 	c.setDefaults()
 
 	err := c.insertCashFlow(db, false)
+	if err == nil {
+		c.saveTags(db)
+	}
 	if err == nil && c.IsScheduledParent() {
 		_err := c.RepeatInterval.Create(db, c)
 		if _err != nil {
@@ -1156,6 +1248,7 @@ func (c *CashFlow) Get(session *Session, edit bool) *CashFlow {
 	if edit {
 		// some Preloads done above at start of Get()
 		c.Preload(db)
+		c.Tags = listCashFlowTags(db, c.ID)
 	} else {
 		if c.IsScheduled() {
 			c.PreloadRepeat(db)
@@ -1192,6 +1285,8 @@ func (c *CashFlow) delete(db *gorm.DB) {
 		   Update("split_from", gorm.Expr("split_from - ?", 1))
 
 		db.Delete(c)
+		db.Where("cash_flow_id = ?", c.ID).Delete(&CashFlowTag{})
+		deleteAttachments(db, &Attachment{CashFlowID: c.ID})
 		c.deleteTransfer(db)
 	} else {
 		log.Printf("[MODEL] DELETE CASHFLOW(%d)", c.ID)
@@ -1204,12 +1299,14 @@ func (c *CashFlow) delete(db *gorm.DB) {
 		}
 
 		db.Delete(c)
+		db.Where("cash_flow_id = ?", c.ID).Delete(&CashFlowTag{})
+		deleteAttachments(db, &Attachment{CashFlowID: c.ID})
 		c.deleteTransfer(db)
 
 		c.Account.ID = c.AccountID
 		c.Amount = decimal.Zero
 		// UpdateBalance will subtract c.oldAmount
-		c.Account.updateBalance(c)
+		c.Account.updateBalance(db, c)
 	}
 }
 
@@ -1220,6 +1317,9 @@ func (c *CashFlow) Delete(session *Session) error {
 	if c == nil {
 		return errors.New("Permission Denied")
 	}
+	if c.isLocked(db) {
+		return errors.New("CashFlow Reconciled")
+	}
 
 	c.delete(db)
 	return nil
@@ -1236,6 +1336,15 @@ func (c *CashFlow) Put(session *Session, request map[string]interface{}) error {
 	jrequest, _ := json.Marshal(request)
 	log.Printf("[MODEL] PUT CASHFLOW(%d) %s", c.ID, jrequest)
 
+	// other fields (and Reconciled) are only changed with Update
+	for key := range request {
+		switch key {
+		case "apply", "tags", "cleared", "amount":
+		default:
+			return errors.New("Invalid Request")
+		}
+	}
+
 	if request["apply"] != nil {
 		delete(request, "apply")
 		if c.IsScheduledEnterable(true) {
@@ -1244,9 +1353,27 @@ func (c *CashFlow) Put(session *Session, request map[string]interface{}) error {
 		}
 	}
 
+	// Tags can be changed even if CashFlow is Reconciled
+	if request["tags"] != nil {
+		c.SetTags(request["tags"].(string))
+		c.saveTags(db)
+		delete(request, "tags")
+	}
+	if len(request) > 0 && c.Reconciled {
+		return errors.New("CashFlow Reconciled")
+	}
+
+	if request["cleared"] != nil {
+		cleared, _ := strconv.ParseBool(request["cleared"].(string))
+		request["cleared"] = cleared
+	}
+
 	// special case c.Amount
 	// need better way if expanded with more fields/types
 	if request["amount"] != nil {
+		if c.isLocked(db) {
+			return errors.New("CashFlow Reconciled")
+		}
 		newAmount, _ := strconv.ParseFloat(request["amount"].(string), 2)
 		c.Amount = decimal.NewFromFloatWithExponent(newAmount, -2)
 		if c.Amount.Equal(c.oldAmount) {
@@ -1258,14 +1385,14 @@ func (c *CashFlow) Put(session *Session, request map[string]interface{}) error {
 				pair.pairFrom(c)
 				pair.Amount = c.Amount.Neg()
 				pair.Account.ID = pair.AccountID
-				pair.Account.updateBalance(pair)
+				pair.Account.updateBalance(db, pair)
 
 				// change type in map for db.Update to succeed
 				request["amount"] = pair.Amount
 				db.Omit(clause.Associations).Model(pair).Updates(request)
 			}
 
-			c.Account.updateBalance(c)
+			c.Account.updateBalance(db, c)
 			// change type in map for db.Update to succeed
 			request["amount"] = c.Amount
 		}
@@ -1284,11 +1411,22 @@ func (c *CashFlow) Update() error {
 	if !c.Account.Verified {
 		return errors.New("!Account.Verified")
 	}
+	// Tags can be changed even if CashFlow is Reconciled
+	c.saveTags(db)
+	if c.isLocked(db) {
+		return errors.New("CashFlow Reconciled")
+	}
 
 	c.sanitizeInputs()
 	if c.isSplitOrSplitPair() {
 		// don't let Splits mess with date
 		c.Date = c.oldDate
+	} else if c.IsScheduledParent() {
+		date, err := c.RepeatInterval.applyRule(c.Date, !c.Date.Equal(c.oldDate))
+		if err != nil {
+			return err
+		}
+		c.Date = date
 	}
 
 	err, pair := c.prepareInsertCashFlow(db, false)
@@ -1304,7 +1442,7 @@ func (c *CashFlow) Update() error {
 		} else {
 			log.Printf("[MODEL] UPDATE CASHFLOW(%d)", c.ID)
 			spewModel(c)
-			c.Account.updateBalance(c)
+			c.Account.updateBalance(db, c)
 			if c.HasSplits() {
 				c.updateSplits(db, c.splitUpdateMap())
 				// above also updates Pair.Date (Transfers)
@@ -1326,7 +1464,9 @@ func (c *CashFlow) Update() error {
 				   Update("CategoryID", pair.ID)
 				log.Printf("[MODEL] CREATE PAIR CASHFLOW(%d)", pair.ID)
 			} else {
-				db.Omit(clause.Associations, "type").Save(pair)
+				// pair is not queried, so preserve its cleared state
+				db.Omit(clause.Associations, "type", "cleared",
+					"reconciled").Save(pair)
 				log.Printf("[MODEL] UPDATE PAIR CASHFLOW(%d)", pair.ID)
 			}
 
@@ -1337,13 +1477,13 @@ func (c *CashFlow) Update() error {
 					newAccountUpdateAmount := pair.Amount
 					pair.Amount = decimal.Zero
 					pair.Account.ID = pair.oldAccountID
-					pair.Account.updateBalance(pair)
+					pair.Account.updateBalance(db, pair)
 
 					pair.oldAmount = decimal.Zero
 					pair.Amount = newAccountUpdateAmount
 				}
 				pair.Account.ID = pair.AccountID
-				pair.Account.updateBalance(pair)
+				pair.Account.updateBalance(db, pair)
 			}
 		}
 	}
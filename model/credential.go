@@ -0,0 +1,368 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+	"github.com/pacificbrian/go-bookkeeper/config"
+	"golang.org/x/crypto/scrypt"
+	"gorm.io/gorm/clause"
+)
+
+const vaultKeyFile string = "vault.key"
+const vaultSaltSize int = 16
+const vaultKeySize int = 32
+// wait for vault.key being written by another request
+const vaultKeyReadRetries int = 10
+const vaultKeyReadDelay = 50 * time.Millisecond
+
+// A Credential is a User's Username and Password for OFX Direct Connect
+// with an Institution, used by FetchOFX when none are entered. Credentials
+// for an Account are used before those for its Institution. Both are kept
+// only in Secret, sealed with AES-GCM using a key derived (scrypt, with
+// per-Credential salt) from the vault_passphrase setting, or else from the
+// vault.key file in the config directory.
+type Credential struct {
+	Model
+	UserID uint `gorm:"not null"`
+	InstitutionID uint `form:"credential.institution_id"`
+	AccountID uint `form:"credential.account_id"`
+	Username string `gorm:"-:all" form:"credential.Username"`
+	Password string `gorm:"-:all" form:"credential.Password"`
+	Secret string
+	CreatedOn time.Time
+	RotatedOn time.Time
+	Verified bool `gorm:"-:all"`
+	Account Account
+	Institution Institution
+}
+
+type credentialSecret struct {
+	Username string
+	Password string
+}
+
+func vaultKeyPath() string {
+	return filepath.Join(config.GetConfigDir("config"), vaultKeyFile)
+}
+
+// Master secret of vault, creating vault.key if no passphrase configured
+func vaultMasterSecret() ([]byte, error) {
+	passphrase := config.GlobalConfig().VaultPassphrase
+	if passphrase != "" {
+		return []byte(passphrase), nil
+	}
+
+	path := vaultKeyPath()
+	secret, err := os.ReadFile(path)
+	if err == nil {
+		if len(secret) == 0 {
+			return nil, errors.New("Invalid Vault Key File")
+		}
+		return secret, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	secret = make([]byte, vaultKeySize)
+	_, err = io.ReadFull(rand.Reader, secret)
+	if err != nil {
+		return nil, err
+	}
+	// O_EXCL so never replace key file created by another request
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			return readNewVaultKey(path)
+		}
+		return nil, err
+	}
+	_, err = file.Write(secret)
+	if err == nil {
+		err = file.Close()
+	} else {
+		file.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[MODEL] CREATE VAULT KEY(%s)", path)
+	return secret, nil
+}
+
+// Read vault.key just created by another request, which may not yet be
+// fully written
+func readNewVaultKey(path string) ([]byte, error) {
+	for i := 0; i < vaultKeyReadRetries; i++ {
+		secret, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(secret) >= vaultKeySize {
+			return secret, nil
+		}
+		time.Sleep(vaultKeyReadDelay)
+	}
+	return nil, errors.New("Invalid Vault Key File")
+}
+
+func VaultKeySource() string {
+	if config.GlobalConfig().VaultPassphrase != "" {
+		return "Passphrase"
+	}
+	return "Key File"
+}
+
+func vaultCipher(salt []byte) (cipher.AEAD, error) {
+	secret, err := vaultMasterSecret()
+	if err != nil {
+		return nil, err
+	}
+	key, err := scrypt.Key(secret, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Secret sealed to User, Institution and Account, so cannot be moved to
+// another User or used for another Institution or Account
+func (cr *Credential) additionalData() []byte {
+	return []byte(fmt.Sprintf("credential:%d:%d:%d", cr.UserID,
+				  cr.InstitutionID, cr.AccountID))
+}
+
+// set Secret (salt, nonce and ciphertext) from Username and Password
+func (cr *Credential) seal() error {
+	plaintext, err := json.Marshal(credentialSecret{Username: cr.Username,
+							Password: cr.Password})
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, vaultSaltSize)
+	_, err = io.ReadFull(rand.Reader, salt)
+	if err != nil {
+		return err
+	}
+	aead, err := vaultCipher(salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return err
+	}
+
+	sealed := append(salt, nonce...)
+	sealed = aead.Seal(sealed, nonce, plaintext, cr.additionalData())
+	cr.Secret = base64.StdEncoding.EncodeToString(sealed)
+	return nil
+}
+
+// set Username and Password from Secret
+func (cr *Credential) open() error {
+	sealed, err := base64.StdEncoding.DecodeString(cr.Secret)
+	if err != nil || len(sealed) < vaultSaltSize {
+		return errors.New("Invalid Credential")
+	}
+
+	aead, err := vaultCipher(sealed[:vaultSaltSize])
+	if err != nil {
+		return err
+	}
+	sealed = sealed[vaultSaltSize:]
+	if len(sealed) < aead.NonceSize() {
+		return errors.New("Invalid Credential")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()],
+				    sealed[aead.NonceSize():], cr.additionalData())
+	if err != nil {
+		return errors.New("Invalid Vault Key")
+	}
+
+	secret := credentialSecret{}
+	err = json.Unmarshal(plaintext, &secret)
+	if err != nil {
+		return errors.New("Invalid Credential")
+	}
+	cr.Username = secret.Username
+	cr.Password = secret.Password
+	return nil
+}
+
+// List User's Credentials (without Username or Password)
+func (*Credential) List(session *Session) []Credential {
+	entries := []Credential{}
+	u := session.GetUser()
+	if u == nil {
+		return entries
+	}
+
+	session.DB.Preload("Account").Preload("Institution").
+	  Order("institution_id").Order("account_id").
+	  Where(&Credential{UserID: u.ID}).Find(&entries)
+	log.Printf("[MODEL] LIST CREDENTIALS(%d)", len(entries))
+	return entries
+}
+
+func (cr *Credential) HaveAccessPermission(session *Session) bool {
+	u := session.GetUser()
+	cr.Verified = !(u == nil || u.ID != cr.UserID)
+	return cr.Verified
+}
+
+func (cr *Credential) Get(session *Session) *Credential {
+	db := session.DB
+	if cr.ID > 0 {
+		db.Preload("Account").Preload("Institution").First(&cr)
+	}
+	// Verify we have access to Credential
+	if !cr.HaveAccessPermission(session) {
+		return nil
+	}
+	return cr
+}
+
+// Decrypt Credential, setting Username and Password
+func (cr *Credential) Open(session *Session) error {
+	// Verify we have access to Credential
+	if !cr.Verified && cr.Get(session) == nil {
+		return errors.New("Permission Denied")
+	}
+	return cr.open()
+}
+
+// Credential for Account, else for Account's Institution
+func (*Credential) ForAccount(session *Session, a *Account) *Credential {
+	u := session.GetUser()
+	if u == nil || !a.Verified || a.InstitutionID == 0 {
+		return nil
+	}
+	db := session.DB
+
+	entries := []Credential{}
+	db.Where("user_id = ? AND institution_id = ? AND account_id IN (0, ?)",
+		 u.ID, a.InstitutionID, a.ID).
+	   Order("account_id desc").Limit(1).Find(&entries)
+	if len(entries) == 0 {
+		return nil
+	}
+	cr := &entries[0]
+	cr.Verified = true
+	return cr
+}
+
+// Save (Add or Rotate) Credential for User, sealing Username and Password.
+// Rotating keeps the Credential's Institution and Account.
+func (cr *Credential) Save(session *Session) error {
+	u := session.GetUser()
+	if u == nil {
+		return errors.New("Permission Denied")
+	}
+	db := session.DB
+	sanitizeString(&cr.Username)
+
+	if cr.Username == "" {
+		return errors.New("Invalid Username")
+	}
+	if cr.Password == "" {
+		return errors.New("Invalid Password")
+	}
+
+	if cr.ID > 0 {
+		old := new(Credential)
+		old.ID = cr.ID
+		if old.Get(session) == nil {
+			return errors.New("Permission Denied")
+		}
+		cr.InstitutionID = old.InstitutionID
+		cr.AccountID = old.AccountID
+		cr.CreatedOn = old.CreatedOn
+	} else {
+		if cr.AccountID > 0 {
+			a := new(Account)
+			a.ID = cr.AccountID
+			if a.Get(session, false) == nil {
+				return errors.New("Permission Denied")
+			}
+			cr.InstitutionID = a.InstitutionID
+		}
+		if cr.InstitutionID == 0 {
+			return errors.New("No OFX Institution")
+		}
+
+		var count int64
+		db.Model(&Credential{}).
+		   Where(&Credential{UserID: u.ID, InstitutionID: cr.InstitutionID}).
+		   Where("account_id = ?", cr.AccountID).Count(&count)
+		if count > 0 {
+			return errors.New("Credential Exists, Rotate Instead")
+		}
+		cr.CreatedOn = time.Now()
+	}
+
+	cr.UserID = u.ID
+	err := cr.seal()
+	if err != nil {
+		return err
+	}
+	cr.RotatedOn = time.Now()
+
+	result := db.Omit(clause.Associations).Save(cr)
+	log.Printf("[MODEL] SAVE CREDENTIAL(%d) INSTITUTION(%d) ACCOUNT(%d)",
+		   cr.ID, cr.InstitutionID, cr.AccountID)
+	cr.Password = ""
+	return result.Error
+}
+
+func (cr *Credential) Delete(session *Session) error {
+	// Verify we have access to Credential
+	cr = cr.Get(session)
+	if cr == nil {
+		return errors.New("Permission Denied")
+	}
+	db := session.DB
+
+	log.Printf("[MODEL] DELETE CREDENTIAL(%d)", cr.ID)
+	db.Delete(cr)
+	return nil
+}
+
+// set Import's Username and Password from stored Credential
+func (im *Import) useCredential(session *Session) error {
+	cr := new(Credential).ForAccount(session, &im.Account)
+	if cr == nil {
+		return errors.New("No Stored Credential")
+	}
+
+	err := cr.Open(session)
+	if err != nil {
+		return err
+	}
+	log.Printf("[MODEL] IMPORT USING CREDENTIAL(%d)", cr.ID)
+	im.Username = cr.Username
+	im.Password = cr.Password
+	return nil
+}
@@ -0,0 +1,259 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	CurrencyTypeUSD uint = 1
+)
+
+// ExchangeRate.Rate is value of one unit of CurrencyType in USD (the
+// currency of CurrencyTypeUSD). Conversion between other currencies is
+// done through USD.
+type ExchangeRate struct {
+	Model
+	CurrencyTypeID uint `form:"currency_type_id"`
+	Date time.Time
+	Rate decimal.Decimal
+	CurrencyType CurrencyType
+}
+
+var currencyTypes map[uint]CurrencyType
+var currencyTypesOnce sync.Once
+
+func loadCurrencyTypes() {
+	db := getDbManager()
+	entries := new(CurrencyType).List(db)
+
+	currencyTypes = map[uint]CurrencyType{}
+	for i := 0; i < len(entries); i++ {
+		currencyTypes[entries[i].ID] = entries[i]
+	}
+	log.Printf("[MODEL] LOAD CURRENCY TYPES(%d)", len(currencyTypes))
+}
+
+func getCurrencyType(currencyTypeID uint) CurrencyType {
+	currencyTypesOnce.Do(loadCurrencyTypes)
+	if currencyTypeID == 0 {
+		currencyTypeID = CurrencyTypeUSD
+	}
+	return currencyTypes[currencyTypeID]
+}
+
+func currencyTypeGetByName(name string) *CurrencyType {
+	currencyTypesOnce.Do(loadCurrencyTypes)
+	name = strings.ToUpper(strings.TrimSpace(name))
+	for _, ct := range currencyTypes {
+		if ct.Name == name {
+			return &ct
+		}
+	}
+	return nil
+}
+
+func (ct CurrencyType) GetSymbol() string {
+	symbol := ct.Symbol
+	if symbol == "" {
+		symbol = ct.Name
+	}
+	if symbol == "" {
+		return "$"
+	}
+
+	// separate alphabetic symbols (CHF, kr) from the amount
+	last := []rune(symbol)
+	if unicode.IsLetter(last[len(last)-1]) {
+		symbol += " "
+	}
+	return symbol
+}
+
+func currencyFormat(value decimal.Decimal, currencyTypeID uint) string {
+	return getCurrencyType(currencyTypeID).GetSymbol() + value.StringFixedBank(2)
+}
+
+func (ExchangeRate) Currency(value decimal.Decimal) string {
+	return currencyFormat(value, CurrencyTypeUSD)
+}
+
+// Returns most recent Rate on or before date for currencyTypeID.
+func exchangeRate(db *gorm.DB, currencyTypeID uint, date time.Time) (decimal.Decimal, bool) {
+	if currencyTypeID == 0 || currencyTypeID == CurrencyTypeUSD {
+		return decimal.NewFromInt(1), true
+	}
+
+	rate := new(ExchangeRate)
+	db.Order("date desc").Where("date <= ?", date).
+	   Where(&ExchangeRate{CurrencyTypeID: currencyTypeID}).First(&rate)
+	if rate.ID == 0 || !rate.Rate.IsPositive() {
+		return decimal.Zero, false
+	}
+	return rate.Rate, true
+}
+
+// Convert amount from one CurrencyType to another using ExchangeRates
+// as of date. Returns false if no ExchangeRate is found.
+func convertCurrency(db *gorm.DB, amount decimal.Decimal, from uint, to uint,
+		     date time.Time) (decimal.Decimal, bool) {
+	if from == 0 {
+		from = CurrencyTypeUSD
+	}
+	if to == 0 {
+		to = CurrencyTypeUSD
+	}
+	if from == to {
+		return amount, true
+	}
+
+	fromRate, valid := exchangeRate(db, from, date)
+	if !valid {
+		return decimal.Zero, false
+	}
+	toRate, valid := exchangeRate(db, to, date)
+	if !valid {
+		return decimal.Zero, false
+	}
+	return amount.Mul(fromRate).DivRound(toRate, 2), true
+}
+
+func (*ExchangeRate) List(db *gorm.DB) []ExchangeRate {
+	entries := []ExchangeRate{}
+	db.Preload("CurrencyType").Order("date desc").
+	   Order("currency_type_id").Find(&entries)
+	return entries
+}
+
+func (r *ExchangeRate) validateInputs() error {
+	if r.CurrencyTypeID == 0 || r.CurrencyTypeID == CurrencyTypeUSD ||
+	   getCurrencyType(r.CurrencyTypeID).ID == 0 {
+		return errors.New("Invalid CurrencyType")
+	}
+	if !r.Rate.IsPositive() || r.Date.IsZero() {
+		return errors.New("Invalid ExchangeRate")
+	}
+	return nil
+}
+
+// Create or replace the ExchangeRate for CurrencyType and Date. Rates are
+// shared by all Users, so only the administrator can change them.
+func (r *ExchangeRate) Create(session *Session) error {
+	db := session.DB
+	u := session.GetUser()
+	if u == nil || !u.IsAdmin() {
+		return errors.New("Permission Denied")
+	}
+	err := r.validateInputs()
+	if err != nil {
+		return err
+	}
+
+	old := new(ExchangeRate)
+	db.Where("date = ?", r.Date).
+	   Where(&ExchangeRate{CurrencyTypeID: r.CurrencyTypeID}).First(&old)
+	r.ID = old.ID
+
+	result := db.Omit(clause.Associations).Save(r)
+	log.Printf("[MODEL] CREATE EXCHANGE RATE(%d) CURRENCY(%d) %s (%f)",
+		   r.ID, r.CurrencyTypeID, dateToString(&r.Date),
+		   r.Rate.InexactFloat64())
+	return result.Error
+}
+
+// Import ExchangeRates from file with lines of: date,currency,rate
+// such as "2024-01-31,EUR,1.0823". Lines beginning with # are ignored.
+func ImportExchangeRates(session *Session, importFile HttpFile) (int, error) {
+	count := 0
+	lineNum := 0
+
+	scanner := bufio.NewScanner(importFile.FileData)
+	for scanner.Scan() {
+		lineNum += 1
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		if len(fields) != 3 {
+			return count, errors.New(fmt.Sprintf("[MODEL] IMPORT [%s:%d]: invalid line",
+							      importFile.FileName, lineNum))
+		}
+		date, err := time.ParseInLocation("2006-01-02",
+						  strings.TrimSpace(fields[0]), time.Local)
+		if err != nil {
+			// skip header line
+			if lineNum == 1 {
+				continue
+			}
+			return count, errors.New(fmt.Sprintf("[MODEL] IMPORT [%s:%d]: error: %v",
+							      importFile.FileName, lineNum, err))
+		}
+		ct := currencyTypeGetByName(fields[1])
+		if ct == nil {
+			return count, errors.New(fmt.Sprintf("[MODEL] IMPORT [%s:%d]: unknown currency (%s)",
+							      importFile.FileName, lineNum, fields[1]))
+		}
+		rate, err := decimal.NewFromString(strings.TrimSpace(fields[2]))
+		if err != nil {
+			return count, errors.New(fmt.Sprintf("[MODEL] IMPORT [%s:%d]: error: %v",
+							      importFile.FileName, lineNum, err))
+		}
+
+		r := new(ExchangeRate)
+		r.CurrencyTypeID = ct.ID
+		r.Date = date
+		r.Rate = rate
+		err = r.Create(session)
+		if err != nil {
+			return count, err
+		}
+		count += 1
+	}
+
+	log.Printf("[MODEL] IMPORT EXCHANGE RATES [%s] (%d)", importFile.FileName, count)
+	return count, scanner.Err()
+}
+
+// Account Balances converted to the User's base CurrencyType using
+// ExchangeRates as of date. Returns total of converted Balances and
+// the number of Accounts which could not be converted (no ExchangeRate).
+func TotalAccounts(session *Session, accounts []Account, date time.Time) (decimal.Decimal, int) {
+	var total decimal.Decimal
+	db := session.DB
+	missing := 0
+	baseCurrencyTypeID := session.GetUser().UserSettings.CurrencyTypeID
+
+	for i := 0; i < len(accounts); i++ {
+		a := &accounts[i]
+		balance, valid := convertCurrency(db, a.Balance, a.CurrencyTypeID,
+						  baseCurrencyTypeID, date)
+		if !valid {
+			missing += 1
+			continue
+		}
+		a.BaseBalance = balance
+		a.BaseCurrencyTypeID = baseCurrencyTypeID
+		total = total.Add(balance)
+	}
+
+	log.Printf("[MODEL] TOTAL ACCOUNTS(%d) CURRENCY(%d) %s MISSING(%d)",
+		   len(accounts), baseCurrencyTypeID, dateToString(&date), missing)
+	return total, missing
+}
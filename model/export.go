@@ -0,0 +1,583 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/aclindsa/ofxgo"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const (
+	ExportQIF string = "qif"
+	ExportOFX string = "ofx"
+	ExportBeancount string = "beancount"
+	ExportLedger string = "ledger"
+)
+
+// An Export writes the CashFlows and Trades of an Account (or of all
+// Accounts if AccountID is 0) between StartDate and EndDate to a QIF or
+// OFX file, or to a Beancount or ledger-cli journal. A zero StartDate
+// exports from the first transaction, and a zero EndDate exports through
+// today.
+type Export struct {
+	AccountID uint
+	Format string
+	StartDate time.Time
+	EndDate time.Time
+	accounts []Account
+}
+
+// CashFlows and Trades of an Account being exported
+type exportAccount struct {
+	account *Account
+	cashFlows []CashFlow
+	trades []Trade
+}
+
+func (e *Export) sanitizeInputs() {
+	e.Format = strings.ToLower(strings.TrimSpace(e.Format))
+	if e.EndDate.IsZero() {
+		e.EndDate = time.Now()
+	}
+	if !e.StartDate.IsZero() {
+		e.StartDate = dateOnly(e.StartDate)
+	}
+	e.EndDate = dateOnly(e.EndDate)
+}
+
+func (e *Export) validateInputs() error {
+	if e.Format != ExportQIF && e.Format != ExportOFX &&
+	   e.Format != ExportBeancount && e.Format != ExportLedger {
+		return errors.New("Invalid Export Format")
+	}
+	if !e.StartDate.IsZero() && e.StartDate.After(e.EndDate) {
+		return errors.New("Invalid Date Range")
+	}
+	return nil
+}
+
+func (e *Export) FileName() string {
+	name := "accounts"
+	if e.AccountID > 0 && len(e.accounts) == 1 {
+		name = strings.ReplaceAll(strings.TrimSpace(e.accounts[0].Name), " ", "_")
+	}
+	return fmt.Sprintf("%s_%s.%s", name, e.EndDate.Format("20060102"), e.Format)
+}
+
+func (e *Export) ContentType() string {
+	switch e.Format {
+	case ExportOFX:
+		return "application/x-ofx"
+	case ExportBeancount, ExportLedger:
+		return "text/plain"
+	}
+	return "application/qif"
+}
+
+// Load and verify access to Accounts being exported
+func (e *Export) loadAccounts(session *Session) error {
+	if e.AccountID > 0 {
+		a := new(Account)
+		a.ID = e.AccountID
+		if a.Get(session, false) == nil {
+			return errors.New("Permission Denied")
+		}
+		e.accounts = []Account{*a}
+	} else {
+		e.accounts = List(session, true)
+	}
+	if len(e.accounts) == 0 {
+		return errors.New("No Accounts to Export")
+	}
+	return nil
+}
+
+func (e *Export) dateQuery(db *gorm.DB) *gorm.DB {
+	if !e.StartDate.IsZero() {
+		db = db.Where("date >= ?", e.StartDate)
+	}
+	return db.Where("date < ?", e.EndDate.AddDate(0, 0, 1))
+}
+
+// Account access already verified by caller
+func (e *Export) listAccount(db *gorm.DB, a *Account) *exportAccount {
+	ea := &exportAccount{account: a}
+
+	// use map to support NULL string (excludes Splits, Scheduled)
+	query := map[string]interface{}{"account_id": a.ID, "type": nil}
+	e.dateQuery(db).Order("date").Order("id").
+	  Preload("Payee").Preload("Category").Find(&ea.cashFlows, query)
+	for i := 0; i < len(ea.cashFlows); i++ {
+		c := &ea.cashFlows[i]
+		c.postQueryInit(false)
+		c.Account.cloneVerified(a)
+		c.Preload(db)
+	}
+
+	if a.IsInvestment() {
+		e.dateQuery(db).Order("date").Order("id").
+		  Preload("Security.Company").
+		  Where(&Trade{AccountID: a.ID}).Find(&ea.trades)
+	}
+	log.Printf("[MODEL] EXPORT ACCOUNT(%d) CASHFLOWS(%d) TRADES(%d)",
+		   a.ID, len(ea.cashFlows), len(ea.trades))
+	return ea
+}
+
+// Write Accounts as QIF, OFX or journal
+func (e *Export) Write(session *Session, w io.Writer) error {
+	e.sanitizeInputs()
+	err := e.validateInputs()
+	if err != nil {
+		return err
+	}
+	err = e.loadAccounts(session)
+	if err != nil {
+		return err
+	}
+
+	entries := []*exportAccount{}
+	for i := 0; i < len(e.accounts); i++ {
+		entries = append(entries, e.listAccount(session.DB, &e.accounts[i]))
+	}
+
+	switch e.Format {
+	case ExportOFX:
+		err = e.writeOFX(session, w, entries)
+	case ExportBeancount, ExportLedger:
+		err = e.writeJournal(session, w, entries)
+	default:
+		err = e.writeQIF(w, entries)
+	}
+	log.Printf("[MODEL] EXPORT %s ACCOUNTS(%d)", strings.ToUpper(e.Format), len(entries))
+	return err
+}
+
+func qifAccountType(a *Account) string {
+	switch a.AccountTypeID {
+	case AccountTypeCash:
+		return "Cash"
+	case AccountTypeCreditCard:
+		return "CCard"
+	case AccountTypeInvestment, AccountTypeCrypto:
+		return "Invst"
+	case AccountTypeLoan:
+		return "Oth L"
+	case AccountTypeAsset, AccountTypeHealthCare:
+		return "Oth A"
+	}
+	return "Bank"
+}
+
+// QIF category of CashFlow: category name, or [Account] for Transfers
+func (c *CashFlow) qifCategory() string {
+	if c.Transfer {
+		return "[" + c.PayeeName + "]"
+	}
+	if c.HasSplits() {
+		return ""
+	}
+	return c.CategoryName
+}
+
+func (c *CashFlow) qifCleared() string {
+	if c.Reconciled {
+		return "X"
+	} else if c.Cleared {
+		return "*"
+	}
+	return ""
+}
+
+type qifWriter struct {
+	w io.Writer
+	err error
+}
+
+func (q *qifWriter) line(code string, value string) {
+	if q.err != nil || (value == "" && code != "^" && code[0] != '!') {
+		return
+	}
+	value = strings.ReplaceAll(value, "\n", " ")
+	_, q.err = fmt.Fprintf(q.w, "%s%s\n", code, value)
+}
+
+func qifDate(date time.Time) string {
+	return date.Format("01/02/2006")
+}
+
+func (e *Export) writeQIF(w io.Writer, entries []*exportAccount) error {
+	q := &qifWriter{w: w}
+	db := getDbManager()
+
+	for _, ea := range entries {
+		a := ea.account
+		qifType := qifAccountType(a)
+		q.line("!Account", "")
+		q.line("N", a.Name)
+		q.line("T", qifType)
+		q.line("^", "")
+		q.line("!Type:", qifType)
+
+		if qifType == "Invst" {
+			ea.writeQIFInvestment(q)
+			continue
+		}
+		for i := 0; i < len(ea.cashFlows); i++ {
+			c := &ea.cashFlows[i]
+			q.line("D", qifDate(c.Date))
+			q.line("T", c.Amount.StringFixed(2))
+			q.line("C", c.qifCleared())
+			q.line("N", c.Transnum)
+			if !c.Transfer {
+				q.line("P", c.PayeeName)
+			}
+			q.line("M", c.Memo)
+			q.line("L", c.qifCategory())
+			if c.HasSplits() {
+				splits, _ := c.ListSplit(db)
+				for j := 0; j < len(splits); j++ {
+					split := &splits[j]
+					q.line("S", split.qifCategory())
+					if split.Memo != c.Memo {
+						q.line("E", split.Memo)
+					}
+					q.line("$", split.Amount.StringFixed(2))
+				}
+			}
+			q.line("^", "")
+		}
+	}
+	return q.err
+}
+
+// Investment Account CashFlows and Trades merged by date
+func (ea *exportAccount) writeQIFInvestment(q *qifWriter) {
+	i := 0
+	j := 0
+	for i < len(ea.cashFlows) || j < len(ea.trades) {
+		if j == len(ea.trades) ||
+		   (i < len(ea.cashFlows) && !ea.cashFlows[i].Date.After(ea.trades[j].Date)) {
+			c := &ea.cashFlows[i]
+			action := "MiscInc"
+			if c.Transfer && c.Amount.IsNegative() {
+				action = "XOut"
+			} else if c.Transfer {
+				action = "XIn"
+			} else if c.Amount.IsNegative() {
+				action = "MiscExp"
+			}
+			q.line("D", qifDate(c.Date))
+			q.line("N", action)
+			q.line("P", c.PayeeName)
+			q.line("T", c.Amount.Abs().StringFixed(2))
+			q.line("C", c.qifCleared())
+			q.line("M", c.Memo)
+			q.line("L", c.qifCategory())
+			if c.Transfer {
+				q.line("$", c.Amount.Abs().StringFixed(2))
+			}
+			q.line("^", "")
+			i++
+		} else {
+			t := &ea.trades[j]
+			q.line("D", qifDate(t.Date))
+			q.line("N", string(tradeTypeToAction(t.TradeTypeID)))
+			q.line("Y", t.Security.Company.GetName())
+			if !t.Price.IsZero() {
+				q.line("I", t.Price.String())
+			}
+			if !t.Shares.IsZero() {
+				q.line("Q", t.Shares.String())
+			}
+			if !t.Amount.IsZero() {
+				q.line("T", t.Amount.StringFixed(2))
+				q.line("U", t.Amount.StringFixed(2))
+			}
+			q.line("^", "")
+			j++
+		}
+	}
+}
+
+func amountToOFX(value decimal.Decimal) ofxgo.Amount {
+	var amount ofxgo.Amount
+	amount.SetString(value.String())
+	return amount
+}
+
+func currencyToOFX(currencyTypeID uint) ofxgo.CurrSymbol {
+	symbol, err := ofxgo.NewCurrSymbol(getCurrencyType(currencyTypeID).Name)
+	if err != nil {
+		symbol, _ = ofxgo.NewCurrSymbol("USD")
+	}
+	return *symbol
+}
+
+// truncate to OFX limit on NAME
+func nameToOFX(name string) ofxgo.String {
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	return ofxgo.String(name)
+}
+
+func (c *CashFlow) makeTransactionOFX() ofxgo.Transaction {
+	tran := ofxgo.Transaction{DtPosted: ofxgo.Date{Time: c.Date},
+				  TrnAmt: amountToOFX(c.Amount),
+				  FiTID: ofxgo.String(strconv.Itoa(int(c.ID))),
+				  Name: nameToOFX(c.PayeeName),
+				  Memo: ofxgo.String(c.Memo)}
+	_, err := strconv.Atoi(c.Transnum)
+	switch {
+	case c.Transfer:
+		tran.TrnType = ofxgo.TrnTypeXfer
+	case err == nil && c.IsDebit():
+		tran.TrnType = ofxgo.TrnTypeCheck
+		tran.CheckNum = ofxgo.String(c.Transnum)
+	case c.IsDebit():
+		tran.TrnType = ofxgo.TrnTypeDebit
+	default:
+		tran.TrnType = ofxgo.TrnTypeCredit
+	}
+	return tran
+}
+
+func securityIDToOFX(s *Security) ofxgo.SecurityID {
+	if s.ImportName != "" {
+		return ofxgo.SecurityID{UniqueID: ofxgo.String(s.ImportName),
+					UniqueIDType: "CUSIP"}
+	}
+	return ofxgo.SecurityID{UniqueID: ofxgo.String(s.Company.Symbol),
+				UniqueIDType: "TICKER"}
+}
+
+// Returns nil if TradeType not supported
+func (t *Trade) makeInvTransactionOFX(currency ofxgo.Currency) ofxgo.InvTransaction {
+	invTran := ofxgo.InvTran{FiTID: ofxgo.String("T" + strconv.Itoa(int(t.ID))),
+				 DtTrade: ofxgo.Date{Time: t.Date}}
+	secID := securityIDToOFX(&t.Security)
+
+	switch t.TradeTypeID {
+	case Buy:
+		buy := ofxgo.InvBuy{InvTran: invTran, SecID: secID,
+				    Units: amountToOFX(t.Shares),
+				    UnitPrice: amountToOFX(t.Price),
+				    Total: amountToOFX(t.Amount.Neg()),
+				    Currency: currency, OrigCurrency: currency,
+				    SubAcctSec: ofxgo.SubAcctTypeCash,
+				    SubAcctFund: ofxgo.SubAcctTypeCash}
+		return ofxgo.BuyStock{InvBuy: buy, BuyType: ofxgo.BuyTypeBuy}
+	case Sell:
+		sell := ofxgo.InvSell{InvTran: invTran, SecID: secID,
+				      Units: amountToOFX(t.Shares.Neg()),
+				      UnitPrice: amountToOFX(t.Price),
+				      Total: amountToOFX(t.Amount),
+				      Currency: currency, OrigCurrency: currency,
+				      SubAcctSec: ofxgo.SubAcctTypeCash,
+				      SubAcctFund: ofxgo.SubAcctTypeCash}
+		return ofxgo.SellStock{InvSell: sell, SellType: ofxgo.SellTypeSell}
+	case Dividend, Distribution:
+		income := ofxgo.Income{InvTran: invTran, SecID: secID,
+				       IncomeType: ofxgo.IncomeTypeDiv,
+				       Total: amountToOFX(t.Amount),
+				       Currency: currency, OrigCurrency: currency,
+				       SubAcctSec: ofxgo.SubAcctTypeCash,
+				       SubAcctFund: ofxgo.SubAcctTypeCash}
+		if t.TradeTypeID == Distribution {
+			income.IncomeType = ofxgo.IncomeTypeCGLong
+		}
+		return income
+	case ReinvestedDividend, ReinvestedDistribution:
+		reinvest := ofxgo.Reinvest{InvTran: invTran, SecID: secID,
+					   IncomeType: ofxgo.IncomeTypeDiv,
+					   Total: amountToOFX(t.Amount.Neg()),
+					   Units: amountToOFX(t.Shares),
+					   UnitPrice: amountToOFX(t.Price),
+					   Currency: currency, OrigCurrency: currency,
+					   SubAcctSec: ofxgo.SubAcctTypeCash}
+		if t.TradeTypeID == ReinvestedDistribution {
+			reinvest.IncomeType = ofxgo.IncomeTypeCGLong
+		}
+		return reinvest
+	case SharesIn, SharesOut:
+		transfer := ofxgo.Transfer{InvTran: invTran, SecID: secID,
+					   Units: amountToOFX(t.Shares),
+					   UnitPrice: amountToOFX(t.Price),
+					   TferAction: ofxgo.TferActionIn,
+					   PosType: ofxgo.PosTypeLong,
+					   SubAcctSec: ofxgo.SubAcctTypeCash}
+		if t.TradeTypeID == SharesOut {
+			transfer.TferAction = ofxgo.TferActionOut
+			transfer.Units = amountToOFX(t.Shares.Neg())
+		}
+		return transfer
+	case Split:
+		// Shares of Split is the ratio of new to old shares
+		ratio := t.Shares.Rat()
+		if !ratio.Num().IsInt64() || !ratio.Denom().IsInt64() {
+			return nil
+		}
+		return ofxgo.Split{InvTran: invTran, SecID: secID,
+				   SubAcctSec: ofxgo.SubAcctTypeCash,
+				   Currency: currency, OrigCurrency: currency,
+				   Numerator: ofxgo.Int(ratio.Num().Int64()),
+				   Denominator: ofxgo.Int(ratio.Denom().Int64())}
+	}
+	return nil
+}
+
+// Balance of Account as of end of Export (current Balance less later
+// CashFlows)
+func (e *Export) balanceOf(db *gorm.DB, a *Account) decimal.Decimal {
+	var later decimal.NullDecimal
+	query := map[string]interface{}{"account_id": a.ID, "type": nil}
+	db.Model(&CashFlow{}).Select("SUM(amount)").
+	   Where("date >= ?", e.EndDate.AddDate(0, 0, 1)).
+	   Where(query).Scan(&later)
+	return a.Balance.Sub(later.Decimal)
+}
+
+func (e *Export) writeOFX(session *Session, w io.Writer, entries []*exportAccount) error {
+	db := session.DB
+	dtStart := ofxgo.Date{Time: e.StartDate}
+	dtEnd := ofxgo.Date{Time: e.EndDate}
+	status := ofxgo.Status{Code: 0, Severity: "INFO"}
+	resp := ofxgo.Response{Version: ofxgo.OfxVersion203,
+			       Signon: ofxgo.SignonResponse{Status: status,
+							    DtServer: ofxgo.Date{Time: time.Now()},
+							    Language: "ENG"}}
+
+	if len(e.accounts) == 1 && e.accounts[0].InstitutionID > 0 {
+		inst := new(Institution)
+		db.First(inst, e.accounts[0].InstitutionID)
+		resp.Signon.Org = ofxgo.String(inst.FiOrg)
+		if inst.FiId > 0 {
+			resp.Signon.Fid = ofxgo.String(strconv.Itoa(int(inst.FiId)))
+		}
+	}
+	if e.StartDate.IsZero() {
+		for _, ea := range entries {
+			if len(ea.cashFlows) > 0 &&
+			   (dtStart.IsZero() || ea.cashFlows[0].Date.Before(dtStart.Time)) {
+				dtStart.Time = ea.cashFlows[0].Date
+			}
+			if len(ea.trades) > 0 &&
+			   (dtStart.IsZero() || ea.trades[0].Date.Before(dtStart.Time)) {
+				dtStart.Time = ea.trades[0].Date
+			}
+		}
+		if dtStart.IsZero() {
+			dtStart = dtEnd
+		}
+	}
+
+	// Securities in order first traded
+	securities := []*Security{}
+	traded := map[uint]bool{}
+	for _, ea := range entries {
+		a := ea.account
+		uid, err := ofxgo.RandomUID()
+		if err != nil {
+			return err
+		}
+		currency := currencyToOFX(a.CurrencyTypeID)
+		acctID := ofxgo.String(a.Number)
+		if acctID == "" {
+			acctID = ofxgo.String(strconv.Itoa(int(a.ID)))
+		}
+		bankTranList := &ofxgo.TransactionList{DtStart: dtStart, DtEnd: dtEnd}
+		for i := 0; i < len(ea.cashFlows); i++ {
+			bankTranList.Transactions = append(bankTranList.Transactions,
+							   ea.cashFlows[i].makeTransactionOFX())
+		}
+
+		switch a.AccountTypeID {
+		case AccountTypeCreditCard:
+			stmt := ofxgo.CCStatementResponse{TrnUID: *uid, Status: status,
+							  CurDef: currency,
+							  CCAcctFrom: ofxgo.CCAcct{AcctID: acctID},
+							  BankTranList: bankTranList,
+							  BalAmt: amountToOFX(e.balanceOf(db, a)),
+							  DtAsOf: dtEnd}
+			resp.CreditCard = append(resp.CreditCard, &stmt)
+		case AccountTypeInvestment, AccountTypeCrypto:
+			currencyOFX := ofxgo.Currency{CurRate: amountToOFX(decimal.NewFromInt(1)),
+						      CurSym: currency}
+			tranList := &ofxgo.InvTranList{DtStart: dtStart, DtEnd: dtEnd}
+			for i := 0; i < len(ea.trades); i++ {
+				t := &ea.trades[i]
+				tran := t.makeInvTransactionOFX(currencyOFX)
+				if tran == nil {
+					continue
+				}
+				tranList.InvTransactions = append(tranList.InvTransactions, tran)
+				if !traded[t.SecurityID] {
+					traded[t.SecurityID] = true
+					securities = append(securities, &t.Security)
+				}
+			}
+			if len(bankTranList.Transactions) > 0 {
+				tranList.BankTransactions = []ofxgo.InvBankTransaction{
+					{Transactions: bankTranList.Transactions,
+					 SubAcctFund: ofxgo.SubAcctTypeCash}}
+			}
+			stmt := ofxgo.InvStatementResponse{TrnUID: *uid, Status: status,
+							   DtAsOf: dtEnd, CurDef: currency,
+							   InvAcctFrom: ofxgo.InvAcct{BrokerID: resp.Signon.Org,
+										      AcctID: acctID},
+							   InvTranList: tranList}
+			resp.InvStmt = append(resp.InvStmt, &stmt)
+		default:
+			acctType := ofxgo.AcctTypeChecking
+			if a.AccountTypeID == AccountTypeLoan {
+				acctType = ofxgo.AcctTypeCreditLine
+			}
+			// OFX requires a BANKID, use zeros if Routing unknown
+			bankID := "000000000"
+			if a.Routing > 0 {
+				bankID = strconv.Itoa(a.Routing)
+			}
+			stmt := ofxgo.StatementResponse{TrnUID: *uid, Status: status,
+							CurDef: currency,
+							BankAcctFrom: ofxgo.BankAcct{BankID: ofxgo.String(bankID),
+										     AcctID: acctID,
+										     AcctType: acctType},
+							BankTranList: bankTranList,
+							BalAmt: amountToOFX(e.balanceOf(db, a)),
+							DtAsOf: dtEnd}
+			resp.Bank = append(resp.Bank, &stmt)
+		}
+	}
+
+	if len(securities) > 0 {
+		secList := ofxgo.SecurityList{}
+		for _, s := range securities {
+			info := ofxgo.SecInfo{SecID: securityIDToOFX(s),
+					      SecName: ofxgo.String(s.Company.GetName()),
+					      Ticker: ofxgo.String(s.Company.Symbol)}
+			secList.Securities = append(secList.Securities,
+						    ofxgo.StockInfo{SecInfo: info})
+		}
+		resp.SecList = append(resp.SecList, &secList)
+	}
+
+	b, err := resp.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = b.WriteTo(w)
+	return err
+}
@@ -0,0 +1,766 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Journal (Beancount, ledger-cli) account names used for Trades and
+// for balancing entries without a Category
+const (
+	journalDividends string = "Income:Investments:Dividends"
+	journalDistributions string = "Income:Investments:Distributions"
+	journalCapitalGains string = "Income:Investments:Capital-Gains"
+	journalOpening string = "Equity:Opening-Balances"
+	journalTransfers string = "Equity:Transfers"
+	journalIncome string = "Income:Uncategorized"
+	journalExpenses string = "Expenses:Uncategorized"
+)
+
+// An open lot of a Security, labeled with the Buy it came from. Cost is
+// the total cost of the remaining Shares.
+type journalLot struct {
+	label string
+	date time.Time
+	commodity string
+	shares decimal.Decimal
+	cost decimal.Decimal
+	currency string
+}
+
+type journalPosting struct {
+	account string
+	amount decimal.Decimal
+	commodity string
+	// no amount, is computed by Beancount/ledger to balance
+	noAmount bool
+	// units of Security with cost basis (lot), augmenting or reducing
+	lot *journalLot
+	reduce bool
+	// per unit price of Sell (informational)
+	price decimal.Decimal
+	// total price when converting between currencies
+	total decimal.Decimal
+	totalCommodity string
+}
+
+type journalEntry struct {
+	date time.Time
+	cleared bool
+	payee string
+	narration string
+	postings []journalPosting
+	// postings are balance assertions (amount is balance)
+	balance bool
+}
+
+type journalWriter struct {
+	db *gorm.DB
+	accounts map[uint]*Account
+	exported []*Account
+	categories map[uint]*Category
+	lots map[uint][]*journalLot
+	commodities map[string]string
+	commodityOrder []string
+	entries []*journalEntry
+}
+
+// Beancount requires components to start with capital letter or digit,
+// and contain only letters, digits and dashes.
+func journalComponent(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range name {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if dash && b.Len() > 0 {
+				b.WriteRune('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	component := b.String()
+	if component == "" {
+		return ""
+	}
+	return strings.ToUpper(component[:1]) + component[1:]
+}
+
+func journalAccountName(root string, name string) string {
+	components := []string{root}
+	for _, part := range strings.Split(name, ":") {
+		component := journalComponent(part)
+		if component != "" {
+			components = append(components, component)
+		}
+	}
+	if len(components) == 1 {
+		components = append(components, "Uncategorized")
+	}
+	return strings.Join(components, ":")
+}
+
+func (j *journalWriter) accountName(a *Account) string {
+	root := "Assets"
+	if a.AccountTypeID == AccountTypeCreditCard || a.AccountTypeID == AccountTypeLoan {
+		root = "Liabilities"
+	}
+	return journalAccountName(root, a.Name)
+}
+
+func (j *journalWriter) currency(a *Account) string {
+	name := getCurrencyType(a.CurrencyTypeID).Name
+	if name == "" {
+		name = "USD"
+	}
+	return name
+}
+
+// Income or Expense account of Category (by CategoryType)
+func (j *journalWriter) categoryName(categoryID uint, amount decimal.Decimal) string {
+	category := j.categories[categoryID]
+	if category == nil || journalComponent(category.Name) == "" {
+		if amount.IsPositive() {
+			return journalIncome
+		}
+		return journalExpenses
+	}
+	// CategoryType 2 is Income
+	if category.CategoryTypeID == 2 {
+		return journalAccountName("Income", category.Name)
+	}
+	return journalAccountName("Expenses", category.Name)
+}
+
+// Beancount commodities are uppercase letters, digits and ' . _ -,
+// starting with a letter and ending with letter or digit.
+func (j *journalWriter) commodity(s *Security) string {
+	symbol := strings.ToUpper(s.Company.Symbol)
+	if symbol == "" {
+		symbol = strings.ToUpper(journalComponent(s.Company.Name))
+	}
+	symbol = strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') ||
+		   r == '.' || r == '_' || r == '-' {
+			return r
+		}
+		return -1
+	}, symbol)
+	symbol = strings.TrimRight(symbol, "._-")
+	if len(symbol) > 24 {
+		symbol = strings.TrimRight(symbol[:24], "._-")
+	}
+	if len(symbol) < 2 || symbol[0] < 'A' || symbol[0] > 'Z' {
+		symbol = "S" + symbol + strconv.Itoa(int(s.ID))
+	}
+
+	if _, found := j.commodities[symbol]; !found {
+		j.commodities[symbol] = s.Company.GetName()
+		j.commodityOrder = append(j.commodityOrder, symbol)
+	}
+	return symbol
+}
+
+func (j *journalWriter) add(entry *journalEntry) {
+	entry.date = dateOnly(entry.date)
+	j.entries = append(j.entries, entry)
+}
+
+func (c *CashFlow) journalNarration() string {
+	return strings.ReplaceAll(c.Memo, "\n", " ")
+}
+
+// Postings of Transfer to own and to other Account, with the other
+// converted to own currency if they differ
+func (j *journalWriter) transferPosting(a *Account, c *CashFlow) (journalPosting, journalPosting) {
+	own := journalPosting{account: j.accountName(a), amount: c.Amount,
+			      commodity: j.currency(a)}
+	other := j.accounts[c.PayeeID]
+	if other == nil {
+		return own, journalPosting{account: journalTransfers,
+					   amount: c.Amount.Neg(),
+					   commodity: own.commodity}
+	}
+
+	pair := journalPosting{account: j.accountName(other),
+			       amount: c.Amount.Neg(),
+			       commodity: j.currency(other)}
+	if pair.commodity != own.commodity {
+		pairFlow := new(CashFlow)
+		j.db.Select("amount").First(pairFlow, c.PairID)
+		pair.amount = pairFlow.Amount
+		pair.total = c.Amount.Abs()
+		pair.totalCommodity = own.commodity
+	}
+	return own, pair
+}
+
+// Is Transfer written from the other Account instead
+func (j *journalWriter) skipTransfer(c *CashFlow, exported map[uint]bool) bool {
+	if !exported[c.PayeeID] {
+		return false
+	}
+	// Pair is a Split, so written with its parent CashFlow
+	if c.SplitFrom > 0 {
+		return true
+	}
+	return c.ID > c.PairID
+}
+
+func (j *journalWriter) addCashFlow(a *Account, c *CashFlow, exported map[uint]bool) {
+	entry := &journalEntry{date: c.Date, cleared: c.Cleared || c.Reconciled,
+			       narration: c.journalNarration()}
+	if c.Transfer {
+		if j.skipTransfer(c, exported) {
+			return
+		}
+		own, pair := j.transferPosting(a, c)
+		entry.narration = strings.TrimSpace("Transfer " + entry.narration)
+		entry.postings = []journalPosting{own, pair}
+		j.add(entry)
+		return
+	}
+
+	entry.payee = c.PayeeName
+	entry.postings = []journalPosting{{account: j.accountName(a),
+					   amount: c.Amount,
+					   commodity: j.currency(a)}}
+	if !c.HasSplits() {
+		entry.postings = append(entry.postings,
+					journalPosting{account: j.categoryName(c.CategoryID, c.Amount),
+						       amount: c.Amount.Neg(),
+						       commodity: j.currency(a)})
+		j.add(entry)
+		return
+	}
+
+	remaining := c.Amount
+	splits, _ := c.ListSplit(j.db)
+	for i := 0; i < len(splits); i++ {
+		split := &splits[i]
+		if split.Transfer {
+			_, pair := j.transferPosting(a, split)
+			entry.postings = append(entry.postings, pair)
+		} else {
+			entry.postings = append(entry.postings,
+						journalPosting{account: j.categoryName(split.CategoryID, split.Amount),
+							       amount: split.Amount.Neg(),
+							       commodity: j.currency(a)})
+		}
+		remaining = remaining.Sub(split.Amount)
+	}
+	if !remaining.IsZero() {
+		entry.postings = append(entry.postings,
+					journalPosting{account: j.categoryName(0, remaining),
+						       amount: remaining.Neg(),
+						       commodity: j.currency(a)})
+	}
+	j.add(entry)
+}
+
+// Reduce open lots of Security, first from those of the TradeGains (of
+// a Sell), then oldest first. Returns postings of the reduced lots.
+func (j *journalWriter) reduceLots(account string, commodity string,
+				   t *Trade, shares decimal.Decimal) []journalPosting {
+	postings := []journalPosting{}
+	lots := j.lots[t.SecurityID]
+
+	take := func(lot *journalLot, want decimal.Decimal) {
+		if !want.IsPositive() || !lot.shares.IsPositive() {
+			return
+		}
+		units := decimal.Min(want, lot.shares)
+		cost := lot.cost.Mul(units).Div(lot.shares).Round(2)
+		if units.Equal(lot.shares) {
+			cost = lot.cost
+		}
+		reduced := *lot
+		reduced.shares = units
+		reduced.cost = cost
+		postings = append(postings, journalPosting{account: account,
+							   amount: units.Neg(),
+							   commodity: commodity,
+							   lot: &reduced,
+							   reduce: true})
+		lot.shares = lot.shares.Sub(units)
+		lot.cost = lot.cost.Sub(cost)
+		shares = shares.Sub(units)
+	}
+
+	for i := 0; i < len(t.TradeGains); i++ {
+		g := &t.TradeGains[i]
+		label := "T" + strconv.Itoa(int(g.BuyID))
+		for _, lot := range lots {
+			if lot.label == label {
+				take(lot, decimal.Min(g.Shares, shares))
+			}
+		}
+	}
+	for _, lot := range lots {
+		take(lot, shares)
+	}
+	if shares.IsPositive() {
+		log.Printf("[MODEL] EXPORT TRADE(%d) MISSING SHARES(%s)",
+			   t.ID, shares.String())
+	}
+
+	open := []*journalLot{}
+	for _, lot := range lots {
+		if lot.shares.IsPositive() {
+			open = append(open, lot)
+		}
+	}
+	j.lots[t.SecurityID] = open
+	return postings
+}
+
+func (j *journalWriter) augmentLot(account string, commodity string, currency string,
+				   t *Trade, shares decimal.Decimal, cost decimal.Decimal) journalPosting {
+	lot := &journalLot{label: "T" + strconv.Itoa(int(t.ID)),
+			   date: dateOnly(t.Date), commodity: commodity,
+			   shares: shares, cost: cost, currency: currency}
+	j.lots[t.SecurityID] = append(j.lots[t.SecurityID], lot)
+	added := *lot
+	return journalPosting{account: account, amount: shares,
+			      commodity: commodity, lot: &added}
+}
+
+// Apply Trade to open lots, and if emit then add entry for it
+func (j *journalWriter) addTrade(a *Account, t *Trade, emit bool) {
+	account := j.accountName(a)
+	currency := j.currency(a)
+	commodity := j.commodity(&t.Security)
+	entry := &journalEntry{date: t.Date, cleared: true,
+			       payee: t.Security.Company.GetName()}
+	cash := t.cashAmount()
+	cost := t.Amount
+	if cost.IsZero() {
+		cost = t.Shares.Mul(t.Price).Round(2)
+	}
+
+	switch t.TradeTypeID {
+	case Buy:
+		entry.narration = "Buy"
+		entry.postings = []journalPosting{
+			j.augmentLot(account, commodity, currency, t, t.Shares, cost),
+			{account: account, amount: cash, commodity: currency}}
+	case Sell:
+		entry.narration = "Sell"
+		entry.postings = j.reduceLots(account, commodity, t, t.Shares)
+		for i := 0; i < len(entry.postings); i++ {
+			entry.postings[i].price = t.Price
+		}
+		entry.postings = append(entry.postings,
+					journalPosting{account: account, amount: cash,
+						       commodity: currency},
+					journalPosting{account: journalCapitalGains,
+						       noAmount: true})
+	case Dividend, Distribution, ReinvestedDividend, ReinvestedDistribution:
+		income := journalDividends
+		entry.narration = "Dividend"
+		if TradeTypeIsDistribution(t.TradeTypeID) {
+			income = journalDistributions
+			entry.narration = "Distribution"
+		}
+		if t.IsReinvest() {
+			entry.narration = "Reinvested " + entry.narration
+			entry.postings = []journalPosting{
+				j.augmentLot(account, commodity, currency, t, t.Shares, cost)}
+		} else {
+			entry.postings = []journalPosting{{account: account, amount: cash,
+							   commodity: currency}}
+		}
+		entry.postings = append(entry.postings,
+					journalPosting{account: income, amount: t.Amount.Neg(),
+						       commodity: currency})
+	case SharesIn:
+		entry.narration = "Shares In"
+		entry.postings = []journalPosting{
+			j.augmentLot(account, commodity, currency, t, t.Shares, cost),
+			{account: journalTransfers, noAmount: true}}
+	case SharesOut:
+		entry.narration = "Shares Out"
+		entry.postings = append(j.reduceLots(account, commodity, t, t.Shares),
+					journalPosting{account: journalTransfers, noAmount: true})
+	case Split:
+		// replace each open lot with split adjusted one of same cost
+		ratio := t.Shares
+		if ratio.IsNegative() {
+			ratio = decimal.NewFromInt(1).Div(ratio.Abs())
+		}
+		if ratio.IsZero() {
+			return
+		}
+		entry.narration = "Split " + t.Shares.String()
+		for _, lot := range j.lots[t.SecurityID] {
+			reduced := *lot
+			entry.postings = append(entry.postings,
+						journalPosting{account: account,
+							       amount: lot.shares.Neg(),
+							       commodity: commodity,
+							       lot: &reduced, reduce: true})
+			lot.shares = lot.shares.Mul(ratio)
+			added := *lot
+			entry.postings = append(entry.postings,
+						journalPosting{account: account,
+							       amount: lot.shares,
+							       commodity: commodity,
+							       lot: &added})
+		}
+	default:
+		return
+	}
+
+	if emit && len(entry.postings) > 0 {
+		j.add(entry)
+	}
+}
+
+// Opening balance of Account as of date: cash, and open lots of its
+// Securities (after Trades prior to date are applied)
+func (j *journalWriter) addOpening(a *Account, date time.Time, securityIDs []uint) {
+	var cash decimal.Decimal
+	cashFlows := []CashFlow{}
+	query := map[string]interface{}{"account_id": a.ID, "type": nil}
+	j.db.Select("amount").Where("date < ?", date).Find(&cashFlows, query)
+	for i := 0; i < len(cashFlows); i++ {
+		cash = cash.Add(cashFlows[i].Amount)
+	}
+	trades := []Trade{}
+	j.db.Where("date < ?", date).Where(&Trade{AccountID: a.ID}).Find(&trades)
+	for i := 0; i < len(trades); i++ {
+		cash = cash.Add(trades[i].cashAmount())
+	}
+
+	entry := &journalEntry{date: date, cleared: true,
+			       narration: "Opening Balance"}
+	if !cash.IsZero() {
+		entry.postings = append(entry.postings,
+					journalPosting{account: j.accountName(a),
+						       amount: cash,
+						       commodity: j.currency(a)})
+	}
+	for _, id := range securityIDs {
+		for _, lot := range j.lots[id] {
+			opened := *lot
+			entry.postings = append(entry.postings,
+						journalPosting{account: j.accountName(a),
+							       amount: lot.shares,
+							       commodity: lot.commodity,
+							       lot: &opened})
+		}
+	}
+	if len(entry.postings) == 0 {
+		return
+	}
+	entry.postings = append(entry.postings,
+				journalPosting{account: journalOpening, noAmount: true})
+	j.add(entry)
+}
+
+
+// Add Trades of Account up to EndDate, and its CashFlows. Trades prior
+// to StartDate only update the open lots used for the opening balance.
+func (j *journalWriter) addAccount(e *Export, ea *exportAccount, exported map[uint]bool) {
+	a := ea.account
+	trades := []Trade{}
+	if a.IsInvestment() {
+		j.db.Order("date").Order("id").
+		     Where("date < ?", e.EndDate.AddDate(0, 0, 1)).
+		     Preload("Security.Company").Preload("TradeGains").
+		     Where(&Trade{AccountID: a.ID}).Find(&trades)
+	}
+
+	i := 0
+	securityIDs := []uint{}
+	for ; i < len(trades) && trades[i].Date.Before(e.StartDate); i++ {
+		t := &trades[i]
+		if _, found := j.lots[t.SecurityID]; !found {
+			securityIDs = append(securityIDs, t.SecurityID)
+		}
+		j.addTrade(a, t, false)
+	}
+	if !e.StartDate.IsZero() {
+		j.addOpening(a, e.StartDate, securityIDs)
+	}
+	for ; i < len(trades); i++ {
+		j.addTrade(a, &trades[i], true)
+	}
+
+	for k := 0; k < len(ea.cashFlows); k++ {
+		j.addCashFlow(a, &ea.cashFlows[k], exported)
+	}
+}
+
+func endOfMonth(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month() + 1, 0, 0, 0, 0, 0, time.Local)
+}
+
+// Sort entries by date, and add balance assertions of exported Accounts
+// at each month end through endDate (after entries of that date)
+func (j *journalWriter) addBalances(endDate time.Time) {
+	sort.SliceStable(j.entries, func(x, y int) bool {
+		return j.entries[x].date.Before(j.entries[y].date)
+	})
+	if len(j.entries) == 0 {
+		return
+	}
+
+	balances := map[string]decimal.Decimal{}
+	entries := []*journalEntry{}
+	monthEnd := endOfMonth(j.entries[0].date)
+	addBalance := func() {
+		entry := &journalEntry{date: monthEnd, balance: true}
+		for _, a := range j.exported {
+			name := j.accountName(a)
+			currency := j.currency(a)
+			entry.postings = append(entry.postings,
+						journalPosting{account: name,
+							       amount: balances[name + " " + currency],
+							       commodity: currency})
+		}
+		entries = append(entries, entry)
+		monthEnd = endOfMonth(monthEnd.AddDate(0, 0, 1))
+	}
+
+	for _, entry := range j.entries {
+		for entry.date.After(monthEnd) {
+			addBalance()
+		}
+		for _, p := range entry.postings {
+			if p.lot == nil && !p.noAmount {
+				key := p.account + " " + p.commodity
+				balances[key] = balances[key].Add(p.amount)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	for !monthEnd.After(endDate) {
+		addBalance()
+	}
+	j.entries = entries
+}
+
+// shares of Security as is, currency amounts with cents
+func (p *journalPosting) units() string {
+	if p.lot != nil {
+		return p.amount.String()
+	}
+	return p.amount.StringFixed(2)
+}
+
+// Beancount strings are double quoted, with \ escapes
+func beancountString(value string) string {
+	value = strings.ReplaceAll(value, "\\", "\\\\")
+	return "\"" + strings.ReplaceAll(value, "\"", "\\\"") + "\""
+}
+
+func (p *journalPosting) beancount() string {
+	if p.noAmount {
+		return "  " + p.account
+	}
+	line := fmt.Sprintf("  %s  %s %s", p.account, p.units(), p.commodity)
+	if p.lot != nil && p.reduce {
+		line += fmt.Sprintf(" {%s, %s}", p.lot.date.Format("2006-01-02"),
+				    beancountString(p.lot.label))
+		if p.price.IsPositive() {
+			line += fmt.Sprintf(" @ %s %s", p.price.String(), p.lot.currency)
+		}
+	} else if p.lot != nil {
+		line += fmt.Sprintf(" {{%s %s, %s, %s}}", p.lot.cost.StringFixed(2),
+				    p.lot.currency, p.lot.date.Format("2006-01-02"),
+				    beancountString(p.lot.label))
+	} else if p.totalCommodity != "" {
+		line += fmt.Sprintf(" @@ %s %s", p.total.StringFixed(2), p.totalCommodity)
+	}
+	return line
+}
+
+// ledger-cli requires commodities other than letters be quoted
+func ledgerCommodity(commodity string) string {
+	for _, r := range commodity {
+		if !unicode.IsLetter(r) {
+			return "\"" + commodity + "\""
+		}
+	}
+	return commodity
+}
+
+func (p *journalPosting) ledger() string {
+	if p.noAmount {
+		return "    " + p.account
+	}
+	line := fmt.Sprintf("    %s  %s %s", p.account, p.units(),
+			    ledgerCommodity(p.commodity))
+	if p.lot != nil {
+		line += fmt.Sprintf(" {{%s %s}} [%s] (%s)", p.lot.cost.StringFixed(2),
+				    ledgerCommodity(p.lot.currency),
+				    p.lot.date.Format("2006/01/02"), p.lot.label)
+	} else if p.totalCommodity != "" {
+		line += fmt.Sprintf(" @@ %s %s", p.total.StringFixed(2),
+				    ledgerCommodity(p.totalCommodity))
+	}
+	return line
+}
+
+// names of Accounts in postings, sorted
+func (j *journalWriter) accountNames() []string {
+	used := map[string]bool{}
+	names := []string{}
+	for _, entry := range j.entries {
+		for _, p := range entry.postings {
+			if !used[p.account] {
+				used[p.account] = true
+				names = append(names, p.account)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (j *journalWriter) writeBeancount(w io.Writer, baseCurrency string) error {
+	lines := []string{fmt.Sprintf("option \"operating_currency\" %s",
+				      beancountString(baseCurrency)), ""}
+	openDate := time.Now()
+	if len(j.entries) > 0 {
+		openDate = j.entries[0].date
+	}
+	for _, symbol := range j.commodityOrder {
+		lines = append(lines,
+			       fmt.Sprintf("%s commodity %s", openDate.Format("2006-01-02"), symbol),
+			       fmt.Sprintf("  name: %s", beancountString(j.commodities[symbol])))
+	}
+	for _, name := range j.accountNames() {
+		lines = append(lines,
+			       fmt.Sprintf("%s open %s", openDate.Format("2006-01-02"), name))
+	}
+
+	for _, entry := range j.entries {
+		lines = append(lines, "")
+		if entry.balance {
+			// Beancount balance is as of start of date
+			date := entry.date.AddDate(0, 0, 1).Format("2006-01-02")
+			for _, p := range entry.postings {
+				lines = append(lines,
+					       fmt.Sprintf("%s balance %s  %s %s", date, p.account,
+							   p.amount.StringFixed(2), p.commodity))
+			}
+			continue
+		}
+
+		flag := "!"
+		if entry.cleared {
+			flag = "*"
+		}
+		header := fmt.Sprintf("%s %s", entry.date.Format("2006-01-02"), flag)
+		if entry.payee != "" {
+			header += " " + beancountString(entry.payee)
+		}
+		lines = append(lines, header + " " + beancountString(entry.narration))
+		for i := 0; i < len(entry.postings); i++ {
+			lines = append(lines, entry.postings[i].beancount())
+		}
+	}
+
+	_, err := io.WriteString(w, strings.Join(lines, "\n") + "\n")
+	return err
+}
+
+func (j *journalWriter) writeLedger(w io.Writer) error {
+	lines := []string{}
+	for _, symbol := range j.commodityOrder {
+		lines = append(lines, "commodity " + ledgerCommodity(symbol),
+			       "    note " + strings.ReplaceAll(j.commodities[symbol], "\n", " "))
+	}
+	for _, name := range j.accountNames() {
+		lines = append(lines, "account " + name)
+	}
+
+	for _, entry := range j.entries {
+		lines = append(lines, "")
+		date := entry.date.Format("2006/01/02")
+		if entry.balance {
+			lines = append(lines, date + " * Balance Assertion")
+			for _, p := range entry.postings {
+				lines = append(lines,
+					       fmt.Sprintf("    %s  0 %s = %s %s", p.account,
+							   ledgerCommodity(p.commodity),
+							   p.amount.StringFixed(2),
+							   ledgerCommodity(p.commodity)))
+			}
+			continue
+		}
+
+		header := date
+		if entry.cleared {
+			header += " *"
+		}
+		payee := entry.payee
+		if payee == "" {
+			payee = entry.narration
+		}
+		lines = append(lines, strings.TrimRight(header + " " + payee, " "))
+		if entry.payee != "" && entry.narration != "" {
+			lines = append(lines, "    ; " + entry.narration)
+		}
+		for i := 0; i < len(entry.postings); i++ {
+			lines = append(lines, entry.postings[i].ledger())
+		}
+	}
+
+	_, err := io.WriteString(w, strings.Join(lines, "\n") + "\n")
+	return err
+}
+
+// Write Accounts as Beancount or ledger-cli journal
+func (e *Export) writeJournal(session *Session, w io.Writer, entries []*exportAccount) error {
+	j := &journalWriter{db: session.DB,
+			    accounts: map[uint]*Account{},
+			    categories: map[uint]*Category{},
+			    lots: map[uint][]*journalLot{},
+			    commodities: map[string]string{}}
+
+	// all Accounts, as Transfers may be to those not exported
+	accounts := List(session, true)
+	for i := 0; i < len(accounts); i++ {
+		j.accounts[accounts[i].ID] = &accounts[i]
+	}
+	categories := []Category{}
+	j.db.Find(&categories)
+	for i := 0; i < len(categories); i++ {
+		j.categories[categories[i].ID] = &categories[i]
+	}
+
+	exported := map[uint]bool{}
+	for _, ea := range entries {
+		exported[ea.account.ID] = true
+		j.exported = append(j.exported, ea.account)
+	}
+	for _, ea := range entries {
+		j.addAccount(e, ea, exported)
+	}
+	j.addBalances(e.EndDate)
+
+	baseCurrency := getCurrencyType(session.GetUser().UserSettings.CurrencyTypeID).Name
+	if e.Format == ExportBeancount {
+		return j.writeBeancount(w, baseCurrency)
+	}
+	return j.writeLedger(w)
+}
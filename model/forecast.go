@@ -0,0 +1,200 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"log"
+	"sort"
+	"time"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const defaultForecastMonths int = 3
+const maxForecastMonths int = 60
+
+// A ForecastCashFlow is a projected occurrence of a ScheduledCashFlow (or
+// the other side of a scheduled Transfer); these are never posted.
+type ForecastCashFlow struct {
+	Date time.Time
+	RepeatID uint
+	PayeeName string
+	CategoryName string
+	Amount decimal.Decimal
+	Balance decimal.Decimal
+	Low bool
+}
+
+type ForecastBalance struct {
+	Date time.Time
+	Balance decimal.Decimal
+	Low bool
+}
+
+// Projected CashFlows and daily Balances of Account. Low is set for dates
+// where Balance is below Account.LowBalance, and LowDate is the first.
+type AccountForecast struct {
+	Account Account
+	CashFlows []ForecastCashFlow
+	Balances []ForecastBalance
+	MinBalance decimal.Decimal
+	MinDate time.Time
+	LowDate time.Time
+}
+
+func (af AccountForecast) Currency(value decimal.Decimal) string {
+	return af.Account.Currency(value)
+}
+
+func (af AccountForecast) HasLow() bool {
+	return !af.LowDate.IsZero()
+}
+
+func (af AccountForecast) EndBalance() decimal.Decimal {
+	if len(af.Balances) == 0 {
+		return af.Account.CashBalance
+	}
+	return af.Balances[len(af.Balances)-1].Balance
+}
+
+func (a *Account) belowLowBalance(balance decimal.Decimal) bool {
+	return a.LowBalance.Valid && balance.LessThan(a.LowBalance.Decimal)
+}
+
+// Add projected occurrences of ScheduledCashFlow repeat before end to the
+// AccountForecasts of its Account and of any Accounts it Transfers into.
+// Overdue occurrences are projected for today (they post on next update).
+// Amounts are as currently scheduled, so Rate adjusted Amounts (interest,
+// loan principal) are approximate.
+func projectScheduled(db *gorm.DB, repeat *CashFlow, today time.Time,
+		      end time.Time, forecasts map[uint]*AccountForecast) int {
+	af := forecasts[repeat.AccountID]
+	r := &repeat.RepeatInterval
+	repeatsLeft := -1 // unlimited
+	if r.RepeatsLeftPtr != nil {
+		repeatsLeft = int(r.RepeatsLeft)
+	}
+
+	transfers := []CashFlow{}
+	if repeat.Transfer {
+		transfers = append(transfers, *repeat)
+	} else if repeat.HasSplits() {
+		splits, _ := repeat.ListSplit(db)
+		for i := 0; i < len(splits); i++ {
+			if splits[i].Transfer {
+				transfers = append(transfers, splits[i])
+			}
+		}
+	}
+
+	count := 0
+	for date := repeat.Date; repeatsLeft != 0 && date.Before(end); {
+		projectedDate := date
+		if projectedDate.Before(today) {
+			projectedDate = today
+		}
+
+		af.CashFlows = append(af.CashFlows,
+				      ForecastCashFlow{Date: projectedDate,
+						       RepeatID: repeat.ID,
+						       PayeeName: repeat.PayeeName,
+						       CategoryName: repeat.CategoryName,
+						       Amount: repeat.Amount})
+		for i := 0; i < len(transfers); i++ {
+			pair := forecasts[transfers[i].PayeeID]
+			if pair == nil {
+				continue
+			}
+			pair.CashFlows = append(pair.CashFlows,
+						ForecastCashFlow{Date: projectedDate,
+								 RepeatID: repeat.ID,
+								 PayeeName: af.Account.Name,
+								 CategoryName: "Transfer",
+								 Amount: transfers[i].Amount.Neg()})
+		}
+		count += 1
+
+		if repeatsLeft > 0 {
+			repeatsLeft -= 1
+		}
+		date = r.nextDate(date)
+		if date.IsZero() {
+			break
+		}
+	}
+	return count
+}
+
+// Compute running and daily Balances from today until end, starting from
+// current CashBalance.
+func (af *AccountForecast) projectBalances(today time.Time, end time.Time) {
+	a := &af.Account
+	sort.SliceStable(af.CashFlows, func(i, j int) bool {
+		return af.CashFlows[i].Date.Before(af.CashFlows[j].Date)
+	})
+
+	balance := a.CashBalance
+	af.MinBalance = balance
+	af.MinDate = today
+	j := 0
+	for date := today; date.Before(end); date = date.AddDate(0, 0, 1) {
+		nextDate := date.AddDate(0, 0, 1)
+		for ; j < len(af.CashFlows) && af.CashFlows[j].Date.Before(nextDate); j++ {
+			c := &af.CashFlows[j]
+			balance = balance.Add(c.Amount)
+			c.Balance = balance
+			c.Low = a.belowLowBalance(balance)
+		}
+
+		fb := ForecastBalance{Date: date, Balance: balance,
+				      Low: a.belowLowBalance(balance)}
+		af.Balances = append(af.Balances, fb)
+		if balance.LessThan(af.MinBalance) {
+			af.MinBalance = balance
+			af.MinDate = date
+		}
+		if fb.Low && af.LowDate.IsZero() {
+			af.LowDate = date
+		}
+	}
+}
+
+// Project all of User's ScheduledCashFlows forward the number of months
+// (without posting any), returning a forecast for each Account.
+func Forecast(session *Session, months int) []AccountForecast {
+	db := session.DB
+	if months <= 0 {
+		months = defaultForecastMonths
+	} else if months > maxForecastMonths {
+		months = maxForecastMonths
+	}
+	today := dateOnly(time.Now())
+	end := today.AddDate(0, months, 0)
+
+	accounts := List(session, false)
+	entries := make([]AccountForecast, len(accounts))
+	forecasts := map[uint]*AccountForecast{}
+	for i := 0; i < len(accounts); i++ {
+		entries[i].Account = accounts[i]
+		forecasts[accounts[i].ID] = &entries[i]
+	}
+
+	count := 0
+	for i := 0; i < len(accounts); i++ {
+		scheduled := accounts[i].ListScheduled(session, false)
+		for j := 0; j < len(scheduled); j++ {
+			count += projectScheduled(db, &scheduled[j], today, end, forecasts)
+		}
+	}
+	for i := 0; i < len(entries); i++ {
+		entries[i].projectBalances(today, end)
+	}
+
+	log.Printf("[MODEL] FORECAST ACCOUNTS(%d) MONTHS(%d) CASHFLOWS(%d)",
+		   len(entries), months, count)
+	return entries
+}
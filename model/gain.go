@@ -101,7 +101,7 @@ func (tg *TradeGain) updateDaysHeld(days int32) {
 }
 
 func (tg *TradeGain) Delete(session *Session) error {
-	db := getDbManager()
+	db := session.DB
 
 	buy := &Trade{}
 	buy.ID = tg.BuyID
@@ -112,7 +112,7 @@ func (tg *TradeGain) Delete(session *Session) error {
 	if tg.BasisFIFO.IsZero() {
 		tg.BasisFIFO = tg.Basis
 	}
-	buy.revertBasis(tg.BasisFIFO, tg.Shares)
+	buy.revertBasis(db, tg.BasisFIFO, tg.Shares)
 
 	db.Delete(tg)
 	log.Printf("[MODEL] DELETE GAIN(%d) FOR BUY(%d)", tg.ID, buy.ID)
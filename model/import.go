@@ -26,8 +26,16 @@ type Import struct {
 	AccountID uint `gorm:"not null"`
 	CashFlowCount uint `gorm:"-:all"`
 	TradeCount uint `gorm:"-:all"`
+	DuplicateCount uint `gorm:"-:all"`
 	Username string `gorm:"-:all" form:"import.Username"`
 	Password string `gorm:"-:all" form:"import.Password"`
+	Download bool `gorm:"-:all" form:"import.Download"`
+	Staged bool `form:"import.Staged"`
+	CsvProfileID uint `gorm:"-:all" form:"import.csv_profile_id"`
+	// Securities created while staging, removed if Import is discarded
+	newSecurities map[uint]bool `gorm:"-:all"`
+	PositionsDate *time.Time
+	BrokerCashBalance decimal.NullDecimal
 	CreatedOn time.Time
 	Account Account
 }
@@ -109,18 +117,23 @@ func (im *Import) CountImported(session *Session) {
 	im.CashFlowCount = uint(count)
 	log.Printf("[MODEL] COUNT IMPORT(%d) CASHFLOWS ACCOUNT(%d:%d)",
 		   im.ID, im.AccountID, im.CashFlowCount)
+	im.DuplicateCount = im.countDuplicates(db)
+}
+
+func timeFromOFX(date *ofxgo.Date) time.Time {
+	//dateStr := date.String()
+	return time.Date(date.Year(),
+			 date.Month(),
+			 date.Day(),
+			 date.Hour(),
+			 date.Minute(),
+			 date.Second(),
+			 date.Nanosecond(),
+			 date.Location())
 }
 
 func dateFromOFX(ofxTran *ofxgo.Transaction) time.Time {
-	//dateStr := ofxTran.DtPosted.String()
-	return time.Date(ofxTran.DtPosted.Year(),
-			 ofxTran.DtPosted.Month(),
-			 ofxTran.DtPosted.Day(),
-			 ofxTran.DtPosted.Hour(),
-			 ofxTran.DtPosted.Minute(),
-			 ofxTran.DtPosted.Second(),
-			 ofxTran.DtPosted.Nanosecond(),
-			 ofxTran.DtPosted.Location())
+	return timeFromOFX(&ofxTran.DtPosted)
 }
 
 func (c *CashFlow) makeCashFlowOFX(ofxTran *ofxgo.Transaction) {
@@ -185,19 +198,110 @@ func (t *Trade) makeTradeQIF(qifTran qif.InvestmentTransaction) {
 	t.setDefaults() // needs t.Date, t.Shares
 }
 
+// Returns SECID of the Security traded, or nil if OFX transaction type
+// is not supported.
+func (t *Trade) makeTradeOFX(ofxTran ofxgo.InvTransaction) *ofxgo.SecurityID {
+	var secID *ofxgo.SecurityID
+
+	if buy := invBuyFromOFX(ofxTran); buy != nil {
+		t.TradeTypeID = Buy
+		t.Amount = decimalFromOFX(&buy.Total, -2)
+		t.Shares = decimalFromOFX(&buy.Units, -4)
+		t.Price = decimalFromOFX(&buy.UnitPrice, -4)
+		secID = &buy.SecID
+	} else if sell := invSellFromOFX(ofxTran); sell != nil {
+		t.TradeTypeID = Sell
+		t.Amount = decimalFromOFX(&sell.Total, -2)
+		t.Shares = decimalFromOFX(&sell.Units, -4)
+		t.Price = decimalFromOFX(&sell.UnitPrice, -4)
+		secID = &sell.SecID
+	} else {
+		switch tran := ofxTran.(type) {
+		case ofxgo.Income:
+			t.TradeTypeID = incomeToTradeType(tran.IncomeType.String(), false)
+			t.Amount = decimalFromOFX(&tran.Total, -2)
+			secID = &tran.SecID
+		case ofxgo.Reinvest:
+			t.TradeTypeID = incomeToTradeType(tran.IncomeType.String(), true)
+			t.Amount = decimalFromOFX(&tran.Total, -2)
+			t.Shares = decimalFromOFX(&tran.Units, -4)
+			t.Price = decimalFromOFX(&tran.UnitPrice, -4)
+			secID = &tran.SecID
+		case ofxgo.Transfer:
+			t.TradeTypeID = SharesIn
+			if tran.TferAction == ofxgo.TferActionOut {
+				t.TradeTypeID = SharesOut
+			}
+			t.Shares = decimalFromOFX(&tran.Units, -4)
+			t.Price = decimalFromOFX(&tran.UnitPrice, -4)
+			secID = &tran.SecID
+		case ofxgo.Split:
+			if tran.Numerator <= 0 || tran.Denominator <= 0 {
+				return nil
+			}
+			// Shares of Split is the ratio of new to old shares
+			t.TradeTypeID = Split
+			t.Shares = decimal.NewFromInt(int64(tran.Numerator)).
+				   Div(decimal.NewFromInt(int64(tran.Denominator))).
+				   Round(4)
+			secID = &tran.SecID
+		default:
+			return nil
+		}
+	}
+
+	// Price is needed for Buys and Sells
+	if t.Price.IsZero() && t.Shares.IsPositive() && !t.IsSplit() {
+		t.Price = t.Amount.Div(t.Shares).Round(4)
+	}
+	invTran := invTranFromOFX(ofxTran)
+	t.Date = timeFromOFX(&invTran.DtTrade)
+	t.FITID = strings.TrimSpace(string(invTran.FiTID))
+	t.applyTradeFixups(strings.TrimSpace(string(invTran.Memo)))
+	t.setDefaults() // needs t.Date, t.Shares
+	return secID
+}
+
+// Look up Security by ImportName or symbol. Security is created (by
+// symbol, with importName) if none exists and create is set.
+func (im *Import) securityGetBySymbol(session *Session, symbol string,
+				      importName string, create bool) *Security {
+	security := im.Account.securityGetByImportName(session, symbol)
+	if security != nil {
+		return security
+	}
+
+	// verifies Account
+	security,_ = im.Account.GetSecurityBySymbol(session, symbol)
+	if security == nil {
+		return nil
+	} else if security.ID == 0 {
+		if !create {
+			return nil
+		}
+		security.ImportName = importName
+		if security.create(session, true) != nil {
+			return nil
+		}
+		if im.Staged {
+			if im.newSecurities == nil {
+				im.newSecurities = map[uint]bool{}
+			}
+			im.newSecurities[security.ID] = true
+		}
+	}
+	return security
+}
+
 func (im *Import) create(db *gorm.DB) error {
 	im.CreatedOn = time.Now()
 	result := db.Omit(clause.Associations).Create(im)
 	return result.Error
 }
 
+// Fetch OFX statement with entered Username and Password, or if neither
+// entered, with those of stored Credential.
 func (im *Import) FetchOFX(session *Session) error {
-	if (im.Username == "") {
-		return errors.New("Invalid Username")
-	}
-	if (im.Password == "") {
-		return errors.New("Invalid Password")
-	}
 	db := session.DB
 
 	// Verify we have access to Account
@@ -213,6 +317,19 @@ func (im *Import) FetchOFX(session *Session) error {
 		return errors.New("No OFX Institution")
 	}
 
+	if (im.Username == "" && im.Password == "") {
+		err := im.useCredential(session)
+		if err != nil {
+			return err
+		}
+	}
+	if (im.Username == "") {
+		return errors.New("Invalid Username")
+	}
+	if (im.Password == "") {
+		return errors.New("Invalid Password")
+	}
+
 	im.Account.Institution.ID = im.Account.InstitutionID
 	db.First(&im.Account.Institution)
 	lastCF := im.Account.lastCashFlow(false)
@@ -277,6 +394,14 @@ func (im *Import) ImportFile(session *Session, importFile HttpFile) error {
 		return im.ImportFromQIF(session, importFile)
 	} else if fileExtension == ".qfx" || fileExtension == ".ofx" {
 		return im.ImportFromQFX(session, importFile)
+	} else if fileExtension == ".csv" {
+		return im.ImportFromCSV(session, importFile)
+	} else if fileExtension == ".xml" || fileExtension == ".camt" ||
+		  fileExtension == ".053" {
+		return im.ImportFromCamt053(session, importFile)
+	} else if fileExtension == ".sta" || fileExtension == ".mt940" ||
+		  fileExtension == ".940" {
+		return im.ImportFromMT940(session, importFile)
 	}
 	return errors.New(fmt.Sprintf("[MODEL] IMPORT [%s]: unsupported file type",
 				      fileName))
@@ -311,6 +436,7 @@ func (im *Import) ImportFromQIF(session *Session, importFile HttpFile) error {
 	recordImport := true
 	count := 0
 	entered := 0
+	duplicates := 0
 
 	// Verify we have access to Account
 	if !im.Account.Verified {
@@ -357,7 +483,12 @@ func (im *Import) ImportFromQIF(session *Session, importFile HttpFile) error {
 			cashflows[i].AccountID = im.Account.ID
 			cashflows[i].Account.cloneVerified(&im.Account)
 			cashflows[i].ImportID = im.ID
-			if cashflows[i].insertCashFlow(db, true) == nil {
+			if im.Staged {
+				im.stageCashFlow(db, &cashflows[i], false)
+				entered++
+			} else if im.checkDuplicate(db, &cashflows[i], false) {
+				duplicates++
+			} else if cashflows[i].insertCashFlow(db, true) == nil {
 				entered++
 			}
 		}
@@ -383,7 +514,11 @@ func (im *Import) ImportFromQIF(session *Session, importFile HttpFile) error {
 			trades[i].makeTradeQIF(transaction)
 			trades[i].SecurityID = security.ID
 			trades[i].ImportID = im.ID
-			trades[i].insertTrade(db, security)
+			if im.Staged {
+				im.stageTrade(db, &trades[i], security)
+			} else {
+				trades[i].insertTrade(db, security)
+			}
 			entered++
 		}
 	default:
@@ -391,8 +526,11 @@ func (im *Import) ImportFromQIF(session *Session, importFile HttpFile) error {
 	}
 
 done:
-	log.Printf("[MODEL] IMPORT(%d) [%s] QIF TRANSACTIONS (ACCEPTED %d of %d)",
-		   im.ID, fileName, entered, count)
+	if !im.Staged && entered > 0 {
+		im.matchTransfers(db)
+	}
+	log.Printf("[MODEL] IMPORT(%d) [%s] QIF TRANSACTIONS (ACCEPTED %d of %d, DUPLICATES %d)",
+		   im.ID, fileName, entered, count, duplicates)
 	return nil
 }
 
@@ -435,6 +573,7 @@ func (im *Import) ImportFromOFX(session *Session, resp *ofxgo.Response, after *t
 	recordImport := true
 	count := 0
 	entered := 0
+	duplicates := 0
 
 	ofxTran = im.getOfxTransactions(resp)
 	count = len(ofxTran)
@@ -465,13 +604,77 @@ func (im *Import) ImportFromOFX(session *Session, resp *ofxgo.Response, after *t
 			entries[i].AccountID = im.Account.ID
 			entries[i].Account.cloneVerified(&im.Account)
 			entries[i].ImportID = im.ID
-			if entries[i].insertCashFlow(db, true) == nil {
+			if im.Staged {
+				im.stageCashFlow(db, &entries[i], true)
+				entered++
+			} else if im.checkDuplicate(db, &entries[i], true) {
+				duplicates++
+			} else if entries[i].insertCashFlow(db, true) == nil {
 				entered++
 			}
 		}
 	}
 
-	log.Printf("[MODEL] IMPORT(%d) OFX TRANSACTIONS (ACCEPTED %d of %d)",
-		   im.ID, entered, count)
+	if im.Account.IsInvestment() {
+		tradeCount, tradesEntered, tradeDuplicates :=
+			im.importOfxTrades(session, resp, after)
+		count += tradeCount
+		entered += tradesEntered
+		duplicates += tradeDuplicates
+		im.savePositions(session, resp)
+	}
+
+	if !im.Staged && entered > 0 {
+		im.matchTransfers(db)
+	}
+	log.Printf("[MODEL] IMPORT(%d) OFX TRANSACTIONS (ACCEPTED %d of %d, DUPLICATES %d)",
+		   im.ID, entered, count, duplicates)
 	return nil
 }
+
+// Enter investment transactions of OFX response as Trades. Securities are
+// resolved using the SECLIST, and are created for Buys if not found.
+// Returns count of transactions, and how many were entered and how many
+// were duplicates.
+func (im *Import) importOfxTrades(session *Session, resp *ofxgo.Response, after *time.Time) (int, int, int) {
+	db := session.DebugDB
+	entered := 0
+	duplicates := 0
+
+	ofxTran := im.getOfxInvTransactions(resp)
+	securities := im.getOfxSecurities(resp)
+	spewModel(ofxTran)
+
+	for i := 0; i < len(ofxTran); i++ {
+		t := new(Trade)
+		secID := t.makeTradeOFX(ofxTran[i])
+		if secID == nil {
+			continue
+		}
+		if after != nil && !t.Date.After(*after) {
+			continue
+		}
+		security := im.securityGetByOFX(session, secID, securities,
+						t.IsBuy() || t.IsSharesIn())
+		if security == nil {
+			log.Printf("[MODEL] IMPORT OFX NO SECURITY FOR (%s)",
+				   secID.UniqueID)
+			continue
+		} else if im.ID == 0 {
+			// write Import, we store ImportID in Trades
+			im.create(db)
+		}
+
+		t.SecurityID = security.ID
+		t.ImportID = im.ID
+		if t.isDuplicate(db, security) {
+			duplicates++
+		} else if im.Staged {
+			im.stageTrade(db, t, security)
+			entered++
+		} else if t.insertTrade(db, security) == nil {
+			entered++
+		}
+	}
+	return len(ofxTran), entered, duplicates
+}
@@ -0,0 +1,477 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm/clause"
+)
+
+// A CsvProfile describes the columns of CSV files from a bank or broker.
+// Columns are numbered from 1, and 0 is an unused column. Amounts are
+// either in one column (negative for withdrawals, unless NegateAmounts),
+// or in separate Debit and Credit columns. DateFormat is written as
+// MM/DD/YYYY. Action and Symbol columns, for investment Accounts, import
+// rows as Trades. A profile is used for imports into its Account, or else
+// for any Account of its Institution.
+type CsvProfile struct {
+	Model
+	UserID uint `gorm:"not null"`
+	Name string `form:"profile.Name"`
+	AccountID uint `form:"profile.account_id"`
+	InstitutionID uint `form:"profile.institution_id"`
+	Delimiter string `form:"profile.Delimiter"`
+	HeaderRows int `form:"profile.HeaderRows"`
+	DateColumn int `form:"profile.DateColumn"`
+	DateFormat string `form:"profile.DateFormat"`
+	AmountColumn int `form:"profile.AmountColumn"`
+	DebitColumn int `form:"profile.DebitColumn"`
+	CreditColumn int `form:"profile.CreditColumn"`
+	NegateAmounts bool `form:"profile.NegateAmounts"`
+	PayeeColumn int `form:"profile.PayeeColumn"`
+	MemoColumn int `form:"profile.MemoColumn"`
+	NumColumn int `form:"profile.NumColumn"`
+	ActionColumn int `form:"profile.ActionColumn"`
+	SymbolColumn int `form:"profile.SymbolColumn"`
+	SharesColumn int `form:"profile.SharesColumn"`
+	PriceColumn int `form:"profile.PriceColumn"`
+	Verified bool `gorm:"-:all"`
+	Account Account
+	Institution Institution
+}
+
+var csvDateFormatReplacer = strings.NewReplacer("YYYY", "2006", "YY", "06",
+						"MM", "01", "M", "1",
+						"DD", "02", "D", "2")
+
+func (p *CsvProfile) sanitizeInputs() {
+	sanitizeString(&p.Name)
+	p.DateFormat = strings.ToUpper(strings.TrimSpace(p.DateFormat))
+	if p.DateFormat == "" {
+		p.DateFormat = "MM/DD/YYYY"
+	}
+	if p.Delimiter == "" {
+		p.Delimiter = ","
+	}
+}
+
+// for Bind() and setting from input/checkboxes */
+func (p *CsvProfile) ClearBooleans() {
+	p.NegateAmounts = false
+}
+
+func (p CsvProfile) HasTrades() bool {
+	return p.ActionColumn > 0 && p.SymbolColumn > 0
+}
+
+// time layout of DateFormat
+func (p *CsvProfile) dateLayout() string {
+	return csvDateFormatReplacer.Replace(p.DateFormat)
+}
+
+func (p *CsvProfile) delimiter() rune {
+	if strings.EqualFold(p.Delimiter, "tab") || p.Delimiter == "\\t" {
+		return '\t'
+	}
+	return []rune(p.Delimiter)[0]
+}
+
+func (p *CsvProfile) validateInputs() error {
+	columns := []int{p.DateColumn, p.AmountColumn, p.DebitColumn,
+			 p.CreditColumn, p.PayeeColumn, p.MemoColumn, p.NumColumn,
+			 p.ActionColumn, p.SymbolColumn, p.SharesColumn,
+			 p.PriceColumn, p.HeaderRows}
+	for _, column := range columns {
+		if column < 0 {
+			return errors.New("Invalid Column")
+		}
+	}
+	if p.DateColumn == 0 {
+		return errors.New("CsvProfile Requires a Date Column")
+	}
+	if p.AmountColumn == 0 && p.DebitColumn == 0 && p.CreditColumn == 0 {
+		return errors.New("CsvProfile Requires an Amount Column")
+	}
+	if (p.ActionColumn > 0) != (p.SymbolColumn > 0) {
+		return errors.New("CsvProfile Requires both Action and Symbol Columns")
+	}
+	if p.delimiter() == '"' || len([]rune(p.Delimiter)) > 1 &&
+	   p.delimiter() != '\t' {
+		return errors.New("Invalid Delimiter")
+	}
+
+	// layout must parse the dates it formats
+	date := time.Date(2024, 12, 31, 0, 0, 0, 0, time.Local)
+	parsed, err := time.ParseInLocation(p.dateLayout(),
+					    date.Format(p.dateLayout()), time.Local)
+	if err != nil || !parsed.Equal(date) {
+		return errors.New("Invalid Date Format")
+	}
+	return nil
+}
+
+// value of column (numbered from 1) of CSV row
+func csvField(row []string, column int) string {
+	if column < 1 || column > len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[column-1])
+}
+
+// parse amount as "$1,234.56", "-1234.56" or "(1,234.56)"
+func csvDecimal(value string) (decimal.Decimal, error) {
+	negative := strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")")
+	value = strings.Trim(value, "()$ ")
+	value = strings.Replace(value, ",", "", -1)
+	value = strings.Replace(value, "$", "", -1)
+	if value == "" {
+		return decimal.Zero, nil
+	}
+	amount, err := decimal.NewFromString(value)
+	if negative {
+		amount = amount.Neg()
+	}
+	return amount, err
+}
+
+func (p *CsvProfile) rowDate(row []string) (time.Time, error) {
+	return time.ParseInLocation(p.dateLayout(), csvField(row, p.DateColumn),
+				    time.Local)
+}
+
+// signed Amount of row, negative for withdrawals
+func (p *CsvProfile) rowAmount(row []string) (decimal.Decimal, error) {
+	if p.AmountColumn > 0 {
+		amount, err := csvDecimal(csvField(row, p.AmountColumn))
+		if p.NegateAmounts {
+			amount = amount.Neg()
+		}
+		return amount, err
+	}
+	debit, err := csvDecimal(csvField(row, p.DebitColumn))
+	if err != nil {
+		return debit, err
+	}
+	credit, err := csvDecimal(csvField(row, p.CreditColumn))
+	return credit.Abs().Sub(debit.Abs()), err
+}
+
+// Read rows of CSV file after HeaderRows, skipping those without a valid
+// Date (such as blank or total lines). Rows are returned oldest first.
+func (p *CsvProfile) readRows(file io.Reader) ([][]string, error) {
+	r := csv.NewReader(file)
+	r.Comma = p.delimiter()
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	r.TrimLeadingSpace = true
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	var dates []time.Time
+	for i := p.HeaderRows; i < len(records); i++ {
+		date, err := p.rowDate(records[i])
+		if err != nil {
+			log.Printf("[MODEL] CSV PROFILE(%d) SKIP ROW(%d)", p.ID, i+1)
+			continue
+		}
+		rows = append(rows, records[i])
+		dates = append(dates, date)
+	}
+
+	count := len(rows)
+	if count > 1 && dates[0].After(dates[count-1]) {
+		for i := 0; i < count/2; i++ {
+			rows[i], rows[count-1-i] = rows[count-1-i], rows[i]
+		}
+	}
+	return rows, nil
+}
+
+func (c *CashFlow) makeCashFlowCSV(p *CsvProfile, row []string) error {
+	date, err := p.rowDate(row)
+	if err != nil {
+		return err
+	}
+	c.Date = date
+	c.setDefaults() // needs c.Date
+	c.Amount, err = p.rowAmount(row)
+	if err != nil {
+		return err
+	}
+	c.Amount = c.Amount.Round(2)
+
+	c.Payee.Name = csvField(row, p.PayeeColumn)
+	c.Payee.Name = trimAlphanumericTag(&c.Payee.Name)
+	c.PayeeName = c.Payee.Name
+	c.Memo = csvField(row, p.MemoColumn)
+	c.Transnum = csvField(row, p.NumColumn)
+	return nil
+}
+
+// TradeType from action text (as Buy, Sold, Reinvest Dividend)
+func csvActionToTradeType(action string) uint {
+	action = strings.ToLower(action)
+	isGain := strings.Contains(action, "gain") ||
+		  strings.Contains(action, "distribution") ||
+		  strings.Contains(action, "cap")
+
+	switch {
+	case strings.Contains(action, "reinv"):
+		if isGain {
+			return ReinvestedDistribution
+		}
+		return ReinvestedDividend
+	case strings.Contains(action, "split"):
+		return Split
+	case strings.Contains(action, "out"):
+		return SharesOut
+	case strings.Contains(action, "shares in") ||
+	     strings.Contains(action, "transfer in"):
+		return SharesIn
+	case strings.Contains(action, "buy") || strings.Contains(action, "bought"):
+		return Buy
+	case strings.Contains(action, "sell") || strings.Contains(action, "sold"):
+		return Sell
+	case isGain:
+		return Distribution
+	case strings.Contains(action, "div") || strings.Contains(action, "interest"):
+		return Dividend
+	}
+	return UndefinedTradeType
+}
+
+func (t *Trade) makeTradeCSV(p *CsvProfile, row []string) error {
+	date, err := p.rowDate(row)
+	if err != nil {
+		return err
+	}
+	t.TradeTypeID = csvActionToTradeType(csvField(row, p.ActionColumn))
+	if !TradeTypeIsValid(t.TradeTypeID) {
+		return errors.New("Invalid Trade Action")
+	}
+	t.Date = date
+	amount, err := p.rowAmount(row)
+	if err == nil {
+		t.Amount = amount.Abs().Round(2)
+		t.Shares, err = csvDecimal(csvField(row, p.SharesColumn))
+	}
+	if err == nil {
+		t.Shares = t.Shares.Abs()
+		t.Price, err = csvDecimal(csvField(row, p.PriceColumn))
+	}
+	if err != nil {
+		return err
+	}
+	t.Price = t.Price.Abs()
+	if t.IsSplit() {
+		t.Amount = decimal.Zero
+	} else if t.Price.IsZero() && t.Shares.IsPositive() {
+		t.Price = t.Amount.Div(t.Shares).Round(4)
+	}
+	t.applyTradeFixups(csvField(row, p.MemoColumn))
+	t.setDefaults() // needs t.Date, t.Shares
+	return nil
+}
+
+// CsvProfile for Import: as chosen, or else the User's profile for the
+// Account, or else for the Account's Institution
+func (im *Import) getCsvProfile(session *Session) *CsvProfile {
+	p := new(CsvProfile)
+	if im.CsvProfileID > 0 {
+		p.ID = im.CsvProfileID
+		return p.Get(session)
+	}
+	db := session.DB
+
+	db.Order("id").Where(&CsvProfile{UserID: im.Account.UserID,
+					 AccountID: im.AccountID}).First(p)
+	if p.ID == 0 && im.Account.InstitutionID > 0 {
+		db.Order("id").Where("account_id = 0 OR account_id IS NULL").
+		   Where(&CsvProfile{UserID: im.Account.UserID,
+				     InstitutionID: im.Account.InstitutionID}).
+		   First(p)
+	}
+	if p.ID == 0 {
+		return nil
+	}
+	return p.Get(session)
+}
+
+func (im *Import) ImportFromCSV(session *Session, importFile HttpFile) error {
+	fileName := importFile.FileName
+	db := session.DebugDB
+	entered := 0
+	duplicates := 0
+
+	// Verify we have access to Account
+	if !im.Account.Verified {
+		im.Account.ID = im.AccountID
+		account := im.Account.Get(session, false)
+		if account == nil {
+			return errors.New("Permission Denied")
+		}
+	}
+
+	p := im.getCsvProfile(session)
+	if p == nil {
+		return errors.New(fmt.Sprintf("[MODEL] IMPORT [%s]: no CSV profile for account",
+					      fileName))
+	}
+	rows, err := p.readRows(importFile.FileData)
+	if err != nil {
+		return errors.New(fmt.Sprintf("[MODEL] IMPORT [%s]: error: %v",
+					      fileName, err))
+	}
+	spewModel(rows)
+	count := len(rows)
+	if count > 0 {
+		// write Import, we store ImportID in CashFlows and Trades
+		im.create(db)
+	}
+
+	// convert CSV rows to CashFlows or Trades
+	if p.HasTrades() && im.Account.IsInvestment() {
+		for i := 0; i < count; i++ {
+			t := new(Trade)
+			if t.makeTradeCSV(p, rows[i]) != nil {
+				continue
+			}
+			symbol := csvField(rows[i], p.SymbolColumn)
+			security := im.securityGetBySymbol(session, symbol, "",
+							   t.IsBuy() || t.IsSharesIn())
+			if symbol == "" || security == nil {
+				continue
+			}
+
+			t.SecurityID = security.ID
+			t.ImportID = im.ID
+			if t.isDuplicate(db, security) {
+				duplicates++
+			} else if im.Staged {
+				im.stageTrade(db, t, security)
+				entered++
+			} else if t.insertTrade(db, security) == nil {
+				entered++
+			}
+		}
+	} else {
+		for i := 0; i < count; i++ {
+			c := new(CashFlow)
+			if c.makeCashFlowCSV(p, rows[i]) != nil {
+				continue
+			}
+			c.AccountID = im.Account.ID
+			c.Account.cloneVerified(&im.Account)
+			c.ImportID = im.ID
+			if im.Staged {
+				im.stageCashFlow(db, c, false)
+				entered++
+			} else if im.checkDuplicate(db, c, false) {
+				duplicates++
+			} else if c.insertCashFlow(db, true) == nil {
+				entered++
+			}
+		}
+	}
+
+	if !im.Staged && entered > 0 {
+		im.matchTransfers(db)
+	}
+	log.Printf("[MODEL] IMPORT(%d) [%s] CSV PROFILE(%d) TRANSACTIONS (ACCEPTED %d of %d, DUPLICATES %d)",
+		   im.ID, fileName, p.ID, entered, count, duplicates)
+	return nil
+}
+
+// List User's CsvProfiles
+func (*CsvProfile) List(session *Session) []CsvProfile {
+	entries := []CsvProfile{}
+	u := session.GetUser()
+	if u == nil {
+		return entries
+	}
+
+	session.DB.Preload("Account").Preload("Institution").Order("name").
+	  Where(&CsvProfile{UserID: u.ID}).Find(&entries)
+	log.Printf("[MODEL] LIST CSV PROFILES(%d)", len(entries))
+	return entries
+}
+
+func (p *CsvProfile) HaveAccessPermission(session *Session) bool {
+	u := session.GetUser()
+	p.Verified = !(u == nil || u.ID != p.UserID)
+	return p.Verified
+}
+
+func (p *CsvProfile) Get(session *Session) *CsvProfile {
+	db := session.DB
+	if p.ID > 0 {
+		db.First(&p)
+	}
+	// Verify we have access to CsvProfile
+	if !p.HaveAccessPermission(session) {
+		return nil
+	}
+	return p
+}
+
+// Save CsvProfile (Create or Update) for User
+func (p *CsvProfile) Save(session *Session) error {
+	u := session.GetUser()
+	if u == nil {
+		return errors.New("Permission Denied")
+	}
+	db := session.DB
+	p.sanitizeInputs()
+
+	if p.ID > 0 {
+		old := new(CsvProfile)
+		old.ID = p.ID
+		if old.Get(session) == nil {
+			return errors.New("Permission Denied")
+		}
+	}
+	if p.AccountID > 0 {
+		a := new(Account)
+		a.ID = p.AccountID
+		if a.Get(session, false) == nil {
+			return errors.New("Permission Denied")
+		}
+	}
+	err := p.validateInputs()
+	if err != nil {
+		return err
+	}
+
+	p.UserID = u.ID
+	result := db.Omit(clause.Associations).Save(p)
+	log.Printf("[MODEL] SAVE CSV PROFILE(%d) NAME(%s)", p.ID, p.Name)
+	return result.Error
+}
+
+func (p *CsvProfile) Delete(session *Session) error {
+	// Verify we have access to CsvProfile
+	p = p.Get(session)
+	if p == nil {
+		return errors.New("Permission Denied")
+	}
+	db := session.DB
+
+	log.Printf("[MODEL] DELETE CSV PROFILE(%d)", p.ID)
+	db.Delete(p)
+	return nil
+}
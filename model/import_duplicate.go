@@ -0,0 +1,250 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// days before or after, for CashFlows to be suspected duplicates
+const duplicateDateWindow int = 3
+
+// An ImportDuplicate is an imported transaction which was not entered
+// because it is suspected to be a duplicate of an existing CashFlow. It is
+// held until the user accepts (enters) or discards it.
+type ImportDuplicate struct {
+	Model
+	ImportID uint `gorm:"not null"`
+	AccountID uint `gorm:"not null"`
+	CashFlowID uint
+	Date time.Time
+	Amount decimal.Decimal
+	PayeeName string
+	Memo string
+	Transnum string
+	CashFlow CashFlow `gorm:"-:all"`
+	Import Import `gorm:"-:all"`
+}
+
+func (d ImportDuplicate) Currency(value decimal.Decimal) string {
+	return d.Import.Account.Currency(value)
+}
+
+// lowercase with only letters and digits, for comparing Payee names
+func normalizePayeeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+// Payee names are similar if one contains the other (ignoring case,
+// spaces and punctuation), or they start with the same 6 characters.
+func payeesSimilar(x string, y string) bool {
+	x = normalizePayeeName(x)
+	y = normalizePayeeName(y)
+	if x == "" || y == "" {
+		return false
+	}
+	if strings.Contains(x, y) || strings.Contains(y, x) {
+		return true
+	}
+	const prefixLength = 6
+	return len(x) >= prefixLength && len(y) >= prefixLength &&
+	       x[:prefixLength] == y[:prefixLength]
+}
+
+// Find existing CashFlow which imported CashFlow duplicates. Exact is set
+// when matched by FITID (stored in Transnum of CashFlows imported from
+// OFX). Otherwise matches on Amount, Date within duplicateDateWindow and
+// similar Payee, ignoring CashFlows from the same Import.
+func (c *CashFlow) findDuplicate(db *gorm.DB, matchFITID bool) (*CashFlow, bool) {
+	dup := new(CashFlow)
+	if matchFITID && c.Transnum != "" {
+		db.Where("account_id = ? AND transnum = ? AND import_id > 0",
+			 c.AccountID, c.Transnum).
+		   Where("(type != ? OR type IS NULL)", "RCashFlow").
+		   First(&dup)
+		if dup.ID > 0 {
+			return dup, true
+		}
+	}
+
+	date := dateOnly(c.Date)
+	entries := []CashFlow{}
+	// decimal binds as string, which sqlite won't compare as a number
+	db.Preload("Payee").
+	   Where("account_id = ? AND amount = ?", c.AccountID, c.Amount.InexactFloat64()).
+	   Where("date >= ? AND date < ?", date.AddDate(0, 0, -duplicateDateWindow),
+		 date.AddDate(0, 0, duplicateDateWindow + 1)).
+	   Where("(type != ? OR type IS NULL)", "RCashFlow"). // not Repeats
+	   Where("split = 0").
+	   Where("COALESCE(import_id, 0) != ?", c.ImportID).
+	   Order("date").Find(&entries)
+	for i := 0; i < len(entries); i++ {
+		e := &entries[i]
+		e.Account.cloneVerified(&c.Account)
+		e.Preload(db)
+		if payeesSimilar(c.PayeeName, e.PayeeName) {
+			return e, false
+		}
+	}
+	return nil, false
+}
+
+// Check if imported CashFlow is a duplicate before inserting. Exact
+// duplicates are dropped, suspected duplicates are held for review.
+// Returns true if CashFlow should not be inserted.
+func (im *Import) checkDuplicate(db *gorm.DB, c *CashFlow, matchFITID bool) bool {
+	dup, exact := c.findDuplicate(db, matchFITID)
+	if dup == nil {
+		return false
+	}
+	if exact {
+		log.Printf("[MODEL] IMPORT(%d) SKIP DUPLICATE FITID(%s) CASHFLOW(%d)",
+			   im.ID, c.Transnum, dup.ID)
+		return true
+	}
+
+	d := ImportDuplicate{ImportID: im.ID, AccountID: c.AccountID,
+			     CashFlowID: dup.ID, Date: c.Date, Amount: c.Amount,
+			     PayeeName: c.PayeeName, Memo: c.Memo,
+			     Transnum: c.Transnum}
+	db.Omit(clause.Associations).Create(&d)
+	log.Printf("[MODEL] IMPORT(%d) HOLD DUPLICATE(%d) OF CASHFLOW(%d)",
+		   im.ID, d.ID, dup.ID)
+	return true
+}
+
+// List held ImportDuplicates of Import, with the CashFlow each duplicates
+func (im *Import) ListDuplicates(session *Session) []ImportDuplicate {
+	entries := []ImportDuplicate{}
+	if !im.Account.Verified {
+		return entries
+	}
+	db := session.DB
+
+	db.Order("date asc").Where(&ImportDuplicate{ImportID: im.ID}).Find(&entries)
+	for i := 0; i < len(entries); i++ {
+		d := &entries[i]
+		d.Import = *im
+		d.CashFlow.ID = d.CashFlowID
+		db.Preload("Payee").First(&d.CashFlow)
+		d.CashFlow.Account.cloneVerified(&im.Account)
+		d.CashFlow.Preload(db)
+	}
+	log.Printf("[MODEL] LIST IMPORT(%d) DUPLICATES(%d)", im.ID, len(entries))
+	return entries
+}
+
+func (im *Import) countDuplicates(db *gorm.DB) uint {
+	var count int64
+	db.Model(&ImportDuplicate{}).Where(&ImportDuplicate{ImportID: im.ID}).
+	   Count(&count)
+	return uint(count)
+}
+
+func (d *ImportDuplicate) Get(session *Session) *ImportDuplicate {
+	db := session.DB
+	if d.ID > 0 {
+		db.First(&d)
+	}
+	// Verify we have access to Import
+	d.Import.ID = d.ImportID
+	if d.ImportID == 0 || d.Import.Get(session) == nil {
+		return nil
+	}
+	return d
+}
+
+// Enter held duplicate as a CashFlow of its Import
+func (d *ImportDuplicate) Accept(session *Session) error {
+	// Verify we have access to ImportDuplicate
+	d = d.Get(session)
+	if d == nil {
+		return errors.New("Permission Denied")
+	}
+	db := session.DB
+
+	c := new(CashFlow)
+	c.AccountID = d.AccountID
+	c.Account.cloneVerified(&d.Import.Account)
+	c.ImportID = d.ImportID
+	c.Date = d.Date
+	c.setDefaults()
+	c.Amount = d.Amount
+	c.PayeeName = d.PayeeName
+	c.Payee.Name = d.PayeeName
+	c.Memo = d.Memo
+	c.Transnum = d.Transnum
+	err := c.insertCashFlow(db, true)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[MODEL] ACCEPT IMPORT DUPLICATE(%d) AS CASHFLOW(%d)", d.ID, c.ID)
+	db.Delete(d)
+	return nil
+}
+
+// Discard held duplicate, it is not entered
+func (d *ImportDuplicate) Discard(session *Session) error {
+	// Verify we have access to ImportDuplicate
+	d = d.Get(session)
+	if d == nil {
+		return errors.New("Permission Denied")
+	}
+	db := session.DB
+
+	log.Printf("[MODEL] DISCARD IMPORT DUPLICATE(%d)", d.ID)
+	db.Delete(d)
+	return nil
+}
+
+// Imported Trade duplicates an existing Trade of Account with the same
+// FITID. Otherwise it duplicates a Trade of Security without FITID (entered
+// by hand or imported without one) with the same TradeType, Date, Shares
+// and Amount, so that identical Trades on the same day can be imported.
+func (t *Trade) isDuplicate(db *gorm.DB, security *Security) bool {
+	var count int64
+	date := dateOnly(t.Date)
+	if t.FITID != "" {
+		db.Model(&Trade{}).
+		   Where("account_id = ? AND fit_id = ?", security.AccountID, t.FITID).
+		   Count(&count)
+		if count > 0 {
+			log.Printf("[MODEL] IMPORT(%d) SKIP DUPLICATE FITID(%s) TRADE SECURITY(%d)",
+				   t.ImportID, t.FITID, security.ID)
+			return true
+		}
+	}
+
+	// decimal binds as string, which sqlite won't compare as a number
+	query := db.Model(&Trade{}).
+		    Where("security_id = ? AND trade_type_id = ?", security.ID, t.TradeTypeID).
+		    Where("date >= ? AND date < ?", date, date.AddDate(0, 0, 1)).
+		    Where("shares = ? AND amount = ?", t.Shares.InexactFloat64(),
+			  t.Amount.InexactFloat64())
+	if t.FITID != "" {
+		query = query.Where("COALESCE(fit_id, '') = ''")
+	}
+	query.Count(&count)
+	if count > 0 {
+		log.Printf("[MODEL] IMPORT(%d) SKIP DUPLICATE TRADE SECURITY(%d)",
+			   t.ImportID, security.ID)
+	}
+	return count > 0
+}
@@ -9,11 +9,20 @@ package model
 import (
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 	"github.com/aclindsa/ofxgo"
+	"github.com/shopspring/decimal"
 )
 
+// OFX requests (including reading the response) taking longer fail,
+// so an unresponsive server cannot stall FetchOFX or the sync_ofx job
+const ofxRequestTimeout = 60 * time.Second
+
 type Institution struct {
 	Model
 	AppVer uint
@@ -37,12 +46,81 @@ func (*Institution) List() []Institution {
 	return entries
 }
 
-func (inst *Institution) getClient() *ofxgo.BasicClient {
+// stand-in OFX server used in place of every Institution's, set only by tests
+var ofxServerURL string
+
+// Tests use SetOfxServerURL to send OFX requests to a stand-in server
+func SetOfxServerURL(url string) {
+	ofxServerURL = url
+}
+
+// OFX server of Institution, unless a stand-in server is set
+func (inst *Institution) getURL() string {
+	if ofxServerURL != "" {
+		return ofxServerURL
+	}
+	return inst.FiUrl
+}
+
+// An ofxClient is an ofxgo.BasicClient whose requests have a timeout
+type ofxClient struct {
+	ofxgo.BasicClient
+}
+
+func (inst *Institution) getClient() *ofxClient {
 	if (inst.AppId != "" && inst.AppVer > 0) {
-		return &ofxgo.BasicClient{ AppID: inst.AppId,
-					   AppVer: strconv.Itoa(int(inst.AppVer)) }
+		return &ofxClient{ofxgo.BasicClient{ AppID: inst.AppId,
+						     AppVer: strconv.Itoa(int(inst.AppVer)) }}
 	}
-	return &ofxgo.BasicClient{ AppID: "QWIN", AppVer: "2900" }
+	return &ofxClient{ofxgo.BasicClient{ AppID: "QWIN", AppVer: "2900" }}
+}
+
+// As BasicClient.RawRequest, but using a copy of http.DefaultClient with
+// ofxRequestTimeout
+func (c *ofxClient) RawRequest(URL string, r io.Reader) (*http.Response, error) {
+	if !strings.HasPrefix(URL, "https://") {
+		return nil, errors.New("Refusing to send OFX request over non-https protocol")
+	}
+
+	request, err := http.NewRequest(http.MethodPost, URL, r)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-ofx")
+	request.Header.Add("Accept", "*/*, application/x-ofx")
+	if c.UserAgent != "" {
+		request.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	httpClient := *http.DefaultClient
+	httpClient.Timeout = ofxRequestTimeout
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, errors.New("OFXQuery request status: " + response.Status)
+	}
+	return response, nil
+}
+
+func (c *ofxClient) RequestNoParse(query *ofxgo.Request) (*http.Response, error) {
+	query.SetClientFields(c)
+	b, err := query.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return c.RawRequest(query.URL, b)
+}
+
+func (c *ofxClient) Request(query *ofxgo.Request) (*ofxgo.Response, error) {
+	response, err := c.RequestNoParse(query)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	return ofxgo.ParseResponse(response.Body)
 }
 
 func (im *Import) getOfxTransactions(resp *ofxgo.Response) []ofxgo.Transaction {
@@ -56,12 +134,179 @@ func (im *Import) getOfxTransactions(resp *ofxgo.Response) []ofxgo.Transaction {
 		if valid {
 			return stmt.BankTranList.Transactions
 		}
+	} else if len(resp.InvStmt) > 0 {
+		// cash transactions of investment account
+		stmt, valid := resp.InvStmt[0].(*ofxgo.InvStatementResponse)
+		if valid && stmt.InvTranList != nil {
+			var transactions []ofxgo.Transaction
+			for _, bank := range stmt.InvTranList.BankTransactions {
+				transactions = append(transactions, bank.Transactions...)
+			}
+			return transactions
+		}
+	}
+	return nil
+}
+
+// Investment transactions (Buys, Sells, Income, etc.), oldest first so
+// that Sells are entered after their Buys
+func (im *Import) getOfxInvTransactions(resp *ofxgo.Response) []ofxgo.InvTransaction {
+	if len(resp.InvStmt) == 0 {
+		return nil
+	}
+	stmt, valid := resp.InvStmt[0].(*ofxgo.InvStatementResponse)
+	if !valid || stmt.InvTranList == nil {
+		return nil
+	}
+
+	transactions := stmt.InvTranList.InvTransactions
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return invTranFromOFX(transactions[i]).DtTrade.Before(
+		       invTranFromOFX(transactions[j]).DtTrade.Time)
+	})
+	return transactions
+}
+
+// SECLIST of response, SecInfo for each Security by CUSIP
+func (im *Import) getOfxSecurities(resp *ofxgo.Response) map[string]ofxgo.SecInfo {
+	securities := make(map[string]ofxgo.SecInfo)
+	for _, message := range resp.SecList {
+		list, valid := message.(*ofxgo.SecurityList)
+		if !valid {
+			continue
+		}
+		for _, security := range list.Securities {
+			var info ofxgo.SecInfo
+			switch s := security.(type) {
+			case ofxgo.DebtInfo:
+				info = s.SecInfo
+			case ofxgo.MFInfo:
+				info = s.SecInfo
+			case ofxgo.OptInfo:
+				info = s.SecInfo
+			case ofxgo.OtherInfo:
+				info = s.SecInfo
+			case ofxgo.StockInfo:
+				info = s.SecInfo
+			default:
+				continue
+			}
+			securities[string(info.SecID.UniqueID)] = info
+		}
+	}
+	return securities
+}
+
+// Look up Security of OFX SECID: by ImportName matching CUSIP or the
+// SECLIST name, or else by ticker symbol. Security is created (by ticker,
+// with CUSIP as ImportName) if none exists and create is set.
+func (im *Import) securityGetByOFX(session *Session, secID *ofxgo.SecurityID,
+				   securities map[string]ofxgo.SecInfo, create bool) *Security {
+	cusip := strings.TrimSpace(string(secID.UniqueID))
+	if cusip == "" {
+		return nil
+	}
+	security := im.Account.securityGetByImportName(session, cusip)
+	if security != nil {
+		return security
+	}
+
+	info, found := securities[cusip]
+	if !found {
+		return nil
+	}
+	name := strings.TrimSpace(string(info.SecName))
+	if name != "" {
+		security = im.Account.securityGetByImportName(session, name)
+		if security != nil {
+			return security
+		}
+	}
+
+	ticker := strings.TrimSpace(string(info.Ticker))
+	if ticker == "" {
+		return nil
+	}
+	return im.securityGetBySymbol(session, ticker, cusip, create)
+}
+
+func invTranFromOFX(ofxTran ofxgo.InvTransaction) *ofxgo.InvTran {
+	if buy := invBuyFromOFX(ofxTran); buy != nil {
+		return &buy.InvTran
+	} else if sell := invSellFromOFX(ofxTran); sell != nil {
+		return &sell.InvTran
+	}
+
+	switch tran := ofxTran.(type) {
+	case ofxgo.Income:
+		return &tran.InvTran
+	case ofxgo.Reinvest:
+		return &tran.InvTran
+	case ofxgo.Split:
+		return &tran.InvTran
+	case ofxgo.Transfer:
+		return &tran.InvTran
+	}
+	return &ofxgo.InvTran{}
+}
+
+func invBuyFromOFX(ofxTran ofxgo.InvTransaction) *ofxgo.InvBuy {
+	switch tran := ofxTran.(type) {
+	case ofxgo.BuyDebt:
+		return &tran.InvBuy
+	case ofxgo.BuyMF:
+		return &tran.InvBuy
+	case ofxgo.BuyOpt:
+		return &tran.InvBuy
+	case ofxgo.BuyOther:
+		return &tran.InvBuy
+	case ofxgo.BuyStock:
+		return &tran.InvBuy
+	}
+	return nil
+}
+
+func invSellFromOFX(ofxTran ofxgo.InvTransaction) *ofxgo.InvSell {
+	switch tran := ofxTran.(type) {
+	case ofxgo.SellDebt:
+		return &tran.InvSell
+	case ofxgo.SellMF:
+		return &tran.InvSell
+	case ofxgo.SellOpt:
+		return &tran.InvSell
+	case ofxgo.SellOther:
+		return &tran.InvSell
+	case ofxgo.SellStock:
+		return &tran.InvSell
 	}
 	return nil
 }
+
+func decimalFromOFX(amount *ofxgo.Amount, exp int32) decimal.Decimal {
+	value, _ := amount.Float64()
+	return decimal.NewFromFloatWithExponent(value, exp).Abs()
+}
+
+// INCOMETYPE (CGLONG, CGSHORT, DIV, INTEREST, MISC) to TradeType
+func incomeToTradeType(incomeType string, reinvest bool) uint {
+	switch incomeType {
+	case "CGLONG":
+		fallthrough
+	case "CGSHORT":
+		if reinvest {
+			return ReinvestedDistribution
+		}
+		return Distribution
+	}
+	if reinvest {
+		return ReinvestedDividend
+	}
+	return Dividend
+}
+
 func (im *Import) setSignon(query *ofxgo.Request) {
 	inst := &im.Account.Institution
-	query.URL = inst.FiUrl
+	query.URL = inst.getURL()
 	query.Signon.Org = ofxgo.String(inst.FiOrg)
 	query.Signon.Fid = ofxgo.String(strconv.Itoa(int(inst.FiId)))
 
@@ -114,8 +359,8 @@ func (im *Import) setStatementRequest(query *ofxgo.Request, uid *ofxgo.UID, date
 			TrnUID: *uid,
 			Include:        true,
 			//IncludeOO:      true,
-			//IncludePos:     true,
-			//IncludeBalance: true,
+			IncludePos:     true,
+			IncludeBalance: true,
 			//Include401K:    true,
 			//Include401KBal: true,
 		}
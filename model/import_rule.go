@@ -0,0 +1,409 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// An ImportRule categorizes imported CashFlows. Rules are tried in order
+// of Position and the first matching rule is applied. PayeePattern and
+// MemoPattern are regular expressions (ignoring case), and MinAmount and
+// MaxAmount are compared to the absolute Amount. Splits is a list of
+// percentages and Category names, as "60% Utilities:Energy, 40% Business".
+type ImportRule struct {
+	Model
+	UserID uint `gorm:"not null"`
+	Name string `form:"rule.Name"`
+	Position int `form:"rule.Position"`
+	PayeePattern string `form:"rule.PayeePattern"`
+	MemoPattern string `form:"rule.MemoPattern"`
+	MinAmount decimal.NullDecimal
+	MaxAmount decimal.NullDecimal
+	AccountID uint `form:"rule.account_id"`
+	CategoryID uint `form:"rule.category_id"`
+	PayeeName string `form:"rule.PayeeName"`
+	Memo string `form:"rule.Memo"`
+	Splits string `form:"rule.Splits"`
+	Skip bool `form:"rule.Skip"`
+	Verified bool `gorm:"-:all"`
+	Account Account
+	Category Category
+	payeeRegexp *regexp.Regexp
+	memoRegexp *regexp.Regexp
+	splits []ruleSplit
+}
+
+type ruleSplit struct {
+	Percent decimal.Decimal
+	CategoryID uint
+}
+
+func (r *ImportRule) sanitizeInputs() {
+	sanitizeString(&r.Name)
+	r.PayeePattern = strings.TrimSpace(r.PayeePattern)
+	r.MemoPattern = strings.TrimSpace(r.MemoPattern)
+	sanitizeString(&r.PayeeName)
+	sanitizeString(&r.Memo)
+	sanitizeString(&r.Splits)
+}
+
+// for Bind() and setting from input/checkboxes */
+func (r *ImportRule) ClearBooleans() {
+	r.Skip = false
+}
+
+func (r ImportRule) GetMinAmount() string {
+	if !r.MinAmount.Valid {
+		return ""
+	}
+	return r.MinAmount.Decimal.StringFixed(2)
+}
+
+func (r ImportRule) GetMaxAmount() string {
+	if !r.MaxAmount.Valid {
+		return ""
+	}
+	return r.MaxAmount.Decimal.StringFixed(2)
+}
+
+func (r *ImportRule) SetMinAmount(amount string) {
+	r.MinAmount = nullDecimalFromString(amount)
+}
+
+func (r *ImportRule) SetMaxAmount(amount string) {
+	r.MaxAmount = nullDecimalFromString(amount)
+}
+
+func (r ImportRule) HasCondition() bool {
+	return r.PayeePattern != "" || r.MemoPattern != "" || r.AccountID > 0 ||
+	       r.MinAmount.Valid || r.MaxAmount.Valid
+}
+
+func (r ImportRule) HasAction() bool {
+	return r.CategoryID > 0 || r.PayeeName != "" || r.Memo != "" ||
+	       r.Splits != "" || r.Skip
+}
+
+// Parse Splits into percentages and Categories; must total 100%
+func parseRuleSplits(splits string) ([]ruleSplit, error) {
+	entries := []ruleSplit{}
+	if splits == "" {
+		return entries, nil
+	}
+
+	total := decimal.Zero
+	for _, split := range strings.Split(splits, ",") {
+		split = strings.TrimSpace(split)
+		percent, name, found := strings.Cut(split, "%")
+		if !found {
+			return nil, errors.New(fmt.Sprintf("Split (%s) Missing Percentage", split))
+		}
+		rs := ruleSplit{}
+		var err error
+		rs.Percent, err = decimal.NewFromString(strings.TrimSpace(percent))
+		if err != nil || !rs.Percent.IsPositive() {
+			return nil, errors.New(fmt.Sprintf("Split (%s) Invalid Percentage", split))
+		}
+		name = strings.TrimSpace(name)
+		category := CategoryGetByName(name)
+		if category.ID == 0 {
+			return nil, errors.New(fmt.Sprintf("Split (%s) Unknown Category", split))
+		}
+		rs.CategoryID = category.ID
+		total = total.Add(rs.Percent)
+		entries = append(entries, rs)
+	}
+	if !total.Equal(decimal.NewFromInt(100)) {
+		return nil, errors.New("Splits Must Total 100%")
+	}
+	return entries, nil
+}
+
+// Compile patterns and parse Splits, needed before matches and apply
+func (r *ImportRule) prepare() error {
+	var err error
+	r.payeeRegexp = nil
+	r.memoRegexp = nil
+	if r.PayeePattern != "" {
+		r.payeeRegexp, err = regexp.Compile("(?i)" + r.PayeePattern)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Invalid Payee Pattern: %v", err))
+		}
+	}
+	if r.MemoPattern != "" {
+		r.memoRegexp, err = regexp.Compile("(?i)" + r.MemoPattern)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Invalid Memo Pattern: %v", err))
+		}
+	}
+	r.splits, err = parseRuleSplits(r.Splits)
+	return err
+}
+
+func (r *ImportRule) matches(c *CashFlow) bool {
+	if c.Transfer {
+		return false
+	}
+	if r.AccountID > 0 && r.AccountID != c.AccountID {
+		return false
+	}
+	if r.payeeRegexp != nil && !r.payeeRegexp.MatchString(c.PayeeName) {
+		return false
+	}
+	if r.memoRegexp != nil && !r.memoRegexp.MatchString(c.Memo) {
+		return false
+	}
+	amount := c.Amount.Abs()
+	if r.MinAmount.Valid && amount.LessThan(r.MinAmount.Decimal) {
+		return false
+	}
+	if r.MaxAmount.Valid && amount.GreaterThan(r.MaxAmount.Decimal) {
+		return false
+	}
+	return true
+}
+
+// Apply Category, Payee and Memo actions to CashFlow (Splits are
+// created after CashFlow is saved). Memo is added once.
+func (r *ImportRule) apply(c *CashFlow) {
+	if r.CategoryID > 0 {
+		c.CategoryID = r.CategoryID
+	}
+	if r.PayeeName != "" {
+		c.PayeeName = r.PayeeName
+		c.Payee.Name = r.PayeeName
+	}
+	if r.Memo != "" && !strings.Contains(c.Memo, r.Memo) {
+		if c.Memo == "" {
+			c.Memo = r.Memo
+		} else {
+			c.Memo = c.Memo + " " + r.Memo
+		}
+	}
+}
+
+// Create Splits of saved CashFlow; last Split gets any remainder from
+// rounding so Splits total the CashFlow Amount.
+func (r *ImportRule) createSplits(db *gorm.DB, c *CashFlow) {
+	if len(r.splits) == 0 || !c.CanSplit() || c.HasSplits() {
+		return
+	}
+
+	remaining := c.Amount
+	for i := 0; i < len(r.splits); i++ {
+		split := new(CashFlow)
+		split.AccountID = c.AccountID
+		split.Account.cloneVerified(&c.Account)
+		split.Date = c.Date
+		split.TaxYear = c.TaxYear
+		split.PayeeID = c.PayeeID
+		split.ImportID = c.ImportID
+		split.Memo = c.Memo
+		split.CategoryID = r.splits[i].CategoryID
+		split.setSplit(c.ID)
+		if i == len(r.splits) - 1 {
+			split.Amount = remaining
+		} else {
+			split.Amount = c.Amount.Mul(r.splits[i].Percent).
+					  Div(decimal.NewFromInt(100)).Round(2)
+			remaining = remaining.Sub(split.Amount)
+		}
+		split.insertCashFlow(db, false)
+	}
+	c.SplitFrom = uint(len(r.splits))
+}
+
+// User's ImportRules for Account, in order, ready for use
+func listImportRules(db *gorm.DB, userID uint, accountID uint) []ImportRule {
+	entries := []ImportRule{}
+	rules := []ImportRule{}
+	db.Order("position").Order("id").
+	   Where("user_id = ? AND (account_id = 0 OR account_id = ?)", userID, accountID).
+	   Find(&entries)
+	for i := 0; i < len(entries); i++ {
+		if entries[i].prepare() == nil {
+			rules = append(rules, entries[i])
+		}
+	}
+	return rules
+}
+
+// Apply first matching ImportRule to CashFlow being imported, returning
+// the rule (to create Splits after insert) or nil if none match.
+func (c *CashFlow) applyImportRules(db *gorm.DB) (*ImportRule, error) {
+	if c.Transfer || c.Split {
+		return nil, nil
+	}
+	rules := listImportRules(db, c.Account.User.ID, c.AccountID)
+	for i := 0; i < len(rules); i++ {
+		r := &rules[i]
+		if !r.matches(c) {
+			continue
+		}
+		log.Printf("[MODEL] IMPORT RULE(%d) MATCHES PAYEE(%s) SKIP(%t)",
+			   r.ID, c.PayeeName, r.Skip)
+		if r.Skip {
+			return r, errors.New("ImportRule has Skip")
+		}
+		r.apply(c)
+		return r, nil
+	}
+	return nil, nil
+}
+
+// List User's ImportRules
+func (*ImportRule) List(session *Session) []ImportRule {
+	entries := []ImportRule{}
+	u := session.GetUser()
+	if u == nil {
+		return entries
+	}
+
+	session.DB.Preload("Account").Preload("Category").
+	  Order("position").Order("id").
+	  Where(&ImportRule{UserID: u.ID}).Find(&entries)
+	log.Printf("[MODEL] LIST IMPORT RULES(%d)", len(entries))
+	return entries
+}
+
+func (r *ImportRule) HaveAccessPermission(session *Session) bool {
+	u := session.GetUser()
+	r.Verified = !(u == nil || u.ID != r.UserID)
+	return r.Verified
+}
+
+func (r *ImportRule) Get(session *Session) *ImportRule {
+	db := session.DB
+	if r.ID > 0 {
+		db.First(&r)
+	}
+	// Verify we have access to ImportRule
+	if !r.HaveAccessPermission(session) {
+		return nil
+	}
+	return r
+}
+
+// Save ImportRule (Create or Update) for User
+func (r *ImportRule) Save(session *Session) error {
+	u := session.GetUser()
+	if u == nil {
+		return errors.New("Permission Denied")
+	}
+	db := session.DB
+	r.sanitizeInputs()
+
+	if r.ID > 0 {
+		old := new(ImportRule)
+		old.ID = r.ID
+		if old.Get(session) == nil {
+			return errors.New("Permission Denied")
+		}
+	}
+	if r.AccountID > 0 {
+		a := new(Account)
+		a.ID = r.AccountID
+		if a.Get(session, false) == nil {
+			return errors.New("Permission Denied")
+		}
+	}
+	if !r.HasCondition() {
+		return errors.New("ImportRule Requires a Condition")
+	}
+	if !r.HasAction() {
+		return errors.New("ImportRule Requires an Action")
+	}
+	err := r.prepare()
+	if err != nil {
+		return err
+	}
+
+	r.UserID = u.ID
+	result := db.Omit(clause.Associations).Save(r)
+	log.Printf("[MODEL] SAVE IMPORT RULE(%d) NAME(%s)", r.ID, r.Name)
+	return result.Error
+}
+
+func (r *ImportRule) Delete(session *Session) error {
+	// Verify we have access to ImportRule
+	r = r.Get(session)
+	if r == nil {
+		return errors.New("Permission Denied")
+	}
+	db := session.DB
+
+	log.Printf("[MODEL] DELETE IMPORT RULE(%d)", r.ID)
+	db.Delete(r)
+	return nil
+}
+
+// Apply ImportRule to User's past CashFlows (not Transfers, Splits or
+// Reconciled). Skip is not applied, past CashFlows are never deleted.
+// Returns number of CashFlows changed.
+func (r *ImportRule) Run(session *Session) (int, error) {
+	if !r.Verified {
+		return 0, errors.New("Permission Denied")
+	}
+	err := r.prepare()
+	if err != nil {
+		return 0, err
+	}
+	db := session.DB
+
+	accounts := map[uint]*Account{}
+	accountIDs := []uint{}
+	entries := List(session, true)
+	for i := 0; i < len(entries); i++ {
+		a := &entries[i]
+		if r.AccountID == 0 || r.AccountID == a.ID {
+			accounts[a.ID] = a
+			accountIDs = append(accountIDs, a.ID)
+		}
+	}
+	if len(accountIDs) == 0 {
+		return 0, nil
+	}
+
+	cashflows := []CashFlow{}
+	db.Where("account_id IN ?", accountIDs).
+	   Where("type IS NULL"). // no Repeats or Splits
+	   Where("transfer = 0 AND reconciled = 0").
+	   Find(&cashflows)
+
+	count := 0
+	for i := 0; i < len(cashflows); i++ {
+		c := &cashflows[i]
+		c.Account = *accounts[c.AccountID]
+		c.Preload(db)
+		if !r.matches(c) {
+			continue
+		}
+
+		c.postQueryInit(true)
+		payeeName := c.PayeeName
+		r.apply(c)
+		if c.PayeeName == payeeName {
+			// ensure c.Update uses c.PayeeID (no lookup)
+			c.PayeeName = ""
+		}
+		if c.Update() == nil {
+			r.createSplits(db, c)
+			count += 1
+		}
+	}
+	log.Printf("[MODEL] RUN IMPORT RULE(%d) CASHFLOWS(%d of %d)",
+		   r.ID, count, len(cashflows))
+	return count, nil
+}
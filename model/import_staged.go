@@ -0,0 +1,376 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"errors"
+	"log"
+	"time"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// staged Imports not committed within this time are discarded
+const stagedImportExpiry = 7 * 24 * time.Hour
+
+// A StagedTransaction is a parsed transaction of a staged Import, held
+// for review until the Import is committed. Trades have a SecurityID,
+// and NewSecurity if the Security was created by staging.
+type StagedTransaction struct {
+	Model
+	ImportID uint `gorm:"not null"`
+	AccountID uint `gorm:"not null"`
+	Date time.Time
+	Amount decimal.Decimal
+	PayeeName string
+	Memo string
+	Transnum string
+	CategoryID uint
+	TransferAccountID uint
+	ImportRuleID uint
+	DuplicateID uint
+	Duplicate bool
+	Selected bool
+	SecurityID uint
+	TradeTypeID uint
+	Shares decimal.Decimal
+	Price decimal.Decimal
+	NewSecurity bool
+	DuplicateCashFlow CashFlow `gorm:"-:all"`
+	Security Security `gorm:"-:all"`
+	TradeType TradeType `gorm:"-:all"`
+	Import Import `gorm:"-:all"`
+}
+
+func (s StagedTransaction) Currency(value decimal.Decimal) string {
+	return s.Import.Account.Currency(value)
+}
+
+func (s StagedTransaction) IsTrade() bool {
+	return s.SecurityID > 0
+}
+
+// Transactions entered when Import is committed
+func (s StagedTransaction) willCommit() bool {
+	return s.Selected && !s.Duplicate
+}
+
+// Stage CashFlow instead of inserting; ImportRules are applied now so
+// the results can be reviewed, and duplicates are marked.
+func (im *Import) stageCashFlow(db *gorm.DB, c *CashFlow, matchFITID bool) {
+	s := new(StagedTransaction)
+	s.ImportID = im.ID
+	s.AccountID = c.AccountID
+	s.Selected = true
+
+	dup, _ := c.findDuplicate(db, matchFITID)
+	if dup != nil {
+		s.DuplicateID = dup.ID
+		s.Duplicate = true
+	}
+
+	rule, err := c.applyImportRules(db)
+	if rule != nil {
+		s.ImportRuleID = rule.ID
+	}
+	if err != nil {
+		s.Selected = false
+	}
+
+	payee := Payee{Name: c.PayeeName, UserID: c.Account.User.ID}
+	db.Where(&payee).First(&payee)
+	if payee.SkipOnImport {
+		s.Selected = false
+	}
+
+	s.Date = c.Date
+	s.Amount = c.Amount
+	s.PayeeName = c.PayeeName
+	s.Memo = c.Memo
+	s.Transnum = c.Transnum
+	s.CategoryID = c.CategoryID
+	db.Omit(clause.Associations).Create(s)
+}
+
+// Stage Trade instead of inserting
+func (im *Import) stageTrade(db *gorm.DB, t *Trade, security *Security) {
+	s := new(StagedTransaction)
+	s.ImportID = im.ID
+	s.AccountID = security.AccountID
+	s.Selected = true
+	s.SecurityID = security.ID
+	s.NewSecurity = im.newSecurities[security.ID]
+	s.Transnum = t.FITID
+	s.TradeTypeID = t.TradeTypeID
+	s.Date = t.Date
+	s.Amount = t.Amount
+	s.Shares = t.Shares
+	s.Price = t.Price
+	db.Omit(clause.Associations).Create(s)
+}
+
+// List StagedTransactions of Import, in the order they will be entered
+func (im *Import) ListStaged(session *Session) []StagedTransaction {
+	entries := []StagedTransaction{}
+	if !im.Account.Verified {
+		return entries
+	}
+	db := session.DB
+
+	db.Order("id").Where(&StagedTransaction{ImportID: im.ID}).Find(&entries)
+	for i := 0; i < len(entries); i++ {
+		s := &entries[i]
+		s.Import = *im
+		if s.DuplicateID > 0 {
+			d := &s.DuplicateCashFlow
+			db.Preload("Payee").First(d, s.DuplicateID)
+			d.Account.cloneVerified(&im.Account)
+			d.Preload(db)
+		}
+		if s.IsTrade() {
+			db.Joins("Company").First(&s.Security, s.SecurityID)
+			db.First(&s.TradeType, s.TradeTypeID)
+		}
+	}
+	log.Printf("[MODEL] LIST IMPORT(%d) STAGED(%d)", im.ID, len(entries))
+	return entries
+}
+
+// Save review changes to StagedTransactions of Import. Choosing a
+// Category replaces that of ImportRule (and any Splits it would create).
+// Nothing is saved if any change is invalid.
+func (im *Import) UpdateStaged(session *Session, entries []StagedTransaction) error {
+	if !im.Account.Verified || !im.Staged {
+		return errors.New("Permission Denied")
+	}
+	db := session.DB
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i := 0; i < len(entries); i++ {
+			e := &entries[i]
+			s := new(StagedTransaction)
+			tx.Where(&StagedTransaction{ImportID: im.ID}).First(&s, e.ID)
+			if s.ID == 0 {
+				return errors.New("Invalid StagedTransaction")
+			}
+
+			s.Selected = e.Selected
+			s.Duplicate = e.Duplicate
+			if !s.IsTrade() {
+				if e.TransferAccountID > 0 {
+					a := new(Account)
+					a.ID = e.TransferAccountID
+					if a.Get(session, false) == nil ||
+					   a.ID == im.AccountID {
+						return errors.New("Invalid Transfer Account")
+					}
+				}
+				if e.CategoryID != s.CategoryID {
+					s.ImportRuleID = 0
+				}
+				s.CategoryID = e.CategoryID
+				s.TransferAccountID = e.TransferAccountID
+				s.PayeeName = e.PayeeName
+				s.Memo = e.Memo
+				sanitizeString(&s.PayeeName)
+				sanitizeString(&s.Memo)
+			}
+			result := tx.Omit(clause.Associations).Save(s)
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("[MODEL] UPDATE IMPORT(%d) STAGED(%d)", im.ID, len(entries))
+	return nil
+}
+
+func (s *StagedTransaction) commitCashFlow(db *gorm.DB, im *Import) error {
+	c := new(CashFlow)
+	c.AccountID = s.AccountID
+	c.Account.cloneVerified(&im.Account)
+	c.ImportID = im.ID
+	c.Date = s.Date
+	c.Transfer = s.TransferAccountID > 0
+	c.setDefaults()
+	c.Amount = s.Amount
+	c.Memo = s.Memo
+	c.Transnum = s.Transnum
+	c.CategoryID = s.CategoryID
+	c.PayeeName = s.PayeeName
+	if c.Transfer {
+		a := new(Account)
+		a.ID = s.TransferAccountID
+		if a.Get(im.Account.Session, false) == nil {
+			return errors.New("Invalid Transfer Account")
+		}
+		c.PayeeName = a.Name
+	}
+
+	// ImportRules were applied when staged
+	err := c.insertCashFlow(db, false)
+	if err != nil {
+		return err
+	}
+	if s.ImportRuleID > 0 && !c.Transfer {
+		rule := new(ImportRule)
+		db.First(&rule, s.ImportRuleID)
+		if rule.ID > 0 && rule.prepare() == nil {
+			rule.createSplits(db, c)
+		}
+	}
+	return nil
+}
+
+func (s *StagedTransaction) commitTrade(db *gorm.DB, im *Import) error {
+	security := new(Security)
+	security.ID = s.SecurityID
+	if security.Get(im.Account.Session) == nil {
+		return errors.New("Invalid Security")
+	}
+
+	t := new(Trade)
+	t.TradeTypeID = s.TradeTypeID
+	t.Date = s.Date
+	t.Amount = s.Amount
+	t.Shares = s.Shares
+	t.Price = s.Price
+	t.FITID = s.Transnum
+	t.setDefaults()
+	t.SecurityID = security.ID
+	t.ImportID = im.ID
+	return t.insertTrade(db, security)
+}
+
+func (im *Import) deleteStaged(db *gorm.DB) {
+	db.Where(&StagedTransaction{ImportID: im.ID}).Delete(&StagedTransaction{})
+}
+
+// delete Securities created by staging which have no Trades entered or
+// staged by another Import
+func (im *Import) deleteStagedSecurities(db *gorm.DB) {
+	securityIDs := []uint{}
+	db.Model(&StagedTransaction{}).
+	   Where(&StagedTransaction{ImportID: im.ID, NewSecurity: true}).
+	   Distinct().Pluck("security_id", &securityIDs)
+	for _, id := range securityIDs {
+		var count, staged int64
+		db.Model(&Trade{}).Where(&Trade{SecurityID: id}).Count(&count)
+		db.Model(&StagedTransaction{}).
+		   Where("security_id = ? AND import_id <> ?", id, im.ID).
+		   Count(&staged)
+		if count == 0 && staged == 0 {
+			log.Printf("[MODEL] IMPORT(%d) DELETE STAGED SECURITY(%d)",
+				   im.ID, id)
+			db.Delete(&Security{}, id)
+		}
+	}
+}
+
+// Enter selected StagedTransactions as CashFlows or Trades, returning
+// how many were entered. Import is no longer staged afterwards. All are
+// entered in a single transaction, so if any fails nothing is entered and
+// Import remains staged.
+func (im *Import) CommitStaged(session *Session) (int, error) {
+	if !im.Account.Verified || !im.Staged {
+		return 0, errors.New("Permission Denied")
+	}
+	db := session.DebugDB
+	entered := 0
+	accountIDs := []uint{im.AccountID}
+
+	entries := []StagedTransaction{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// claim Import, so concurrent commits cannot both enter it
+		result := tx.Model(&Import{}).Where("id = ? AND staged = ?", im.ID, true).
+			     Update("staged", false)
+		if result.Error != nil {
+			return result.Error
+		} else if result.RowsAffected == 0 {
+			return errors.New("Import is not staged")
+		}
+
+		// enter using Session of transaction, whose cached Balances
+		// are discarded with it
+		txImport := *im
+		txImport.Account.setSession(session.withDB(tx))
+		tx.Order("id").Where(&StagedTransaction{ImportID: im.ID}).Find(&entries)
+		for i := 0; i < len(entries); i++ {
+			s := &entries[i]
+			if !s.willCommit() {
+				continue
+			}
+
+			var err error
+			if s.IsTrade() {
+				err = s.commitTrade(tx, &txImport)
+			} else {
+				err = s.commitCashFlow(tx, &txImport)
+			}
+			if err != nil {
+				log.Printf("[MODEL] COMMIT IMPORT(%d) STAGED(%d) ERROR: %s",
+					   im.ID, s.ID, err)
+				return err
+			}
+			entered++
+			if s.TransferAccountID > 0 {
+				accountIDs = append(accountIDs, s.TransferAccountID)
+			}
+		}
+
+		im.deleteStaged(tx)
+		return nil
+	})
+	// Balances were updated in database, not in cache of session
+	session.GetUser().uncacheAccountBalances(accountIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	im.Staged = false
+	im.matchTransfers(db)
+	log.Printf("[MODEL] COMMIT IMPORT(%d) (ACCEPTED %d of %d)",
+		   im.ID, entered, len(entries))
+	return entered, nil
+}
+
+// Discard staged Import, nothing is entered and Securities it created
+// are removed
+func (im *Import) DiscardStaged(session *Session) error {
+	if !im.Account.Verified || !im.Staged {
+		return errors.New("Permission Denied")
+	}
+	db := session.DB
+
+	im.deleteStagedSecurities(db)
+	im.deleteStaged(db)
+	im.deletePositions(db)
+	db.Delete(im)
+	log.Printf("[MODEL] DISCARD IMPORT(%d)", im.ID)
+	return nil
+}
+
+// Discard staged Imports older than stagedImportExpiry, for all Users
+func expireStagedImports(db *gorm.DB) int {
+	entries := []Import{}
+	db.Where("staged = ? AND created_on < ?", true,
+		 time.Now().Add(-stagedImportExpiry)).Find(&entries)
+	for i := 0; i < len(entries); i++ {
+		im := &entries[i]
+		im.deleteStagedSecurities(db)
+		im.deleteStaged(db)
+		im.deletePositions(db)
+		db.Delete(im)
+	}
+	log.Printf("[MODEL] EXPIRE STAGED IMPORTS(%d)", len(entries))
+	return len(entries)
+}
@@ -0,0 +1,462 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+	"github.com/shopspring/decimal"
+)
+
+// A statementEntry is one booked entry of a camt.053 or MT940 bank
+// statement. Reference is the bank's entry reference, used as Transnum.
+type statementEntry struct {
+	Date time.Time
+	Amount decimal.Decimal
+	Currency string
+	Payee string
+	Memo string
+	Reference string
+}
+
+// camt.053 (ISO 20022 BankToCustomerStatement), only elements used.
+// Tags have no namespace so any version of the schema is accepted.
+type camtDocument struct {
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	Entries []camtEntry `xml:"Ntry"`
+}
+
+type camtDate struct {
+	Date string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+type camtParty struct {
+	Name string `xml:"Nm"`
+	// since camt.053.001.08, name is within Pty
+	PartyName string `xml:"Pty>Nm"`
+}
+
+type camtAmount struct {
+	Value string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+// Sts is text before camt.053.001.08, and within Cd since
+type camtStatus struct {
+	Text string `xml:",chardata"`
+	Code string `xml:"Cd"`
+}
+
+type camtTransaction struct {
+	EndToEndID string `xml:"Refs>EndToEndId"`
+	AcctSvcrRef string `xml:"Refs>AcctSvcrRef"`
+	Creditor camtParty `xml:"RltdPties>Cdtr"`
+	Debtor camtParty `xml:"RltdPties>Dbtr"`
+	Unstructured []string `xml:"RmtInf>Ustrd"`
+	AdditionalInfo string `xml:"AddtlTxInf"`
+}
+
+type camtEntry struct {
+	Reference string `xml:"NtryRef"`
+	Amount camtAmount `xml:"Amt"`
+	CreditDebit string `xml:"CdtDbtInd"`
+	Status camtStatus `xml:"Sts"`
+	BookingDate camtDate `xml:"BookgDt"`
+	ValueDate camtDate `xml:"ValDt"`
+	AcctSvcrRef string `xml:"AcctSvcrRef"`
+	AdditionalInfo string `xml:"AddtlNtryInf"`
+	Transactions []camtTransaction `xml:"NtryDtls>TxDtls"`
+}
+
+func (d *camtDate) time() (time.Time, error) {
+	if d.Date != "" {
+		return time.ParseInLocation("2006-01-02", strings.TrimSpace(d.Date),
+					    time.Local)
+	}
+	if len(d.DateTime) >= 10 {
+		return time.ParseInLocation("2006-01-02", d.DateTime[0:10], time.Local)
+	}
+	return time.Time{}, errors.New("Missing Date")
+}
+
+func (p *camtParty) name() string {
+	if p.Name != "" {
+		return strings.TrimSpace(p.Name)
+	}
+	return strings.TrimSpace(p.PartyName)
+}
+
+// camt references use NOTPROVIDED when there is none
+func camtReference(refs ...string) string {
+	for _, ref := range refs {
+		ref = strings.TrimSpace(ref)
+		if ref != "" && ref != "NOTPROVIDED" {
+			return ref
+		}
+	}
+	return ""
+}
+
+func (ce *camtEntry) isBooked() bool {
+	status := strings.TrimSpace(ce.Status.Code)
+	if status == "" {
+		status = strings.TrimSpace(ce.Status.Text)
+	}
+	return status == "" || status == "BOOK"
+}
+
+func (ce *camtEntry) makeStatementEntry() (*statementEntry, error) {
+	amount, err := decimal.NewFromString(strings.TrimSpace(ce.Amount.Value))
+	if err != nil {
+		return nil, err
+	}
+	date, err := ce.BookingDate.time()
+	if err != nil {
+		date, err = ce.ValueDate.time()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e := &statementEntry{Date: date, Amount: amount,
+			     Currency: strings.TrimSpace(ce.Amount.Currency),
+			     Memo: strings.TrimSpace(ce.AdditionalInfo)}
+	debit := strings.TrimSpace(ce.CreditDebit) == "DBIT"
+	if debit {
+		e.Amount = e.Amount.Neg()
+	}
+
+	var tx *camtTransaction
+	if len(ce.Transactions) > 0 {
+		tx = &ce.Transactions[0]
+		// counterparty is Creditor of debits, Debtor of credits
+		if debit {
+			e.Payee = tx.Creditor.name()
+		} else {
+			e.Payee = tx.Debtor.name()
+		}
+		remittance := strings.TrimSpace(strings.Join(tx.Unstructured, " "))
+		if remittance != "" {
+			e.Memo = remittance
+		} else if e.Memo == "" {
+			e.Memo = strings.TrimSpace(tx.AdditionalInfo)
+		}
+		e.Reference = camtReference(ce.AcctSvcrRef, ce.Reference,
+					    tx.AcctSvcrRef, tx.EndToEndID)
+	} else {
+		e.Reference = camtReference(ce.AcctSvcrRef, ce.Reference)
+	}
+	if e.Payee == "" {
+		e.Payee = e.Memo
+	}
+	return e, nil
+}
+
+// Parse booked entries of camt.053 statement(s)
+func parseCamt053(r io.Reader) ([]statementEntry, error) {
+	var doc camtDocument
+	err := xml.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Statements) == 0 {
+		return nil, errors.New("No camt.053 Statements")
+	}
+
+	entries := []statementEntry{}
+	for _, stmt := range doc.Statements {
+		for i := 0; i < len(stmt.Entries); i++ {
+			ce := &stmt.Entries[i]
+			if !ce.isBooked() {
+				continue
+			}
+			e, err := ce.makeStatementEntry()
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, *e)
+		}
+	}
+	return entries, nil
+}
+
+// MT940 tag at start of line, as :61: or :60F:
+var mt940TagRegexp = regexp.MustCompile(`^:([0-9]{2}[A-Z]?):`)
+
+// :61: value date (YYMMDD), optional entry date (MMDD), debit/credit mark
+// (with R for reversals), optional funds code, amount, transaction type,
+// customer reference (which may contain /) and optional bank reference
+// following //
+var mt940LineRegexp = regexp.MustCompile(`^([0-9]{6})([0-9]{4})?(RC|RD|C|D)([A-Z])?([0-9]+,[0-9]*)([A-Z][A-Z0-9]{3})(.*?)(//(.*))?$`)
+
+type mt940Tag struct {
+	name string
+	lines []string
+}
+
+// Split MT940 text into its tags, ignoring message headers and trailers
+func readMT940Tags(r io.Reader) ([]mt940Tag, error) {
+	tags := []mt940Tag{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r ")
+		match := mt940TagRegexp.FindStringSubmatch(line)
+		if match != nil {
+			tags = append(tags, mt940Tag{name: match[1],
+						     lines: []string{line[len(match[0]):]}})
+		} else if line == "-" || strings.HasPrefix(line, "-}") ||
+			  strings.HasPrefix(line, "{") {
+			// end of message, or block header
+			tags = append(tags, mt940Tag{})
+		} else if len(tags) > 0 && tags[len(tags) - 1].name != "" {
+			t := &tags[len(tags) - 1]
+			t.lines = append(t.lines, line)
+		}
+	}
+	return tags, scanner.Err()
+}
+
+func mt940Date(value string) (time.Time, error) {
+	return time.ParseInLocation("060102", value, time.Local)
+}
+
+// Parse :61: statement line
+func parseMT940Line(value string, currency string) (*statementEntry, error) {
+	match := mt940LineRegexp.FindStringSubmatch(value)
+	if match == nil {
+		return nil, fmt.Errorf("Invalid MT940 Statement Line (%s)", value)
+	}
+	valueDate, err := mt940Date(match[1])
+	if err != nil {
+		return nil, err
+	}
+	e := &statementEntry{Date: valueDate, Currency: currency}
+
+	// entry (booking) date has no year, so take from value date
+	if match[2] != "" {
+		date, err := time.ParseInLocation("0102", match[2], time.Local)
+		if err != nil {
+			return nil, err
+		}
+		date = time.Date(valueDate.Year(), date.Month(), date.Day(),
+				 0, 0, 0, 0, time.Local)
+		if date.Sub(valueDate) > 180 * 24 * time.Hour {
+			date = date.AddDate(-1, 0, 0)
+		} else if valueDate.Sub(date) > 180 * 24 * time.Hour {
+			date = date.AddDate(1, 0, 0)
+		}
+		e.Date = date
+	}
+
+	// decimal comma, and may have no cents (as 5,)
+	amount := strings.TrimSuffix(strings.Replace(match[5], ",", ".", 1), ".")
+	e.Amount, err = decimal.NewFromString(amount)
+	if err != nil {
+		return nil, err
+	}
+	if match[3] == "D" || match[3] == "RC" {
+		e.Amount = e.Amount.Neg()
+	}
+
+	customerRef := strings.TrimSpace(match[7])
+	bankRef := strings.TrimSpace(match[9])
+	if bankRef != "" {
+		e.Reference = bankRef
+	} else if customerRef != "NONREF" {
+		e.Reference = customerRef
+	}
+	return e, nil
+}
+
+// Apply :86: information to entry. Structured (German GVC) information
+// has ?NN subfields, with ?20-?29 and ?60-?63 the purpose and ?32-?33
+// the counterparty name. Otherwise first line is taken as the Payee.
+func (e *statementEntry) applyMT940Information(lines []string) {
+	text := strings.Join(lines, "")
+	if len(text) > 4 && text[3] == '?' {
+		var payee string
+		var memo []string
+		for _, field := range strings.Split(text[3:], "?")[1:] {
+			if len(field) < 2 {
+				continue
+			}
+			value := strings.TrimSpace(field[2:])
+			switch code := field[0:2]; {
+			case code >= "20" && code <= "29", code >= "60" && code <= "63":
+				memo = append(memo, value)
+			case code == "32":
+				payee = field[2:]
+			case code == "33":
+				// ?33 continues ?32 directly only if it is full
+				if len(payee) < 27 {
+					payee += " "
+				}
+				payee += field[2:]
+			}
+		}
+		e.Payee = strings.TrimSpace(payee)
+		e.Memo = strings.TrimSpace(strings.Join(memo, " "))
+	} else if len(lines) > 0 {
+		e.Payee = strings.TrimSpace(lines[0])
+		e.Memo = strings.TrimSpace(strings.Join(lines[1:], " "))
+	}
+	if e.Payee == "" {
+		e.Payee = e.Memo
+	}
+}
+
+// Parse entries of MT940 statement(s), skipping any :61: statement lines
+// which cannot be parsed
+func parseMT940(r io.Reader) ([]statementEntry, error) {
+	tags, err := readMT940Tags(r)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []statementEntry{}
+	currency := ""
+	var last *statementEntry
+	for _, t := range tags {
+		switch t.name {
+		case "60F", "60M":
+			// opening balance: mark, date (YYMMDD), currency, amount
+			if len(t.lines[0]) >= 10 {
+				currency = t.lines[0][7:10]
+			}
+		case "61":
+			last, err = parseMT940Line(t.lines[0], currency)
+			if err != nil {
+				log.Printf("[MODEL] IMPORT MT940 SKIP LINE: %v", err)
+				last = nil
+				continue
+			}
+			entries = append(entries, *last)
+			last = &entries[len(entries) - 1]
+		case "86":
+			if last != nil {
+				last.applyMT940Information(t.lines)
+			}
+			last = nil
+		default:
+			last = nil
+		}
+	}
+	if len(tags) == 0 {
+		return nil, errors.New("No MT940 Statements")
+	}
+	return entries, nil
+}
+
+func (c *CashFlow) makeCashFlowStatement(e *statementEntry) {
+	c.Date = e.Date
+	c.setDefaults() // needs c.Date
+	c.Amount = e.Amount.Round(2)
+
+	c.Payee.Name = strings.TrimSpace(e.Payee)
+	c.Payee.Name = trimAlphanumericTag(&c.Payee.Name)
+	c.PayeeName = c.Payee.Name
+	c.Memo = e.Memo
+	c.Transnum = e.Reference
+}
+
+// Insert statement entries as CashFlows; entries with a Reference
+// already imported into the Account are skipped
+func (im *Import) importStatement(session *Session, fileName string, format string,
+				  entries []statementEntry) error {
+	db := session.DebugDB
+	currency := getCurrencyType(im.Account.CurrencyTypeID).Name
+	count := len(entries)
+	entered := 0
+	duplicates := 0
+
+	if count > 0 {
+		// write Import, we store ImportID in CashFlows
+		im.create(db)
+	}
+
+	for i := 0; i < count; i++ {
+		e := &entries[i]
+		if e.Currency != "" && e.Currency != currency {
+			log.Printf("[MODEL] IMPORT(%d) SKIP ENTRY(%s) CURRENCY(%s)",
+				   im.ID, e.Reference, e.Currency)
+			continue
+		}
+		c := new(CashFlow)
+		c.makeCashFlowStatement(e)
+		c.AccountID = im.Account.ID
+		c.Account.cloneVerified(&im.Account)
+		c.ImportID = im.ID
+		if im.Staged {
+			im.stageCashFlow(db, c, true)
+			entered++
+		} else if im.checkDuplicate(db, c, true) {
+			duplicates++
+		} else if c.insertCashFlow(db, true) == nil {
+			entered++
+		}
+	}
+
+	if !im.Staged && entered > 0 {
+		im.matchTransfers(db)
+	}
+	log.Printf("[MODEL] IMPORT(%d) [%s] %s TRANSACTIONS (ACCEPTED %d of %d, DUPLICATES %d)",
+		   im.ID, fileName, format, entered, count, duplicates)
+	return nil
+}
+
+func (im *Import) ImportFromCamt053(session *Session, importFile HttpFile) error {
+	fileName := importFile.FileName
+
+	// Verify we have access to Account
+	if !im.Account.Verified {
+		im.Account.ID = im.AccountID
+		account := im.Account.Get(session, false)
+		if account == nil {
+			return errors.New("Permission Denied")
+		}
+	}
+
+	entries, err := parseCamt053(importFile.FileData)
+	if err != nil {
+		return errors.New(fmt.Sprintf("[MODEL] IMPORT [%s]: error: %v",
+					      fileName, err))
+	}
+	spewModel(entries)
+	return im.importStatement(session, fileName, "CAMT.053", entries)
+}
+
+func (im *Import) ImportFromMT940(session *Session, importFile HttpFile) error {
+	fileName := importFile.FileName
+
+	// Verify we have access to Account
+	if !im.Account.Verified {
+		im.Account.ID = im.AccountID
+		account := im.Account.Get(session, false)
+		if account == nil {
+			return errors.New("Permission Denied")
+		}
+	}
+
+	entries, err := parseMT940(importFile.FileData)
+	if err != nil {
+		return errors.New(fmt.Sprintf("[MODEL] IMPORT [%s]: error: %v",
+					      fileName, err))
+	}
+	spewModel(entries)
+	return im.importStatement(session, fileName, "MT940", entries)
+}
@@ -0,0 +1,138 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"gorm.io/gorm"
+)
+
+// Trades of Import, newest first so Sells are reversed before their Buys
+func (im *Import) listTrades(db *gorm.DB) []Trade {
+	entries := []Trade{}
+	db.Order("date desc").Order("id desc").
+	   Where(&Trade{AccountID: im.AccountID, ImportID: im.ID}).
+	   Find(&entries)
+	return entries
+}
+
+// Verify Trades of Import can be deleted: Sells must be newer than any
+// other Sells of the Security, and Buys must only have been sold by Sells
+// from the same Import.
+func (im *Import) canUndoTrades(db *gorm.DB, trades []Trade) error {
+	for i := 0; i < len(trades); i++ {
+		t := &trades[i]
+		var count int64
+
+		if t.IsSplit() {
+			return errors.New(fmt.Sprintf("Trade(%d) is a Split", t.ID))
+		} else if t.IsSell() {
+			db.Model(&Trade{}).Where(TradeTypeQueries[Sell]).
+			   Where("security_id = ? AND COALESCE(import_id, 0) != ?",
+				 t.SecurityID, im.ID).
+			   Where("date > ? OR (date = ? AND id > ?)", t.Date, t.Date, t.ID).
+			   Count(&count)
+			if count > 0 {
+				return errors.New(fmt.Sprintf("Trade(%d) has later Sells", t.ID))
+			}
+		} else if t.IsBuy() && t.Basis.IsPositive() {
+			db.Model(&TradeGain{}).Where("buy_id = ?", t.ID).
+			   Where("sell_id NOT IN (?)",
+				 db.Model(&Trade{}).Select("id").
+				    Where(&Trade{ImportID: im.ID})).
+			   Count(&count)
+			if count > 0 {
+				return errors.New(fmt.Sprintf("Trade(%d) was later Sold", t.ID))
+			}
+		}
+	}
+	return nil
+}
+
+// Delete all CashFlows (with their Splits and Transfer pairs) and Trades
+// (with their TradeGains) entered by Import, and then Import itself.
+// Transfers linked by matching with a CashFlow entered otherwise are
+// unlinked, keeping that CashFlow. Account balances and Security shares
+// and basis are restored as with individual deletes. Nothing is deleted
+// if any cannot be.
+func (im *Import) Undo(session *Session) error {
+	if !im.Account.Verified {
+		return errors.New("Permission Denied")
+	}
+	if im.Staged {
+		return errors.New("Import is not committed")
+	}
+	db := session.DB
+	accountIDs := []uint{im.AccountID}
+
+	// Splits are deleted with their parent
+	cashflows := []CashFlow{}
+	trades := []Trade{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		txSession := session.withDB(tx)
+		tx.Where(&CashFlow{AccountID: im.AccountID, ImportID: im.ID}).
+		   Where("split = 0").Find(&cashflows)
+		for i := 0; i < len(cashflows); i++ {
+			c := &cashflows[i]
+			c.postQueryInit(false)
+			// linked Transfer pair is kept (only unlinked), so
+			// only check if this CashFlow is Reconciled
+			m := c.transferLink(tx)
+			if m != nil && c.Reconciled {
+				return errors.New(fmt.Sprintf("CashFlow(%d) is Reconciled", c.ID))
+			} else if m == nil && c.isLocked(tx) {
+				return errors.New(fmt.Sprintf("CashFlow(%d) is Reconciled", c.ID))
+			}
+			if c.Transfer {
+				// PayeeID is Pair.AccountID
+				accountIDs = append(accountIDs, c.PayeeID)
+			}
+		}
+		trades = im.listTrades(tx)
+		err := im.canUndoTrades(tx, trades)
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < len(cashflows); i++ {
+			m := cashflows[i].transferLink(tx)
+			if m != nil {
+				m.unlinkTransfer(tx)
+			}
+		}
+		for i := 0; i < len(trades); i++ {
+			t := new(Trade)
+			t.ID = trades[i].ID
+			err := t.Delete(txSession)
+			if err != nil {
+				return err
+			}
+		}
+		for i := 0; i < len(cashflows); i++ {
+			c := new(CashFlow)
+			c.ID = cashflows[i].ID
+			err := c.Delete(txSession)
+			if err != nil {
+				return err
+			}
+		}
+
+		tx.Where(&ImportDuplicate{ImportID: im.ID}).Delete(&ImportDuplicate{})
+		im.deletePositions(tx)
+		return tx.Delete(im).Error
+	})
+	// Balances were updated in database, not in cache of session
+	session.GetUser().uncacheAccountBalances(accountIDs)
+	if err != nil {
+		return err
+	}
+	log.Printf("[MODEL] UNDO IMPORT(%d) CASHFLOWS(%d) TRADES(%d)",
+		   im.ID, len(cashflows), len(trades))
+	return nil
+}
@@ -0,0 +1,269 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// how often scheduler checks for Jobs which are due
+const jobSchedulerTick = time.Minute
+
+// A Job is periodic maintenance run by the background scheduler. Run
+// returns a short summary of what was done.
+type Job struct {
+	Name string
+	Interval time.Duration
+	Running bool
+	Runs int
+	Failures int
+	LastRun time.Time
+	LastDuration time.Duration
+	LastResult string
+	LastError string
+	NextRun time.Time
+	run func(js *jobScheduler) (string, error)
+}
+
+type jobScheduler struct {
+	mutex sync.Mutex
+	jobs []*Job
+	runNow chan *Job
+}
+
+var scheduler *jobScheduler
+
+func (j Job) HasRun() bool {
+	return !j.LastRun.IsZero()
+}
+
+// Run fn with new Session of each User. Jobs never share a logged in
+// User's Session, as that is used concurrently by the User's requests,
+// and their Sessions don't cache Balances (see newJobSession).
+func (js *jobScheduler) forEachUser(fn func(session *Session) int) int {
+	db := getDbManager()
+	count := 0
+
+	users := []User{}
+	db.Select("id").Find(&users)
+	for i := 0; i < len(users); i++ {
+		session := users[i].newJobSession()
+		count += fn(session)
+		session.CloseSession()
+	}
+	return count
+}
+
+// Post ScheduledCashFlows which are due, for all Users
+func jobPostScheduled(js *jobScheduler) (string, error) {
+	count := js.forEachUser(func(session *Session) int {
+		accounts := List(session, true)
+		for i := 0; i < len(accounts); i++ {
+			accounts[i].updateAccount(session, false)
+		}
+		return len(accounts)
+	})
+	return fmt.Sprintf("%d accounts updated", count), nil
+}
+
+// Refresh Security quotes and Values of investment Accounts
+func jobUpdateQuotes(js *jobScheduler) (string, error) {
+	count := js.forEachUser(func(session *Session) int {
+		updated := 0
+		accounts := List(session, true)
+		for i := 0; i < len(accounts); i++ {
+			a := &accounts[i]
+			if a.IsInvestment() {
+				a.getOpenSecurities(false)
+				updated += 1
+			}
+		}
+		return updated
+	})
+	return fmt.Sprintf("%d accounts updated", count), nil
+}
+
+// Record today's BalanceSnapshots so net worth history has no gaps
+func jobRecordSnapshots(js *jobScheduler) (string, error) {
+	count := js.forEachUser(func(session *Session) int {
+		db := session.DB
+		accounts := List(session, true)
+		for i := 0; i < len(accounts); i++ {
+			accounts[i].recordSnapshot(db)
+		}
+		return len(accounts)
+	})
+	return fmt.Sprintf("%d accounts recorded", count), nil
+}
+
+// Audit ledgers (without repair), failing if any discrepancies
+func jobAuditLedger(js *jobScheduler) (string, error) {
+	entries := AuditAllUsers(false)
+	if len(entries) > 0 {
+		return "", errors.New(fmt.Sprintf("%d discrepancies, see /admin/audit",
+						  len(entries)))
+	}
+	return "no discrepancies", nil
+}
+
+// Discard staged Imports which were never committed
+func jobExpireStagedImports(js *jobScheduler) (string, error) {
+	count := expireStagedImports(getDbManager())
+	return fmt.Sprintf("%d imports expired", count), nil
+}
+
+func newJobScheduler() *jobScheduler {
+	js := new(jobScheduler)
+	js.runNow = make(chan *Job, 8)
+	js.jobs = []*Job{{Name: "post_scheduled", Interval: time.Hour,
+			  run: jobPostScheduled},
+			 {Name: "update_quotes", Interval: 4 * time.Hour,
+			  run: jobUpdateQuotes},
+			 {Name: "record_snapshots", Interval: 24 * time.Hour,
+			  run: jobRecordSnapshots},
+			 {Name: "audit_ledger", Interval: 24 * time.Hour,
+			  run: jobAuditLedger},
+			 {Name: "expire_staged_imports", Interval: time.Hour,
+			  run: jobExpireStagedImports},
+			 {Name: "sync_ofx", Interval: ofxSyncRetryDelay,
+			  run: jobSyncOFX}}
+	return js
+}
+
+func (js *jobScheduler) getJob(name string) *Job {
+	for i := 0; i < len(js.jobs); i++ {
+		if js.jobs[i].Name == name {
+			return js.jobs[i]
+		}
+	}
+	return nil
+}
+
+// run Job, recovering from panic so that one Job cannot stop scheduler
+func (j *Job) safeRun(js *jobScheduler) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[MODEL] JOB(%s) PANIC(%v)", j.Name, r)
+			err = errors.New(fmt.Sprintf("Job Panic (%v)", r))
+		}
+	}()
+	return j.run(js)
+}
+
+func (js *jobScheduler) runJob(j *Job) {
+	js.mutex.Lock()
+	j.Running = true
+	js.mutex.Unlock()
+
+	log.Printf("[MODEL] JOB(%s) START", j.Name)
+	start := time.Now()
+	result, err := j.safeRun(js)
+
+	js.mutex.Lock()
+	j.Running = false
+	j.Runs += 1
+	j.LastRun = start
+	j.LastDuration = time.Since(start).Round(time.Millisecond)
+	j.LastResult = result
+	j.LastError = ""
+	if err != nil {
+		j.Failures += 1
+		j.LastError = err.Error()
+	}
+	j.NextRun = start.Add(j.Interval)
+	js.mutex.Unlock()
+
+	log.Printf("[MODEL] JOB(%s) DONE (%s) %s ERROR(%v)", j.Name,
+		   j.LastDuration, result, err)
+}
+
+// Jobs run one at a time, so they don't compete for the database
+func (js *jobScheduler) loop() {
+	ticker := time.NewTicker(jobSchedulerTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case j := <-js.runNow:
+			js.runJob(j)
+		case now := <-ticker.C:
+			for i := 0; i < len(js.jobs); i++ {
+				j := js.jobs[i]
+				if !now.Before(j.NextRun) {
+					js.runJob(j)
+				}
+			}
+		}
+	}
+}
+
+// Start background scheduler. Jobs first run one per tick, in order, so
+// posting of ScheduledCashFlows happens first.
+func StartJobScheduler() {
+	if scheduler != nil {
+		return
+	}
+	js := newJobScheduler()
+
+	now := time.Now()
+	for i := 0; i < len(js.jobs); i++ {
+		js.jobs[i].NextRun = now.Add(time.Duration(i + 1) * jobSchedulerTick)
+	}
+	scheduler = js
+	go js.loop()
+	log.Printf("[MODEL] START JOB SCHEDULER JOBS(%d)", len(js.jobs))
+}
+
+// Status of all Jobs
+func ListJobs() []Job {
+	entries := []Job{}
+	if scheduler == nil {
+		return entries
+	}
+
+	scheduler.mutex.Lock()
+	for i := 0; i < len(scheduler.jobs); i++ {
+		entries = append(entries, *scheduler.jobs[i])
+	}
+	scheduler.mutex.Unlock()
+	return entries
+}
+
+// Queue Job to run now (in background), only by administrator as Jobs
+// run for all Users
+func RunJob(session *Session, name string) error {
+	u := session.GetUser()
+	if u == nil || !u.IsAdmin() {
+		return errors.New("Permission Denied")
+	}
+	if scheduler == nil {
+		return errors.New("Job Scheduler Not Running")
+	}
+	j := scheduler.getJob(name)
+	if j == nil {
+		return errors.New(fmt.Sprintf("Unknown Job (%s)", name))
+	}
+
+	scheduler.mutex.Lock()
+	running := j.Running
+	scheduler.mutex.Unlock()
+	if running {
+		return errors.New(fmt.Sprintf("Job (%s) Already Running", name))
+	}
+
+	select {
+	case scheduler.runNow <- j:
+	default:
+		return errors.New("Job Queue Full")
+	}
+	log.Printf("[MODEL] QUEUE JOB(%s)", name)
+	return nil
+}
@@ -0,0 +1,251 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"errors"
+	"log"
+	"time"
+	"github.com/shopspring/decimal"
+)
+
+// stop projecting Loans which would never be paid off (50 years)
+const maxLoanPayments int = 600
+
+// A LoanScenario is a what-if for paying off a Loan. ExtraPayment is
+// additional principal paid with each payment, LumpSum is one time extra
+// principal paid with first payment on or after LumpSumDate. If
+// RefinanceRate or RefinanceMonths is set, the Loan is refinanced (with
+// RefinanceCosts added to balance); RefinanceMonths of 0 keeps the current
+// payment.
+type LoanScenario struct {
+	Name string
+	ExtraPayment decimal.Decimal
+	LumpSum decimal.Decimal
+	LumpSumDate time.Time
+	RefinanceRate decimal.Decimal
+	RefinanceMonths int
+	RefinanceCosts decimal.Decimal
+}
+
+type LoanPayment struct {
+	Number int
+	Date time.Time
+	Payment decimal.Decimal
+	Principal decimal.Decimal
+	Interest decimal.Decimal
+	Balance decimal.Decimal
+}
+
+// Amortization schedule for a LoanScenario. Payment is the monthly
+// principal and interest (not including Fees or ExtraPayment).
+type LoanSchedule struct {
+	LoanScenario
+	Rate decimal.Decimal
+	Payment decimal.Decimal
+	Fees decimal.Decimal
+	Payments []LoanPayment
+	PayoffDate time.Time
+	TotalInterest decimal.Decimal
+	InterestSaved decimal.Decimal
+}
+
+// Current terms of Loan from its scheduled payment
+type loanTerms struct {
+	Balance decimal.Decimal
+	Rate decimal.Decimal
+	Payment decimal.Decimal
+	Fees decimal.Decimal
+	Date time.Time
+}
+
+func (a *Account) IsLoan() bool {
+	return a.AccountTypeID == AccountTypeLoan
+}
+
+func (ls LoanSchedule) NumPayments() int {
+	return len(ls.Payments)
+}
+
+func (ls LoanSchedule) IsRefinance() bool {
+	return ls.RefinanceRate.IsPositive() || ls.RefinanceMonths > 0
+}
+
+// same day of month as dx, or last day if month is shorter
+func addMonths(dx time.Time, months int) time.Time {
+	date := dx.AddDate(0, months, 0)
+	if date.Day() < dx.Day() {
+		// we overran into next month
+		date = date.AddDate(0, 0, -date.Day())
+	}
+	return date
+}
+
+// Fixed monthly payment to repay balance over months at annual rate
+func loanPayment(balance decimal.Decimal, annualRate decimal.Decimal,
+		 months int) decimal.Decimal {
+	n := decimal.NewFromInt(int64(months))
+	if !annualRate.IsPositive() {
+		return balance.DivRound(n, 2)
+	}
+
+	rate := annualRate.Div(decimal.NewFromInt32(1200))
+	factor := decimal.NewFromInt(1).Add(rate).Pow(n)
+	return balance.Mul(rate).Mul(factor).
+		       DivRound(factor.Sub(decimal.NewFromInt(1)), 2)
+}
+
+// Find the ScheduledCashFlow which is the payment for Loan Account a.
+// This is the Scheduled CashFlow with a Rate and Splits for principal and
+// interest (see calculateLoanPI); either in a itself, or in the Account
+// making the payment with a Transfer Split into a.
+func (a *Account) loanTerms(session *Session) (*loanTerms, error) {
+	db := session.DB
+
+	transfers := db.Model(&CashFlow{}).Select("split_from").
+			Where(map[string]interface{}{"type": "RCashFlow",
+						     "split": true,
+						     "transfer": true,
+						     "payee_id": a.ID})
+	entries := []CashFlow{}
+	query := map[string]interface{}{"type": "RCashFlow", "split": false}
+	db.Order("date asc").
+	   Where("split_from > 0 AND repeat_interval_id > 0").
+	   Where("account_id = ? OR id IN (?)", a.ID, transfers).
+	   Find(&entries, query)
+
+	for i := 0; i < len(entries); i++ {
+		repeat := &entries[i]
+		if repeat.AccountID == a.ID {
+			repeat.Account.cloneVerified(a)
+		} else {
+			payer := new(Account)
+			payer.ID = repeat.AccountID
+			payer = payer.Get(session, false)
+			if payer == nil {
+				continue
+			}
+			repeat.Account.cloneVerified(payer)
+		}
+		if !repeat.getMonthlyRate(db).IsPositive() {
+			continue
+		}
+
+		terms := new(loanTerms)
+		terms.Balance = a.CashBalance.Neg()
+		terms.Rate = repeat.RepeatInterval.Rate
+		terms.Date = repeat.Date
+		if repeat.AccountID == a.ID {
+			terms.Payment = repeat.Amount.Abs()
+		}
+
+		splits, _ := repeat.ListSplit(db)
+		for j := 0; j < len(splits); j++ {
+			split := &splits[j]
+			split.Category.ID = split.CategoryID
+			if split.Transfer {
+				if repeat.AccountID != a.ID {
+					terms.Payment = terms.Payment.Add(split.Amount.Abs())
+				}
+			} else if split.Category.LoanPI() {
+				terms.Payment = terms.Payment.Add(split.Amount.Abs())
+			} else {
+				terms.Fees = terms.Fees.Add(split.Amount.Abs())
+			}
+		}
+
+		log.Printf("[MODEL] ACCOUNT(%d) LOAN PAYMENT CASHFLOW(%d) (%f)",
+			   a.ID, repeat.ID, terms.Payment.InexactFloat64())
+		return terms, nil
+	}
+
+	return nil, errors.New("No Scheduled Loan Payment")
+}
+
+// Project payments from terms until balance is repaid
+func (ls *LoanSchedule) project(terms *loanTerms) error {
+	balance := terms.Balance
+	ls.Rate = terms.Rate
+	ls.Payment = terms.Payment
+	ls.Fees = terms.Fees
+	if ls.IsRefinance() {
+		balance = balance.Add(ls.RefinanceCosts)
+		if ls.RefinanceRate.IsPositive() {
+			ls.Rate = ls.RefinanceRate
+		}
+		if ls.RefinanceMonths > 0 {
+			ls.Payment = loanPayment(balance, ls.Rate, ls.RefinanceMonths)
+		}
+	}
+
+	lumpSum := ls.LumpSum
+	for n := 0; balance.IsPositive(); n++ {
+		if n == maxLoanPayments {
+			return errors.New("Loan Payment Too Small")
+		}
+
+		p := LoanPayment{Number: n + 1, Date: addMonths(terms.Date, n)}
+		p.Interest = balance.Mul(monthlyRate(ls.Rate, p.Date)).RoundBank(2)
+		p.Principal = ls.Payment.Sub(p.Interest).Add(ls.ExtraPayment)
+		if lumpSum.IsPositive() && !p.Date.Before(ls.LumpSumDate) {
+			p.Principal = p.Principal.Add(lumpSum)
+			lumpSum = decimal.Zero
+		}
+		if !p.Principal.IsPositive() {
+			return errors.New("Loan Payment Less Than Interest")
+		}
+		if p.Principal.GreaterThan(balance) {
+			p.Principal = balance
+		}
+
+		balance = balance.Sub(p.Principal)
+		p.Payment = p.Principal.Add(p.Interest)
+		p.Balance = balance
+		ls.TotalInterest = ls.TotalInterest.Add(p.Interest)
+		ls.PayoffDate = p.Date
+		ls.Payments = append(ls.Payments, p)
+	}
+	return nil
+}
+
+// Amortization schedules for Loan Account: first for the current scheduled
+// payment, followed by one for each of scenarios.
+func (a *Account) LoanAmortization(session *Session,
+				   scenarios []LoanScenario) ([]LoanSchedule, error) {
+	schedules := []LoanSchedule{}
+	if !a.Verified {
+		return schedules, errors.New("Permission Denied")
+	}
+	if !a.IsLoan() {
+		return schedules, errors.New("Amortization Requires Loan Account")
+	}
+	if !a.CashBalance.IsNegative() {
+		return schedules, errors.New("Loan Has No Balance")
+	}
+
+	terms, err := a.loanTerms(session)
+	if err != nil {
+		return schedules, err
+	}
+
+	scenarios = append([]LoanScenario{{Name: "Current"}}, scenarios...)
+	for i := 0; i < len(scenarios); i++ {
+		ls := LoanSchedule{LoanScenario: scenarios[i]}
+		err = ls.project(terms)
+		if err != nil {
+			return schedules, err
+		}
+		if i > 0 {
+			ls.InterestSaved = schedules[0].TotalInterest.Sub(ls.TotalInterest)
+		}
+		schedules = append(schedules, ls)
+	}
+
+	log.Printf("[MODEL] ACCOUNT(%d) LOAN AMORTIZATION SCENARIOS(%d) PAYMENTS(%d)",
+		   a.ID, len(schedules), schedules[0].NumPayments())
+	return schedules, nil
+}
@@ -58,8 +58,9 @@ func compareDates(dx *time.Time, dy *time.Time) bool {
 	return dx.Format(timeFormatCompare) == dy.Format(timeFormatCompare)
 }
 
+// default (USD) currency formatting, see currencyFormat for others
 func currency(value decimal.Decimal) string {
-	return  "$" + value.StringFixedBank(2)
+	return currencyFormat(value, CurrencyTypeUSD)
 }
 
 func dateFirst(a *time.Time, b *time.Time, descending bool) bool {
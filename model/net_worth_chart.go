@@ -0,0 +1,68 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+)
+
+func NetWorthChartOptions() string {
+	opts := new(SecurityChartOptions)
+
+	jsonData, err := json.Marshal(opts)
+	if err != nil {
+		log.Println(err)
+	}
+	return string(jsonData)
+}
+
+func NetWorthChartData(entries []NetWorth) string {
+	hasInvestments := false
+	longRange := len(entries) > 1 &&
+		     entries[len(entries)-1].Date.Sub(entries[0].Date).Hours() > 24 * 366
+
+	dataset0 := new(SecurityChartDataSet)
+	dataset0.Label = "Net Worth"
+	dataset0.BorderColor = "#3B82F6"
+	dataset0.BackgroundColor = "transparent"
+	dataset0.Fill = "origin"
+
+	dataset1 := new(SecurityChartDataSet)
+	dataset1.Label = "Investments"
+	dataset1.BorderColor = "#10B981"
+	dataset1.BackgroundColor = "transparent"
+	dataset1.Fill = "origin"
+
+	data := new(SecurityChart)
+	for i := 0; i < len(entries); i++ {
+		nw := &entries[i]
+		d := nw.Date
+		if longRange {
+			data.Labels = append(data.Labels, Months[d.Month()] + strconv.Itoa(d.Year()))
+		} else {
+			data.Labels = append(data.Labels, Months[d.Month()] + strconv.Itoa(d.Day()))
+		}
+		dataset0.Data = append(dataset0.Data, nw.Total())
+		dataset1.Data = append(dataset1.Data, nw.Investments)
+		hasInvestments = hasInvestments || !nw.Investments.IsZero()
+	}
+
+	data.Datasets = append(data.Datasets, dataset0)
+	if hasInvestments {
+		data.Datasets = append(data.Datasets, dataset1)
+	}
+
+	log.Printf("[MODEL] NET WORTH CHART DATA POINTS(%d)", len(entries))
+
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		log.Println(err)
+	}
+	return string(jsonData)
+}
@@ -0,0 +1,215 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"github.com/pacificbrian/go-bookkeeper/config"
+	"gorm.io/gorm/clause"
+)
+
+const defaultOfxSyncInterval = 24 * time.Hour
+// first retry of failed OfxSync, doubled for each further failure
+const ofxSyncRetryDelay = 15 * time.Minute
+const maxOfxSyncErrorLength = 255
+
+// An OfxSync is one scheduled download (FetchOFX) of a linked Account,
+// using its stored Credential. Failures counts consecutive failed
+// downloads, and NextSync is when Account is next downloaded, retried
+// after a delay doubling with each failure (up to the sync interval).
+type OfxSync struct {
+	Model
+	AccountID uint `gorm:"not null"`
+	ImportID uint
+	StartedAt time.Time
+	CashFlowCount uint
+	TradeCount uint
+	DuplicateCount uint
+	Failures uint
+	Error string
+	NextSync time.Time
+	Account Account
+}
+
+func ofxSyncInterval() time.Duration {
+	hours := config.GlobalConfig().OfxSyncHours
+	if hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return defaultOfxSyncInterval
+}
+
+func ofxSyncRetry(failures uint) time.Duration {
+	delay := ofxSyncRetryDelay
+	interval := ofxSyncInterval()
+	for i := uint(1); i < failures && delay < interval; i++ {
+		delay *= 2
+	}
+	if delay > interval {
+		delay = interval
+	}
+	return delay
+}
+
+func (s OfxSync) Failed() bool {
+	return s.Error != ""
+}
+
+func (s OfxSync) TransactionCount() uint {
+	return s.CashFlowCount + s.TradeCount
+}
+
+// Account is linked if it can download from its Institution with a
+// stored Credential
+func (a *Account) isOfxLinked(session *Session) bool {
+	return a.SupportsDownload(true) &&
+	       new(Credential).ForAccount(session, a) != nil
+}
+
+func (a *Account) lastOfxSync(session *Session) *OfxSync {
+	entries := []OfxSync{}
+	session.DB.Where(&OfxSync{AccountID: a.ID}).
+	   Order("id desc").Limit(1).Find(&entries)
+	if len(entries) == 0 {
+		return nil
+	}
+	return &entries[0]
+}
+
+// List Account's most recent OfxSyncs
+func (a *Account) ListOfxSyncs(session *Session, limit int) []OfxSync {
+	entries := []OfxSync{}
+	if !a.Verified {
+		a = a.Get(session, false)
+		if a == nil {
+			return entries
+		}
+	}
+
+	session.DB.Where(&OfxSync{AccountID: a.ID}).
+	   Order("id desc").Limit(limit).Find(&entries)
+	return entries
+}
+
+// List User's Accounts whose last OfxSync failed (with Account set)
+func ListOfxSyncFailures(session *Session) []OfxSync {
+	entries := []OfxSync{}
+	accounts := List(session, false)
+	for i := 0; i < len(accounts); i++ {
+		a := &accounts[i]
+		if a.InstitutionID == 0 {
+			continue
+		}
+		s := a.lastOfxSync(session)
+		if s != nil && s.Failed() {
+			s.Account = *a
+			entries = append(entries, *s)
+		}
+	}
+	return entries
+}
+
+// Download Account with FetchOFX and record OfxSync
+func (a *Account) syncOFX(session *Session, last *OfxSync) *OfxSync {
+	s := &OfxSync{AccountID: a.ID, StartedAt: time.Now()}
+	im := &Import{AccountID: a.ID}
+
+	err := im.FetchOFX(session)
+	if err == nil {
+		s.NextSync = s.StartedAt.Add(ofxSyncInterval())
+		if im.ID > 0 {
+			im.CountImported(session)
+			s.ImportID = im.ID
+			s.CashFlowCount = im.CashFlowCount
+			s.TradeCount = im.TradeCount
+			s.DuplicateCount = im.DuplicateCount
+		}
+	} else {
+		s.Failures = 1
+		if last != nil {
+			s.Failures += last.Failures
+		}
+		s.Error = err.Error()
+		// truncate whole characters, not bytes
+		if runes := []rune(s.Error); len(runes) > maxOfxSyncErrorLength {
+			s.Error = string(runes[:maxOfxSyncErrorLength])
+		}
+		s.NextSync = s.StartedAt.Add(ofxSyncRetry(s.Failures))
+	}
+
+	session.DB.Omit(clause.Associations).Create(s)
+	log.Printf("[MODEL] SYNC OFX ACCOUNT(%d) IMPORT(%d) TRANSACTIONS(%d) FAILURES(%d) NEXT(%s)",
+		   a.ID, s.ImportID, s.TransactionCount(), s.Failures,
+		   s.NextSync.Format(timeFormatPrint))
+	return s
+}
+
+// Download linked Account now, without waiting for NextSync
+func (a *Account) SyncOFX(session *Session) (*OfxSync, error) {
+	if !a.Verified {
+		a = a.Get(session, false)
+		if a == nil {
+			return nil, errors.New("Permission Denied")
+		}
+	}
+	if !a.isOfxLinked(session) {
+		return nil, errors.New("Account Not Linked")
+	}
+
+	s := a.syncOFX(session, a.lastOfxSync(session))
+	if s.Failed() {
+		return s, errors.New(s.Error)
+	}
+	return s, nil
+}
+
+// Download linked Accounts of User which are due, returning count of
+// Accounts downloaded and how many failed
+func syncOfxAccounts(session *Session, now time.Time) (int, int) {
+	synced := 0
+	failed := 0
+
+	accounts := List(session, false)
+	for i := 0; i < len(accounts); i++ {
+		a := &accounts[i]
+		if !a.isOfxLinked(session) {
+			continue
+		}
+		last := a.lastOfxSync(session)
+		if last != nil && now.Before(last.NextSync) {
+			continue
+		}
+
+		s := a.syncOFX(session, last)
+		synced += 1
+		if s.Failed() {
+			failed += 1
+		}
+	}
+	return synced, failed
+}
+
+// Download linked Accounts which are due, for all Users
+func jobSyncOFX(js *jobScheduler) (string, error) {
+	failed := 0
+	now := time.Now()
+	count := js.forEachUser(func(session *Session) int {
+		synced, userFailed := syncOfxAccounts(session, now)
+		failed += userFailed
+		return synced
+	})
+
+	result := fmt.Sprintf("%d accounts synced", count)
+	if failed > 0 {
+		return result, errors.New(fmt.Sprintf("%d of %d accounts failed, see /accounts",
+						      failed, count))
+	}
+	return result, nil
+}
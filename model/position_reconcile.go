@@ -0,0 +1,274 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"github.com/aclindsa/ofxgo"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// A BrokerPosition is the shares of a Security held as reported by the
+// broker in an OFX investment statement (INVPOSLIST). SecurityID is 0 if
+// the Security could not be found.
+type BrokerPosition struct {
+	Model
+	ImportID uint `gorm:"not null"`
+	AccountID uint `gorm:"not null"`
+	SecurityID uint
+	UniqueID string
+	Name string
+	Shares decimal.Decimal
+	Price decimal.Decimal
+	ComputedShares decimal.Decimal `gorm:"-:all"`
+	Security Security `gorm:"-:all"`
+}
+
+// Compares the latest broker positions and cash balance of an investment
+// Account with the Account's Securities and CashBalance.
+type PositionReport struct {
+	Import Import
+	Date time.Time
+	Positions []BrokerPosition
+	CashBalance decimal.Decimal
+	BrokerCashBalance decimal.NullDecimal
+}
+
+// broker shares minus shares computed from Trades
+func (p BrokerPosition) Difference() decimal.Decimal {
+	return p.Shares.Sub(p.ComputedShares)
+}
+
+func (p BrokerPosition) IsBalanced() bool {
+	return p.Difference().IsZero()
+}
+
+func (r PositionReport) Currency(value decimal.Decimal) string {
+	return r.Import.Account.Currency(value)
+}
+
+func (r PositionReport) HasBrokerCashBalance() bool {
+	return r.BrokerCashBalance.Valid
+}
+
+// broker cash balance minus Account.CashBalance
+func (r PositionReport) CashDifference() decimal.Decimal {
+	return r.BrokerCashBalance.Decimal.Sub(r.CashBalance)
+}
+
+func (r PositionReport) IsBalanced() bool {
+	if r.HasBrokerCashBalance() && !r.CashDifference().IsZero() {
+		return false
+	}
+	for i := 0; i < len(r.Positions); i++ {
+		if !r.Positions[i].IsBalanced() {
+			return false
+		}
+	}
+	return true
+}
+
+func positionFromOFX(position ofxgo.Position) *ofxgo.InvPosition {
+	switch p := position.(type) {
+	case ofxgo.DebtPosition:
+		return &p.InvPos
+	case ofxgo.MFPosition:
+		return &p.InvPos
+	case ofxgo.OptPosition:
+		return &p.InvPos
+	case ofxgo.OtherPosition:
+		return &p.InvPos
+	case ofxgo.StockPosition:
+		return &p.InvPos
+	}
+	return nil
+}
+
+// Save positions and cash balance of OFX investment statement with Import
+func (im *Import) savePositions(session *Session, resp *ofxgo.Response) int {
+	if len(resp.InvStmt) == 0 {
+		return 0
+	}
+	stmt, valid := resp.InvStmt[0].(*ofxgo.InvStatementResponse)
+	if !valid || (len(stmt.InvPosList) == 0 && stmt.InvBal == nil) {
+		return 0
+	}
+	db := session.DB
+	securities := im.getOfxSecurities(resp)
+
+	if im.ID == 0 {
+		im.create(db)
+	}
+	date := timeFromOFX(&stmt.DtAsOf)
+	updates := map[string]interface{}{"positions_date": date}
+	if stmt.InvBal != nil {
+		cash, _ := stmt.InvBal.AvailCash.Float64()
+		updates["broker_cash_balance"] = decimal.NewFromFloatWithExponent(cash, -2)
+	}
+	db.Omit(clause.Associations).Model(im).Updates(updates)
+
+	for _, position := range stmt.InvPosList {
+		invPos := positionFromOFX(position)
+		if invPos == nil {
+			continue
+		}
+		units, _ := invPos.Units.Float64()
+		price, _ := invPos.UnitPrice.Float64()
+		p := BrokerPosition{ImportID: im.ID, AccountID: im.AccountID,
+				    UniqueID: strings.TrimSpace(string(invPos.SecID.UniqueID)),
+				    Shares: decimal.NewFromFloatWithExponent(units, -4),
+				    Price: decimal.NewFromFloatWithExponent(price, -4)}
+		info, found := securities[p.UniqueID]
+		if found {
+			p.Name = strings.TrimSpace(string(info.SecName))
+			if p.Name == "" {
+				p.Name = strings.TrimSpace(string(info.Ticker))
+			}
+		}
+		security := im.securityGetByOFX(session, &invPos.SecID, securities, false)
+		if security != nil {
+			p.SecurityID = security.ID
+		}
+		db.Omit(clause.Associations).Create(&p)
+	}
+	log.Printf("[MODEL] IMPORT(%d) SAVE POSITIONS(%d)", im.ID, len(stmt.InvPosList))
+	return len(stmt.InvPosList)
+}
+
+func (im *Import) deletePositions(db *gorm.DB) {
+	db.Where(&BrokerPosition{ImportID: im.ID}).Delete(&BrokerPosition{})
+}
+
+// Shares of Security from its Trades dated on or before date
+func (s *Security) computeSharesAsOf(db *gorm.DB, date time.Time) decimal.Decimal {
+	shares := decimal.Zero
+	trades := []Trade{}
+
+	db.Order("date").Order("id").Where(&Trade{SecurityID: s.ID}).
+	   Where("date < ?", dateOnly(date).AddDate(0, 0, 1)).Find(&trades)
+	for i := 0; i < len(trades); i++ {
+		t := &trades[i]
+		if t.IsBuy() || t.IsSharesIn() {
+			shares = shares.Add(t.Shares)
+		} else if t.IsSell() || t.IsSharesOut() {
+			shares = shares.Sub(t.Shares)
+		} else if t.IsSplit() {
+			// Shares of Split is the ratio of new to old shares
+			shares = shares.Mul(t.Shares)
+		}
+	}
+	return shares
+}
+
+// Compare the latest broker positions (from a committed Import) with the
+// shares of Account's Securities computed from Trades as of the date of
+// the positions. Securities held then but not reported by the broker are
+// included with broker Shares of 0.
+func (a *Account) GetPositionReport(session *Session) (*PositionReport, error) {
+	if !a.Verified {
+		a = a.Get(session, false)
+		if a == nil {
+			return nil, errors.New("Permission Denied")
+		}
+	}
+	if !a.IsInvestment() {
+		return nil, errors.New("Not an Investment Account")
+	}
+	db := session.DB
+
+	r := new(PositionReport)
+	im := &r.Import
+	db.Where(&Import{AccountID: a.ID}).
+	   Where("positions_date IS NOT NULL AND staged = ?", false).
+	   Order("id desc").First(im)
+	if im.ID == 0 {
+		return nil, errors.New("No Broker Positions Imported")
+	}
+	im.Account = *a
+	r.Date = *im.PositionsDate
+	r.CashBalance = a.CashBalance
+	r.BrokerCashBalance = im.BrokerCashBalance
+
+	reported := make(map[uint]bool)
+	db.Order("id").Where(&BrokerPosition{ImportID: im.ID}).Find(&r.Positions)
+	for i := 0; i < len(r.Positions); i++ {
+		p := &r.Positions[i]
+		if p.SecurityID > 0 {
+			p.Security.ID = p.SecurityID
+			if p.Security.Get(session) == nil {
+				return nil, errors.New("Permission Denied")
+			}
+			p.ComputedShares = p.Security.computeSharesAsOf(db, r.Date)
+			reported[p.SecurityID] = true
+		}
+	}
+
+	securities := []Security{}
+	db.Order("id").Where(&Security{AccountID: a.ID}).Find(&securities)
+	for i := 0; i < len(securities); i++ {
+		if reported[securities[i].ID] {
+			continue
+		}
+		shares := securities[i].computeSharesAsOf(db, r.Date)
+		if !shares.IsPositive() {
+			continue
+		}
+		p := BrokerPosition{AccountID: a.ID, SecurityID: securities[i].ID}
+		p.Security.ID = p.SecurityID
+		if p.Security.Get(session) == nil {
+			return nil, errors.New("Permission Denied")
+		}
+		p.Name = p.Security.Company.GetName()
+		p.ComputedShares = shares
+		r.Positions = append(r.Positions, p)
+	}
+
+	log.Printf("[MODEL] ACCOUNT(%d) POSITION REPORT IMPORT(%d) POSITIONS(%d)",
+		   a.ID, im.ID, len(r.Positions))
+	return r, nil
+}
+
+// Enter SharesIn or SharesOut Trade (dated as of broker positions) so the
+// Security's shares match those reported by the broker
+func (r *PositionReport) Adjust(session *Session, securityID uint) error {
+	var p *BrokerPosition
+	for i := 0; i < len(r.Positions); i++ {
+		if r.Positions[i].SecurityID == securityID && securityID > 0 {
+			p = &r.Positions[i]
+		}
+	}
+	if p == nil {
+		return errors.New("Invalid Security")
+	}
+	difference := p.Difference()
+	if difference.IsZero() {
+		return errors.New("Position Already Matches")
+	}
+
+	t := new(Trade)
+	t.TradeTypeID = SharesIn
+	if difference.IsNegative() {
+		t.TradeTypeID = SharesOut
+	}
+	t.Date = r.Date
+	t.Shares = difference.Abs()
+	t.Price = p.Price
+	t.setDefaults()
+	t.SecurityID = p.SecurityID
+	err := t.insertTrade(session.DB, &p.Security)
+	if err != nil {
+		return err
+	}
+	p.ComputedShares = p.Shares
+	log.Printf("[MODEL] ADJUST POSITION SECURITY(%d) TRADE(%d)", p.SecurityID, t.ID)
+	return nil
+}
@@ -0,0 +1,127 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm/clause"
+)
+
+// A Reconcile is a reconcile session of an Account against a statement.
+// Only one Reconcile per Account is in progress (not Completed) at a time.
+type Reconcile struct {
+	Model
+	AccountID uint `gorm:"not null"`
+	StatementDate time.Time
+	StatementBalance decimal.Decimal
+	OpeningBalance decimal.Decimal `gorm:"-:all"`
+	ClearedBalance decimal.Decimal `gorm:"-:all"`
+	Completed bool
+	CreatedOn time.Time
+	Account Account
+}
+
+func (r Reconcile) Currency(value decimal.Decimal) string {
+	return r.Account.Currency(value)
+}
+
+// amount remaining to be cleared for Account to match statement
+func (r Reconcile) Difference() decimal.Decimal {
+	return r.StatementBalance.Sub(r.ClearedBalance)
+}
+
+func (r Reconcile) IsBalanced() bool {
+	return r.Difference().IsZero()
+}
+
+// r.Account must be verified
+func (r *Reconcile) postQueryInit() {
+	db := getDbManager()
+	r.OpeningBalance = r.Account.reconciledBalance(db, nil)
+	r.ClearedBalance = r.Account.reconciledBalance(db, &r.StatementDate)
+}
+
+// Create or Update statement details (StatementDate, StatementBalance)
+// r.Account access already verified with Account.GetReconcile
+func (r *Reconcile) Update() error {
+	db := getDbManager()
+	if !r.Account.Verified {
+		return errors.New("Permission Denied")
+	}
+	if r.Completed {
+		return errors.New("Reconcile Completed")
+	}
+
+	var err error
+	if r.ID == 0 {
+		r.CreatedOn = time.Now()
+		result := db.Omit(clause.Associations).Create(r)
+		err = result.Error
+	} else {
+		result := db.Omit(clause.Associations).Save(r)
+		err = result.Error
+	}
+	if err == nil {
+		log.Printf("[MODEL] UPDATE RECONCILE(%d) ACCOUNT(%d) STATEMENT(%s %f)",
+			   r.ID, r.AccountID, dateToString(&r.StatementDate),
+			   r.StatementBalance.InexactFloat64())
+		r.postQueryInit()
+	}
+	return err
+}
+
+// Mark cleared CashFlows as reconciled (locking them), and complete the
+// Reconcile. This requires that cleared CashFlows match the statement.
+func (r *Reconcile) Finish() error {
+	db := getDbManager()
+	if !r.Account.Verified {
+		return errors.New("Permission Denied")
+	}
+	if r.ID == 0 || r.Completed {
+		return errors.New("Invalid Request")
+	}
+
+	r.postQueryInit()
+	if !r.IsBalanced() {
+		return errors.New(fmt.Sprintf("Reconcile Difference (%s)",
+					      r.Account.Currency(r.Difference())))
+	}
+
+	query := map[string]interface{}{"account_id": r.AccountID, "type": nil}
+	result := db.Model(&CashFlow{}).
+		     Where("cleared = 1 AND (reconciled = 0 OR reconciled IS NULL)").
+		     Where("date <= ?", r.StatementDate).
+		     Where(query).Update("reconciled", true)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	r.Completed = true
+	db.Omit(clause.Associations).Model(r).Update("completed", true)
+	log.Printf("[MODEL] FINISH RECONCILE(%d) ACCOUNT(%d) RECONCILED(%d)",
+		   r.ID, r.AccountID, result.RowsAffected)
+	return nil
+}
+
+// Cancel the in progress Reconcile; cleared CashFlows remain cleared.
+func (r *Reconcile) Delete() error {
+	db := getDbManager()
+	if !r.Account.Verified {
+		return errors.New("Permission Denied")
+	}
+	if r.ID == 0 || r.Completed {
+		return errors.New("Invalid Request")
+	}
+
+	log.Printf("[MODEL] DELETE RECONCILE(%d) ACCOUNT(%d)", r.ID, r.AccountID)
+	db.Delete(r)
+	return nil
+}
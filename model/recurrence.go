@@ -0,0 +1,455 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Adjustment of ScheduledCashFlow dates which fall on a weekend or holiday
+const (
+	AdjustNone uint = iota
+	AdjustPrevious // previous business day
+	AdjustNext // next business day
+	AdjustModifiedNext // next business day, unless in next month
+)
+
+type RepeatAdjustType struct {
+	ID uint
+	Name string
+}
+
+// stop searching for rule occurrences after this many periods
+const maxRecurrencePeriods int = 1000
+// most days Adjust can move a date (holiday weekends)
+const maxAdjustDays int = 7
+
+type weekdayNum struct {
+	n int // 0 for every weekday in period
+	day time.Weekday
+}
+
+// A recurrenceRule is parsed from an RFC 5545 RRULE. Supported are FREQ
+// (DAILY, WEEKLY, MONTHLY, YEARLY), INTERVAL, COUNT, UNTIL, BYDAY (with
+// ordinals such as 2TU or -1FR), BYMONTHDAY (negative counts from end of
+// month), BYMONTH and BYSETPOS. Weeks start on Monday (WKST is ignored).
+type recurrenceRule struct {
+	freq string
+	interval int
+	count int
+	until time.Time
+	byDay []weekdayNum
+	byMonthDay []int
+	byMonth []int
+	bySetPos []int
+}
+
+var weekdayNames = map[string]time.Weekday{"SU": time.Sunday, "MO": time.Monday,
+					   "TU": time.Tuesday, "WE": time.Wednesday,
+					   "TH": time.Thursday, "FR": time.Friday,
+					   "SA": time.Saturday}
+
+func (*RepeatAdjustType) List() []RepeatAdjustType {
+	return []RepeatAdjustType{{ID: AdjustNone, Name: "None"},
+				  {ID: AdjustPrevious, Name: "Previous Business Day"},
+				  {ID: AdjustNext, Name: "Next Business Day"},
+				  {ID: AdjustModifiedNext, Name: "Next Business Day (Same Month)"}}
+}
+
+func parseRuleInts(value string, min int, max int) ([]int, error) {
+	values := []int{}
+	for _, field := range strings.Split(value, ",") {
+		i, err := strconv.Atoi(field)
+		if err != nil || i == 0 || i < min || i > max {
+			return values, errors.New("Invalid Rule Value: " + field)
+		}
+		values = append(values, i)
+	}
+	return values, nil
+}
+
+func parseRecurrenceRule(rule string) (*recurrenceRule, error) {
+	var err error
+	rr := new(recurrenceRule)
+	rr.interval = 1
+
+	rule = strings.ToUpper(strings.TrimSpace(rule))
+	rule = strings.TrimPrefix(rule, "RRULE:")
+	for _, part := range strings.Split(rule, ";") {
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			return nil, errors.New("Invalid Rule: " + part)
+		}
+
+		switch key {
+		case "FREQ":
+			switch value {
+			case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+				rr.freq = value
+			default:
+				return nil, errors.New("Unsupported FREQ: " + value)
+			}
+		case "INTERVAL":
+			rr.interval, err = strconv.Atoi(value)
+			if err != nil || rr.interval < 1 {
+				return nil, errors.New("Invalid INTERVAL: " + value)
+			}
+		case "COUNT":
+			rr.count, err = strconv.Atoi(value)
+			if err != nil || rr.count < 1 {
+				return nil, errors.New("Invalid COUNT: " + value)
+			}
+		case "UNTIL":
+			// date only, any time (or UTC) is ignored
+			if len(value) > 8 {
+				value = value[:8]
+			}
+			rr.until, err = time.ParseInLocation("20060102", value, time.Local)
+			if err != nil {
+				return nil, errors.New("Invalid UNTIL: " + value)
+			}
+		case "BYDAY":
+			for _, field := range strings.Split(value, ",") {
+				if len(field) < 2 {
+					return nil, errors.New("Invalid BYDAY: " + field)
+				}
+				wn := weekdayNum{}
+				day, found := weekdayNames[field[len(field)-2:]]
+				if !found {
+					return nil, errors.New("Invalid BYDAY: " + field)
+				}
+				wn.day = day
+				if len(field) > 2 {
+					wn.n, err = strconv.Atoi(field[:len(field)-2])
+					if err != nil || wn.n == 0 || wn.n < -53 || wn.n > 53 {
+						return nil, errors.New("Invalid BYDAY: " + field)
+					}
+				}
+				rr.byDay = append(rr.byDay, wn)
+			}
+		case "BYMONTHDAY":
+			rr.byMonthDay, err = parseRuleInts(value, -31, 31)
+		case "BYMONTH":
+			rr.byMonth, err = parseRuleInts(value, 1, 12)
+		case "BYSETPOS":
+			rr.bySetPos, err = parseRuleInts(value, -366, 366)
+		case "WKST":
+		default:
+			return nil, errors.New("Unsupported Rule: " + key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if rr.freq == "" {
+		return nil, errors.New("Rule Requires FREQ")
+	}
+	return rr, nil
+}
+
+// Civil day number of dx, for counting days across DST changes
+func dayNumber(dx time.Time) int {
+	year, month, day := dx.Date()
+	return int(time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix() / 86400)
+}
+
+// Day of month of nth weekday (n < 0 counts from end of month), or 0 if
+// month has no such day.
+func nthWeekday(year int, month time.Month, weekday time.Weekday, n int) int {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if n > 0 {
+		first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC).Weekday()
+		day := 1 + (int(weekday) - int(first) + 7) % 7 + (n - 1) * 7
+		if day > last {
+			return 0
+		}
+		return day
+	}
+	lastWeekday := time.Date(year, month, last, 0, 0, 0, 0, time.UTC).Weekday()
+	day := last - (int(lastWeekday) - int(weekday) + 7) % 7 + (n + 1) * 7
+	if day < 1 {
+		return 0
+	}
+	return day
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// start of period (day, week, month or year) containing dx
+func (rr *recurrenceRule) periodStart(dx time.Time) time.Time {
+	year, month, day := dx.Date()
+	switch rr.freq {
+	case "WEEKLY":
+		// weeks start on Monday
+		offset := (int(dx.Weekday()) + 6) % 7
+		return time.Date(year, month, day - offset, 0, 0, 0, 0, time.Local)
+	case "MONTHLY":
+		return time.Date(year, month, 1, 0, 0, 0, 0, time.Local)
+	case "YEARLY":
+		return time.Date(year, time.January, 1, 0, 0, 0, 0, time.Local)
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+}
+
+func (rr *recurrenceRule) addPeriods(period time.Time, n int) time.Time {
+	switch rr.freq {
+	case "WEEKLY":
+		return period.AddDate(0, 0, 7 * n)
+	case "MONTHLY":
+		return period.AddDate(0, n, 0)
+	case "YEARLY":
+		return period.AddDate(n, 0, 0)
+	}
+	return period.AddDate(0, 0, n)
+}
+
+// number of periods from period a to period b
+func (rr *recurrenceRule) periodsBetween(a time.Time, b time.Time) int {
+	switch rr.freq {
+	case "WEEKLY":
+		return (dayNumber(b) - dayNumber(a)) / 7
+	case "MONTHLY":
+		return (b.Year() - a.Year()) * 12 + int(b.Month()) - int(a.Month())
+	case "YEARLY":
+		return b.Year() - a.Year()
+	}
+	return dayNumber(b) - dayNumber(a)
+}
+
+// days of month matching BYMONTHDAY and BYDAY, or start's day if neither
+func (rr *recurrenceRule) monthDays(year int, month time.Month, start time.Time) []int {
+	days := []int{}
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+
+	if len(rr.byMonthDay) > 0 {
+		for _, d := range rr.byMonthDay {
+			if d < 0 {
+				d = last + d + 1
+			}
+			if d >= 1 && d <= last {
+				days = append(days, d)
+			}
+		}
+	} else if len(rr.byDay) == 0 {
+		if start.Day() <= last {
+			days = append(days, start.Day())
+		}
+	}
+
+	if len(rr.byDay) > 0 {
+		byDays := []int{}
+		for _, wn := range rr.byDay {
+			if wn.n != 0 {
+				d := nthWeekday(year, month, wn.day, wn.n)
+				if d > 0 {
+					byDays = append(byDays, d)
+				}
+				continue
+			}
+			for d := nthWeekday(year, month, wn.day, 1); d <= last; d += 7 {
+				byDays = append(byDays, d)
+			}
+		}
+		if len(rr.byMonthDay) > 0 {
+			// BYDAY limits BYMONTHDAY
+			matched := []int{}
+			for _, d := range days {
+				if containsInt(byDays, d) {
+					matched = append(matched, d)
+				}
+			}
+			days = matched
+		} else {
+			days = byDays
+		}
+	}
+	return days
+}
+
+func (rr *recurrenceRule) matchesWeekday(dx time.Time) bool {
+	if len(rr.byDay) == 0 {
+		return true
+	}
+	for _, wn := range rr.byDay {
+		if wn.day == dx.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// Occurrences of rule within period (in order), at time of day of start
+func (rr *recurrenceRule) occurrences(period time.Time, start time.Time) []time.Time {
+	dates := []time.Time{}
+	makeDate := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, start.Hour(), start.Minute(),
+				 start.Second(), 0, start.Location())
+	}
+
+	switch rr.freq {
+	case "DAILY":
+		dx := makeDate(period.Year(), period.Month(), period.Day())
+		if (len(rr.byMonthDay) == 0 ||
+		    containsInt(rr.monthDays(dx.Year(), dx.Month(), dx), dx.Day())) &&
+		   rr.matchesWeekday(dx) {
+			dates = append(dates, dx)
+		}
+	case "WEEKLY":
+		for i := 0; i < 7; i++ {
+			dx := period.AddDate(0, 0, i)
+			dx = makeDate(dx.Year(), dx.Month(), dx.Day())
+			if len(rr.byDay) == 0 && dx.Weekday() != start.Weekday() {
+				continue
+			}
+			if rr.matchesWeekday(dx) {
+				dates = append(dates, dx)
+			}
+		}
+	case "MONTHLY":
+		for _, d := range rr.monthDays(period.Year(), period.Month(), start) {
+			dates = append(dates, makeDate(period.Year(), period.Month(), d))
+		}
+	case "YEARLY":
+		months := rr.byMonth
+		if len(months) == 0 {
+			months = []int{int(start.Month())}
+		}
+		for _, m := range months {
+			for _, d := range rr.monthDays(period.Year(), time.Month(m), start) {
+				dates = append(dates, makeDate(period.Year(), time.Month(m), d))
+			}
+		}
+	}
+
+	if len(rr.byMonth) > 0 {
+		matched := []time.Time{}
+		for _, dx := range dates {
+			if containsInt(rr.byMonth, int(dx.Month())) {
+				matched = append(matched, dx)
+			}
+		}
+		dates = matched
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+
+	if len(rr.bySetPos) > 0 {
+		selected := []time.Time{}
+		for _, pos := range rr.bySetPos {
+			if pos < 0 {
+				pos = len(dates) + pos + 1
+			}
+			if pos >= 1 && pos <= len(dates) {
+				selected = append(selected, dates[pos-1])
+			}
+		}
+		sort.Slice(selected, func(i, j int) bool { return selected[i].Before(selected[j]) })
+		dates = selected
+	}
+	return dates
+}
+
+// First occurrence of rule (beginning at start) which is after date, or
+// zero Time if there are none (or after UNTIL).
+func (rr *recurrenceRule) next(start time.Time, date time.Time) time.Time {
+	first := rr.periodStart(start)
+	period := rr.periodStart(date)
+	if period.Before(first) {
+		period = first
+	}
+	// align to INTERVAL periods from start
+	skip := rr.periodsBetween(first, period) % rr.interval
+	if skip > 0 {
+		period = rr.addPeriods(period, rr.interval - skip)
+	}
+
+	for i := 0; i < maxRecurrencePeriods; i++ {
+		for _, dx := range rr.occurrences(period, start) {
+			if !rr.until.IsZero() && dayNumber(dx) > dayNumber(rr.until) {
+				return time.Time{}
+			}
+			if dx.After(date) && !dx.Before(start) {
+				return dx
+			}
+		}
+		period = rr.addPeriods(period, rr.interval)
+	}
+	return time.Time{}
+}
+
+// US Federal Reserve holidays (banks closed). Holidays on Sunday are
+// observed on Monday; those on Saturday are not observed.
+func isHoliday(dx time.Time) bool {
+	year, month, day := dx.Date()
+	weekday := dx.Weekday()
+	if weekday == time.Saturday {
+		return false
+	}
+
+	fixed := func(m time.Month, d int) bool {
+		if month == m && day == d {
+			return true
+		}
+		// observed Monday after
+		return weekday == time.Monday && month == m && day == d + 1
+	}
+	nth := func(m time.Month, wd time.Weekday, n int) bool {
+		return month == m && day == nthWeekday(year, m, wd, n)
+	}
+
+	switch {
+	case fixed(time.January, 1),
+	     nth(time.January, time.Monday, 3), // Martin Luther King Jr.
+	     nth(time.February, time.Monday, 3), // Presidents
+	     nth(time.May, time.Monday, -1), // Memorial
+	     year >= 2022 && fixed(time.June, 19), // Juneteenth
+	     fixed(time.July, 4),
+	     nth(time.September, time.Monday, 1), // Labor
+	     nth(time.October, time.Monday, 2), // Columbus
+	     fixed(time.November, 11), // Veterans
+	     nth(time.November, time.Thursday, 4), // Thanksgiving
+	     fixed(time.December, 25):
+		return true
+	}
+	return false
+}
+
+func isBusinessDay(dx time.Time) bool {
+	weekday := dx.Weekday()
+	return weekday != time.Saturday && weekday != time.Sunday && !isHoliday(dx)
+}
+
+// Move date falling on weekend or holiday according to adjust
+func adjustDate(dx time.Time, adjust uint) time.Time {
+	if adjust == AdjustNone || isBusinessDay(dx) {
+		return dx
+	}
+
+	step := 1
+	if adjust == AdjustPrevious {
+		step = -1
+	}
+	adjusted := dx
+	for !isBusinessDay(adjusted) {
+		adjusted = adjusted.AddDate(0, 0, step)
+	}
+	if adjust == AdjustModifiedNext && adjusted.Month() != dx.Month() {
+		return adjustDate(dx, AdjustPrevious)
+	}
+	return adjusted
+}
@@ -7,8 +7,11 @@
 package model
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"strconv"
+	"time"
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -27,7 +30,11 @@ type RepeatInterval struct {
 	RepeatIntervalTypeID uint `form:"repeat_interval_type_id"`
 	RepeatsLeft uint `form:"repeats" gorm:"default:NULL"`
 	RepeatsLeftPtr *uint `gorm:"-:all"`
+	Rule string `form:"rule" gorm:"default:NULL"`
+	Adjust uint `form:"adjust"`
 	StartDay int
+	StartDate time.Time `gorm:"default:NULL"`
+	EndDate time.Time `gorm:"default:NULL"`
 	RepeatIntervalType RepeatIntervalType
 }
 
@@ -65,6 +72,25 @@ func (r *RepeatInterval) SetRepeatsLeft(repeats string) {
 	}
 }
 
+// Rule (if set) replaces RepeatIntervalType for scheduling
+func (r RepeatInterval) GetName() string {
+	if r.Rule != "" {
+		return r.Rule
+	}
+	return r.RepeatIntervalType.Name
+}
+
+func (r RepeatInterval) GetEndDate() string {
+	if r.EndDate.IsZero() {
+		return ""
+	}
+	return r.EndDate.Format("2006-01-02")
+}
+
+func (r *RepeatInterval) SetEndDate(endDate string) {
+	r.EndDate, _ = time.ParseInLocation("2006-01-02", endDate, time.Local)
+}
+
 func (r *RepeatInterval) Preload(db *gorm.DB) {
 	if r.CashFlowID == 0 {
 		db.Preload("RepeatIntervalType").First(&r)
@@ -84,30 +110,111 @@ func (r *RepeatInterval) Preload(db *gorm.DB) {
 	}
 }
 
-// r should already been Preloaded
-func (r *RepeatInterval) advance(db *gorm.DB) int {
-	days := int(r.RepeatIntervalType.Days)
+// First occurrence of Rule whose (Adjusted) date is after date. As Adjust
+// may have moved date, occurrences are searched from before it.
+func (r *RepeatInterval) nextRuleDate(rr *recurrenceRule, date time.Time) time.Time {
+	start := r.StartDate
+	if start.IsZero() {
+		start = date
+	}
+
+	nominal := date.AddDate(0, 0, -maxAdjustDays)
+	for {
+		nominal = rr.next(start, nominal)
+		if nominal.IsZero() {
+			return nominal
+		}
+		adjusted := adjustDate(nominal, r.Adjust)
+		if adjusted.After(date) {
+			return adjusted
+		}
+	}
+}
+
+// Validate Rule and return first date on or after date which it
+// schedules. If newStart, date also becomes start of Rule (for INTERVAL)
+// and COUNT is used for RepeatsLeft.
+func (r *RepeatInterval) applyRule(date time.Time, newStart bool) (time.Time, error) {
+	if r.Rule == "" {
+		return date, nil
+	}
+	rr, err := parseRecurrenceRule(r.Rule)
+	if err != nil {
+		return date, errors.New(fmt.Sprintf("Invalid Recurrence Rule (%v)", err))
+	}
+
+	if newStart || r.StartDate.IsZero() {
+		r.StartDate = date
+	}
+	if newStart && rr.count > 0 && r.RepeatsLeftPtr == nil {
+		r.SetRepeatsLeft(strconv.Itoa(rr.count))
+	}
+	first := r.nextRuleDate(rr, date.Add(-time.Second))
+	if first.IsZero() {
+		return date, errors.New("Recurrence Rule Has No Dates")
+	}
+	return first, nil
+}
+
+// Date following date per Rule or RepeatIntervalType, or zero Time if
+// there is none (Once, or after EndDate). Does not use RepeatsLeft.
+func (r *RepeatInterval) nextDate(date time.Time) time.Time {
+	var next time.Time
+	if r.Rule != "" {
+		rr, err := parseRecurrenceRule(r.Rule)
+		if err != nil {
+			log.Printf("[MODEL] REPEAT_INTERVAL(%d) RULE ERROR: %v", r.ID, err)
+			return next
+		}
+		next = r.nextRuleDate(rr, date)
+	} else if r.RepeatIntervalType.Days > 0 {
+		next = advanceDate(date, int(r.RepeatIntervalType.Days), r.StartDay)
+	}
+
+	if !next.IsZero() && !r.EndDate.IsZero() &&
+	   dayNumber(next) > dayNumber(r.EndDate) {
+		return time.Time{}
+	}
+	return next
+}
 
-	// decrement RepeatsLeft
-	if r.RepeatsLeft > 0 {
+// r should already been Preloaded. Returns Date to follow date, or zero
+// Time if ScheduledCashFlow should not repeat. RepeatsLeft is only updated
+// if unchanged in database, else returns false as was already advanced
+// (posted concurrently by a Job or another Session).
+func (r *RepeatInterval) advance(db *gorm.DB, date time.Time) (time.Time, bool) {
+	var result *gorm.DB
+	next := r.nextDate(date)
+
+	if next.IsZero() {
+		// if IntervalType == Once or past EndDate, don't let it repeat
+		r.RepeatsLeft = 0
+		r.RepeatsLeftPtr = &r.RepeatsLeft
+		updates := map[string]interface{}{"repeats_left": 0}
+		result = db.Omit(clause.Associations).Model(r).
+			    Where("repeats_left IS NULL OR repeats_left > 0").
+			    Select("repeats_left").Updates(updates)
+	} else if r.RepeatsLeft > 0 {
+		// decrement RepeatsLeft
 		r.RepeatsLeft -= 1
 		updates := map[string]interface{}{"repeats_left": gorm.Expr("repeats_left - ?", 1)}
-		db.Omit(clause.Associations).Model(r).
-		   Select("repeats_left").Updates(updates)
-	} else if days == 0 {
-		// if IntervalType == Once, don't let it repeat
-		db.Omit(clause.Associations).Model(r).
-		   Select("repeats_left").Updates(RepeatInterval{RepeatsLeft: 0})
+		result = db.Omit(clause.Associations).Model(r).
+			    Where("repeats_left = ?", r.RepeatsLeft + 1).
+			    Select("repeats_left").Updates(updates)
+	}
+	if result != nil && result.RowsAffected == 0 {
+		log.Printf("[MODEL] ADVANCE REPEAT_INTERVAL(%d) ALREADY ADVANCED", r.ID)
+		return time.Time{}, false
 	}
 
 	// use helper, can't test r.RepeatsLeft because unset/NULL == 0
 	if !r.HasRepeatsLeft() {
-		days = 0 // hit when looping until final Repeat
+		next = time.Time{} // hit when looping until final Repeat
 	}
 
-	log.Printf("[MODEL] ADVANCE REPEAT_INTERVAL(%d) DAYS(%d) LEFT(%d, %t)",
-		   r.ID, days, r.RepeatsLeft, r.RepeatsLeftPtr != nil)
-	return days
+	log.Printf("[MODEL] ADVANCE REPEAT_INTERVAL(%d) NEXT(%s) LEFT(%d, %t)",
+		   r.ID, dateToString(&next), r.RepeatsLeft, r.RepeatsLeftPtr != nil)
+	return next, true
 }
 
 func (*RepeatIntervalType) List(db *gorm.DB) []RepeatIntervalType {
@@ -120,6 +227,9 @@ func (*RepeatIntervalType) List(db *gorm.DB) []RepeatIntervalType {
 func (r *RepeatInterval) Create(db *gorm.DB, c *CashFlow) error {
 	r.CashFlowID = c.ID
 	r.StartDay = c.Date.Day()
+	if r.StartDate.IsZero() {
+		r.StartDate = c.Date
+	}
 	result := db.Omit(clause.Associations).Create(r)
 	log.Printf("[MODEL] CREATE REPEAT_INTERVAL(%d) FOR CASHFLOW(%d)",
 		   r.ID, c.ID)
@@ -135,6 +245,11 @@ func (r *RepeatInterval) Update() error {
 		result = db.Omit(clause.Associations).Model(r).
 			     Select("repeats_left").Updates(updates)
 	}
+	if result.Error == nil && r.EndDate.IsZero() {
+		updates := map[string]interface{}{"end_date": nil}
+		result = db.Omit(clause.Associations).Model(r).
+			     Select("end_date").Updates(updates)
+	}
 	log.Printf("[MODEL] UPDATE REPEAT_INTERVAL(%d) FOR CASHFLOW(%d)",
 		   r.ID, r.CashFlowID)
 	return result.Error
@@ -0,0 +1,358 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// choices for the Transfer, Split and Imported filters of a Search
+const (
+	SearchAny uint = iota
+	SearchOnly
+	SearchExclude
+)
+
+// more than this many results and Search is Truncated
+const maxSearchResults int = 2000
+
+// A Search filters CashFlows across all of a User's Accounts; empty fields
+// match everything. PayeeName and Memo match any part of the text, and
+// MinAmount/MaxAmount are compared to the absolute Amount. A Search with
+// a Name is saved, and can be run again later.
+type Search struct {
+	Model
+	UserID uint `gorm:"not null"`
+	Name string `form:"search.Name"`
+	PayeeName string `form:"search.PayeeName"`
+	Memo string `form:"search.Memo"`
+	Transnum string `form:"search.Transnum"`
+	MinAmount decimal.NullDecimal
+	MaxAmount decimal.NullDecimal
+	StartDate time.Time `gorm:"default:NULL"`
+	EndDate time.Time `gorm:"default:NULL"`
+	AccountID uint `form:"search.account_id"`
+	CategoryID uint `form:"search.category_id"`
+	TagID uint `form:"search.tag_id"`
+	Transfer uint `form:"search.transfer"`
+	Split uint `form:"search.split"`
+	Imported uint `form:"search.imported"`
+	Verified bool `gorm:"-:all"`
+}
+
+// Matching CashFlows (Splits instead of their parent) by date, with
+// totals in User's base CurrencyType. Missing is number of CashFlows
+// which could not be converted (no ExchangeRate).
+type SearchResult struct {
+	CashFlows []CashFlow
+	Credits decimal.Decimal
+	Debits decimal.Decimal
+	Missing int
+	Truncated bool
+	currencyTypeID uint
+}
+
+type SearchFilterType struct {
+	ID uint
+	Name string
+}
+
+func (*SearchFilterType) List() []SearchFilterType {
+	return []SearchFilterType{{ID: SearchAny, Name: "Any"},
+				  {ID: SearchOnly, Name: "Only"},
+				  {ID: SearchExclude, Name: "Exclude"}}
+}
+
+func (sr SearchResult) Currency(value decimal.Decimal) string {
+	return currencyFormat(value, sr.currencyTypeID)
+}
+
+func (sr SearchResult) Count() int {
+	return len(sr.CashFlows)
+}
+
+func (sr SearchResult) Total() decimal.Decimal {
+	return sr.Credits.Add(sr.Debits)
+}
+
+func (s *Search) sanitizeInputs() {
+	sanitizeString(&s.Name)
+	sanitizeString(&s.PayeeName)
+	sanitizeString(&s.Memo)
+	sanitizeString(&s.Transnum)
+	if s.Transfer > SearchExclude {
+		s.Transfer = SearchAny
+	}
+	if s.Split > SearchExclude {
+		s.Split = SearchAny
+	}
+	if s.Imported > SearchExclude {
+		s.Imported = SearchAny
+	}
+}
+
+// parse monetary input (allowing $ and commas); invalid or empty is NULL
+func nullDecimalFromString(input string) decimal.NullDecimal {
+	input = strings.Replace(strings.Trim(input, "$ "), ",", "", -1)
+	value, err := decimal.NewFromString(input)
+	return decimal.NullDecimal{Decimal: value.Round(2), Valid: (err == nil)}
+}
+
+func (s Search) GetMinAmount() string {
+	if !s.MinAmount.Valid {
+		return ""
+	}
+	return s.MinAmount.Decimal.StringFixed(2)
+}
+
+func (s Search) GetMaxAmount() string {
+	if !s.MaxAmount.Valid {
+		return ""
+	}
+	return s.MaxAmount.Decimal.StringFixed(2)
+}
+
+func (s *Search) SetMinAmount(amount string) {
+	s.MinAmount = nullDecimalFromString(amount)
+}
+
+func (s *Search) SetMaxAmount(amount string) {
+	s.MaxAmount = nullDecimalFromString(amount)
+}
+
+func (s Search) GetStartDate() string {
+	if s.StartDate.IsZero() {
+		return ""
+	}
+	return s.StartDate.Format("2006-01-02")
+}
+
+func (s Search) GetEndDate() string {
+	if s.EndDate.IsZero() {
+		return ""
+	}
+	return s.EndDate.Format("2006-01-02")
+}
+
+func (s *Search) SetStartDate(startDate string) {
+	s.StartDate, _ = time.ParseInLocation("2006-01-02", startDate, time.Local)
+}
+
+func (s *Search) SetEndDate(endDate string) {
+	s.EndDate, _ = time.ParseInLocation("2006-01-02", endDate, time.Local)
+}
+
+// LIKE pattern matching any part of text; use with ESCAPE '!' (sqlite
+// has no default escape character)
+func likePattern(text string) string {
+	text = strings.Replace(text, "!", "!!", -1)
+	text = strings.Replace(text, "%", "!%", -1)
+	return "%" + strings.Replace(text, "_", "!_", -1) + "%"
+}
+
+// add Where clause to dbQuery for column according to SearchFilterType
+func searchFilter(dbQuery *gorm.DB, column string, filter uint) *gorm.DB {
+	switch filter {
+	case SearchOnly:
+		return dbQuery.Where(column)
+	case SearchExclude:
+		return dbQuery.Where("NOT (" + column + ")")
+	}
+	return dbQuery
+}
+
+// Build CashFlow query for Search within accountIDs.
+func (s *Search) query(db *gorm.DB, userID uint, accountIDs []uint) *gorm.DB {
+	dbQuery := db.Where("account_id IN ?", accountIDs).
+		      Where("(type != ? OR type IS NULL)", "RCashFlow"). // not Repeats
+		      Where("NOT (split_from > 0 AND split = 0)") // not HasSplits
+
+	if s.PayeeName != "" {
+		pattern := likePattern(s.PayeeName)
+		payees := db.Model(&Payee{}).Select("id").
+			     Where("user_id = ? AND name LIKE ? ESCAPE '!'", userID, pattern)
+		// Transfers store the other Account in PayeeID
+		accounts := db.Model(&Account{}).Select("id").
+			       Where("user_id = ? AND name LIKE ? ESCAPE '!'", userID, pattern)
+		dbQuery = dbQuery.
+			  Where("((transfer = 0 AND payee_id IN (?)) OR (transfer = 1 AND payee_id IN (?)))",
+				payees, accounts)
+	}
+	if s.Memo != "" {
+		dbQuery = dbQuery.Where("memo LIKE ? ESCAPE '!'", likePattern(s.Memo))
+	}
+	if s.Transnum != "" {
+		dbQuery = dbQuery.Where("transnum = ?", s.Transnum)
+	}
+	// decimal binds as string, which sqlite won't compare as a number
+	if s.MinAmount.Valid {
+		dbQuery = dbQuery.Where("ABS(amount) >= ?", s.MinAmount.Decimal.InexactFloat64())
+	}
+	if s.MaxAmount.Valid {
+		dbQuery = dbQuery.Where("ABS(amount) <= ?", s.MaxAmount.Decimal.InexactFloat64())
+	}
+	if !s.StartDate.IsZero() {
+		dbQuery = dbQuery.Where("date >= ?", dateOnly(s.StartDate))
+	}
+	if !s.EndDate.IsZero() {
+		dbQuery = dbQuery.Where("date < ?", dateOnly(s.EndDate).AddDate(0, 0, 1))
+	}
+	if s.CategoryID > 0 {
+		dbQuery = dbQuery.Where("transfer = 0 AND category_id = ?", s.CategoryID)
+	}
+	if s.TagID > 0 {
+		// Splits have Tags of parent
+		tagged := taggedCashFlows(db, s.TagID)
+		dbQuery = dbQuery.Where("(id IN (?) OR (split = 1 AND split_from IN (?)))",
+					tagged, tagged)
+	}
+	dbQuery = searchFilter(dbQuery, "transfer", s.Transfer)
+	dbQuery = searchFilter(dbQuery, "split", s.Split)
+	dbQuery = searchFilter(dbQuery, "COALESCE(import_id, 0) > 0", s.Imported)
+	return dbQuery
+}
+
+// Run Search over User's Accounts (or only Search.AccountID).
+func (s *Search) Run(session *Session) (*SearchResult, error) {
+	u := session.GetUser()
+	if u == nil {
+		return nil, errors.New("Permission Denied")
+	}
+	db := session.DB
+	s.sanitizeInputs()
+
+	sr := new(SearchResult)
+	sr.currencyTypeID = u.UserSettings.CurrencyTypeID
+	accounts := map[uint]*Account{}
+	accountIDs := []uint{}
+	entries := List(session, true)
+	for i := 0; i < len(entries); i++ {
+		a := &entries[i]
+		if s.AccountID == 0 || s.AccountID == a.ID {
+			accounts[a.ID] = a
+			accountIDs = append(accountIDs, a.ID)
+		}
+	}
+	if len(accountIDs) == 0 {
+		return sr, nil
+	}
+
+	s.query(db, u.ID, accountIDs).
+	  Order("date desc").Order("id desc").
+	  Preload("Payee").Preload("Category").
+	  Limit(maxSearchResults + 1).Find(&sr.CashFlows)
+	if len(sr.CashFlows) > maxSearchResults {
+		sr.CashFlows = sr.CashFlows[:maxSearchResults]
+		sr.Truncated = true
+	}
+
+	for i := 0; i < len(sr.CashFlows); i++ {
+		c := &sr.CashFlows[i]
+		a := accounts[c.AccountID]
+		c.Account = *a
+		c.postQueryInit(false)
+		c.Preload(db)
+
+		amount, valid := convertCurrency(db, c.Amount, a.CurrencyTypeID,
+						 sr.currencyTypeID, c.Date)
+		if !valid {
+			sr.Missing += 1
+		} else if amount.IsPositive() {
+			sr.Credits = sr.Credits.Add(amount)
+		} else {
+			sr.Debits = sr.Debits.Add(amount)
+		}
+	}
+
+	log.Printf("[MODEL] SEARCH(%d) USER(%d) ACCOUNTS(%d) CASHFLOWS(%d) TRUNCATED(%t)",
+		   s.ID, u.ID, len(accountIDs), len(sr.CashFlows), sr.Truncated)
+	return sr, nil
+}
+
+// List User's saved Searches
+func (*Search) List(session *Session) []Search {
+	entries := []Search{}
+	u := session.GetUser()
+	if u == nil {
+		return entries
+	}
+
+	session.DB.Order("name").Where(&Search{UserID: u.ID}).Find(&entries)
+	log.Printf("[MODEL] LIST SEARCHES(%d)", len(entries))
+	return entries
+}
+
+func (s *Search) HaveAccessPermission(session *Session) bool {
+	u := session.GetUser()
+	s.Verified = !(u == nil || u.ID != s.UserID)
+	return s.Verified
+}
+
+func (s *Search) Get(session *Session) *Search {
+	db := session.DB
+	if s.ID > 0 {
+		db.First(&s)
+	}
+	// Verify we have access to Search
+	if !s.HaveAccessPermission(session) {
+		return nil
+	}
+	return s
+}
+
+// Save Search (Create or Update) for User
+func (s *Search) Save(session *Session) error {
+	u := session.GetUser()
+	if u == nil {
+		return errors.New("Permission Denied")
+	}
+	db := session.DB
+	s.sanitizeInputs()
+	if s.Name == "" {
+		return errors.New("Saved Search Requires Name")
+	}
+
+	if s.ID > 0 {
+		old := new(Search)
+		old.ID = s.ID
+		if old.Get(session) == nil {
+			return errors.New("Permission Denied")
+		}
+	}
+	s.UserID = u.ID
+	result := db.Omit(clause.Associations).Save(s)
+	if result.Error == nil {
+		// Save writes zero Dates, want NULL
+		if s.StartDate.IsZero() {
+			db.Model(s).Update("start_date", nil)
+		}
+		if s.EndDate.IsZero() {
+			db.Model(s).Update("end_date", nil)
+		}
+	}
+	log.Printf("[MODEL] SAVE SEARCH(%d) NAME(%s)", s.ID, s.Name)
+	return result.Error
+}
+
+func (s *Search) Delete(session *Session) error {
+	// Verify we have access to Search
+	s = s.Get(session)
+	if s == nil {
+		return errors.New("Permission Denied")
+	}
+	db := session.DB
+
+	log.Printf("[MODEL] DELETE SEARCH(%d)", s.ID)
+	db.Delete(s)
+	return nil
+}
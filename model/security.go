@@ -45,8 +45,8 @@ func (s *Security) sanitizeInputs() {
 	sanitizeString(&s.ImportName)
 }
 
-func (Security) Currency(value decimal.Decimal) string {
-	return currency(value)
+func (s Security) Currency(value decimal.Decimal) string {
+	return s.Account.Currency(value)
 }
 
 func (s Security) Price() decimal.Decimal {
@@ -199,8 +199,7 @@ func (s *Security) addTrade(trade *Trade) {
 		   s.ID, trade.ID, trade.TradeTypeID)
 }
 
-func (s *Security) updateTrade(trade *Trade) {
-	db := getDbManager()
+func (s *Security) updateTrade(db *gorm.DB, trade *Trade) {
 	updates := make(map[string]interface{})
 	price := s.Price()
 
@@ -0,0 +1,329 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// A Tag is a label which can be applied to any number of CashFlows
+// (including Splits) and Trades, unlike the single Category. Splits
+// without Tags of their own have the Tags of their parent.
+type Tag struct {
+	Model
+	UserID uint `gorm:"not null"`
+	Name string `form:"tag.Name"`
+	Verified bool `gorm:"-:all"`
+}
+
+type CashFlowTag struct {
+	CashFlowID uint `gorm:"primaryKey;autoIncrement:false"`
+	TagID uint `gorm:"primaryKey;autoIncrement:false"`
+}
+
+type TradeTag struct {
+	TradeID uint `gorm:"primaryKey;autoIncrement:false"`
+	TagID uint `gorm:"primaryKey;autoIncrement:false"`
+}
+
+// Totals of Tag's CashFlows and Trades, in User's base CurrencyType.
+// Missing is number which could not be converted (no ExchangeRate).
+type TagTotal struct {
+	Tag Tag
+	CashFlows int
+	Credits decimal.Decimal
+	Debits decimal.Decimal
+	Trades int
+	TradeAmount decimal.Decimal
+	Missing int
+	currencyTypeID uint
+}
+
+func (tt TagTotal) Currency(value decimal.Decimal) string {
+	return currencyFormat(value, tt.currencyTypeID)
+}
+
+func (tt TagTotal) Total() decimal.Decimal {
+	return tt.Credits.Add(tt.Debits).Add(tt.TradeAmount)
+}
+
+func (t *Tag) sanitizeInputs() {
+	sanitizeString(&t.Name)
+	t.Name = strings.Replace(t.Name, ",", "", -1)
+}
+
+// Split comma separated Tag names, removing empty and duplicates
+func parseTagNames(tags string) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, name := range strings.Split(tags, ",") {
+		sanitizeString(&name)
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+func tagNames(tags []Tag) string {
+	names := make([]string, len(tags))
+	for i := 0; i < len(tags); i++ {
+		names[i] = tags[i].Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// Get User's Tags by name (ignoring case), creating any which don't exist
+func getTagsByName(db *gorm.DB, userID uint, names []string) []Tag {
+	tags := []Tag{}
+	for i := 0; i < len(names); i++ {
+		tag := new(Tag)
+		db.Where("user_id = ? AND LOWER(name) = LOWER(?)", userID, names[i]).
+		   First(&tag)
+		if tag.ID == 0 {
+			tag.UserID = userID
+			tag.Name = names[i]
+			tag.sanitizeInputs()
+			db.Omit(clause.Associations).Create(tag)
+			log.Printf("[MODEL] CREATE TAG(%d) NAME(%s)", tag.ID, tag.Name)
+		}
+		tags = append(tags, *tag)
+	}
+	return tags
+}
+
+func listCashFlowTags(db *gorm.DB, cashFlowID uint) []Tag {
+	tags := []Tag{}
+	ids := db.Model(&CashFlowTag{}).Select("tag_id").
+		  Where("cash_flow_id = ?", cashFlowID)
+	db.Order("LOWER(name)").Where("id IN (?)", ids).Find(&tags)
+	return tags
+}
+
+func listTradeTags(db *gorm.DB, tradeID uint) []Tag {
+	tags := []Tag{}
+	ids := db.Model(&TradeTag{}).Select("tag_id").
+		  Where("trade_id = ?", tradeID)
+	db.Order("LOWER(name)").Where("id IN (?)", ids).Find(&tags)
+	return tags
+}
+
+// Replace Tags of CashFlow with Tags named (comma separated) in names
+func saveCashFlowTags(db *gorm.DB, userID uint, cashFlowID uint, names string) []Tag {
+	tags := getTagsByName(db, userID, parseTagNames(names))
+	db.Where("cash_flow_id = ?", cashFlowID).Delete(&CashFlowTag{})
+	for i := 0; i < len(tags); i++ {
+		db.Create(&CashFlowTag{CashFlowID: cashFlowID, TagID: tags[i].ID})
+	}
+	log.Printf("[MODEL] CASHFLOW(%d) TAGS(%d)", cashFlowID, len(tags))
+	return tags
+}
+
+func saveTradeTags(db *gorm.DB, userID uint, tradeID uint, names string) []Tag {
+	tags := getTagsByName(db, userID, parseTagNames(names))
+	db.Where("trade_id = ?", tradeID).Delete(&TradeTag{})
+	for i := 0; i < len(tags); i++ {
+		db.Create(&TradeTag{TradeID: tradeID, TagID: tags[i].ID})
+	}
+	log.Printf("[MODEL] TRADE(%d) TAGS(%d)", tradeID, len(tags))
+	return tags
+}
+
+// copy Tags of ScheduledCashFlow to the CashFlow posted from it
+func copyCashFlowTags(db *gorm.DB, fromID uint, toID uint) {
+	entries := []CashFlowTag{}
+	db.Where("cash_flow_id = ?", fromID).Find(&entries)
+	for i := 0; i < len(entries); i++ {
+		db.Create(&CashFlowTag{CashFlowID: toID, TagID: entries[i].TagID})
+	}
+}
+
+// IDs of CashFlows with Tag, for use as subquery
+func taggedCashFlows(db *gorm.DB, tagID uint) *gorm.DB {
+	return db.Model(&CashFlowTag{}).Select("cash_flow_id").
+		  Where("tag_id = ?", tagID)
+}
+
+// List User's Tags
+func (*Tag) List(session *Session) []Tag {
+	entries := []Tag{}
+	u := session.GetUser()
+	if u == nil {
+		return entries
+	}
+
+	session.DB.Order("LOWER(name)").Where(&Tag{UserID: u.ID}).Find(&entries)
+	log.Printf("[MODEL] LIST TAGS(%d)", len(entries))
+	return entries
+}
+
+func (t *Tag) HaveAccessPermission(session *Session) bool {
+	u := session.GetUser()
+	t.Verified = !(u == nil || u.ID != t.UserID)
+	return t.Verified
+}
+
+func (t *Tag) Get(session *Session) *Tag {
+	db := session.DB
+	if t.ID > 0 {
+		db.First(&t)
+	}
+	// Verify we have access to Tag
+	if !t.HaveAccessPermission(session) {
+		return nil
+	}
+	return t
+}
+
+// Tag access already verified with Get
+func (t *Tag) Update() error {
+	db := getDbManager()
+	t.sanitizeInputs()
+	if t.Name == "" {
+		return errors.New("Tag Requires Name")
+	}
+
+	other := new(Tag)
+	db.Where("user_id = ? AND id != ? AND LOWER(name) = LOWER(?)",
+		 t.UserID, t.ID, t.Name).First(&other)
+	if other.ID > 0 {
+		return errors.New("Tag Already Exists")
+	}
+	result := db.Omit(clause.Associations).Save(t)
+	return result.Error
+}
+
+// Delete Tag, removing it from all CashFlows and Trades
+func (t *Tag) Delete(session *Session) error {
+	// Verify we have access to Tag
+	t = t.Get(session)
+	if t == nil {
+		return errors.New("Permission Denied")
+	}
+	db := session.DB
+
+	log.Printf("[MODEL] DELETE TAG(%d)", t.ID)
+	db.Where("tag_id = ?", t.ID).Delete(&CashFlowTag{})
+	db.Where("tag_id = ?", t.ID).Delete(&TradeTag{})
+	db.Delete(t)
+	return nil
+}
+
+// List Trades with Tag, in Account if not nil.
+func (t *Tag) ListTrades(session *Session, account *Account) []Trade {
+	entries := []Trade{}
+	u := session.GetUser()
+	if !t.Verified || u == nil {
+		return entries
+	}
+	db := session.DB
+
+	ids := db.Model(&TradeTag{}).Select("trade_id").Where("tag_id = ?", t.ID)
+	dbQuery := db.Preload("TradeType").Preload("Account").
+		      Preload("Security.Company").Joins("Security").
+		      Where("trades.id IN (?)", ids)
+	if account != nil {
+		dbQuery = dbQuery.Where("trades.account_id = ?", account.ID)
+	}
+	dbQuery.Order("trades.date desc").Find(&entries)
+
+	// Verify Trades are in User's Accounts
+	trades := []Trade{}
+	for i := 0; i < len(entries); i++ {
+		if entries[i].HaveAccessPermission(session) {
+			trades = append(trades, entries[i])
+		}
+	}
+	log.Printf("[MODEL] LIST TAG(%d) TRADES(%d)", t.ID, len(trades))
+	return trades
+}
+
+// Trades of Tag as CashFlows (for listing with CashFlows of Account)
+func (t *Tag) ListTradeCashFlows(session *Session, account *Account) []CashFlow {
+	entries := []CashFlow{}
+	trades := t.ListTrades(session, account)
+	for i := 0; i < len(trades); i++ {
+		c := trades[i].toCashFlow(true)
+		if c != nil {
+			c.Account = trades[i].Account
+			entries = append(entries, *c)
+		}
+	}
+	return entries
+}
+
+// List CashFlows (and Trades) of Account with Tag, newest first
+func (a *Account) ListTagged(session *Session, t *Tag) []CashFlow {
+	entries := []CashFlow{}
+	if !a.Verified || !t.Verified {
+		return entries
+	}
+
+	s := Search{AccountID: a.ID, TagID: t.ID}
+	result, err := s.Run(session)
+	if err == nil {
+		entries = result.CashFlows
+	}
+	if a.IsInvestment() {
+		entries = append(entries, t.ListTradeCashFlows(session, a)...)
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].Date.After(entries[j].Date)
+		})
+	}
+	return entries
+}
+
+// Totals of each of User's Tags
+func TagTotals(session *Session) []TagTotal {
+	entries := []TagTotal{}
+	u := session.GetUser()
+	if u == nil {
+		return entries
+	}
+	db := session.DB
+
+	tags := new(Tag).List(session)
+	for i := 0; i < len(tags); i++ {
+		tt := TagTotal{Tag: tags[i], currencyTypeID: u.UserSettings.CurrencyTypeID}
+		tt.Tag.Verified = true
+
+		s := Search{TagID: tt.Tag.ID}
+		result, err := s.Run(session)
+		if err == nil {
+			tt.CashFlows = result.Count()
+			tt.Credits = result.Credits
+			tt.Debits = result.Debits
+			tt.Missing = result.Missing
+		}
+
+		trades := tt.Tag.ListTrades(session, nil)
+		tt.Trades = len(trades)
+		for j := 0; j < len(trades); j++ {
+			tr := &trades[j]
+			amount, valid := convertCurrency(db, tr.cashAmount(),
+							 tr.Account.CurrencyTypeID,
+							 tt.currencyTypeID, tr.Date)
+			if !valid {
+				tt.Missing += 1
+				continue
+			}
+			tt.TradeAmount = tt.TradeAmount.Add(amount)
+		}
+		entries = append(entries, tt)
+	}
+	log.Printf("[MODEL] TAG TOTALS(%d)", len(entries))
+	return entries
+}
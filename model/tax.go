@@ -342,6 +342,7 @@ func (te *TaxEntry) Delete(session *Session) error {
 
 	log.Printf("[MODEL] DELETE TAX ENTRY(%d)", te.ID)
 	db.Table("taxes").Delete(te)
+	deleteAttachments(db, &Attachment{TaxEntryID: te.ID})
 	return nil
 }
 
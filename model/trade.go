@@ -23,6 +23,8 @@ type Trade struct {
 	oldAccountID uint `gorm:"-:all"`
 	SecurityID uint `gorm:"not null"`
 	ImportID uint
+	// FITID of imported OFX transaction
+	FITID string
 	Symbol string `form:"Symbol" gorm:"-:all"`
 	Date time.Time
 	oldDate time.Time `gorm:"-:all"`
@@ -48,6 +50,8 @@ type Trade struct {
 	oldShares decimal.Decimal `gorm:"-:all"`
 	oldBasis decimal.Decimal `gorm:"-:all"`
 	Closed bool
+	Tags []Tag `gorm:"-:all"`
+	tagNames *string
 	TradeType TradeType
 	Account Account
 	Security Security
@@ -58,8 +62,24 @@ func (t *Trade) sanitizeInputs() {
 	sanitizeString(&t.Symbol)
 }
 
-func (Trade) Currency(value decimal.Decimal) string {
-	return currency(value)
+func (t Trade) Currency(value decimal.Decimal) string {
+	return t.Account.Currency(value)
+}
+
+func (t Trade) GetTags() string {
+	return tagNames(t.Tags)
+}
+
+// Set Tags (comma separated names) to save with Create or Update
+func (t *Trade) SetTags(tags string) {
+	t.tagNames = &tags
+}
+
+func (t *Trade) saveTags(db *gorm.DB, userID uint) {
+	if t.tagNames != nil {
+		t.Tags = saveTradeTags(db, userID, t.ID, *t.tagNames)
+		t.tagNames = nil
+	}
 }
 
 func (t *Trade) IsBuy() bool {
@@ -106,9 +126,9 @@ func (t Trade) ViewIsSell() bool {
 
 func (t Trade) GetBasis() string {
 	if t.IsSell() {
-		return "$" + t.Basis.StringFixed(2)
+		return t.Currency(t.Basis)
 	} else if t.IsBuy() {
-		return "$" + t.Amount.Sub(t.Basis).StringFixed(2)
+		return t.Currency(t.Amount.Sub(t.Basis))
 	} else {
 		return ""
 	}
@@ -247,6 +267,9 @@ func (t *Trade) ListByType(session *Session, tradeType uint, daysHeld uint) ([]T
 	for i := 0; i < len(entries); i++ {
 		entry := &entries[i]
 		entry.postQueryInit()
+		if t.AccountID > 0 {
+			entry.Account.CurrencyTypeID = t.Account.CurrencyTypeID
+		}
 		gain[0] = gain[0].Add(entry.Gain)
 		if entry.Account.Taxable {
 			capGain := entry.totalGains(daysHeld)
@@ -344,8 +367,7 @@ func (t *Trade) gainBasis(soldShares decimal.Decimal) decimal.Decimal {
 	}
 }
 
-func (t *Trade) revertBasis(basis decimal.Decimal, soldShares decimal.Decimal) {
-	db := getDbManager()
+func (t *Trade) revertBasis(db *gorm.DB, basis decimal.Decimal, soldShares decimal.Decimal) {
 	updates := make(map[string]interface{})
 	if t.IsBuy() {
 		t.AdjustedShares = t.AdjustedShares.Add(soldShares)
@@ -520,7 +542,7 @@ func (t *Trade) insertTrade(db *gorm.DB, security *Security) error {
 	security.addTrade(t)
 	c := t.toCashFlow(false)
 	if c != nil {
-		security.Account.updateBalance(c)
+		security.Account.updateBalance(db, c)
 	}
 	return nil
 }
@@ -544,7 +566,11 @@ func (t *Trade) Create(session *Session) error {
 	}
 	t.ID = 0
 	t.setDefaults()
-	return t.insertTrade(db, security)
+	err := t.insertTrade(db, security)
+	if err == nil {
+		t.saveTags(db, session.GetUser().ID)
+	}
+	return err
 }
 
 // t.Account must be preloaded
@@ -598,11 +624,11 @@ func (t *Trade) Get(session *Session) *Trade {
 
 	// for Update, store old values before overwritten
 	t.postQueryInit()
+	t.Tags = listTradeTags(db, t.ID)
 	return t
 }
 
-func (t *Trade) reverseGain(isDelete bool) error {
-	db := getDbManager()
+func (t *Trade) reverseGain(db *gorm.DB, isDelete bool) error {
 	sellBasis := decimal.Zero
 	entries := []TradeGain{}
 
@@ -622,7 +648,7 @@ func (t *Trade) reverseGain(isDelete bool) error {
 
 	// update Basis in Sell (don't bother if Trade will be deleted)
 	if !isDelete {
-		t.revertBasis(sellBasis, t.Shares)
+		t.revertBasis(db, sellBasis, t.Shares)
 	}
 
 	log.Printf("[MODEL] REVERSED TRADE(%d) AND %d GAINS", t.ID, len(entries))
@@ -659,7 +685,7 @@ func (t *Trade) updateGains() {
 
 func (t *Trade) Delete(session *Session) error {
 	var err error
-	db := getDbManager()
+	db := session.DB
 
 	// Verify we have access to Trade
 	t = t.Get(session)
@@ -672,7 +698,7 @@ func (t *Trade) Delete(session *Session) error {
 	t.Shares = decimal.Zero
 
 	if t.IsSell() {
-		err = t.reverseGain(true)
+		err = t.reverseGain(db, true)
 	} else if t.IsBuy() && !t.oldBasis.IsZero() {
 		err = errors.New("Don't yet support Delete of Partially Sold Buy Trades!")
 	} else if t.IsSplit() {
@@ -686,13 +712,15 @@ func (t *Trade) Delete(session *Session) error {
 		return err
 	}
 
-	t.Security.updateTrade(t)
+	t.Security.updateTrade(db, t)
 	c := t.toCashFlow(false)
 	if c != nil {
-		t.Account.updateBalance(c)
+		t.Account.updateBalance(db, c)
 	}
 	spewModel(t)
 	db.Delete(t)
+	db.Where("trade_id = ?", t.ID).Delete(&TradeTag{})
+	deleteAttachments(db, &Attachment{TradeID: t.ID})
 	log.Printf("[MODEL] DELETE TRADE(%d)", t.ID)
 	return nil
 }
@@ -712,6 +740,8 @@ func (t *Trade) Update() error {
 	if !t.Account.Verified {
 		return errors.New("!Account.Verified")
 	}
+	// Tags can be changed even if Trade cannot be updated
+	t.saveTags(db, t.Account.User.ID)
 
 	err = t.validateInputs()
 	if err != nil {
@@ -730,7 +760,7 @@ func (t *Trade) Update() error {
 			t.updateGains()
 		}
 	} else if t.IsSell() {
-		err = t.reverseGain(false)
+		err = t.reverseGain(db, false)
 		if err == nil {
 			activeBuys, err = t.Security.validateTrade(t)
 		}
@@ -759,10 +789,10 @@ func (t *Trade) Update() error {
 			t.recordSplit(activeBuys)
 		}
 
-		t.Security.updateTrade(t)
+		t.Security.updateTrade(db, t)
 		c := t.toCashFlow(false)
 		if c != nil {
-			t.Account.updateBalance(c)
+			t.Account.updateBalance(db, c)
 		}
 	}
 	if err == nil {
@@ -155,6 +155,30 @@ func actionToTradeType(action qif.InvestmentAction) uint {
 	return UndefinedTradeType
 }
 
+func tradeTypeToAction(tradeTypeID uint) qif.InvestmentAction {
+	switch tradeTypeID {
+	case Buy:
+		return qif.ActionBuy
+	case Sell:
+		return qif.ActionSell
+	case Dividend:
+		return qif.ActionDiv
+	case Distribution:
+		return qif.ActionCGLong
+	case ReinvestedDividend:
+		return qif.ActionReInvDiv
+	case ReinvestedDistribution:
+		return qif.ActionReInvLg
+	case SharesIn:
+		return qif.ActionSharesIn
+	case SharesOut:
+		return qif.ActionSharesOut
+	case Split:
+		return qif.ActionStockSplit
+	}
+	return ""
+}
+
 func (*TradeType) List(db *gorm.DB) []TradeType {
 	// need userCache lookup
 	entries := []TradeType{}
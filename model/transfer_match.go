@@ -0,0 +1,350 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// days apart the two sides of a Transfer can be posted
+const transferMatchDateWindow int = 5
+// days of past CashFlows searched by MatchTransfers
+const transferMatchDays int = 90
+// matches scoring at least this are linked without review
+const transferAutoLinkScore int = 80
+
+var transferKeywords = []string{"transfer", "xfer", "payment", "pmt", "autopay"}
+
+// A TransferMatch is a proposed Transfer between two unrelated CashFlows
+// in different Accounts, with opposite Amounts. Score (out of 100) is the
+// confidence they are the same Transfer. Dismissed matches are kept so
+// that they are not proposed again. Once linked, a match records the
+// Payee and Category each CashFlow had, so the link can be undone.
+type TransferMatch struct {
+	Model
+	UserID uint `gorm:"not null"`
+	CashFlowID uint `gorm:"not null"`
+	PairID uint `gorm:"not null"`
+	Score int
+	Dismissed bool
+	Linked bool
+	CashFlowPayeeID uint
+	CashFlowCategoryID uint
+	PairPayeeID uint
+	PairCategoryID uint
+	CashFlow CashFlow `gorm:"-:all"`
+	Pair CashFlow `gorm:"-:all"`
+	Verified bool `gorm:"-:all"`
+}
+
+// Can be linked into a Transfer: not already a Transfer, Split, has no
+// Splits, not Scheduled or Trade, and not Reconciled
+func (c *CashFlow) canMatchTransfer() bool {
+	return c.ID > 0 && c.Type == "" && !c.Transfer && c.SplitFrom == 0 &&
+	       !c.Reconciled
+}
+
+func (c *CashFlow) daysApart(x *CashFlow) int {
+	days := int(dateOnly(c.Date).Sub(dateOnly(x.Date)).Hours() / 24)
+	if days < 0 {
+		return -days
+	}
+	return days
+}
+
+// Payee or Memo suggests a Transfer, or names the other Account
+func (c *CashFlow) mentionsTransfer(accountName string) bool {
+	text := normalizePayeeName(c.PayeeName + " " + c.Memo)
+	for _, keyword := range transferKeywords {
+		if strings.Contains(text, keyword) {
+			return true
+		}
+	}
+	name := normalizePayeeName(accountName)
+	return len(name) >= 4 && strings.Contains(text, name)
+}
+
+func (c *CashFlow) loadForTransferMatch(db *gorm.DB, id uint) {
+	db.Joins("Account").Preload("Payee").First(&c, id)
+	c.PayeeName = c.Payee.Name
+}
+
+// CashFlows of User's other Accounts with opposite Amount near c.Date,
+// closest Date first
+func (c *CashFlow) listTransferCandidates(db *gorm.DB, userID uint) []CashFlow {
+	entries := []CashFlow{}
+	date := dateOnly(c.Date)
+
+	db.Joins("Account").Preload("Payee").
+	   Where("user_id = ?", userID).
+	   Where("cash_flows.account_id != ?", c.AccountID).
+	   // decimal binds as string, which sqlite won't compare as a number
+	   Where("cash_flows.amount = ?", c.Amount.Neg().InexactFloat64()).
+	   Where("cash_flows.date >= ? AND cash_flows.date < ?",
+		 date.AddDate(0, 0, -transferMatchDateWindow),
+		 date.AddDate(0, 0, transferMatchDateWindow + 1)).
+	   Where("cash_flows.type IS NULL AND cash_flows.transfer = ?", false).
+	   Where("COALESCE(cash_flows.split_from, 0) = 0").
+	   Where("cash_flows.reconciled = ?", false).
+	   Find(&entries)
+	for i := 0; i < len(entries); i++ {
+		entries[i].PayeeName = entries[i].Payee.Name
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return c.daysApart(&entries[i]) < c.daysApart(&entries[j])
+	})
+	return entries
+}
+
+// Confidence (out of 100) that c and pair are the same Transfer; unique
+// is set if each is the only candidate of the other.
+func (c *CashFlow) transferScore(pair *CashFlow, unique bool) int {
+	score := 20
+	if unique {
+		score = 50
+	}
+	days := c.daysApart(pair)
+	if days == 0 {
+		score += 20
+	} else if days <= 2 {
+		score += 10
+	}
+	if c.mentionsTransfer(pair.Account.Name) ||
+	   pair.mentionsTransfer(c.Account.Name) {
+		score += 20
+	}
+	return score
+}
+
+// Link two CashFlows into a Transfer pair. Amounts are unchanged so
+// Account balances need no update.
+func (c *CashFlow) linkTransfer(db *gorm.DB, pair *CashFlow, userID uint, score int) {
+	link := TransferMatch{UserID: userID, CashFlowID: c.ID, PairID: pair.ID,
+			      Score: score, Linked: true,
+			      CashFlowPayeeID: c.PayeeID,
+			      CashFlowCategoryID: c.CategoryID,
+			      PairPayeeID: pair.PayeeID,
+			      PairCategoryID: pair.CategoryID}
+	db.Omit(clause.Associations).Model(c).
+	   Updates(map[string]interface{}{"transfer": true,
+					  "payee_id": pair.AccountID,
+					  "category_id": pair.ID})
+	db.Omit(clause.Associations).Model(pair).
+	   Updates(map[string]interface{}{"transfer": true,
+					  "payee_id": c.AccountID,
+					  "category_id": c.ID})
+	// pending matches of either are now stale
+	db.Where("cash_flow_id IN ? OR pair_id IN ?",
+		 []uint{c.ID, pair.ID}, []uint{c.ID, pair.ID}).
+	   Delete(&TransferMatch{})
+	db.Omit(clause.Associations).Create(&link)
+	log.Printf("[MODEL] LINK TRANSFER CASHFLOW(%d) PAIR(%d)", c.ID, pair.ID)
+}
+
+// TransferMatch which linked Transfer c, nil if not linked by matching
+func (c *CashFlow) transferLink(db *gorm.DB) *TransferMatch {
+	entries := []TransferMatch{}
+	if !c.Transfer {
+		return nil
+	}
+
+	db.Where("linked = ?", true).
+	   Where("(cash_flow_id = ? AND pair_id = ?) OR (cash_flow_id = ? AND pair_id = ?)",
+		 c.ID, c.PairID, c.PairID, c.ID).
+	   Limit(1).Find(&entries)
+	if len(entries) == 0 {
+		return nil
+	}
+	return &entries[0]
+}
+
+// Undo linkTransfer, both CashFlows get back their Payee and Category
+func (m *TransferMatch) unlinkTransfer(db *gorm.DB) {
+	c := new(CashFlow)
+	c.ID = m.CashFlowID
+	db.Omit(clause.Associations).Model(c).
+	   Updates(map[string]interface{}{"transfer": false,
+					  "payee_id": m.CashFlowPayeeID,
+					  "category_id": m.CashFlowCategoryID})
+	pair := new(CashFlow)
+	pair.ID = m.PairID
+	db.Omit(clause.Associations).Model(pair).
+	   Updates(map[string]interface{}{"transfer": false,
+					  "payee_id": m.PairPayeeID,
+					  "category_id": m.PairCategoryID})
+	db.Delete(m)
+	log.Printf("[MODEL] UNLINK TRANSFER CASHFLOW(%d) PAIR(%d)", c.ID, pair.ID)
+}
+
+func hasTransferMatch(db *gorm.DB, ids []uint) bool {
+	var count int64
+	db.Model(&TransferMatch{}).
+	   Where("cash_flow_id IN ? OR pair_id IN ?", ids, ids).
+	   Where("linked = ?", false).Count(&count)
+	return count > 0
+}
+
+// Match each of entries with CashFlows in User's other Accounts, linking
+// high confidence matches and proposing the others.
+func matchTransfers(db *gorm.DB, userID uint, entries []CashFlow) (int, int) {
+	linked := 0
+	proposed := 0
+
+	for i := 0; i < len(entries); i++ {
+		// reload, may have been linked as pair of earlier entry
+		c := new(CashFlow)
+		c.loadForTransferMatch(db, entries[i].ID)
+		if !c.canMatchTransfer() {
+			continue
+		}
+		candidates := c.listTransferCandidates(db, userID)
+		if len(candidates) == 0 {
+			continue
+		}
+		pair := &candidates[0]
+		if hasTransferMatch(db, []uint{c.ID, pair.ID}) {
+			continue
+		}
+
+		unique := len(candidates) == 1 &&
+			  len(pair.listTransferCandidates(db, userID)) == 1
+		score := c.transferScore(pair, unique)
+		if score >= transferAutoLinkScore {
+			c.linkTransfer(db, pair, userID, score)
+			linked++
+		} else {
+			m := TransferMatch{UserID: userID, CashFlowID: c.ID,
+					   PairID: pair.ID, Score: score}
+			db.Omit(clause.Associations).Create(&m)
+			proposed++
+		}
+	}
+	log.Printf("[MODEL] MATCH TRANSFERS(%d) LINKED(%d) PROPOSED(%d)",
+		   len(entries), linked, proposed)
+	return linked, proposed
+}
+
+// Match Transfers for CashFlows entered by Import
+func (im *Import) matchTransfers(db *gorm.DB) (int, int) {
+	entries := []CashFlow{}
+	if !im.Account.Verified {
+		return 0, 0
+	}
+
+	db.Select("id").Order("date").
+	   Where(&CashFlow{AccountID: im.AccountID, ImportID: im.ID}).
+	   Where("type IS NULL").Find(&entries)
+	if len(entries) == 0 {
+		return 0, 0
+	}
+	return matchTransfers(db, im.Account.User.ID, entries)
+}
+
+// Match Transfers for User's recent CashFlows, returns how many were
+// linked and how many proposed
+func MatchTransfers(session *Session) (int, int) {
+	entries := []CashFlow{}
+	u := session.GetUser()
+	if u == nil {
+		return 0, 0
+	}
+	db := session.DB
+
+	db.Select("cash_flows.id").Order("cash_flows.date").Joins("Account").
+	   Where("user_id = ?", u.ID).
+	   Where("cash_flows.date >= ?", time.Now().AddDate(0, 0, -transferMatchDays)).
+	   Where("cash_flows.type IS NULL AND cash_flows.transfer = ?", false).
+	   Find(&entries)
+	return matchTransfers(db, u.ID, entries)
+}
+
+func (m *TransferMatch) HaveAccessPermission(session *Session) bool {
+	u := session.GetUser()
+	m.Verified = !(u == nil || m.ID == 0 || u.ID != m.UserID)
+	return m.Verified
+}
+
+// Load both CashFlows, returns false if either can no longer be linked
+func (m *TransferMatch) loadCashFlows(db *gorm.DB) bool {
+	m.CashFlow.loadForTransferMatch(db, m.CashFlowID)
+	m.Pair.loadForTransferMatch(db, m.PairID)
+	return m.CashFlow.canMatchTransfer() && m.Pair.canMatchTransfer()
+}
+
+// List User's proposed TransferMatches; stale ones are removed
+func (*TransferMatch) List(session *Session) []TransferMatch {
+	entries := []TransferMatch{}
+	matches := []TransferMatch{}
+	u := session.GetUser()
+	if u == nil {
+		return matches
+	}
+	db := session.DB
+
+	db.Order("id").Where(&TransferMatch{UserID: u.ID}).
+	   Where("dismissed = ? AND linked = ?", false, false).Find(&entries)
+	for i := 0; i < len(entries); i++ {
+		m := &entries[i]
+		if !m.loadCashFlows(db) {
+			db.Delete(m)
+			continue
+		}
+		matches = append(matches, *m)
+	}
+	log.Printf("[MODEL] LIST TRANSFER MATCHES(%d)", len(matches))
+	return matches
+}
+
+func (m *TransferMatch) Get(session *Session) *TransferMatch {
+	db := session.DB
+	if m.ID > 0 {
+		db.First(&m)
+	}
+	// Verify we have access to TransferMatch
+	if !m.HaveAccessPermission(session) {
+		return nil
+	}
+	return m
+}
+
+// Link proposed TransferMatch into a Transfer
+func (m *TransferMatch) Accept(session *Session) error {
+	// Verify we have access to TransferMatch
+	m = m.Get(session)
+	if m == nil {
+		return errors.New("Permission Denied")
+	}
+	db := session.DB
+
+	if !m.loadCashFlows(db) {
+		db.Delete(m)
+		return errors.New("CashFlows can no longer be linked")
+	}
+	m.CashFlow.linkTransfer(db, &m.Pair, m.UserID, m.Score)
+	return nil
+}
+
+// Dismiss proposed TransferMatch, it won't be proposed again
+func (m *TransferMatch) Dismiss(session *Session) error {
+	// Verify we have access to TransferMatch
+	m = m.Get(session)
+	if m == nil {
+		return errors.New("Permission Denied")
+	}
+	db := session.DB
+
+	m.Dismissed = true
+	db.Omit(clause.Associations).Model(m).Update("dismissed", true)
+	log.Printf("[MODEL] DISMISS TRANSFER MATCH(%d)", m.ID)
+	return nil
+}
@@ -20,12 +20,17 @@ import (
 
 const (
 	DefaultCashFlowLimit = 200
+	// primary User (created with database) is the administrator
+	AdminUserID = 1
 )
 
 type UserCache struct {
 	AccountBalances map[uint]decimal.Decimal
 	AccountNames map[uint]string
 	CategoryNames map[uint]string
+	// Balances not cached (Sessions of Jobs), but written to database
+	// as changed, so never overwrite those cached by the User's Session
+	noBalances bool
 	mutex sync.Mutex
 }
 
@@ -33,6 +38,7 @@ type UserSettings struct {
 	Model
 	UserID uint
 	CashFlowLimit int `gorm:"-:all"`
+	CurrencyTypeID uint `gorm:"-:all"`
 }
 
 type User struct {
@@ -41,6 +47,7 @@ type User struct {
 	Email string `form:"user.Email"`
 	PasswordDigest string
 	CashflowLimit int
+	CurrencyTypeID uint
 	Session *Session `gorm:"-:all"`
 	UserSettings UserSettings
 	Accounts []Account
@@ -54,6 +61,16 @@ type Session struct {
 	DebugDB *gorm.DB
 }
 
+// formatted in base CurrencyType
+func (us UserSettings) Currency(value decimal.Decimal) string {
+	return currencyFormat(value, us.CurrencyTypeID)
+}
+
+// Administrator manages data shared by all Users (ExchangeRates)
+func (u *User) IsAdmin() bool {
+	return u.ID == AdminUserID
+}
+
 func (u *User) sanitizeInputs() {
 	sanitizeString(&u.Login)
 	sanitizeString(&u.Email)
@@ -68,6 +85,10 @@ func (u *User) Cache() *UserCache {
 
 func (u *User) cacheAccountBalance(a *Account) {
 	uc := u.Cache()
+	if uc.noBalances {
+		a.writeBalance()
+		return
+	}
 	uc.mutex.Lock()
 	uc.AccountBalances[a.ID] = a.Balance
 	uc.mutex.Unlock()
@@ -75,6 +96,13 @@ func (u *User) cacheAccountBalance(a *Account) {
 
 func (u *User) writeAccountBalance(a *Account, update decimal.Decimal, force bool) decimal.Decimal {
 	uc := u.Cache()
+	if uc.noBalances {
+		// if !force, caller writes update to database
+		if force {
+			a.addBalance(update)
+		}
+		return a.Balance.Add(update)
+	}
 
 	uc.mutex.Lock()
 	balance, valid := u.lookupAccountBalance(a.ID)
@@ -97,14 +125,29 @@ func (u *User) updateAccountBalance(a *Account, update decimal.Decimal) decimal.
 	return u.writeAccountBalance(a, update, false)
 }
 
+// discard cached Balances of Accounts (updated in database)
+func (u *User) uncacheAccountBalances(accountIDs []uint) {
+	uc := u.Cache()
+	uc.mutex.Lock()
+	for _, id := range accountIDs {
+		delete(uc.AccountBalances, id)
+	}
+	uc.mutex.Unlock()
+}
+
 func (u *User) cacheAccountName(a *Account) {
-	u.Cache().AccountNames[a.ID] = a.Name
+	uc := u.Cache()
+	uc.mutex.Lock()
+	uc.AccountNames[a.ID] = a.Name
+	uc.mutex.Unlock()
 }
 
 func (u *User) clearAccountName(a *Account) {
 	uc := u.Cache()
 	if uc != nil {
+		uc.mutex.Lock()
 		delete(uc.AccountNames, a.ID)
+		uc.mutex.Unlock()
 	}
 }
 
@@ -119,7 +162,11 @@ func (u *User) lookupAccountBalance(id uint) (decimal.Decimal, bool) {
 }
 
 func (u *User) lookupAccountName(id uint) string {
-	return u.Cache().AccountNames[id]
+	uc := u.Cache()
+	uc.mutex.Lock()
+	name := uc.AccountNames[id]
+	uc.mutex.Unlock()
+	return name
 }
 
 func (u *User) lookupCategoryName(id uint) string {
@@ -148,6 +195,32 @@ func (u *User) initSettings() {
 	}
 	u.UserSettings.CashFlowLimit = cashflowLimit
 	u.UserSettings.UserID = u.ID
+
+	// base CurrencyType for Account totals
+	if u.CurrencyTypeID == 0 && u.ID > 0 {
+		db := getDbManager()
+		db.Model(&User{}).Select("currency_type_id").
+		   Where("id = ?", u.ID).Scan(&u.CurrencyTypeID)
+	}
+	u.UserSettings.CurrencyTypeID = u.CurrencyTypeID
+	if u.UserSettings.CurrencyTypeID == 0 {
+		u.UserSettings.CurrencyTypeID = CurrencyTypeUSD
+	}
+}
+
+// Set base CurrencyType for Account totals
+func (u *User) SetCurrencyType(currencyTypeID uint) error {
+	if getCurrencyType(currencyTypeID).ID == 0 {
+		return errors.New("Invalid CurrencyType")
+	}
+	db := getDbManager()
+
+	u.CurrencyTypeID = currencyTypeID
+	u.UserSettings.CurrencyTypeID = currencyTypeID
+	result := db.Omit(clause.Associations).Model(u).
+		     Update("currency_type_id", currencyTypeID)
+	log.Printf("[MODEL] USER(%d) SET CURRENCY(%d)", u.ID, currencyTypeID)
+	return result.Error
 }
 
 func (u *User) init(session *Session) {
@@ -179,6 +252,22 @@ func (session *Session) CloseSession() {
 	}
 }
 
+// Session of same User using db (such as a transaction), with empty
+// caches
+func (session *Session) withDB(db *gorm.DB) *Session {
+	sn := &Session{User: session.User, DB: db, DebugDB: db}
+	sn.Cache.init()
+	sn.User.Session = sn
+	return sn
+}
+
+// Session for background Jobs, which doesn't cache Balances
+func (u *User) newJobSession() *Session {
+	session := u.NewSession()
+	session.Cache.noBalances = true
+	return session
+}
+
 func (u *User) NewSession() *Session {
 	newSession := new(Session)
 	newSession.init()
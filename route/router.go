@@ -65,11 +65,36 @@ func Init(staticFS *embed.FS, viewFS *embed.FS) *echo.Echo {
 	e.GET("/accounts", controllers.ListAccounts)   // Index/List
 	e.POST("/accounts", controllers.CreateAccount) // Create
 	e.GET("/accounts/new", controllers.NewAccount)
+	e.POST("/accounts/currency", controllers.UpdateTotalCurrency)
 	e.GET("/accounts/:id/edit", controllers.EditAccount)
 	e.GET("/accounts/:id", controllers.GetAccount) // Show
 	e.POST("/accounts/:id", controllers.UpdateAccount) // Update
 	e.DELETE("/accounts/:id", controllers.DeleteAccount)
 
+	// Reconcile
+	e.GET("/accounts/:id/reconcile", controllers.GetReconcile)
+	e.POST("/accounts/:id/reconcile", controllers.UpdateReconcile)
+	e.POST("/accounts/:id/reconcile/finish", controllers.FinishReconcile)
+	e.DELETE("/accounts/:id/reconcile", controllers.DeleteReconcile)
+	e.GET("/accounts/:id/positions", controllers.GetPositions)
+	e.POST("/accounts/:id/positions/adjust", controllers.AdjustPosition)
+
+	// Loan
+	e.GET("/accounts/:id/amortization", controllers.GetAmortization)
+
+	// Forecast
+	e.GET("/forecast", controllers.GetForecast)
+	e.GET("/accounts/:id/forecast", controllers.GetForecast)
+
+	// Chart
+	e.GET("/charts", controllers.ListNetWorth)
+	e.POST("/charts", controllers.CreateBalanceSnapshots)
+	e.GET("/accounts/:id/charts", controllers.ListNetWorth)
+
+	// ExchangeRate
+	e.GET("/exchange_rates", controllers.ListExchangeRates)
+	e.POST("/exchange_rates", controllers.CreateExchangeRate)
+
 	// CashFlow
 	e.POST("/accounts/:id/cash_flows", controllers.CreateCashFlow)
 	e.POST("/accounts/:id/scheduled", controllers.CreateScheduledCashFlow)
@@ -79,11 +104,57 @@ func Init(staticFS *embed.FS, viewFS *embed.FS) *echo.Echo {
 	e.POST("/cash_flows/:id", controllers.UpdateCashFlow)
 	e.PUT("/cash_flows/:id", controllers.PutCashFlow)
 	e.DELETE("/cash_flows/:id", controllers.DeleteCashFlow)
+	e.POST("/cash_flows/:id/attachments", controllers.CreateCashFlowAttachment)
 
 	// Import
 	e.POST("/accounts/:id/imported", controllers.CreateImportedCashFlows)
 	e.GET("/accounts/:id/imported", controllers.ListImported)
+	e.POST("/accounts/:id/sync", controllers.SyncAccount)
 	e.GET("/imported/:id", controllers.ListImportedCashFlows)
+	e.POST("/imported/:id", controllers.UpdateStagedImport)
+	e.POST("/imported/:id/commit", controllers.CommitStagedImport)
+	e.POST("/imported/:id/discard", controllers.DiscardStagedImport)
+	e.POST("/imported/:id/undo", controllers.UndoImport)
+	e.POST("/import_duplicates/:id/accept", controllers.AcceptImportDuplicate)
+	e.POST("/import_duplicates/:id/discard", controllers.DiscardImportDuplicate)
+	e.GET("/import_rules", controllers.ListImportRules)
+	e.POST("/import_rules", controllers.CreateImportRule)
+	e.GET("/import_rules/:id/edit", controllers.EditImportRule)
+	e.POST("/import_rules/:id", controllers.UpdateImportRule)
+	e.POST("/import_rules/:id/run", controllers.RunImportRule)
+	e.DELETE("/import_rules/:id", controllers.DeleteImportRule)
+	e.GET("/csv_profiles", controllers.ListCsvProfiles)
+	e.POST("/csv_profiles", controllers.CreateCsvProfile)
+	e.GET("/csv_profiles/:id/edit", controllers.EditCsvProfile)
+	e.POST("/csv_profiles/:id", controllers.UpdateCsvProfile)
+	e.DELETE("/csv_profiles/:id", controllers.DeleteCsvProfile)
+	e.GET("/credentials", controllers.ListCredentials)
+	e.POST("/credentials", controllers.CreateCredential)
+	e.GET("/credentials/:id/edit", controllers.EditCredential)
+	e.POST("/credentials/:id", controllers.RotateCredential)
+	e.DELETE("/credentials/:id", controllers.DeleteCredential)
+	e.GET("/transfer_matches", controllers.ListTransferMatches)
+	e.POST("/transfer_matches", controllers.CreateTransferMatches)
+	e.POST("/transfer_matches/:id/accept", controllers.AcceptTransferMatch)
+	e.POST("/transfer_matches/:id/dismiss", controllers.DismissTransferMatch)
+	e.GET("/export", controllers.GetExport)
+	e.GET("/export/download", controllers.DownloadExport)
+	e.GET("/backup", controllers.GetBackup)
+	e.GET("/backup/download", controllers.DownloadBackup)
+	e.POST("/backup/restore", controllers.RestoreBackup)
+
+	// Search
+	e.GET("/search", controllers.NewSearch)
+	e.POST("/search", controllers.CreateSearch)
+	e.GET("/searches/:id", controllers.GetSearch)
+	e.POST("/searches/:id", controllers.UpdateSearch)
+	e.DELETE("/searches/:id", controllers.DeleteSearch)
+
+	// Tag
+	e.GET("/tags", controllers.ListTags)
+	e.GET("/tags/:id", controllers.GetTag)
+	e.POST("/tags/:id", controllers.UpdateTag)
+	e.DELETE("/tags/:id", controllers.DeleteTag)
 
 	// Payee
 	e.GET("/payees", controllers.ListPayees)
@@ -121,6 +192,7 @@ func Init(staticFS *embed.FS, viewFS *embed.FS) *echo.Echo {
 	e.POST("/securities/:security_id/trades/:id", controllers.UpdateTrade)
 	e.POST("/trades/:id", controllers.UpdateTrade)
 	e.DELETE("/trades/:id", controllers.DeleteTrade)
+	e.POST("/trades/:id/attachments", controllers.CreateTradeAttachment)
 	e.GET("/years/:year/gains", controllers.ListTradeGains)
 	e.GET("/years/:year/accounts/:account_id/gains", controllers.ListTradeGains)
 	e.GET("/gains/:id", controllers.GetTradeGain)
@@ -137,8 +209,19 @@ func Init(staticFS *embed.FS, viewFS *embed.FS) *echo.Echo {
 	e.GET("/years/:year/tax_types/:tax_type_id", controllers.ListTaxCashFlows)
 	e.GET("/tax_entries/:id/edit", controllers.EditTaxEntry)
 	e.POST("/tax_entries/:id", controllers.UpdateTaxEntry)
+	e.POST("/tax_entries/:id/attachments", controllers.CreateTaxEntryAttachment)
+
+	// Attachment
+	e.GET("/attachments/:id", controllers.GetAttachment)
+	e.DELETE("/attachments/:id", controllers.DeleteAttachment)
 	//e.GET("/tax_categories", controllers.ListTaxCategories)
 	//e.GET("/tax_years", controllers.ListTaxYears)
 
+	// Admin
+	e.GET("/admin/audit", controllers.GetAudit)
+	e.POST("/admin/audit", controllers.FixAudit)
+	e.GET("/admin/jobs", controllers.ListJobs)
+	e.POST("/admin/jobs/:name", controllers.RunJob)
+
 	return e
 }
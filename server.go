@@ -15,9 +15,11 @@ import (
 	"os/signal"
 	"syscall"
 	"github.com/labstack/echo/v4"
+	flag "github.com/spf13/pflag"
 	"github.com/pacificbrian/go-bookkeeper/config"
 	"github.com/pacificbrian/go-bookkeeper/controllers"
 	"github.com/pacificbrian/go-bookkeeper/db"
+	"github.com/pacificbrian/go-bookkeeper/model"
 	"github.com/pacificbrian/go-bookkeeper/route"
 )
 
@@ -36,12 +38,51 @@ func userSignal(ctx context.Context, e *echo.Echo) {
 	}
 }
 
+// Audit ledgers of all Users; use --fix to repair discrepancies.
+// Returns non-zero if any discrepancies remain.
+func runAudit() int {
+	remaining := 0
+
+	entries := model.AuditAllUsers(config.FixFlag)
+	for i := 0; i < len(entries); i++ {
+		e := &entries[i]
+		fmt.Println(e.String())
+		if !e.Fixed {
+			remaining += 1
+		}
+	}
+	fmt.Printf("AUDIT: %d discrepancies, %d remaining\n",
+		   len(entries), remaining)
+
+	if remaining > 0 {
+		return 1
+	}
+	return 0
+}
+
+// Run command given on command line instead of starting server
+func runCommand(command string) int {
+	log.Printf("[SERVER] RUN COMMAND(%s)", command)
+	switch command {
+	case "audit":
+		return runAudit()
+	}
+	log.Printf("[SERVER] UNKNOWN COMMAND(%s)", command)
+	return 2
+}
+
 func main() {
 	log.Println("[SERVER] START")
 	globals := config.GlobalConfig()
 
 	db.Init()
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(flag.Arg(0)))
+	}
 	e := route.Init(&publicStore, &templateStore)
+	if globals.JobScheduler {
+		model.StartJobScheduler()
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(),
 					  os.Interrupt, syscall.SIGTERM)
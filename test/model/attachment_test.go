@@ -0,0 +1,85 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"gotest.tools/v3/assert"
+)
+
+func openHttpFile(t *testing.T, name string, data string) model.HttpFile {
+	var file model.HttpFile
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(data), 0600)
+	assert.NilError(t, err)
+	file.FileName = name
+	file.FileData, err = os.Open(path)
+	assert.NilError(t, err)
+	t.Cleanup(func() { file.FileData.Close() })
+	return file
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestAttachments(t *testing.T) {
+	const receipt = "%PDF-1.4\n% Gopher Charity receipt\n%%EOF\n"
+	t.Cleanup(func() { os.RemoveAll("attachments") })
+
+	te1 := &model.TaxEntry{DateYear: 2025, Memo: "Gopher Charity"}
+	err := te1.Create(defaultSession)
+	assert.NilError(t, err)
+	te2 := &model.TaxEntry{DateYear: 2025, Memo: "Gopher Charity"}
+	err = te2.Create(defaultSession)
+	assert.NilError(t, err)
+
+	// must be for a CashFlow, Trade or TaxEntry
+	at := new(model.Attachment)
+	err = at.Create(defaultSession, openHttpFile(t, "receipt.pdf", receipt))
+	assert.Assert(t, err != nil)
+	// only PDFs and images
+	at.TaxEntryID = te1.ID
+	err = at.Create(defaultSession, openHttpFile(t, "receipt.txt", "receipt"))
+	assert.Assert(t, err != nil)
+
+	err = at.Create(defaultSession, openHttpFile(t, "receipt.pdf", receipt))
+	assert.NilError(t, err)
+	assert.Equal(t, at.ContentType, "application/pdf")
+	assert.Assert(t, fileExists(at.FilePath()))
+
+	// same file is stored once
+	at2 := &model.Attachment{TaxEntryID: te2.ID}
+	err = at2.Create(defaultSession, openHttpFile(t, "copy.pdf", receipt))
+	assert.NilError(t, err)
+	assert.Assert(t, at2.ID != at.ID)
+	assert.Equal(t, at2.FilePath(), at.FilePath())
+	at3 := &model.Attachment{TaxEntryID: te2.ID}
+	err = at3.Create(defaultSession, openHttpFile(t, "again.pdf", receipt))
+	assert.NilError(t, err)
+	assert.Equal(t, at3.ID, at2.ID)
+
+	entries := (&model.Attachment{TaxEntryID: te1.ID}).List(defaultSession)
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].FileName, "receipt.pdf")
+
+	// file removed once no Attachments use it
+	err = at.Delete(defaultSession)
+	assert.NilError(t, err)
+	assert.Assert(t, fileExists(at2.FilePath()))
+	err = te2.Delete(defaultSession)
+	assert.NilError(t, err)
+	assert.Assert(t, !fileExists(at2.FilePath()))
+	entries = (&model.Attachment{TaxEntryID: te2.ID}).List(defaultSession)
+	assert.Equal(t, len(entries), 0)
+	err = te1.Delete(defaultSession)
+	assert.NilError(t, err)
+}
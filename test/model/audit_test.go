@@ -0,0 +1,36 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"testing"
+	"github.com/pacificbrian/go-bookkeeper/db"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"gotest.tools/v3/assert"
+)
+
+func TestAuditLedger(t *testing.T) {
+	a := model.GetAccountByName(defaultSession, "Gopher Checking")
+	assert.Assert(t, a != nil)
+
+	c := makeCashFlow(a, "Gopher Audit", 40)
+	err := c.Create(defaultSession)
+	assert.NilError(t, err)
+
+	entries := model.AuditLedger(defaultSession, false)
+	assert.Equal(t, len(entries), 0)
+
+	// simulate drift in stored CashBalance
+	db.DbManager().Model(&model.Account{}).Where("id = ?", a.ID).
+	   Update("cash_balance", 0)
+	entries = model.AuditLedger(defaultSession, true)
+	assert.Equal(t, len(entries), 1)
+	assert.Assert(t, entries[0].Fixed)
+
+	entries = model.AuditLedger(defaultSession, false)
+	assert.Equal(t, len(entries), 0)
+}
@@ -0,0 +1,48 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"testing"
+	"time"
+	"github.com/shopspring/decimal"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"gotest.tools/v3/assert"
+)
+
+func TestListNetWorth(t *testing.T) {
+	a := new(model.Account)
+	a.Name = "Gopher Savings"
+	err := a.Create(defaultSession)
+	assert.NilError(t, err)
+	a = model.GetAccountByName(defaultSession, "Gopher Savings")
+	assert.Assert(t, a != nil)
+
+	c := new(model.CashFlow)
+	c.AccountID = a.ID
+	c.Date = time.Now().AddDate(0, 0, -10)
+	c.PayeeName = "Gopher Payroll"
+	c.CashFlowTypeID = model.Credit
+	c.Amount = decimal.NewFromInt32(500)
+	err = c.Create(defaultSession)
+	assert.NilError(t, err)
+
+	// Account without snapshots only has today's (current) balance
+	entries := model.ListNetWorth(defaultSession, []model.Account{*a}, 30)
+	assert.Assert(t, len(entries) == 31)
+	assert.Assert(t, entries[0].Total().IsZero())
+	assert.Assert(t, entries[25].Total().IsZero())
+	assert.Assert(t, entries[len(entries)-1].Total().Equal(decimal.NewFromInt32(500)))
+	assert.Equal(t, entries[0].Missing, 0)
+
+	// history is rebuilt from CashFlows
+	count := model.BackfillSnapshots(defaultSession)
+	assert.Assert(t, count > 0)
+	entries = model.ListNetWorth(defaultSession, []model.Account{*a}, 30)
+	assert.Assert(t, entries[0].Total().IsZero())
+	assert.Assert(t, entries[25].Total().Equal(decimal.NewFromInt32(500)))
+}
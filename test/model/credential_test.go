@@ -0,0 +1,90 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"gotest.tools/v3/assert"
+)
+
+func TestCredential(t *testing.T) {
+	t.Cleanup(func() { os.Remove("vault.key") })
+	a := model.GetAccountByName(defaultSession, "Gopher Credit")
+	assert.Assert(t, a != nil)
+
+	// need Username, Password and an Institution
+	cr := &model.Credential{InstitutionID: 1, Username: "gopher"}
+	err := cr.Save(defaultSession)
+	assert.Assert(t, err != nil)
+	cr = &model.Credential{AccountID: a.ID, Username: "gopher",
+			       Password: "burrow"}
+	err = cr.Save(defaultSession)
+	assert.Error(t, err, "No OFX Institution")
+
+	inst := &model.Credential{InstitutionID: 1, Username: "gopher",
+				  Password: "burrow"}
+	err = inst.Save(defaultSession)
+	assert.NilError(t, err)
+	assert.Assert(t, inst.ID > 0)
+	assert.Assert(t, !strings.Contains(inst.Secret, "gopher"))
+	_, err = os.Stat("vault.key")
+	assert.NilError(t, err)
+	again := &model.Credential{InstitutionID: 1, Username: "gopher",
+				   Password: "burrow"}
+	assert.Assert(t, again.Save(defaultSession) != nil)
+
+	saved := new(model.Credential)
+	saved.ID = inst.ID
+	err = saved.Open(defaultSession)
+	assert.NilError(t, err)
+	assert.Equal(t, saved.Username, "gopher")
+	assert.Equal(t, saved.Password, "burrow")
+	assert.Equal(t, len(new(model.Credential).List(defaultSession)), 1)
+
+	// rotate keeps Institution, with new Secret
+	secret := saved.Secret
+	saved.InstitutionID = 2
+	saved.Password = "tunnel"
+	err = saved.Save(defaultSession)
+	assert.NilError(t, err)
+	assert.Equal(t, saved.InstitutionID, uint(1))
+	assert.Assert(t, saved.Secret != secret)
+	rotated := new(model.Credential)
+	rotated.ID = inst.ID
+	assert.NilError(t, rotated.Open(defaultSession))
+	assert.Equal(t, rotated.Password, "tunnel")
+
+	// Secret cannot be opened if moved to another Institution
+	defaultSession.DB.Model(&model.Credential{}).Where("id = ?", inst.ID).
+			  Update("institution_id", 2)
+	moved := new(model.Credential)
+	moved.ID = inst.ID
+	assert.Error(t, moved.Open(defaultSession), "Invalid Vault Key")
+	defaultSession.DB.Model(&model.Credential{}).Where("id = ?", inst.ID).
+			  Update("institution_id", 1)
+
+	// used for Accounts of Institution
+	a.InstitutionID = 1
+	found := new(model.Credential).ForAccount(defaultSession, a)
+	assert.Assert(t, found != nil)
+	assert.Equal(t, found.ID, inst.ID)
+	a.InstitutionID = 2
+	assert.Assert(t, new(model.Credential).ForAccount(defaultSession, a) == nil)
+
+	// FetchOFX without Username and Password needs stored Credential
+	im := &model.Import{AccountID: a.ID}
+	im.Account = *a
+	err = im.FetchOFX(defaultSession)
+	assert.Error(t, err, "No Stored Credential")
+
+	err = inst.Delete(defaultSession)
+	assert.NilError(t, err)
+	assert.Equal(t, len(new(model.Credential).List(defaultSession)), 0)
+}
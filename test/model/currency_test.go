@@ -0,0 +1,59 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"testing"
+	"time"
+	"github.com/shopspring/decimal"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"gotest.tools/v3/assert"
+)
+
+const (
+	currencyTypeEUR uint = 6
+	currencyTypeGBP uint = 7
+)
+
+func TestTotalAccountsCurrency(t *testing.T) {
+	a := new(model.Account)
+	a.Name = "Gopher Euro Checking"
+	a.CurrencyTypeID = currencyTypeEUR
+	err := a.Create(defaultSession)
+	assert.NilError(t, err)
+	a.AddToBalance(100)
+	assert.Equal(t, a.Currency(a.Balance), "€100.00")
+
+	b := new(model.Account)
+	b.Name = "Gopher Sterling Checking"
+	b.CurrencyTypeID = currencyTypeGBP
+	b.AddToBalance(100)
+
+	r := new(model.ExchangeRate)
+	r.CurrencyTypeID = currencyTypeEUR
+	r.Date = time.Now().AddDate(0, 0, -7)
+	r.Rate = decimal.NewFromFloat(1.1)
+	// shared by all Users, so only administrator can add
+	other := new(model.User)
+	other.ID = model.AdminUserID + 1
+	otherSession := other.NewSession()
+	assert.Assert(t, r.Create(otherSession) != nil)
+	otherSession.CloseSession()
+	err = r.Create(defaultSession)
+	assert.NilError(t, err)
+
+	// Rate for GBP is missing
+	accounts := []model.Account{*a, *b}
+	total, missing := model.TotalAccounts(defaultSession, accounts, time.Now())
+	assert.Equal(t, missing, 1)
+	assert.Assert(t, total.Equal(decimal.NewFromInt32(110)))
+
+	// no Rate before date
+	_, missing = model.TotalAccounts(defaultSession, accounts[0:1],
+					 time.Now().AddDate(0, 0, -14))
+	assert.Equal(t, missing, 1)
+}
@@ -0,0 +1,211 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"github.com/aclindsa/ofxgo"
+	"github.com/shopspring/decimal"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"gotest.tools/v3/assert"
+)
+
+func TestExport(t *testing.T) {
+	a := model.GetAccountByName(defaultSession, "Gopher Checking")
+	assert.Assert(t, a != nil)
+	date := time.Now().AddDate(-1, 0, -30)
+
+	// Split and Transfer, dated before other entries
+	c := makeCashFlow(a, "Gopher Grocery", 80)
+	c.Date = date
+	c.Memo = "weekly"
+	err := c.Create(defaultSession)
+	assert.NilError(t, err)
+	for _, name := range []string{"Business", "Utilities:Energy"} {
+		split, _ := model.NewSplitCashFlow(defaultSession, c.ID)
+		assert.Assert(t, split != nil)
+		split.CashFlowTypeID = model.Debit
+		split.Amount = decimal.NewFromInt32(40)
+		split.CategoryID = model.CategoryGetByName(name).ID
+		err = split.Create(defaultSession)
+		assert.NilError(t, err)
+	}
+	transfer := makeCashFlow(a, "Gopher Savings", 25)
+	transfer.Date = date
+	transfer.CashFlowTypeID = model.DebitTransfer
+	err = transfer.Create(defaultSession)
+	assert.NilError(t, err)
+
+	e := &model.Export{AccountID: a.ID, Format: "qif",
+			   StartDate: date, EndDate: date}
+	var b bytes.Buffer
+	err = e.Write(defaultSession, &b)
+	assert.NilError(t, err)
+	qif := b.String()
+	assert.Assert(t, strings.HasPrefix(qif, "!Account\nNGopher Checking\nTBank\n^\n!Type:Bank\n"))
+	assert.Equal(t, strings.Count(qif, "^\n"), 3)
+	assert.Assert(t, strings.Contains(qif, "T-80.00\nPGopher Grocery\nMweekly\n" +
+						"SBusiness\n$-40.00\nSUtilities:Energy\n$-40.00\n^\n"))
+	assert.Assert(t, strings.Contains(qif, "T-25.00\nL[Gopher Savings]\n^\n"))
+	assert.Equal(t, e.FileName(), "Gopher_Checking_" + date.Format("20060102") + ".qif")
+
+	// OFX statement, with balance as of end of export
+	e = &model.Export{AccountID: a.ID, Format: "ofx", StartDate: date}
+	b.Reset()
+	err = e.Write(defaultSession, &b)
+	assert.NilError(t, err)
+	resp, err := ofxgo.ParseResponse(&b)
+	assert.NilError(t, err)
+	assert.Equal(t, len(resp.Bank), 1)
+	stmt := resp.Bank[0].(*ofxgo.StatementResponse)
+	tranList := stmt.BankTranList.Transactions
+	assert.Assert(t, len(tranList) >= 2)
+	assert.Equal(t, tranList[0].Name, ofxgo.String("Gopher Grocery"))
+	assert.Equal(t, tranList[1].TrnType, ofxgo.TrnTypeXfer)
+	a = model.GetAccountByName(defaultSession, "Gopher Checking")
+	assert.Equal(t, stmt.BalAmt.String(), a.Balance.String())
+
+	// Trades with investment actions
+	inv := model.GetAccountByName(defaultSession, "Gopher Investments")
+	assert.Assert(t, inv != nil)
+	tr := new(model.Trade)
+	tr.AccountID = inv.ID
+	makeTrade(tr, "GEXP", 0, 20, 5)
+	tr.Date = date
+	err = tr.Create(defaultSession)
+	assert.NilError(t, err)
+
+	e = &model.Export{AccountID: inv.ID, Format: "qif", StartDate: date, EndDate: date}
+	b.Reset()
+	err = e.Write(defaultSession, &b)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(b.String(), "!Type:Invst\n"))
+	assert.Assert(t, strings.Contains(b.String(), "NBuy\nYGEXP\nI20\nQ5\nT100.00\n"))
+
+	e.Format = "ofx"
+	b.Reset()
+	err = e.Write(defaultSession, &b)
+	assert.NilError(t, err)
+	resp, err = ofxgo.ParseResponse(&b)
+	assert.NilError(t, err)
+	assert.Equal(t, len(resp.InvStmt), 1)
+	invStmt := resp.InvStmt[0].(*ofxgo.InvStatementResponse)
+	assert.Equal(t, len(invStmt.InvTranList.InvTransactions), 1)
+	buy := invStmt.InvTranList.InvTransactions[0].(ofxgo.BuyStock)
+	assert.Equal(t, buy.InvBuy.Units.String(), "5")
+	assert.Equal(t, len(resp.SecList), 1)
+
+	e.Format = "csv"
+	err = e.Write(defaultSession, &b)
+	assert.Assert(t, err != nil)
+
+	err = tr.Delete(defaultSession)
+	assert.NilError(t, err)
+	err = transfer.Delete(defaultSession)
+	assert.NilError(t, err)
+	err = c.Delete(defaultSession)
+	assert.NilError(t, err)
+}
+
+func TestExportJournal(t *testing.T) {
+	a := makeAccount(t, "Gopher Journal Checking", model.AccountTypeDeposit)
+	makeAccount(t, "Gopher Journal Savings", model.AccountTypeDeposit)
+	inv := makeAccount(t, "Gopher Journal Investments", model.AccountTypeInvestment)
+	date := time.Now().AddDate(-1, -2, 0)
+	day := func(days int) string {
+		return date.AddDate(0, 0, days).Format("2006-01-02")
+	}
+
+	c := makeCashFlow(a, "Gopher Grocery", 80)
+	c.Date = date
+	err := c.Create(defaultSession)
+	assert.NilError(t, err)
+	for _, name := range []string{"Business", "Utilities:Energy"} {
+		split, _ := model.NewSplitCashFlow(defaultSession, c.ID)
+		assert.Assert(t, split != nil)
+		split.CashFlowTypeID = model.Debit
+		split.Amount = decimal.NewFromInt32(40)
+		split.CategoryID = model.CategoryGetByName(name).ID
+		err = split.Create(defaultSession)
+		assert.NilError(t, err)
+	}
+	transfer := makeCashFlow(a, "Gopher Journal Savings", 25)
+	transfer.Date = date
+	transfer.CashFlowTypeID = model.DebitTransfer
+	err = transfer.Create(defaultSession)
+	assert.NilError(t, err)
+
+	// two lots, Sell reduces first and part of second
+	trades := []*model.Trade{}
+	for i, shares := range []int32{10, 5, 12} {
+		tr := new(model.Trade)
+		tr.AccountID = inv.ID
+		makeTrade(tr, "GJRN", 0, 20 + int32(i) * 5, shares)
+		tr.Date = date.AddDate(0, 0, i)
+		if i == 2 {
+			tr.TradeTypeID = model.Sell
+		}
+		err = tr.Create(defaultSession)
+		assert.NilError(t, err)
+		trades = append(trades, tr)
+	}
+	lot1 := "T" + strconv.Itoa(int(trades[0].ID))
+	lot2 := "T" + strconv.Itoa(int(trades[1].ID))
+
+	e := &model.Export{Format: "beancount", StartDate: date,
+			   EndDate: date.AddDate(0, 0, 40)}
+	var b bytes.Buffer
+	err = e.Write(defaultSession, &b)
+	assert.NilError(t, err)
+	journal := b.String()
+	assert.Assert(t, strings.HasPrefix(journal, "option \"operating_currency\" \"USD\"\n"))
+	assert.Assert(t, strings.Contains(journal, " commodity GJRN\n  name: \"GJRN\"\n"))
+	assert.Assert(t, strings.Contains(journal, " open Assets:Gopher-Journal-Checking\n"))
+	assert.Assert(t, strings.Contains(journal, day(0) + " ! \"Gopher Grocery\" \"\"\n" +
+					  "  Assets:Gopher-Journal-Checking  -80.00 USD\n" +
+					  "  Expenses:Business  40.00 USD\n" +
+					  "  Expenses:Utilities:Energy  40.00 USD\n"))
+	// Transfer written once, from one of the Accounts
+	assert.Equal(t, strings.Count(journal, "  Assets:Gopher-Journal-Savings  25.00 USD\n") +
+			strings.Count(journal, "  Assets:Gopher-Journal-Checking  -25.00 USD\n"), 2)
+	assert.Assert(t, strings.Contains(journal, "  Assets:Gopher-Journal-Investments  10 GJRN {{200.00 USD, " +
+					  day(0) + ", \"" + lot1 + "\"}}\n"))
+	assert.Assert(t, strings.Contains(journal, "  Assets:Gopher-Journal-Investments  -10 GJRN {" +
+					  day(0) + ", \"" + lot1 + "\"} @ 30 USD\n" +
+					  "  Assets:Gopher-Journal-Investments  -2 GJRN {" +
+					  day(1) + ", \"" + lot2 + "\"} @ 30 USD\n" +
+					  "  Assets:Gopher-Journal-Investments  360.00 USD\n" +
+					  "  Income:Investments:Capital-Gains\n"))
+	monthEnd := time.Date(date.Year(), date.Month() + 1, 1, 0, 0, 0, 0, time.Local)
+	assert.Assert(t, strings.Contains(journal, monthEnd.Format("2006-01-02") +
+					  " balance Assets:Gopher-Journal-Checking  "))
+
+	e.Format = "ledger"
+	b.Reset()
+	err = e.Write(defaultSession, &b)
+	assert.NilError(t, err)
+	journal = b.String()
+	assert.Assert(t, strings.Contains(journal, "account Assets:Gopher-Journal-Checking\n"))
+	assert.Assert(t, strings.Contains(journal, "    Assets:Gopher-Journal-Investments  -2 GJRN {{50.00 USD}} [" +
+					  date.AddDate(0, 0, 1).Format("2006/01/02") + "] (" + lot2 + ")\n"))
+	assert.Assert(t, strings.Contains(journal, monthEnd.AddDate(0, 0, -1).Format("2006/01/02") +
+					  " * Balance Assertion\n"))
+	assert.Assert(t, strings.Contains(journal, "    Assets:Gopher-Journal-Checking  0 USD = "))
+
+	for i := len(trades) - 1; i >= 0; i-- {
+		err = trades[i].Delete(defaultSession)
+		assert.NilError(t, err)
+	}
+	err = transfer.Delete(defaultSession)
+	assert.NilError(t, err)
+	err = c.Delete(defaultSession)
+	assert.NilError(t, err)
+}
@@ -0,0 +1,101 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"testing"
+	"time"
+	"github.com/shopspring/decimal"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"gotest.tools/v3/assert"
+)
+
+const repeatOnce uint = 1
+
+func makeScheduled(a *model.Account, payee string, amount int32,
+		   days int, repeatIntervalTypeID uint) *model.CashFlow {
+	c := makeCashFlow(a, payee, amount)
+	c.Type = "RCashFlow"
+	c.Date = time.Now().AddDate(0, 0, days)
+	c.RepeatInterval.RepeatIntervalTypeID = repeatIntervalTypeID
+	return c
+}
+
+func makeAccount(t *testing.T, name string, accountTypeID uint) *model.Account {
+	a := new(model.Account)
+	a.Name = name
+	a.AccountTypeID = accountTypeID
+	err := a.Create(defaultSession)
+	assert.NilError(t, err)
+	a = model.GetAccountByName(defaultSession, name)
+	assert.Assert(t, a != nil)
+	return a
+}
+
+func TestForecast(t *testing.T) {
+	a := new(model.Account)
+	a.Name = "Gopher Bills"
+	a.AccountTypeID = model.AccountTypeDeposit
+	a.SetLowBalance("0")
+	err := a.Create(defaultSession)
+	assert.NilError(t, err)
+	a = model.GetAccountByName(defaultSession, "Gopher Bills")
+	assert.Assert(t, a != nil)
+	assert.Equal(t, a.GetLowBalance(), "0.00")
+
+	c := makeCashFlow(a, "Gopher Payroll", 100)
+	c.CashFlowTypeID = model.Credit
+	err = c.Create(defaultSession)
+	assert.NilError(t, err)
+
+	bill := makeScheduled(a, "Gopher Power", 60, 7, repeatMonthly)
+	bill.RepeatInterval.SetRepeatsLeft("3")
+	err = bill.Create(defaultSession)
+	assert.NilError(t, err)
+
+	savings := makeAccount(t, "Gopher Bills Savings", model.AccountTypeDeposit)
+	transfer := makeScheduled(savings, "Gopher Bills", 10, 14, repeatOnce)
+	transfer.CashFlowTypeID = model.DebitTransfer
+	err = transfer.Create(defaultSession)
+	assert.NilError(t, err)
+
+	var bills, other *model.AccountForecast
+	entries := model.Forecast(defaultSession, 6)
+	for i := 0; i < len(entries); i++ {
+		switch entries[i].Account.ID {
+		case a.ID:
+			bills = &entries[i]
+		case savings.ID:
+			other = &entries[i]
+		}
+	}
+	assert.Assert(t, bills != nil && other != nil)
+
+	// +10 Transfer in, and 3 remaining bills
+	assert.Equal(t, len(bills.CashFlows), 4)
+	assert.Assert(t, bills.CashFlows[0].Balance.Equal(decimal.NewFromInt32(40)))
+	assert.Assert(t, bills.CashFlows[1].Amount.Equal(decimal.NewFromInt32(10)))
+	assert.Assert(t, !bills.CashFlows[1].Low)
+	assert.Assert(t, bills.CashFlows[2].Low)
+	assert.Assert(t, bills.HasLow())
+	assert.Assert(t, bills.MinBalance.Equal(decimal.NewFromInt32(-70)))
+	assert.Assert(t, bills.EndBalance().Equal(decimal.NewFromInt32(-70)))
+	assert.Assert(t, bills.Balances[0].Balance.Equal(decimal.NewFromInt32(100)))
+
+	found := false
+	for i := 0; i < len(other.CashFlows); i++ {
+		if other.CashFlows[i].RepeatID == transfer.ID {
+			found = other.CashFlows[i].Amount.Equal(decimal.NewFromInt32(-10))
+		}
+	}
+	assert.Assert(t, found)
+	assert.Assert(t, !other.HasLow())
+
+	// nothing was posted
+	a = model.GetAccountByName(defaultSession, "Gopher Bills")
+	assert.Assert(t, a.CashBalance.Equal(decimal.NewFromInt32(100)))
+}
@@ -0,0 +1,100 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+	"github.com/shopspring/decimal"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"gotest.tools/v3/assert"
+)
+
+func TestImportCSV(t *testing.T) {
+	a := model.GetAccountByName(defaultSession, "Gopher Checking")
+	assert.Assert(t, a != nil)
+	balance := a.Balance
+
+	// need a date column, and amount or debit/credit columns
+	p := &model.CsvProfile{Name: "Invalid", AccountID: a.ID, AmountColumn: 2}
+	err := p.Save(defaultSession)
+	assert.Assert(t, err != nil)
+	p.DateColumn = 1
+	p.AmountColumn = 0
+	err = p.Save(defaultSession)
+	assert.Assert(t, err != nil)
+
+	p = &model.CsvProfile{Name: "Gopher Bank", AccountID: a.ID, Delimiter: ";",
+			      HeaderRows: 1, DateColumn: 1, DateFormat: "YYYY-MM-DD",
+			      PayeeColumn: 2, DebitColumn: 3, CreditColumn: 4,
+			      NumColumn: 5}
+	err = p.Save(defaultSession)
+	assert.NilError(t, err)
+
+	// rows newest first, and a row without a valid date
+	date := time.Now().AddDate(0, 0, -20)
+	csv := "Date;Description;Debit;Credit;Check\n" +
+	       fmt.Sprintf("%s;Gopher Bakery;$1,020.50;;1001\n", date.AddDate(0, 0, 2).Format("2006-01-02")) +
+	       fmt.Sprintf("%s;Gopher Refund;;(45.25);\n", date.Format("2006-01-02")) +
+	       "Total;;1020.50;45.25;\n"
+	im := &model.Import{AccountID: a.ID}
+	err = im.ImportFile(defaultSession, openHttpFile(t, "bank.csv", csv))
+	assert.NilError(t, err)
+
+	entries := searchCashFlows(model.Search{PayeeName: "Gopher Bakery"})
+	assert.Equal(t, len(entries), 1)
+	assert.Assert(t, entries[0].Amount.Equal(decimal.RequireFromString("-1020.50")))
+	assert.Equal(t, entries[0].Transnum, "1001")
+	entries = searchCashFlows(model.Search{PayeeName: "Gopher Refund"})
+	assert.Equal(t, len(entries), 1)
+	assert.Assert(t, entries[0].Amount.Equal(decimal.RequireFromString("45.25")))
+	a = model.GetAccountByName(defaultSession, "Gopher Checking")
+	assert.Assert(t, a.Balance.Equal(balance.Sub(decimal.RequireFromString("975.25"))))
+
+	// importing again enters nothing
+	again := &model.Import{AccountID: a.ID}
+	err = again.ImportFile(defaultSession, openHttpFile(t, "bank.csv", csv))
+	assert.NilError(t, err)
+	a = model.GetAccountByName(defaultSession, "Gopher Checking")
+	assert.Assert(t, a.Balance.Equal(balance.Sub(decimal.RequireFromString("975.25"))))
+	err = im.Undo(defaultSession)
+	assert.NilError(t, err)
+
+	// Trades with investment profile
+	a = model.GetAccountByName(defaultSession, "Gopher Investments")
+	assert.Assert(t, a != nil)
+	p = &model.CsvProfile{Name: "Gopher Brokerage", AccountID: a.ID,
+			      HeaderRows: 1, DateColumn: 1, ActionColumn: 2,
+			      SymbolColumn: 3, SharesColumn: 4, PriceColumn: 5,
+			      AmountColumn: 6}
+	err = p.Save(defaultSession)
+	assert.NilError(t, err)
+	assert.Assert(t, p.HasTrades())
+
+	csv = "Date,Action,Symbol,Quantity,Price,Amount\n" +
+	      fmt.Sprintf("%s,Bought,WOMB,20,12.50,-250.00\n", date.Format("01/02/2006")) +
+	      fmt.Sprintf("%s,Dividend,WOMB,,,3.00\n", date.AddDate(0, 0, 1).Format("01/02/2006")) +
+	      fmt.Sprintf("%s,Sold,WOMB,-5,14,70.00\n", date.AddDate(0, 0, 3).Format("01/02/2006"))
+	im = &model.Import{AccountID: a.ID}
+	err = im.ImportFile(defaultSession, openHttpFile(t, "trades.csv", csv))
+	assert.NilError(t, err)
+	im2 := new(model.Import)
+	im2.ID = im.ID
+	im = im2.Get(defaultSession)
+	assert.Assert(t, im != nil)
+	im.CountImported(defaultSession)
+	assert.Equal(t, im.TradeCount, uint(3))
+
+	s, _ := a.GetSecurityBySymbol(defaultSession, "WOMB")
+	assert.Assert(t, s != nil && s.ID > 0)
+	assert.Assert(t, s.Shares.Equal(decimal.NewFromInt32(15)))
+	err = im.Undo(defaultSession)
+	assert.NilError(t, err)
+	s, _ = a.GetSecurityBySymbol(defaultSession, "WOMB")
+	assert.Assert(t, s.Shares.IsZero())
+}
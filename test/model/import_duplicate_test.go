@@ -0,0 +1,105 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"github.com/shopspring/decimal"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"gotest.tools/v3/assert"
+)
+
+func importOFX(t *testing.T, a *model.Account, ofx string) *model.Import {
+	im := &model.Import{AccountID: a.ID}
+	err := im.ImportFile(defaultSession, openHttpFile(t, "duplicates.ofx", ofx))
+	assert.NilError(t, err)
+	im2 := new(model.Import)
+	im2.ID = im.ID
+	return im2.Get(defaultSession)
+}
+
+func TestImportDuplicates(t *testing.T) {
+	a := model.GetAccountByName(defaultSession, "Gopher Checking")
+	assert.Assert(t, a != nil)
+
+	date := time.Now().AddDate(0, 0, -5)
+	ofx := makeStatementOFX([]ofxTransaction{
+		{FiTID: "D1", Date: date, Amount: "-12.34", Name: "BURROW BAKERY", Memo: ""},
+		{FiTID: "D2", Date: date, Amount: "-45.00", Name: "TUNNEL BOOKS", Memo: ""}})
+	im := importOFX(t, a, ofx)
+	assert.Assert(t, im != nil)
+	assert.Equal(t, len(im.ListImported(defaultSession)), 2)
+
+	// same FITIDs are skipped
+	im = importOFX(t, a, ofx)
+	assert.Assert(t, im != nil)
+	assert.Equal(t, len(im.ListImported(defaultSession)), 0)
+	assert.Equal(t, len(im.ListDuplicates(defaultSession)), 0)
+
+	// same amount, similar payee and near date are held
+	ofx = makeStatementOFX([]ofxTransaction{
+		{FiTID: "D3", Date: date.AddDate(0, 0, 1), Amount: "-12.34", Name: "Burrow Bakery #12", Memo: ""},
+		{FiTID: "D4", Date: date.AddDate(0, 0, -2), Amount: "-45.00", Name: "TUNNEL BOOKS", Memo: ""},
+		{FiTID: "D5", Date: date, Amount: "-46.00", Name: "TUNNEL BOOKS", Memo: ""}})
+	im = importOFX(t, a, ofx)
+	assert.Assert(t, im != nil)
+	assert.Equal(t, len(im.ListImported(defaultSession)), 1)
+	duplicates := im.ListDuplicates(defaultSession)
+	assert.Equal(t, len(duplicates), 2)
+	assert.Equal(t, duplicates[0].PayeeName, "TUNNEL BOOKS")
+	assert.Equal(t, duplicates[0].CashFlow.PayeeName, "TUNNEL BOOKS")
+	assert.Equal(t, duplicates[1].CashFlow.PayeeName, "BURROW BAKERY")
+	im.CountImported(defaultSession)
+	assert.Equal(t, im.DuplicateCount, uint(2))
+
+	// accept enters CashFlow, discard does not
+	err := duplicates[1].Accept(defaultSession)
+	assert.NilError(t, err)
+	err = duplicates[0].Discard(defaultSession)
+	assert.NilError(t, err)
+	assert.Equal(t, len(im.ListImported(defaultSession)), 2)
+	assert.Equal(t, len(im.ListDuplicates(defaultSession)), 0)
+	entries := searchCashFlows(model.Search{PayeeName: "Burrow Bakery #12"})
+	assert.Equal(t, len(entries), 1)
+}
+
+func TestImportDuplicateTrades(t *testing.T) {
+	a := new(model.Account)
+	a.Name = "Gopher Brokerage"
+	a.AccountTypeID = model.AccountTypeInvestment
+	assert.NilError(t, a.Create(defaultSession))
+	a = model.GetAccountByName(defaultSession, "Gopher Brokerage")
+	assert.Assert(t, a != nil)
+
+	// second Buy is identical except for FITID
+	date := time.Now().AddDate(0, 0, -10)
+	ofx := makeInvStatementOFX(date)
+	start := strings.Index(ofx, "<BUYSTOCK>")
+	end := strings.Index(ofx, "</BUYSTOCK>") + len("</BUYSTOCK>\n")
+	buy := ofx[start:end]
+	ofx = ofx[:end] + strings.Replace(buy, "<FITID>I1<", "<FITID>I1B<", 1) + ofx[end:]
+
+	im := &model.Import{AccountID: a.ID}
+	err := im.ImportFile(defaultSession, openHttpFile(t, "trades.qfx", ofx))
+	assert.NilError(t, err)
+	im.CountImported(defaultSession)
+	assert.Equal(t, im.TradeCount, uint(4))
+	s, _ := a.GetSecurityBySymbol(defaultSession, "GOPH")
+	assert.Assert(t, s.Shares.Equal(decimal.NewFromInt32(16)))
+
+	// same FITIDs are skipped
+	again := &model.Import{AccountID: a.ID}
+	err = again.ImportFile(defaultSession, openHttpFile(t, "trades.qfx", ofx))
+	assert.NilError(t, err)
+	again.CountImported(defaultSession)
+	assert.Equal(t, again.TradeCount, uint(0))
+
+	err = im.Undo(defaultSession)
+	assert.NilError(t, err)
+}
@@ -0,0 +1,107 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"github.com/shopspring/decimal"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"gotest.tools/v3/assert"
+)
+
+const gopherCUSIP = "999999101"
+
+func ofxSecID(cusip string) string {
+	return "<SECID><UNIQUEID>" + cusip + "</UNIQUEID><UNIQUEIDTYPE>CUSIP</UNIQUEIDTYPE></SECID>"
+}
+
+func ofxInvTran(fitid string, date time.Time) string {
+	return fmt.Sprintf("<INVTRAN><FITID>%s</FITID><DTTRADE>%s</DTTRADE></INVTRAN>",
+			   fitid, date.Format("20060102"))
+}
+
+// investment statement (and SECLIST) with Buy, Dividend and Sell of
+// Gopher Holdings, the Sell listed first, and a cash deposit
+func makeInvStatementOFX(date time.Time) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="203" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX><SIGNONMSGSRSV1><SONRS><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+<DTSERVER>20260101120000</DTSERVER><LANGUAGE>ENG</LANGUAGE></SONRS></SIGNONMSGSRSV1>
+<INVSTMTMSGSRSV1><INVSTMTTRNRS><TRNUID>1</TRNUID><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+<INVSTMTRS><DTASOF>20260101</DTASOF><CURDEF>USD</CURDEF>
+<INVACCTFROM><BROKERID>example.com</BROKERID><ACCTID>789</ACCTID></INVACCTFROM>
+<INVTRANLIST><DTSTART>20260101</DTSTART><DTEND>20260101</DTEND>
+`)
+	fmt.Fprintf(&b, "<SELLSTOCK><INVSELL>%s%s<UNITS>-4</UNITS><UNITPRICE>25</UNITPRICE>" +
+			"<TOTAL>100.00</TOTAL><SUBACCTSEC>CASH</SUBACCTSEC>" +
+			"<SUBACCTFUND>CASH</SUBACCTFUND></INVSELL><SELLTYPE>SELL</SELLTYPE></SELLSTOCK>\n",
+		    ofxInvTran("I3", date.AddDate(0, 0, 4)), ofxSecID(gopherCUSIP))
+	fmt.Fprintf(&b, "<BUYSTOCK><INVBUY>%s%s<UNITS>10</UNITS><UNITPRICE>20</UNITPRICE>" +
+			"<TOTAL>-200.00</TOTAL><SUBACCTSEC>CASH</SUBACCTSEC>" +
+			"<SUBACCTFUND>CASH</SUBACCTFUND></INVBUY><BUYTYPE>BUY</BUYTYPE></BUYSTOCK>\n",
+		    ofxInvTran("I1", date), ofxSecID(gopherCUSIP))
+	fmt.Fprintf(&b, "<INCOME>%s%s<INCOMETYPE>DIV</INCOMETYPE><TOTAL>5.00</TOTAL>" +
+			"<SUBACCTSEC>CASH</SUBACCTSEC><SUBACCTFUND>CASH</SUBACCTFUND></INCOME>\n",
+		    ofxInvTran("I2", date.AddDate(0, 0, 2)), ofxSecID(gopherCUSIP))
+	fmt.Fprintf(&b, "<INVBANKTRAN><STMTTRN><TRNTYPE>CREDIT</TRNTYPE><DTPOSTED>%s</DTPOSTED>" +
+			"<TRNAMT>500.00</TRNAMT><FITID>I0</FITID><NAME>DEPOSIT</NAME></STMTTRN>" +
+			"<SUBACCTFUND>CASH</SUBACCTFUND></INVBANKTRAN>\n",
+		    date.AddDate(0, 0, -1).Format("20060102"))
+	b.WriteString(`</INVTRANLIST></INVSTMTRS></INVSTMTTRNRS></INVSTMTMSGSRSV1>
+<SECLISTMSGSRSV1><SECLIST><STOCKINFO><SECINFO>`)
+	b.WriteString(ofxSecID(gopherCUSIP))
+	b.WriteString(`<SECNAME>Gopher Holdings</SECNAME><TICKER>GOPH</TICKER></SECINFO></STOCKINFO>
+</SECLIST></SECLISTMSGSRSV1></OFX>
+`)
+	return b.String()
+}
+
+func TestImportInvestmentOFX(t *testing.T) {
+	a := model.GetAccountByName(defaultSession, "Gopher Investments")
+	assert.Assert(t, a != nil)
+	cashBalance := a.CashBalance
+
+	ofx := makeInvStatementOFX(time.Now().AddDate(0, 0, -10))
+	im := &model.Import{AccountID: a.ID}
+	err := im.ImportFile(defaultSession, openHttpFile(t, "invest.qfx", ofx))
+	assert.NilError(t, err)
+	im2 := new(model.Import)
+	im2.ID = im.ID
+	im = im2.Get(defaultSession)
+	assert.Assert(t, im != nil)
+	im.CountImported(defaultSession)
+	assert.Equal(t, im.TradeCount, uint(3))
+	assert.Equal(t, im.CashFlowCount, uint(1))
+
+	// Security created from SECLIST ticker, Sell entered after Buy
+	s, _ := a.GetSecurityBySymbol(defaultSession, "GOPH")
+	assert.Assert(t, s != nil && s.ID > 0)
+	assert.Equal(t, s.ImportName, gopherCUSIP)
+	assert.Assert(t, s.Shares.Equal(decimal.NewFromInt32(6)))
+	a = model.GetAccountByName(defaultSession, "Gopher Investments")
+	assert.Assert(t, a.CashBalance.Equal(cashBalance.Add(decimal.NewFromInt32(405))))
+
+	// importing again enters nothing
+	again := &model.Import{AccountID: a.ID}
+	err = again.ImportFile(defaultSession, openHttpFile(t, "invest.qfx", ofx))
+	assert.NilError(t, err)
+	s, _ = a.GetSecurityBySymbol(defaultSession, "GOPH")
+	assert.Assert(t, s.Shares.Equal(decimal.NewFromInt32(6)))
+	a = model.GetAccountByName(defaultSession, "Gopher Investments")
+	assert.Assert(t, a.CashBalance.Equal(cashBalance.Add(decimal.NewFromInt32(405))))
+
+	err = im.Undo(defaultSession)
+	assert.NilError(t, err)
+	s, _ = a.GetSecurityBySymbol(defaultSession, "GOPH")
+	assert.Assert(t, s.Shares.IsZero())
+	a = model.GetAccountByName(defaultSession, "Gopher Investments")
+	assert.Assert(t, a.CashBalance.Equal(cashBalance))
+}
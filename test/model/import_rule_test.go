@@ -0,0 +1,129 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"gotest.tools/v3/assert"
+)
+
+type ofxTransaction struct {
+	FiTID string
+	Date time.Time
+	Amount string
+	Name string
+	Memo string
+}
+
+// OFX (v2) bank statement with transactions
+func makeStatementOFX(transactions []ofxTransaction) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="203" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX><SIGNONMSGSRSV1><SONRS><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+<DTSERVER>20260101120000</DTSERVER><LANGUAGE>ENG</LANGUAGE></SONRS></SIGNONMSGSRSV1>
+<BANKMSGSRSV1><STMTTRNRS><TRNUID>1</TRNUID><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+<STMTRS><CURDEF>USD</CURDEF>
+<BANKACCTFROM><BANKID>123</BANKID><ACCTID>456</ACCTID><ACCTTYPE>CHECKING</ACCTTYPE></BANKACCTFROM>
+<BANKTRANLIST><DTSTART>20260101</DTSTART><DTEND>20260101</DTEND>
+`)
+	for _, tr := range transactions {
+		fmt.Fprintf(&b, "<STMTTRN><TRNTYPE>OTHER</TRNTYPE><DTPOSTED>%s</DTPOSTED>" +
+				"<TRNAMT>%s</TRNAMT><FITID>%s</FITID><NAME>%s</NAME>" +
+				"<MEMO>%s</MEMO></STMTTRN>\n",
+			    tr.Date.Format("20060102"), tr.Amount, tr.FiTID, tr.Name, tr.Memo)
+	}
+	b.WriteString(`</BANKTRANLIST><LEDGERBAL><BALAMT>0</BALAMT><DTASOF>20260101</DTASOF></LEDGERBAL>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>
+`)
+	return b.String()
+}
+
+func searchCashFlows(s model.Search) []model.CashFlow {
+	result, _ := s.Run(defaultSession)
+	return result.CashFlows
+}
+
+func TestImportRules(t *testing.T) {
+	a := model.GetAccountByName(defaultSession, "Gopher Checking")
+	assert.Assert(t, a != nil)
+	categoryEnergy := model.CategoryGetByName("Utilities:Energy").ID
+	categoryBusiness := model.CategoryGetByName("Business").ID
+
+	// need a condition, valid patterns and Splits of 100%
+	r := &model.ImportRule{Name: "Invalid", CategoryID: categoryEnergy}
+	assert.Assert(t, r.Save(defaultSession) != nil)
+	r.PayeePattern = "gopher ("
+	assert.Assert(t, r.Save(defaultSession) != nil)
+	r.PayeePattern = "gopher"
+	r.Splits = "50% Business"
+	assert.Assert(t, r.Save(defaultSession) != nil)
+
+	power := &model.ImportRule{Name: "Power", PayeePattern: "^gopher power",
+				   CategoryID: categoryEnergy, PayeeName: "Gopher Power",
+				   Memo: "electric"}
+	err := power.Save(defaultSession)
+	assert.NilError(t, err)
+	coffee := &model.ImportRule{Name: "Coffee", PayeePattern: "coffee", Skip: true}
+	err = coffee.Save(defaultSession)
+	assert.NilError(t, err)
+	shared := &model.ImportRule{Name: "Shared", MemoPattern: "shared",
+				    Splits: "60% Utilities:Energy, 40% Business"}
+	shared.SetMinAmount("50")
+	err = shared.Save(defaultSession)
+	assert.NilError(t, err)
+
+	date := time.Now().AddDate(0, 0, -2)
+	ofx := makeStatementOFX([]ofxTransaction{
+		{FiTID: "R1", Date: date, Amount: "-100.00", Name: "GOPHER POWER CO", Memo: "ACH"},
+		{FiTID: "R2", Date: date, Amount: "-4.50", Name: "GOPHER COFFEE", Memo: ""},
+		{FiTID: "R3", Date: date, Amount: "-77.77", Name: "GOPHER NET", Memo: "SHARED SERVICE"}})
+	im := &model.Import{AccountID: a.ID}
+	err = im.ImportFile(defaultSession, openHttpFile(t, "rules.ofx", ofx))
+	assert.NilError(t, err)
+
+	entries := searchCashFlows(model.Search{PayeeName: "Gopher Power"})
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].CategoryID, categoryEnergy)
+	assert.Equal(t, entries[0].Memo, "ACH electric")
+	entries = searchCashFlows(model.Search{PayeeName: "Gopher Coffee"})
+	assert.Equal(t, len(entries), 0)
+	// Search returns Splits instead of parent
+	entries = searchCashFlows(model.Search{PayeeName: "Gopher Net"})
+	assert.Equal(t, len(entries), 2)
+	assert.Assert(t, entries[0].Split && entries[1].Split)
+	amounts := map[uint]string{}
+	for i := 0; i < len(entries); i++ {
+		amounts[entries[i].CategoryID] = entries[i].Amount.String()
+	}
+	assert.Equal(t, amounts[categoryEnergy], "-46.66")
+	assert.Equal(t, amounts[categoryBusiness], "-31.11")
+
+	// apply to past CashFlows
+	c := makeCashFlow(a, "GOPHER POWER CO", 80)
+	err = c.Create(defaultSession)
+	assert.NilError(t, err)
+	power = power.Get(defaultSession)
+	assert.Assert(t, power != nil)
+	count, err := power.Run(defaultSession)
+	assert.NilError(t, err)
+	assert.Assert(t, count >= 1)
+	c = getCashFlow(c.ID)
+	assert.Equal(t, c.CategoryID, categoryEnergy)
+	assert.Equal(t, c.Memo, "electric")
+	entries = searchCashFlows(model.Search{PayeeName: "Gopher Power"})
+	assert.Equal(t, len(entries), 2)
+
+	assert.NilError(t, power.Delete(defaultSession))
+	assert.NilError(t, coffee.Delete(defaultSession))
+	assert.NilError(t, shared.Delete(defaultSession))
+	assert.Equal(t, len(new(model.ImportRule).List(defaultSession)), 0)
+}
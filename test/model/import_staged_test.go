@@ -0,0 +1,126 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"testing"
+	"time"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"gotest.tools/v3/assert"
+)
+
+func TestImportStaged(t *testing.T) {
+	a := model.GetAccountByName(defaultSession, "Gopher Checking")
+	assert.Assert(t, a != nil)
+	savings := model.GetAccountByName(defaultSession, "Gopher Savings")
+	assert.Assert(t, savings != nil)
+	category := model.CategoryGetByName("Business").ID
+
+	date := time.Now().AddDate(0, 0, -3)
+	ofx := makeStatementOFX([]ofxTransaction{
+		{FiTID: "S1", Date: date, Amount: "-20.00", Name: "BADGER GROCER", Memo: ""},
+		{FiTID: "S2", Date: date, Amount: "-21.00", Name: "BADGER GROCER", Memo: ""},
+		{FiTID: "S3", Date: date, Amount: "-30.00", Name: "WSL*FUEL 1234", Memo: ""},
+		{FiTID: "S4", Date: date, Amount: "-50.00", Name: "ONLINE TRANSFER", Memo: ""}})
+	im := &model.Import{AccountID: a.ID, Staged: true}
+	err := im.ImportFile(defaultSession, openHttpFile(t, "staged.ofx", ofx))
+	assert.NilError(t, err)
+	im2 := new(model.Import)
+	im2.ID = im.ID
+	im = im2.Get(defaultSession)
+	assert.Assert(t, im != nil && im.Staged)
+
+	// nothing entered until committed
+	assert.Equal(t, len(im.ListImported(defaultSession)), 0)
+	staged := im.ListStaged(defaultSession)
+	assert.Equal(t, len(staged), 4)
+	assert.Assert(t, staged[0].Selected && !staged[0].Duplicate)
+
+	staged[1].Selected = false
+	staged[2].PayeeName = "Weasel Fuel"
+	staged[2].CategoryID = category
+	staged[3].TransferAccountID = savings.ID
+	err = im.UpdateStaged(defaultSession, staged)
+	assert.NilError(t, err)
+	// cannot transfer to same Account, and no other change is saved
+	staged[0].Memo = "Not Saved"
+	staged[3].TransferAccountID = a.ID
+	err = im.UpdateStaged(defaultSession, staged)
+	assert.Assert(t, err != nil)
+	assert.Equal(t, im.ListStaged(defaultSession)[0].Memo, "")
+
+	// failed commit enters nothing and remains staged
+	defaultSession.DB.Model(&model.StagedTransaction{}).Where("id = ?", staged[3].ID).
+			  Update("transfer_account_id", 999999)
+	count, err := im.CommitStaged(defaultSession)
+	assert.Error(t, err, "Invalid Transfer Account")
+	assert.Equal(t, count, 0)
+	assert.Equal(t, len(im.ListImported(defaultSession)), 0)
+	assert.Equal(t, len(im.ListStaged(defaultSession)), 4)
+	defaultSession.DB.Model(&model.StagedTransaction{}).Where("id = ?", staged[3].ID).
+			  Update("transfer_account_id", savings.ID)
+
+	im2 = new(model.Import)
+	im2.ID = im.ID
+	stale := im2.Get(defaultSession)
+	assert.Assert(t, stale != nil && stale.Staged)
+	count, err = im.CommitStaged(defaultSession)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 3)
+	// cannot be committed twice
+	count, err = stale.CommitStaged(defaultSession)
+	assert.Error(t, err, "Import is not staged")
+	assert.Equal(t, len(im.ListImported(defaultSession)), 3)
+	assert.Assert(t, !im.Staged)
+	assert.Equal(t, len(im.ListStaged(defaultSession)), 0)
+	entries := im.ListImported(defaultSession)
+	assert.Equal(t, len(entries), 3)
+	assert.Equal(t, entries[1].PayeeName, "Weasel Fuel")
+	assert.Equal(t, entries[1].CategoryID, category)
+	assert.Assert(t, entries[2].Transfer)
+	assert.Equal(t, entries[2].PayeeID, savings.ID)
+
+	// staging again marks duplicates, discard enters nothing
+	im = &model.Import{AccountID: a.ID, Staged: true}
+	err = im.ImportFile(defaultSession, openHttpFile(t, "staged.ofx", ofx))
+	assert.NilError(t, err)
+	im2 = new(model.Import)
+	im2.ID = im.ID
+	im = im2.Get(defaultSession)
+	assert.Assert(t, im != nil)
+	staged = im.ListStaged(defaultSession)
+	assert.Equal(t, len(staged), 4)
+	assert.Assert(t, staged[0].Duplicate && staged[0].DuplicateID > 0)
+	assert.Assert(t, !staged[1].Duplicate)
+	err = im.DiscardStaged(defaultSession)
+	assert.NilError(t, err)
+	im2 = new(model.Import)
+	im2.ID = im.ID
+	assert.Assert(t, im2.Get(defaultSession) == nil)
+
+	// discard removes Securities created by staging
+	inv := new(model.Account)
+	inv.Name = "Gopher Staged Investments"
+	inv.AccountTypeID = model.AccountTypeInvestment
+	assert.NilError(t, inv.Create(defaultSession))
+	inv = model.GetAccountByName(defaultSession, "Gopher Staged Investments")
+	assert.Assert(t, inv != nil)
+	im = &model.Import{AccountID: inv.ID, Staged: true}
+	err = im.ImportFile(defaultSession, openHttpFile(t, "staged.qfx",
+				makeInvStatementOFX(date)))
+	assert.NilError(t, err)
+	s, _ := inv.GetSecurityBySymbol(defaultSession, "GOPH")
+	assert.Assert(t, s != nil && s.ID > 0)
+	im2 = new(model.Import)
+	im2.ID = im.ID
+	im = im2.Get(defaultSession)
+	assert.Assert(t, im != nil)
+	err = im.DiscardStaged(defaultSession)
+	assert.NilError(t, err)
+	s, _ = inv.GetSecurityBySymbol(defaultSession, "GOPH")
+	assert.Assert(t, s != nil && s.ID == 0)
+}
@@ -0,0 +1,120 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+	"github.com/shopspring/decimal"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"gotest.tools/v3/assert"
+)
+
+const camt053Entry string = `<Ntry>
+<NtryRef>%s</NtryRef>
+<Amt Ccy="%s">%s</Amt>
+<CdtDbtInd>%s</CdtDbtInd>
+<Sts><Cd>%s</Cd></Sts>
+<BookgDt><Dt>%s</Dt></BookgDt>
+<ValDt><Dt>%s</Dt></ValDt>
+<NtryDtls><TxDtls>
+<Refs><EndToEndId>NOTPROVIDED</EndToEndId></Refs>
+<RltdPties><Dbtr><Pty><Nm>Gopher Employer</Nm></Pty></Dbtr><Cdtr><Pty><Nm>%s</Nm></Pty></Cdtr></RltdPties>
+<RmtInf><Ustrd>%s</Ustrd></RmtInf>
+</TxDtls></NtryDtls>
+</Ntry>
+`
+
+func TestImportStatement(t *testing.T) {
+	a := model.GetAccountByName(defaultSession, "Gopher Euro Checking")
+	assert.Assert(t, a != nil)
+	balance := a.Balance
+	date := time.Now().AddDate(0, 0, -10)
+	day := func(days int) string {
+		return date.AddDate(0, 0, days).Format("2006-01-02")
+	}
+
+	// booked debit and credit, pending and other currency are skipped
+	camt := `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.08">
+<BkToCstmrStmt><Stmt>
+` + fmt.Sprintf(camt053Entry, "CAMT-1", "EUR", "42.50", "DBIT", "BOOK",
+		day(0), day(1), "Gopher Camt Market", "Groceries") +
+	    fmt.Sprintf(camt053Entry, "CAMT-2", "EUR", "1000.00", "CRDT", "BOOK",
+		day(1), day(1), "Gopher Bank", "Salary") +
+	    fmt.Sprintf(camt053Entry, "CAMT-3", "EUR", "9.99", "DBIT", "PDNG",
+		day(2), day(2), "Gopher Pending", "Pending") +
+	    fmt.Sprintf(camt053Entry, "CAMT-4", "USD", "5.00", "DBIT", "BOOK",
+		day(2), day(2), "Gopher Dollar", "Dollars") + `</Stmt></BkToCstmrStmt>
+</Document>`
+	im := &model.Import{AccountID: a.ID}
+	err := im.ImportFile(defaultSession, openHttpFile(t, "statement.xml", camt))
+	assert.NilError(t, err)
+
+	entries := searchCashFlows(model.Search{PayeeName: "Gopher Camt Market"})
+	assert.Equal(t, len(entries), 1)
+	assert.Assert(t, entries[0].Amount.Equal(decimal.RequireFromString("-42.50")))
+	assert.Equal(t, entries[0].Transnum, "CAMT-1")
+	assert.Equal(t, entries[0].Memo, "Groceries")
+	assert.Equal(t, entries[0].Date.Format("2006-01-02"), day(0))
+	// counterparty of credit is Debtor
+	entries = searchCashFlows(model.Search{PayeeName: "Gopher Employer"})
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].Transnum, "CAMT-2")
+	assert.Equal(t, len(searchCashFlows(model.Search{PayeeName: "Gopher Pending"})), 0)
+	assert.Equal(t, len(searchCashFlows(model.Search{PayeeName: "Gopher Dollar"})), 0)
+	a = model.GetAccountByName(defaultSession, "Gopher Euro Checking")
+	assert.Assert(t, a.Balance.Equal(balance.Add(decimal.RequireFromString("957.50"))))
+
+	// importing again enters nothing, as references already imported
+	im = &model.Import{AccountID: a.ID}
+	err = im.ImportFile(defaultSession, openHttpFile(t, "statement.xml", camt))
+	assert.NilError(t, err)
+	assert.Equal(t, len(searchCashFlows(model.Search{PayeeName: "Gopher Camt Market"})), 1)
+
+	// MT940 with structured and unstructured :86: information,
+	// the booking date (MMDD) differs from the value date, a customer
+	// reference containing / and an invalid line which is skipped
+	valueDate := date.AddDate(0, 0, 3)
+	mt940 := "{1:F01GOPHDEFFAXXX0000000000}{2:I940GOPHDEFFXXXXN}{4:\n" +
+		 ":20:STMT1\n:25:DE00123456780000000000\n:28C:1/1\n" +
+		 ":60F:C" + valueDate.Format("060102") + "EUR0,00\n" +
+		 ":61:" + valueDate.Format("060102") + date.AddDate(0, 0, 2).Format("0102") +
+		 "D17,25NTRFNONREF//MT940-1\n" +
+		 ":86:177?00UEBERWEISUNG?20Invoice 42?21March?32Gopher Mt\n?33Power\n" +
+		 ":61:" + valueDate.Format("060102") + "C5,NMSCREF-2\n" +
+		 ":86:Gopher Mt Refund\nReturned item\n" +
+		 ":61:" + valueDate.Format("060102") + "C8,NTRFINV/2024/7//B123\n" +
+		 ":86:Gopher Mt Invoice\n" +
+		 ":61:INVALID\n:86:Gopher Mt Invalid\n" +
+		 ":62F:C" + valueDate.Format("060102") + "EUR-12,25\n-}\n"
+	im = &model.Import{AccountID: a.ID}
+	err = im.ImportFile(defaultSession, openHttpFile(t, "statement.sta", mt940))
+	assert.NilError(t, err)
+
+	entries = searchCashFlows(model.Search{PayeeName: "Gopher Mt Power"})
+	assert.Equal(t, len(entries), 1)
+	assert.Assert(t, entries[0].Amount.Equal(decimal.RequireFromString("-17.25")))
+	assert.Equal(t, entries[0].Transnum, "MT940-1")
+	assert.Equal(t, entries[0].Memo, "Invoice 42 March")
+	assert.Equal(t, entries[0].Date.Format("2006-01-02"), day(2))
+	entries = searchCashFlows(model.Search{PayeeName: "Gopher Mt Refund"})
+	assert.Equal(t, len(entries), 1)
+	assert.Assert(t, entries[0].Amount.Equal(decimal.RequireFromString("5")))
+	assert.Equal(t, entries[0].Transnum, "REF-2")
+	assert.Equal(t, entries[0].Memo, "Returned item")
+	assert.Equal(t, entries[0].Date.Format("2006-01-02"), day(3))
+	entries = searchCashFlows(model.Search{PayeeName: "Gopher Mt Invoice"})
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].Transnum, "B123")
+	assert.Equal(t, len(searchCashFlows(model.Search{PayeeName: "Gopher Mt Invalid"})), 0)
+
+	im = &model.Import{AccountID: a.ID}
+	err = im.ImportFile(defaultSession, openHttpFile(t, "statement.sta", "not a statement"))
+	assert.Assert(t, err != nil)
+}
@@ -0,0 +1,69 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"testing"
+	"time"
+	"github.com/shopspring/decimal"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"gotest.tools/v3/assert"
+)
+
+func TestUndoImport(t *testing.T) {
+	a := model.GetAccountByName(defaultSession, "Gopher Checking")
+	assert.Assert(t, a != nil)
+	savings := model.GetAccountByName(defaultSession, "Gopher Savings")
+	assert.Assert(t, savings != nil)
+	balance := a.Balance
+	savingsBalance := savings.Balance
+
+	rule := &model.ImportRule{Name: "Otter", PayeePattern: "^otter",
+				  Splits: "50% Business, 50% Utilities:Energy"}
+	err := rule.Save(defaultSession)
+	assert.NilError(t, err)
+	defer rule.Delete(defaultSession)
+
+	date := time.Now().AddDate(0, 0, -4)
+	ofx := makeStatementOFX([]ofxTransaction{
+		{FiTID: "U1", Date: date, Amount: "-40.00", Name: "OTTER SUPPLY", Memo: ""},
+		{FiTID: "U2", Date: date, Amount: "-25.00", Name: "ONLINE TRANSFER", Memo: ""},
+		{FiTID: "U3", Date: date, Amount: "-7.25", Name: "MARMOT CAFE", Memo: ""}})
+	im := &model.Import{AccountID: a.ID, Staged: true}
+	err = im.ImportFile(defaultSession, openHttpFile(t, "undo.ofx", ofx))
+	assert.NilError(t, err)
+	im2 := new(model.Import)
+	im2.ID = im.ID
+	im = im2.Get(defaultSession)
+	assert.Assert(t, im != nil)
+	staged := im.ListStaged(defaultSession)
+	assert.Equal(t, len(staged), 3)
+	staged[1].TransferAccountID = savings.ID
+	err = im.UpdateStaged(defaultSession, staged)
+	assert.NilError(t, err)
+	count, err := im.CommitStaged(defaultSession)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 3)
+
+	a = model.GetAccountByName(defaultSession, "Gopher Checking")
+	assert.Assert(t, a.Balance.Equal(balance.Sub(decimal.RequireFromString("72.25"))))
+	savings = model.GetAccountByName(defaultSession, "Gopher Savings")
+	assert.Assert(t, savings.Balance.Equal(savingsBalance.Add(decimal.RequireFromString("25"))))
+	assert.Equal(t, len(searchCashFlows(model.Search{PayeeName: "OTTER SUPPLY"})), 2)
+
+	err = im.Undo(defaultSession)
+	assert.NilError(t, err)
+	im2 = new(model.Import)
+	im2.ID = im.ID
+	assert.Assert(t, im2.Get(defaultSession) == nil)
+	a = model.GetAccountByName(defaultSession, "Gopher Checking")
+	assert.Assert(t, a.Balance.Equal(balance))
+	savings = model.GetAccountByName(defaultSession, "Gopher Savings")
+	assert.Assert(t, savings.Balance.Equal(savingsBalance))
+	assert.Equal(t, len(searchCashFlows(model.Search{PayeeName: "OTTER SUPPLY"})), 0)
+	assert.Equal(t, len(searchCashFlows(model.Search{PayeeName: "MARMOT CAFE"})), 0)
+}
@@ -0,0 +1,101 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"testing"
+	"time"
+	"github.com/pacificbrian/go-bookkeeper/model"
+)
+
+func getJob(name string) *model.Job {
+	jobs := model.ListJobs()
+	for i := 0; i < len(jobs); i++ {
+		if jobs[i].Name == name {
+			return &jobs[i]
+		}
+	}
+	return nil
+}
+
+// wait for Job to complete run after runs
+func waitJob(name string, runs int) *model.Job {
+	j := getJob(name)
+	for i := 0; i < 100 && (j.Runs == runs || j.Running); i++ {
+		time.Sleep(50 * time.Millisecond)
+		j = getJob(name)
+	}
+	return j
+}
+
+// count CashFlows posted from ScheduledCashFlow
+func countPosted(c *model.CashFlow) int64 {
+	var count int64
+	defaultSession.DB.Model(&model.CashFlow{}).
+			  Where("repeat_interval_id = ? AND id <> ?", c.ID, c.ID).
+			  Count(&count)
+	return count
+}
+
+func TestJobScheduler(t *testing.T) {
+	a := new(model.Account)
+	a.Name = "Gopher Job Checking"
+	a.AccountTypeID = model.AccountTypeDeposit
+	err := a.Create(defaultSession)
+	if err != nil {
+		t.Fatalf("Account Create failed: %v", err)
+	}
+	a = model.GetAccountByName(defaultSession, "Gopher Job Checking")
+	bill := makeScheduled(a, "Gopher Job Rent", 25, -10, repeatMonthly)
+	err = bill.Create(defaultSession)
+	if err != nil {
+		t.Fatalf("CashFlow Create failed: %v", err)
+	}
+
+	model.StartJobScheduler()
+	if len(model.ListJobs()) == 0 {
+		t.Fatalf("Job Scheduler has no Jobs")
+	}
+	if model.RunJob(defaultSession, "no_such_job") == nil {
+		t.Errorf("RunJob of unknown Job succeeded")
+	}
+
+	err = model.RunJob(defaultSession, "post_scheduled")
+	if err != nil {
+		t.Fatalf("RunJob failed: %v", err)
+	}
+	j := waitJob("post_scheduled", 0)
+	if j.Runs != 1 || !j.HasRun() {
+		t.Fatalf("Job (%s) did not run", j.Name)
+	}
+	if j.LastError != "" {
+		t.Errorf("Job (%s) failed: %s", j.Name, j.LastError)
+	}
+	if !j.NextRun.After(j.LastRun) {
+		t.Errorf("Job (%s) not rescheduled", j.Name)
+	}
+
+	// posted once, with Balance written to database by Job
+	if countPosted(bill) != 1 {
+		t.Errorf("ScheduledCashFlow posted %d times", countPosted(bill))
+	}
+	stored := new(model.Account)
+	defaultSession.DB.First(stored, a.ID)
+	if stored.Balance.String() != "-25" {
+		t.Errorf("Account Balance (%s) not updated", stored.Balance)
+	}
+
+	// running again doesn't post same Date
+	err = model.RunJob(defaultSession, "post_scheduled")
+	if err != nil {
+		t.Fatalf("RunJob failed: %v", err)
+	}
+	waitJob("post_scheduled", 1)
+	if countPosted(bill) != 1 {
+		t.Errorf("ScheduledCashFlow posted %d times", countPosted(bill))
+	}
+}
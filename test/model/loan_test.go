@@ -0,0 +1,81 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"testing"
+	"time"
+	"github.com/shopspring/decimal"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"gotest.tools/v3/assert"
+)
+
+const repeatMonthly uint = 5
+const categoryMortgageInterest uint = 35
+
+func TestLoanAmortization(t *testing.T) {
+	loan := new(model.Account)
+	loan.Name = "Gopher Mortgage"
+	loan.AccountTypeID = model.AccountTypeLoan
+	err := loan.Create(defaultSession)
+	assert.NilError(t, err)
+	loan = model.GetAccountByName(defaultSession, "Gopher Mortgage")
+	assert.Assert(t, loan != nil)
+
+	c := makeCashFlow(loan, "Gopher Bank", 10000)
+	err = c.Create(defaultSession)
+	assert.NilError(t, err)
+
+	// scheduled payment from checking, split into principal and interest
+	checking := model.GetAccountByName(defaultSession, "Gopher Checking")
+	assert.Assert(t, checking != nil)
+	repeat := makeCashFlow(checking, "Gopher Bank", 500)
+	repeat.Date = time.Now().AddDate(0, 1, 0)
+	repeat.Type = "RCashFlow"
+	repeat.RepeatInterval.RepeatIntervalTypeID = repeatMonthly
+	repeat.RepeatInterval.Rate = decimal.NewFromInt32(6)
+	err = repeat.Create(defaultSession)
+	assert.NilError(t, err)
+
+	principal, _ := model.NewSplitCashFlow(defaultSession, repeat.ID)
+	principal.CashFlowTypeID = model.DebitTransfer
+	principal.PayeeName = "Gopher Mortgage"
+	principal.Amount = decimal.NewFromInt32(450)
+	err = principal.Create(defaultSession)
+	assert.NilError(t, err)
+
+	interest, _ := model.NewSplitCashFlow(defaultSession, repeat.ID)
+	interest.CategoryID = categoryMortgageInterest
+	interest.Amount = decimal.NewFromInt32(50)
+	err = interest.Create(defaultSession)
+	assert.NilError(t, err)
+
+	loan = model.GetAccountByName(defaultSession, "Gopher Mortgage")
+	scenarios := []model.LoanScenario{{Name: "Extra",
+					   ExtraPayment: decimal.NewFromInt32(100)},
+					  {Name: "Refinance",
+					   RefinanceRate: decimal.NewFromInt32(6),
+					   RefinanceMonths: 12}}
+	schedules, err := loan.LoanAmortization(defaultSession, scenarios)
+	assert.NilError(t, err)
+	assert.Equal(t, len(schedules), 3)
+
+	current := &schedules[0]
+	assert.Assert(t, current.Payment.Equal(decimal.NewFromInt32(500)))
+	assert.Assert(t, current.NumPayments() > 20)
+	assert.Assert(t, current.Payments[current.NumPayments()-1].Balance.IsZero())
+	assert.Assert(t, current.TotalInterest.IsPositive())
+
+	assert.Assert(t, schedules[1].NumPayments() < current.NumPayments())
+	assert.Assert(t, schedules[1].InterestSaved.IsPositive())
+	assert.Equal(t, schedules[2].NumPayments(), 12)
+	assert.Assert(t, schedules[2].Payment.Equal(decimal.RequireFromString("860.66")))
+
+	// not a Loan Account
+	_, err = checking.LoanAmortization(defaultSession, nil)
+	assert.Assert(t, err != nil)
+}
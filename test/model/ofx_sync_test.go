@@ -0,0 +1,116 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+	"github.com/shopspring/decimal"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"github.com/pacificbrian/go-bookkeeper/test/ofxserver"
+	"gotest.tools/v3/assert"
+)
+
+// point OFX downloads at stand-in server, trusting its certificate
+func useOfxServer(t *testing.T, srv *ofxserver.Server) {
+	httpClient := http.DefaultClient
+	http.DefaultClient = srv.Client()
+	model.SetOfxServerURL(srv.URL)
+	t.Cleanup(func() {
+		http.DefaultClient = httpClient
+		model.SetOfxServerURL("")
+		srv.Close()
+		os.Remove("vault.key")
+	})
+}
+
+func TestOfxSync(t *testing.T) {
+	srv := ofxserver.NewServer("gopher", "burrow", "1001")
+	useOfxServer(t, srv)
+	date := time.Now().AddDate(0, 0, -10)
+	srv.AddTransaction(ofxserver.Transaction{FITID: "S1", Date: date,
+				Amount: decimal.RequireFromString("1234.11"),
+				Name: "Gopher Payroll"})
+	srv.AddTransaction(ofxserver.Transaction{FITID: "S2", Date: date.AddDate(0, 0, 3),
+				Amount: decimal.RequireFromString("-87.13"),
+				Name: "Gopher Utilities"})
+
+	a := new(model.Account)
+	a.Name = "Gopher Linked Checking"
+	a.AccountTypeID = model.AccountTypeDeposit
+	a.InstitutionID = 3
+	err := a.Create(defaultSession)
+	assert.NilError(t, err)
+	a = model.GetAccountByName(defaultSession, "Gopher Linked Checking")
+	assert.Assert(t, a != nil)
+
+	_, err = a.SyncOFX(defaultSession)
+	assert.Error(t, err, "Account Not Linked")
+
+	// bad password, retried after 15 minutes
+	cr := &model.Credential{AccountID: a.ID, Username: "gopher",
+			       Password: "tunnel"}
+	err = cr.Save(defaultSession)
+	assert.NilError(t, err)
+	s, err := a.SyncOFX(defaultSession)
+	assert.Assert(t, err != nil)
+	assert.Equal(t, s.Failures, uint(1))
+	assert.Equal(t, s.NextSync.Sub(s.StartedAt), 15 * time.Minute)
+	failures := model.ListOfxSyncFailures(defaultSession)
+	assert.Equal(t, len(failures), 1)
+	assert.Equal(t, failures[0].Account.ID, a.ID)
+
+	// server unavailable, retried after 30 minutes
+	cr.Password = "burrow"
+	err = cr.Save(defaultSession)
+	assert.NilError(t, err)
+	srv.FailRequests(1)
+	s, err = a.SyncOFX(defaultSession)
+	assert.Assert(t, err != nil)
+	assert.Equal(t, s.Failures, uint(2))
+	assert.Equal(t, s.NextSync.Sub(s.StartedAt), 30 * time.Minute)
+
+	// scheduled job skips Account until retry is due
+	model.StartJobScheduler()
+	requests := srv.RequestCount()
+	runs := getJob("sync_ofx").Runs
+	err = model.RunJob(defaultSession, "sync_ofx")
+	assert.NilError(t, err)
+	j := getJob("sync_ofx")
+	for i := 0; i < 100 && (j.Runs == runs || j.Running); i++ {
+		time.Sleep(50 * time.Millisecond)
+		j = getJob("sync_ofx")
+	}
+	assert.Equal(t, j.Runs, runs + 1)
+	assert.Equal(t, j.LastError, "")
+	assert.Equal(t, srv.RequestCount(), requests)
+
+	s, err = a.SyncOFX(defaultSession)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Failures, uint(0))
+	assert.Equal(t, s.CashFlowCount, uint(2))
+	assert.Equal(t, s.NextSync.Sub(s.StartedAt), 24 * time.Hour)
+	assert.Equal(t, len(model.ListOfxSyncFailures(defaultSession)), 0)
+	a = model.GetAccountByName(defaultSession, "Gopher Linked Checking")
+	assert.Assert(t, a.Balance.Equal(decimal.RequireFromString("1146.98")))
+
+	// next sync downloads only new transactions
+	srv.AddTransaction(ofxserver.Transaction{FITID: "S3", Date: date.AddDate(0, 0, 6),
+				Amount: decimal.RequireFromString("-12.07"),
+				Name: "Gopher Cafe"})
+	s, err = a.SyncOFX(defaultSession)
+	assert.NilError(t, err)
+	assert.Equal(t, s.CashFlowCount, uint(1))
+	syncs := a.ListOfxSyncs(defaultSession, 10)
+	assert.Equal(t, len(syncs), 4)
+	assert.Equal(t, syncs[0].ID, s.ID)
+
+	err = cr.Delete(defaultSession)
+	assert.NilError(t, err)
+}
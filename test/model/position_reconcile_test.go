@@ -0,0 +1,104 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"github.com/shopspring/decimal"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"gotest.tools/v3/assert"
+)
+
+const marmotCUSIP = "999999202"
+
+// investment statement with Buy of 10 shares of Marmot Mining, and the
+// broker's position of 12 shares and available cash
+func makePositionsOFX(date time.Time, cash decimal.Decimal) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="203" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX><SIGNONMSGSRSV1><SONRS><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+<DTSERVER>20260101120000</DTSERVER><LANGUAGE>ENG</LANGUAGE></SONRS></SIGNONMSGSRSV1>
+<INVSTMTMSGSRSV1><INVSTMTTRNRS><TRNUID>1</TRNUID><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+<INVSTMTRS>`)
+	fmt.Fprintf(&b, "<DTASOF>%s</DTASOF><CURDEF>USD</CURDEF>\n", date.Format("20060102"))
+	b.WriteString(`<INVACCTFROM><BROKERID>example.com</BROKERID><ACCTID>789</ACCTID></INVACCTFROM>
+<INVTRANLIST><DTSTART>20260101</DTSTART><DTEND>20260101</DTEND>
+`)
+	fmt.Fprintf(&b, "<BUYSTOCK><INVBUY>%s%s<UNITS>10</UNITS><UNITPRICE>10</UNITPRICE>" +
+			"<TOTAL>-100.00</TOTAL><SUBACCTSEC>CASH</SUBACCTSEC>" +
+			"<SUBACCTFUND>CASH</SUBACCTFUND></INVBUY><BUYTYPE>BUY</BUYTYPE></BUYSTOCK>\n",
+		    ofxInvTran("P1", date.AddDate(0, 0, -5)), ofxSecID(marmotCUSIP))
+	b.WriteString("</INVTRANLIST><INVPOSLIST>")
+	fmt.Fprintf(&b, "<POSSTOCK><INVPOS>%s<HELDINACCT>CASH</HELDINACCT><POSTYPE>LONG</POSTYPE>" +
+			"<UNITS>12</UNITS><UNITPRICE>11</UNITPRICE><MKTVAL>132</MKTVAL>" +
+			"<DTPRICEASOF>%s</DTPRICEASOF></INVPOS></POSSTOCK>\n",
+		    ofxSecID(marmotCUSIP), date.Format("20060102"))
+	fmt.Fprintf(&b, "</INVPOSLIST><INVBAL><AVAILCASH>%s</AVAILCASH>" +
+			"<MARGINBALANCE>0</MARGINBALANCE><SHORTBALANCE>0</SHORTBALANCE></INVBAL>\n",
+		    cash.StringFixed(2))
+	b.WriteString(`</INVSTMTRS></INVSTMTTRNRS></INVSTMTMSGSRSV1>
+<SECLISTMSGSRSV1><SECLIST><STOCKINFO><SECINFO>`)
+	b.WriteString(ofxSecID(marmotCUSIP))
+	b.WriteString(`<SECNAME>Marmot Mining</SECNAME><TICKER>MRMT</TICKER></SECINFO></STOCKINFO>
+</SECLIST></SECLISTMSGSRSV1></OFX>
+`)
+	return b.String()
+}
+
+func TestPositionReconcile(t *testing.T) {
+	a := model.GetAccountByName(defaultSession, "Gopher Investments")
+	assert.Assert(t, a != nil)
+	_, err := a.GetPositionReport(defaultSession)
+	assert.Assert(t, err != nil)
+
+	cash := a.CashBalance.Sub(decimal.NewFromInt32(100))
+	ofx := makePositionsOFX(time.Now().AddDate(0, 0, -1), cash)
+	im := &model.Import{AccountID: a.ID}
+	err = im.ImportFile(defaultSession, openHttpFile(t, "positions.ofx", ofx))
+	assert.NilError(t, err)
+
+	a = model.GetAccountByName(defaultSession, "Gopher Investments")
+	r, err := a.GetPositionReport(defaultSession)
+	assert.NilError(t, err)
+	assert.Equal(t, len(r.Positions), 1)
+	p := &r.Positions[0]
+	assert.Equal(t, p.Name, "Marmot Mining")
+	assert.Assert(t, p.SecurityID > 0)
+	assert.Assert(t, p.Shares.Equal(decimal.NewFromInt32(12)))
+	assert.Assert(t, p.ComputedShares.Equal(decimal.NewFromInt32(10)))
+	assert.Assert(t, p.Difference().Equal(decimal.NewFromInt32(2)))
+	assert.Assert(t, r.HasBrokerCashBalance())
+	assert.Assert(t, r.CashDifference().IsZero())
+	assert.Assert(t, !r.IsBalanced())
+
+	// adjust with SharesIn of 2, cannot adjust again
+	err = r.Adjust(defaultSession, p.SecurityID)
+	assert.NilError(t, err)
+	r, err = a.GetPositionReport(defaultSession)
+	assert.NilError(t, err)
+	assert.Assert(t, r.Positions[0].ComputedShares.Equal(decimal.NewFromInt32(12)))
+	assert.Assert(t, r.IsBalanced())
+	err = r.Adjust(defaultSession, r.Positions[0].SecurityID)
+	assert.Assert(t, err != nil)
+	s, _ := a.GetSecurityBySymbol(defaultSession, "MRMT")
+	assert.Assert(t, s.Shares.Equal(decimal.NewFromInt32(12)))
+
+	// Trades after date of positions are not compared
+	tr := new(model.Trade)
+	tr.AccountID = a.ID
+	makeTrade(tr, "MRMT", 0, 15, 5)
+	assert.NilError(t, tr.Create(defaultSession))
+	r, err = a.GetPositionReport(defaultSession)
+	assert.NilError(t, err)
+	assert.Assert(t, r.Positions[0].ComputedShares.Equal(decimal.NewFromInt32(12)))
+	assert.Assert(t, r.IsBalanced())
+	assert.NilError(t, tr.Delete(defaultSession))
+}
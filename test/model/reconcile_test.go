@@ -0,0 +1,79 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+	"github.com/shopspring/decimal"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"gotest.tools/v3/assert"
+)
+
+func makeCashFlow(a *model.Account, payee string, amount int32) *model.CashFlow {
+	c := new(model.CashFlow)
+	c.AccountID = a.ID
+	c.Date = time.Now().AddDate(0, 0, -1)
+	c.PayeeName = payee
+	c.CashFlowTypeID = model.Debit
+	c.Amount = decimal.NewFromInt32(amount)
+	return c
+}
+
+func TestReconcileAccount(t *testing.T) {
+	a := model.GetAccountByName(defaultSession, "Gopher Credit")
+	assert.Assert(t, a != nil)
+
+	c1 := makeCashFlow(a, "Gopher Grocery", 20)
+	err := c1.Create(defaultSession)
+	assert.NilError(t, err)
+	c2 := makeCashFlow(a, "Gopher Gas", 30)
+	err = c2.Create(defaultSession)
+	assert.NilError(t, err)
+
+	r, err := a.GetReconcile(defaultSession)
+	assert.NilError(t, err)
+	assert.Assert(t, r.ID == 0)
+	r.StatementDate = time.Now()
+	r.StatementBalance = decimal.NewFromInt32(-20)
+	err = r.Update()
+	assert.NilError(t, err)
+	assert.Assert(t, r.ID > 0)
+	assert.Equal(t, len(a.ListUnreconciled(defaultSession, &r.StatementDate)), 2)
+
+	// cannot Finish until cleared CashFlows match statement
+	err = r.Finish()
+	assert.Assert(t, err != nil)
+
+	request := map[string]interface{}{"cleared": strconv.FormatBool(true)}
+	err = c1.Put(defaultSession, request)
+	assert.NilError(t, err)
+
+	r, err = a.GetReconcile(defaultSession)
+	assert.NilError(t, err)
+	assert.Assert(t, r.IsBalanced())
+	err = r.Finish()
+	assert.NilError(t, err)
+	assert.Equal(t, len(a.ListUnreconciled(defaultSession, &r.StatementDate)), 1)
+
+	// reconciled CashFlows are locked
+	locked := new(model.CashFlow)
+	locked.ID = c1.ID
+	err = locked.Delete(defaultSession)
+	assert.Assert(t, err != nil)
+	err = locked.Put(defaultSession, map[string]interface{}{"cleared": "false"})
+	assert.Error(t, err, "CashFlow Reconciled")
+	err = locked.Put(defaultSession, map[string]interface{}{"tags": "gopher-reconciled"})
+	assert.NilError(t, err)
+
+	// Put only changes cleared, amount and Tags
+	err = locked.Put(defaultSession, map[string]interface{}{"reconciled": "false"})
+	assert.Error(t, err, "Invalid Request")
+	err = c2.Put(defaultSession, map[string]interface{}{"memo": "Gopher"})
+	assert.Error(t, err, "Invalid Request")
+}
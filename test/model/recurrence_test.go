@@ -0,0 +1,94 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"testing"
+	"time"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"gotest.tools/v3/assert"
+)
+
+func secondTuesday(dx time.Time) time.Time {
+	day := time.Date(dx.Year(), dx.Month(), 1, 0, 0, 0, 0, time.Local)
+	for day.Weekday() != time.Tuesday {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day.AddDate(0, 0, 7)
+}
+
+func isWeekend(dx time.Time) bool {
+	return dx.Weekday() == time.Saturday || dx.Weekday() == time.Sunday
+}
+
+func getCashFlow(id uint) *model.CashFlow {
+	c := new(model.CashFlow)
+	c.ID = id
+	return c.Get(defaultSession, false)
+}
+
+func TestRecurrenceRule(t *testing.T) {
+	a := makeAccount(t, "Gopher Club Savings", model.AccountTypeDeposit)
+
+	c := makeScheduled(a, "Gopher Club", 25, 1, repeatMonthly)
+	c.RepeatInterval.Rule = "FREQ=MONTHLY;BYDAY=TU;BYSETPOS=2"
+	err := c.Create(defaultSession)
+	assert.NilError(t, err)
+
+	// Date moved to first 2nd Tuesday
+	tomorrow := time.Now().AddDate(0, 0, 1)
+	expected := secondTuesday(tomorrow)
+	if expected.Format("2006-01-02") < tomorrow.Format("2006-01-02") {
+		expected = secondTuesday(expected.AddDate(0, 1, 0))
+	}
+	assert.Equal(t, c.Date.Format("2006-01-02"), expected.Format("2006-01-02"))
+
+	// Enter Now posts and advances to following month's 2nd Tuesday
+	err = c.Put(defaultSession, map[string]interface{}{"apply": "1"})
+	assert.NilError(t, err)
+	c = getCashFlow(c.ID)
+	assert.Assert(t, c != nil)
+	expected = secondTuesday(time.Date(expected.Year(), expected.Month() + 1, 1,
+					   0, 0, 0, 0, time.Local))
+	assert.Equal(t, c.Date.Format("2006-01-02"), expected.Format("2006-01-02"))
+
+	// every other Monday and Friday, COUNT used for Repeats
+	c = makeScheduled(a, "Gopher Gym", 15, 1, repeatMonthly)
+	c.RepeatInterval.Rule = "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR;COUNT=3"
+	err = c.Create(defaultSession)
+	assert.NilError(t, err)
+	assert.Equal(t, c.RepeatInterval.GetRepeatsLeft(), "3")
+
+	dates := []time.Time{}
+	for _, f := range model.Forecast(defaultSession, 3) {
+		for _, fc := range f.CashFlows {
+			if fc.RepeatID == c.ID {
+				dates = append(dates, fc.Date)
+			}
+		}
+	}
+	assert.Equal(t, len(dates), 3)
+	for i := 0; i < len(dates); i++ {
+		weekday := dates[i].Weekday()
+		assert.Assert(t, weekday == time.Monday || weekday == time.Friday)
+	}
+	assert.Assert(t, dates[2].Sub(dates[0]).Hours() > 24 * 10)
+
+	// Christmas is moved to next business day
+	c = makeScheduled(a, "Gopher Gifts", 100, 1, repeatMonthly)
+	c.RepeatInterval.Rule = "FREQ=YEARLY;BYMONTH=12;BYMONTHDAY=25"
+	c.RepeatInterval.Adjust = model.AdjustNext
+	err = c.Create(defaultSession)
+	assert.NilError(t, err)
+	assert.Equal(t, c.Date.Month(), time.December)
+	assert.Assert(t, c.Date.Day() > 25 && !isWeekend(c.Date))
+
+	c = makeScheduled(a, "Gopher Error", 100, 1, repeatMonthly)
+	c.RepeatInterval.Rule = "FREQ=HOURLY"
+	err = c.Create(defaultSession)
+	assert.Assert(t, err != nil)
+}
@@ -0,0 +1,99 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"testing"
+	"time"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"gotest.tools/v3/assert"
+)
+
+func TestSearch(t *testing.T) {
+	a := model.GetAccountByName(defaultSession, "Gopher Checking")
+	assert.Assert(t, a != nil)
+	c1 := makeCashFlow(a, "Gopher Hardware 100%", 45)
+	c1.Memo = "garden hose"
+	c1.Transnum = "1234"
+	err := c1.Create(defaultSession)
+	assert.NilError(t, err)
+	c2 := makeCashFlow(a, "Gopher Hardware Outlet", 250)
+	c2.CashFlowTypeID = model.Credit
+	err = c2.Create(defaultSession)
+	assert.NilError(t, err)
+
+	s := new(model.Search)
+	s.PayeeName = "gopher hardware"
+	result, err := s.Run(defaultSession)
+	assert.NilError(t, err)
+	assert.Equal(t, result.Count(), 2)
+	assert.Equal(t, result.Credits.String(), "250")
+	assert.Equal(t, result.Debits.String(), "-45")
+	assert.Equal(t, result.Total().String(), "205")
+
+	// % is not a wildcard
+	s.PayeeName = "100%"
+	result, _ = s.Run(defaultSession)
+	assert.Equal(t, result.Count(), 1)
+	s.PayeeName = "Hardware"
+	s.Memo = "HOSE"
+	result, _ = s.Run(defaultSession)
+	assert.Equal(t, result.Count(), 1)
+	assert.Equal(t, result.CashFlows[0].ID, c1.ID)
+
+	s.Memo = ""
+	s.SetMinAmount("$100")
+	s.SetMaxAmount("1,000")
+	result, _ = s.Run(defaultSession)
+	assert.Equal(t, result.Count(), 1)
+	assert.Equal(t, result.CashFlows[0].ID, c2.ID)
+	s.SetMinAmount("")
+	s.SetMaxAmount("")
+
+	s.Transnum = "1234"
+	s.SetStartDate(time.Now().AddDate(0, 0, -1).Format("2006-01-02"))
+	s.SetEndDate(time.Now().Format("2006-01-02"))
+	result, _ = s.Run(defaultSession)
+	assert.Equal(t, result.Count(), 1)
+	s.SetStartDate(time.Now().Format("2006-01-02"))
+	result, _ = s.Run(defaultSession)
+	assert.Equal(t, result.Count(), 0)
+
+	s.Transnum = ""
+	s.SetStartDate("")
+	s.Imported = model.SearchOnly
+	result, _ = s.Run(defaultSession)
+	assert.Equal(t, result.Count(), 0)
+	s.Imported = model.SearchExclude
+	s.Transfer = model.SearchExclude
+	s.AccountID = a.ID
+	result, _ = s.Run(defaultSession)
+	assert.Equal(t, result.Count(), 2)
+
+	// saved Searches need a Name
+	err = s.Save(defaultSession)
+	assert.Assert(t, err != nil)
+	s.Name = "Gopher Hardware"
+	err = s.Save(defaultSession)
+	assert.NilError(t, err)
+	assert.Assert(t, s.ID > 0)
+
+	saved := new(model.Search)
+	saved.ID = s.ID
+	saved = saved.Get(defaultSession)
+	assert.Assert(t, saved != nil)
+	assert.Equal(t, saved.GetStartDate(), "")
+	assert.Equal(t, saved.GetEndDate(), time.Now().Format("2006-01-02"))
+	assert.Equal(t, saved.GetMinAmount(), "")
+	result, _ = saved.Run(defaultSession)
+	assert.Equal(t, result.Count(), 2)
+	assert.Equal(t, len(saved.List(defaultSession)), 1)
+
+	err = saved.Delete(defaultSession)
+	assert.NilError(t, err)
+	assert.Equal(t, len(saved.List(defaultSession)), 0)
+}
@@ -0,0 +1,96 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"testing"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"gotest.tools/v3/assert"
+)
+
+func getTagTotal(name string) *model.TagTotal {
+	entries := model.TagTotals(defaultSession)
+	for i := 0; i < len(entries); i++ {
+		if entries[i].Tag.Name == name {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+func getTaggedCashFlow(id uint) *model.CashFlow {
+	c := new(model.CashFlow)
+	c.ID = id
+	return c.Get(defaultSession, true)
+}
+
+func TestTags(t *testing.T) {
+	a := model.GetAccountByName(defaultSession, "Gopher Checking")
+	assert.Assert(t, a != nil)
+	c1 := makeCashFlow(a, "Gopher Airlines", 400)
+	c1.SetTags("Vacation-2026, reimbursable, vacation-2026,")
+	err := c1.Create(defaultSession)
+	assert.NilError(t, err)
+	c2 := makeCashFlow(a, "Gopher Hotel", 300)
+	c2.SetTags("Vacation-2026")
+	err = c2.Create(defaultSession)
+	assert.NilError(t, err)
+
+	// Tags are ordered by name, and matched ignoring case
+	c := getTaggedCashFlow(c1.ID)
+	assert.Equal(t, c.GetTags(), "reimbursable, Vacation-2026")
+	tt := getTagTotal("Vacation-2026")
+	assert.Assert(t, tt != nil)
+	assert.Equal(t, tt.CashFlows, 2)
+	assert.Equal(t, tt.Debits.String(), "-700")
+	assert.Equal(t, tt.Total().String(), "-700")
+
+	// Splits have Tags of parent
+	split, _ := model.NewSplitCashFlow(defaultSession, c2.ID)
+	assert.Assert(t, split != nil)
+	split.CashFlowTypeID = model.Debit
+	split.Amount = c2.Amount
+	err = split.Create(defaultSession)
+	assert.NilError(t, err)
+	s := model.Search{TagID: tt.Tag.ID}
+	result, err := s.Run(defaultSession)
+	assert.NilError(t, err)
+	assert.Equal(t, result.Count(), 2)
+
+	tag := new(model.Tag)
+	tag.ID = tt.Tag.ID
+	tag = tag.Get(defaultSession)
+	assert.Assert(t, tag != nil)
+	entries := a.ListTagged(defaultSession, tag)
+	assert.Equal(t, len(entries), 2)
+
+	// change Tags with Put
+	c = getCashFlow(c1.ID)
+	request := map[string]interface{}{"tags": "reimbursable"}
+	err = c.Put(defaultSession, request)
+	assert.NilError(t, err)
+	c = getTaggedCashFlow(c1.ID)
+	assert.Equal(t, c.GetTags(), "reimbursable")
+	tt = getTagTotal("Vacation-2026")
+	assert.Equal(t, tt.CashFlows, 1)
+
+	// rename to existing Tag fails
+	tag.Name = "Reimbursable"
+	err = tag.Update()
+	assert.Assert(t, err != nil)
+	tag.Name = "Vacation"
+	err = tag.Update()
+	assert.NilError(t, err)
+	assert.Assert(t, getTagTotal("Vacation") != nil)
+
+	err = tag.Delete(defaultSession)
+	assert.NilError(t, err)
+	assert.Assert(t, getTagTotal("Vacation") == nil)
+	s = model.Search{TagID: tag.ID}
+	result, _ = s.Run(defaultSession)
+	assert.Equal(t, result.Count(), 0)
+}
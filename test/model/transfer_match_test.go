@@ -0,0 +1,109 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"testing"
+	"time"
+	"github.com/shopspring/decimal"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"gotest.tools/v3/assert"
+)
+
+func makeCredit(a *model.Account, payee string, amount string, date time.Time) *model.CashFlow {
+	c := new(model.CashFlow)
+	c.AccountID = a.ID
+	c.Date = date
+	c.PayeeName = payee
+	c.CashFlowTypeID = model.Credit
+	c.Amount = decimal.RequireFromString(amount)
+	return c
+}
+
+func findTransferMatch(cashflowID uint) *model.TransferMatch {
+	matches := new(model.TransferMatch).List(defaultSession)
+	for i := 0; i < len(matches); i++ {
+		if matches[i].CashFlowID == cashflowID {
+			return &matches[i]
+		}
+	}
+	return nil
+}
+
+func TestTransferMatch(t *testing.T) {
+	a := model.GetAccountByName(defaultSession, "Gopher Checking")
+	assert.Assert(t, a != nil)
+	credit := model.GetAccountByName(defaultSession, "Gopher Credit")
+	assert.Assert(t, credit != nil)
+	savings := model.GetAccountByName(defaultSession, "Gopher Savings")
+	assert.Assert(t, savings != nil)
+
+	date := time.Now().AddDate(0, 0, -6)
+	payment := makeCredit(credit, "Payment Thank You", "61.23", date)
+	assert.NilError(t, payment.Create(defaultSession))
+	paymentPayeeID := getCashFlow(payment.ID).PayeeID
+	refund := makeCredit(savings, "Refund", "33.33", date.AddDate(0, 0, 3))
+	assert.NilError(t, refund.Create(defaultSession))
+	deposit := makeCredit(savings, "Deposit", "44.44", date.AddDate(0, 0, 4))
+	assert.NilError(t, deposit.Create(defaultSession))
+
+	ofx := makeStatementOFX([]ofxTransaction{
+		{FiTID: "T1", Date: date, Amount: "-61.23", Name: "CARD AUTOPAY", Memo: ""},
+		{FiTID: "T2", Date: date, Amount: "-33.33", Name: "FERRET GOODS", Memo: ""},
+		{FiTID: "T3", Date: date, Amount: "-44.44", Name: "STOAT OUTLET", Memo: ""}})
+	im := importOFX(t, a, ofx)
+	assert.Assert(t, im != nil)
+	entries := im.ListImported(defaultSession)
+	assert.Equal(t, len(entries), 3)
+
+	// high confidence is linked
+	c := getCashFlow(entries[0].ID)
+	assert.Assert(t, c.Transfer)
+	assert.Equal(t, c.PayeeID, credit.ID)
+	payment = getCashFlow(payment.ID)
+	assert.Assert(t, payment.Transfer)
+	assert.Equal(t, payment.PayeeID, a.ID)
+	assert.Equal(t, payment.PairID, c.ID)
+
+	// others are proposed
+	m1 := findTransferMatch(entries[1].ID)
+	assert.Assert(t, m1 != nil)
+	assert.Equal(t, m1.PairID, refund.ID)
+	assert.Assert(t, m1.Score < 80)
+	m2 := findTransferMatch(entries[2].ID)
+	assert.Assert(t, m2 != nil)
+
+	err := m1.Dismiss(defaultSession)
+	assert.NilError(t, err)
+	assert.Assert(t, findTransferMatch(entries[1].ID) == nil)
+	// dismissed are not proposed again
+	model.MatchTransfers(defaultSession)
+	assert.Assert(t, findTransferMatch(entries[1].ID) == nil)
+	assert.Assert(t, !getCashFlow(refund.ID).Transfer)
+
+	err = m2.Accept(defaultSession)
+	assert.NilError(t, err)
+	assert.Assert(t, findTransferMatch(entries[2].ID) == nil)
+	deposit = getCashFlow(deposit.ID)
+	assert.Assert(t, deposit.Transfer)
+	assert.Equal(t, deposit.PairID, entries[2].ID)
+
+	// undo of Import unlinks Transfers, keeping the other CashFlows
+	// (even if Reconciled)
+	defaultSession.DB.Model(&model.CashFlow{}).Where("id = ?", payment.ID).
+			  Update("reconciled", true)
+	creditBalance := model.GetAccountByName(defaultSession, "Gopher Credit").Balance
+	err = im.Undo(defaultSession)
+	assert.NilError(t, err)
+	payment = getCashFlow(payment.ID)
+	assert.Assert(t, payment.ID > 0 && !payment.Transfer && payment.Reconciled)
+	assert.Equal(t, payment.PayeeID, paymentPayeeID)
+	deposit = getCashFlow(deposit.ID)
+	assert.Assert(t, deposit.ID > 0 && !deposit.Transfer)
+	credit = model.GetAccountByName(defaultSession, "Gopher Credit")
+	assert.Assert(t, credit.Balance.Equal(creditBalance))
+}
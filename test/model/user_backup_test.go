@@ -0,0 +1,198 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+package model_test
+
+import (
+	"bytes"
+	"testing"
+	"github.com/shopspring/decimal"
+	"github.com/pacificbrian/go-bookkeeper/model"
+	"gotest.tools/v3/assert"
+)
+
+// all CashFlows of User's Accounts, as stored (no postQueryInit)
+func listUserCashFlows(session *model.Session) []model.CashFlow {
+	entries := []model.CashFlow{}
+	accountIDs := session.DB.Model(&model.Account{}).Select("id").
+				 Where("user_id = ?", session.GetUser().ID)
+	session.DB.Where("account_id IN (?)", accountIDs).Order("id").
+		   Find(&entries)
+	return entries
+}
+
+// count RepeatIntervals of User's CashFlows with RepeatsLeft NULL and 0
+func countRepeatsLeft(session *model.Session) (int64, int64) {
+	var unlimited, none int64
+	cashFlowIDs := session.DB.Model(&model.CashFlow{}).Select("id").
+			Where("account_id IN (?)",
+			      session.DB.Model(&model.Account{}).Select("id").
+					 Where("user_id = ?", session.GetUser().ID))
+	session.DB.Model(&model.RepeatInterval{}).Where("cash_flow_id IN (?)", cashFlowIDs).
+		   Where("repeats_left IS NULL").Count(&unlimited)
+	session.DB.Model(&model.RepeatInterval{}).Where("cash_flow_id IN (?)", cashFlowIDs).
+		   Where("repeats_left = 0").Count(&none)
+	return unlimited, none
+}
+
+func restoreNewUser(t *testing.T, login string, data []byte) (*model.Session, error) {
+	u := new(model.User)
+	u.Login = login
+	err := u.Create([2]string{"", ""})
+	assert.NilError(t, err)
+	session := u.NewSession()
+
+	file := openHttpFile(t, "backup", string(data))
+	return session, new(model.Backup).Restore(session, file)
+}
+
+func TestUserBackup(t *testing.T) {
+	a := model.GetAccountByName(defaultSession, "Gopher Checking")
+	assert.Assert(t, a != nil)
+
+	// Split, Transfer and applied Scheduled CashFlows
+	c := makeCashFlow(a, "Gopher Grocery", 50)
+	c.SetTags("gopher-backup")
+	err := c.Create(defaultSession)
+	assert.NilError(t, err)
+	split, _ := model.NewSplitCashFlow(defaultSession, c.ID)
+	assert.Assert(t, split != nil)
+	split.CashFlowTypeID = model.Debit
+	split.Amount = decimal.NewFromInt32(50)
+	split.CategoryID = model.CategoryGetByName("Business").ID
+	err = split.Create(defaultSession)
+	assert.NilError(t, err)
+	transfer := makeCashFlow(a, "Gopher Savings", 30)
+	transfer.CashFlowTypeID = model.DebitTransfer
+	err = transfer.Create(defaultSession)
+	assert.NilError(t, err)
+	bill := makeScheduled(a, "Gopher Water", 40, 1, repeatMonthly)
+	err = bill.Create(defaultSession)
+	assert.NilError(t, err)
+	err = bill.Put(defaultSession, map[string]interface{}{"apply": "1"})
+	assert.NilError(t, err)
+	// finished Scheduled CashFlow has RepeatsLeft of 0, not NULL
+	done := makeScheduled(a, "Gopher Lease", 70, 1, repeatMonthly)
+	err = done.Create(defaultSession)
+	assert.NilError(t, err)
+	defaultSession.DB.Model(&model.RepeatInterval{}).Where("cash_flow_id = ?", done.ID).
+			  Update("repeats_left", 0)
+	unlimited, none := countRepeatsLeft(defaultSession)
+	assert.Assert(t, unlimited > 0 && none > 0)
+
+	rule := &model.ImportRule{Name: "Backup", PayeePattern: "gopher grocery",
+				  PayeeName: "Gopher Grocery"}
+	err = rule.Save(defaultSession)
+	assert.NilError(t, err)
+	s := new(model.Search)
+	s.Name = "Gopher Backup"
+	s.PayeeName = "grocery"
+	err = s.Save(defaultSession)
+	assert.NilError(t, err)
+
+	var b bytes.Buffer
+	err = new(model.Backup).Write(defaultSession, &b, "xml")
+	assert.ErrorContains(t, err, "Invalid Backup Format")
+	err = new(model.Backup).Write(defaultSession, &b, model.BackupJSON)
+	assert.NilError(t, err)
+
+	session, err := restoreNewUser(t, "gopher_restore", b.Bytes())
+	assert.NilError(t, err)
+	assert.Equal(t, len(model.List(session, true)),
+			len(model.List(defaultSession, true)))
+	restoredUnlimited, restoredNone := countRepeatsLeft(session)
+	assert.Equal(t, restoredUnlimited, unlimited)
+	assert.Equal(t, restoredNone, none)
+	assert.Equal(t, len(new(model.Tag).List(session)),
+			len(new(model.Tag).List(defaultSession)))
+	assert.Equal(t, len(new(model.ImportRule).List(session)),
+			len(new(model.ImportRule).List(defaultSession)))
+	assert.Equal(t, len(new(model.Search).List(session)),
+			len(new(model.Search).List(defaultSession)))
+
+	// compare by position, as both ordered by ID
+	original := listUserCashFlows(defaultSession)
+	restored := listUserCashFlows(session)
+	assert.Equal(t, len(restored), len(original))
+	oldIndex := map[uint]int{}
+	newIndex := map[uint]int{}
+	for i := 0; i < len(original); i++ {
+		oldIndex[original[i].ID] = i
+		newIndex[restored[i].ID] = i
+	}
+	transfers, splits, applied := 0, 0, 0
+	for i := 0; i < len(original); i++ {
+		oc := &original[i]
+		rc := &restored[i]
+		assert.Assert(t, rc.Amount.Equal(oc.Amount))
+		assert.Equal(t, rc.Type, oc.Type)
+		if oc.Transfer {
+			// CategoryID is Pair.ID
+			assert.Equal(t, newIndex[rc.CategoryID], oldIndex[oc.CategoryID])
+			transfers += 1
+		}
+		if oc.Split || oc.Transfer {
+			assert.Equal(t, newIndex[rc.SplitFrom], oldIndex[oc.SplitFrom])
+			if oc.Split {
+				splits += 1
+			}
+		} else {
+			assert.Equal(t, rc.SplitFrom, oc.SplitFrom)
+		}
+		if !oc.IsScheduled() && oc.RepeatIntervalID > 0 {
+			// RepeatIntervalID is origin ScheduledCashFlow.ID
+			assert.Equal(t, newIndex[rc.RepeatIntervalID],
+					oldIndex[oc.RepeatIntervalID])
+			applied += 1
+		} else if oc.IsScheduled() && !oc.Split {
+			ri := new(model.RepeatInterval)
+			session.DB.First(ri, rc.RepeatIntervalID)
+			assert.Equal(t, ri.CashFlowID, rc.ID)
+		}
+	}
+	assert.Assert(t, transfers >= 2)
+	assert.Assert(t, splits >= 1)
+	assert.Assert(t, applied >= 1)
+
+	// restored Transfer Payee is restored Account
+	rc := &restored[oldIndex[transfer.ID]]
+	pair := new(model.Account)
+	session.DB.First(pair, rc.PayeeID)
+	assert.Equal(t, pair.UserID, session.GetUser().ID)
+	assert.Equal(t, pair.Name, "Gopher Savings")
+
+	// restored Tags of CashFlow
+	rc = &restored[oldIndex[c.ID]]
+	tagged := new(model.CashFlow)
+	tagged.ID = rc.ID
+	tagged = tagged.Get(session, true)
+	assert.Assert(t, tagged != nil)
+	assert.Equal(t, tagged.GetTags(), "gopher-backup")
+
+	// Trades and Securities of restored investment Account
+	ia := model.GetAccountByName(defaultSession, "Gopher Investments")
+	ra := model.GetAccountByName(session, "Gopher Investments")
+	assert.Assert(t, ia != nil && ra != nil)
+	var numTrades, numRestored int64
+	session.DB.Model(&model.Trade{}).Where("account_id = ?", ia.ID).Count(&numTrades)
+	session.DB.Model(&model.Trade{}).Where("account_id = ?", ra.ID).Count(&numRestored)
+	assert.Assert(t, numTrades > 0)
+	assert.Equal(t, numRestored, numTrades)
+
+	// Restore only allowed without Accounts
+	file := openHttpFile(t, "backup", b.String())
+	err = new(model.Backup).Restore(session, file)
+	assert.ErrorContains(t, err, "Without Accounts")
+
+	// ZIP archive
+	b.Reset()
+	err = new(model.Backup).Write(defaultSession, &b, model.BackupZIP)
+	assert.NilError(t, err)
+	assert.Equal(t, b.String()[0:2], "PK")
+	session, err = restoreNewUser(t, "gopher_restore_zip", b.Bytes())
+	assert.NilError(t, err)
+	assert.Equal(t, len(listUserCashFlows(session)), len(original))
+}
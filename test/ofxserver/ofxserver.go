@@ -0,0 +1,228 @@
+/*
+ * SPDX-FileCopyrightText: 2024 Brian Welty
+ *
+ * SPDX-License-Identifier: MPL-2.0
+ */
+
+// Package ofxserver is a local stand-in for an Institution's OFX Direct
+// Connect server, for testing downloads without a real bank. It answers
+// account information and bank or credit card statement requests for a
+// single user and account. OFX clients only connect with https, so the
+// server uses a self-signed certificate trusted by Client().
+package ofxserver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"github.com/shopspring/decimal"
+)
+
+const ofxDateFormat string = "20060102"
+const ofxTimeFormat string = "20060102150405"
+
+type Transaction struct {
+	FITID string
+	Date time.Time
+	Amount decimal.Decimal
+	Name string
+	Memo string
+}
+
+type Server struct {
+	*httptest.Server
+	Username string
+	Password string
+	AcctID string
+	CreditCard bool
+	Transactions []Transaction
+	Requests int
+	// respond to this many next requests with an HTTP error
+	failRequests int
+	mutex sync.Mutex
+}
+
+var ofxRequestField = regexp.MustCompile(`<(USERID|USERPASS|TRNUID|DTSTART)>([^<\r\n]*)`)
+
+// Start Server accepting username and password for account acctID
+func NewServer(username string, password string, acctID string) *Server {
+	s := &Server{Username: username, Password: password, AcctID: acctID}
+	s.Server = httptest.NewTLSServer(s)
+	return s
+}
+
+func (s *Server) AddTransaction(t Transaction) {
+	s.mutex.Lock()
+	s.Transactions = append(s.Transactions, t)
+	s.mutex.Unlock()
+}
+
+// Respond to the next count requests with an HTTP error
+func (s *Server) FailRequests(count int) {
+	s.mutex.Lock()
+	s.failRequests = count
+	s.mutex.Unlock()
+}
+
+func (s *Server) RequestCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.Requests
+}
+
+// first value of each field of OFX request
+func parseRequest(body string) map[string]string {
+	fields := map[string]string{}
+	for _, match := range ofxRequestField.FindAllStringSubmatch(body, -1) {
+		_, exists := fields[match[1]]
+		if !exists {
+			fields[match[1]] = strings.TrimSpace(match[2])
+		}
+	}
+	return fields
+}
+
+func writeStatus(b *strings.Builder, code int) {
+	severity := "INFO"
+	if code != 0 {
+		severity = "ERROR"
+	}
+	fmt.Fprintf(b, "<STATUS><CODE>%d</CODE><SEVERITY>%s</SEVERITY></STATUS>",
+		    code, severity)
+}
+
+func (s *Server) writeAcctFrom(b *strings.Builder) {
+	if s.CreditCard {
+		fmt.Fprintf(b, "<CCACCTFROM><ACCTID>%s</ACCTID></CCACCTFROM>", s.AcctID)
+	} else {
+		fmt.Fprintf(b, "<BANKACCTFROM><BANKID>123456789</BANKID><ACCTID>%s</ACCTID>" +
+			       "<ACCTTYPE>CHECKING</ACCTTYPE></BANKACCTFROM>", s.AcctID)
+	}
+}
+
+func (s *Server) writeAcctInfo(b *strings.Builder, trnUID string, now time.Time) {
+	fmt.Fprintf(b, "<SIGNUPMSGSRSV1><ACCTINFOTRNRS><TRNUID>%s</TRNUID>", trnUID)
+	writeStatus(b, 0)
+	fmt.Fprintf(b, "<ACCTINFORS><DTACCTUP>%s</DTACCTUP><ACCTINFO><DESC>Stand-in</DESC>",
+		    now.Format(ofxTimeFormat))
+	if s.CreditCard {
+		b.WriteString("<CCACCTINFO>")
+	} else {
+		b.WriteString("<BANKACCTINFO>")
+	}
+	s.writeAcctFrom(b)
+	b.WriteString("<SUPTXDL>Y</SUPTXDL><XFERSRC>N</XFERSRC><XFERDEST>N</XFERDEST>" +
+		      "<SVCSTATUS>ACTIVE</SVCSTATUS>")
+	if s.CreditCard {
+		b.WriteString("</CCACCTINFO>")
+	} else {
+		b.WriteString("</BANKACCTINFO>")
+	}
+	b.WriteString("</ACCTINFO></ACCTINFORS></ACCTINFOTRNRS></SIGNUPMSGSRSV1>\n")
+}
+
+// statement of Transactions posted on or after start
+func (s *Server) writeStatement(b *strings.Builder, trnUID string, start time.Time, now time.Time) {
+	balance := decimal.Zero
+	if s.CreditCard {
+		fmt.Fprintf(b, "<CREDITCARDMSGSRSV1><CCSTMTTRNRS><TRNUID>%s</TRNUID>", trnUID)
+		writeStatus(b, 0)
+		b.WriteString("<CCSTMTRS><CURDEF>USD</CURDEF>")
+	} else {
+		fmt.Fprintf(b, "<BANKMSGSRSV1><STMTTRNRS><TRNUID>%s</TRNUID>", trnUID)
+		writeStatus(b, 0)
+		b.WriteString("<STMTRS><CURDEF>USD</CURDEF>")
+	}
+	s.writeAcctFrom(b)
+
+	fmt.Fprintf(b, "<BANKTRANLIST><DTSTART>%s</DTSTART><DTEND>%s</DTEND>\n",
+		    start.Format(ofxDateFormat), now.Format(ofxTimeFormat))
+	for _, t := range s.Transactions {
+		balance = balance.Add(t.Amount)
+		if t.Date.Before(start) {
+			continue
+		}
+		trnType := "CREDIT"
+		if t.Amount.IsNegative() {
+			trnType = "DEBIT"
+		}
+		fmt.Fprintf(b, "<STMTTRN><TRNTYPE>%s</TRNTYPE><DTPOSTED>%s</DTPOSTED>" +
+			       "<TRNAMT>%s</TRNAMT><FITID>%s</FITID><NAME>%s</NAME>",
+			    trnType, t.Date.Format(ofxDateFormat), t.Amount.StringFixed(2),
+			    t.FITID, t.Name)
+		if t.Memo != "" {
+			fmt.Fprintf(b, "<MEMO>%s</MEMO>", t.Memo)
+		}
+		b.WriteString("</STMTTRN>\n")
+	}
+	fmt.Fprintf(b, "</BANKTRANLIST><LEDGERBAL><BALAMT>%s</BALAMT><DTASOF>%s</DTASOF></LEDGERBAL>",
+		    balance.StringFixed(2), now.Format(ofxTimeFormat))
+
+	if s.CreditCard {
+		b.WriteString("</CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1>\n")
+	} else {
+		b.WriteString("</STMTRS></STMTTRNRS></BANKMSGSRSV1>\n")
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Requests += 1
+
+	data, err := io.ReadAll(r.Body)
+	if r.Method != http.MethodPost || err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if s.failRequests > 0 {
+		s.failRequests -= 1
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	body := string(data)
+	fields := parseRequest(body)
+	now := time.Now()
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="203" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX><SIGNONMSGSRSV1><SONRS>`)
+	// 15500 is invalid signon
+	loggedIn := fields["USERID"] == s.Username && fields["USERPASS"] == s.Password
+	if loggedIn {
+		writeStatus(&b, 0)
+	} else {
+		writeStatus(&b, 15500)
+	}
+	fmt.Fprintf(&b, "<DTSERVER>%s</DTSERVER><LANGUAGE>ENG</LANGUAGE></SONRS></SIGNONMSGSRSV1>\n",
+		    now.Format(ofxTimeFormat))
+
+	if loggedIn {
+		if strings.Contains(body, "<ACCTINFORQ>") {
+			s.writeAcctInfo(&b, fields["TRNUID"], now)
+		} else if strings.Contains(body, "<STMTRQ>") ||
+			  strings.Contains(body, "<CCSTMTRQ>") {
+			start, _ := time.ParseInLocation(ofxDateFormat,
+							 firstDigits(fields["DTSTART"], 8),
+							 time.Local)
+			s.writeStatement(&b, fields["TRNUID"], start, now)
+		}
+	}
+	b.WriteString("</OFX>\n")
+
+	w.Header().Set("Content-Type", "application/x-ofx")
+	io.WriteString(w, b.String())
+}
+
+func firstDigits(value string, length int) string {
+	if len(value) < length {
+		return value
+	}
+	return value[:length]
+}